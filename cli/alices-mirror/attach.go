@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"alices-mirror/internal/app"
+	"alices-mirror/internal/proxy"
+)
+
+// detachKey followed by d detaches the owner terminal. Pressed twice, it
+// sends one detachKey to the shell.
+const detachKey = 0x1c // Ctrl+\
+
+// errDetached is returned when the owner detached from the shared shell.
+var errDetached = errors.New("detached from the shared shell")
+
+var attachSpecs = []flagSpec{
+	{Long: "help", Short: "h", ExpectsValue: false, IsBool: true},
+	{Long: "port", Short: "p", ExpectsValue: true, IsBool: false},
+	{Long: "session", Short: "", ExpectsValue: true, IsBool: false},
+}
+
+// shareState is what attach needs to reach a --share daemon. It holds the
+// owner token, so it is only readable by the user.
+type shareState struct {
+	OwnerURL      string `json:"ownerURL"`
+	ResumeURL     string `json:"resumeURL"`
+	Authorization string `json:"authorization,omitempty"`
+}
+
+// maxSessionName bounds --session names, which become file names.
+const maxSessionName = 32
+
+// shareTarget names a --share session for attach: by its --session name,
+// or by its port when it has none.
+type shareTarget struct {
+	port    int
+	session string
+}
+
+// String returns the attach option that selects t.
+func (t shareTarget) String() string {
+	if t.session != "" {
+		return "--session=" + t.session
+	}
+	return fmt.Sprintf("--port=%d", t.port)
+}
+
+// checkSessionName accepts names of letters, digits, - and _ that start
+// with a letter, so they cannot be mistaken for a port.
+func checkSessionName(name string) error {
+	if name == "" || len(name) > maxSessionName {
+		return fmt.Errorf("must be 1 to %d characters", maxSessionName)
+	}
+	for i, r := range name {
+		letter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if i == 0 && !letter {
+			return errors.New("must start with a letter")
+		}
+		if !letter && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return fmt.Errorf("invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+func shareStatePath(target shareTarget) (string, error) {
+	dir, err := app.StateDir()
+	if err != nil {
+		return "", err
+	}
+	if target.session != "" {
+		return filepath.Join(dir, "share-"+target.session+".json"), nil
+	}
+	return filepath.Join(dir, fmt.Sprintf("share-%d.json", target.port)), nil
+}
+
+func writeShareState(target shareTarget, state shareState) error {
+	path, err := shareStatePath(target)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+func readShareState(target shareTarget) (shareState, error) {
+	var state shareState
+	path, err := shareStatePath(target)
+	if err != nil {
+		return state, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if target.session != "" {
+			return state, fmt.Errorf("no shared shell named %q to attach to", target.session)
+		}
+		return state, fmt.Errorf("no shared shell to attach to on port %d", target.port)
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("invalid session file %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// removeShareState forgets target once its shell has exited.
+func removeShareState(target shareTarget) {
+	if path, err := shareStatePath(target); err == nil {
+		_ = os.Remove(path)
+	}
+}
+
+func printDetached(target shareTarget) {
+	fmt.Printf("\nDetached. The shared shell keeps running; run 'alices-mirror attach %s' to return.\n", target)
+}
+
+// runAttach attaches this terminal again to the shell shared by --share
+// after the owner detached from it.
+func runAttach(args []string) error {
+	canonical, positionals, err := normalizeArgsWith(attachSpecs, args)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("alices-mirror attach", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		help    bool
+		target  shareTarget
+		portSet bool
+	)
+	fs.BoolVar(&help, "help", false, "")
+	fs.IntVar(&target.port, "port", 3002, "")
+	fs.StringVar(&target.session, "session", "", "")
+	if err := fs.Parse(canonical); err != nil {
+		return err
+	}
+	if help {
+		printAttachHelp()
+		return nil
+	}
+	if len(positionals) > 0 {
+		return fmt.Errorf("unexpected argument %q", positionals[0])
+	}
+	fs.Visit(func(f *flag.Flag) {
+		portSet = portSet || f.Name == "port"
+	})
+	if target.session != "" {
+		if portSet {
+			return errors.New("--port cannot be used with --session")
+		}
+		if err := checkSessionName(target.session); err != nil {
+			return fmt.Errorf("invalid value %q for --session: %v", target.session, err)
+		}
+	}
+
+	state, err := readShareState(target)
+	if err != nil {
+		return err
+	}
+	proxyFunc, err := proxy.Func("")
+	if err != nil {
+		return err
+	}
+	fmt.Println("This terminal is now attached to the shared shell.")
+	fmt.Println("Press Ctrl+\\ then d to detach again.")
+	fmt.Println()
+	err = attachOwnerShell(state, proxyFunc, true)
+	if errors.Is(err, errDetached) {
+		printDetached(target)
+		return nil
+	}
+	if err == nil {
+		removeShareState(target)
+	}
+	return err
+}
+
+// detachKeys finds the detach keys in what the owner types.
+type detachKeys struct {
+	pending bool
+}
+
+// filter returns the input to send to the shell and whether the detach keys
+// were pressed; input after them is dropped.
+func (d *detachKeys) filter(in []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(in)+1)
+	for _, b := range in {
+		if d.pending {
+			d.pending = false
+			switch b {
+			case 'd':
+				return out, true
+			case detachKey:
+				out = append(out, detachKey)
+			default:
+				out = append(out, detachKey, b)
+			}
+			continue
+		}
+		if b == detachKey {
+			d.pending = true
+			continue
+		}
+		out = append(out, b)
+	}
+	return out, false
+}
+
+func printAttachHelp() {
+	fmt.Println("Attach options (alices-mirror attach [options]):")
+	fmt.Println("  -h, --help             Show help and exit.")
+	fmt.Println("  -p, --port=<port>      Port of the --share session to attach to (default 3002).")
+	fmt.Println("  --session=<name>       Name of the --share --session to attach to.")
+}
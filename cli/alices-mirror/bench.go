@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"alices-mirror/internal/bench"
+)
+
+const benchBytes = 64 << 20
+
+// runBench pushes synthetic output through the server to 1 client and then
+// to clients clients, printing throughput and allocations for each run.
+func runBench(clients int) error {
+	if clients < 1 {
+		return fmt.Errorf("invalid value %q for --bench-clients", fmt.Sprintf("%d", clients))
+	}
+
+	fmt.Printf("Benchmarking %d MB of synthetic output over loopback...\n", benchBytes>>20)
+	counts := []int{1}
+	if clients > 1 {
+		counts = append(counts, clients)
+	}
+	for _, n := range counts {
+		result, err := bench.Run(bench.Config{Clients: n, Bytes: benchBytes})
+		if err != nil {
+			return err
+		}
+		fmt.Println(result)
+	}
+	return nil
+}
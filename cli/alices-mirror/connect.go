@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+
+	"alices-mirror/internal/datagram"
+	"alices-mirror/internal/protocol"
+	"alices-mirror/internal/proxy"
+)
+
+const udpDialTimeout = 3 * time.Second
+
+var connectSpecs = []flagSpec{
+	{Long: "help", Short: "h", ExpectsValue: false, IsBool: true},
+	{Long: "password", Short: "P", ExpectsValue: true, IsBool: false},
+	{Long: "proxy", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "udp", Short: "", ExpectsValue: false, IsBool: true},
+	{Long: "user", Short: "u", ExpectsValue: true, IsBool: false},
+}
+
+// runConnect attaches this terminal to a running mirror. With --udp it
+// uses the datagram transport when the mirror offers it and falls back to
+// the WebSocket otherwise.
+func runConnect(args []string) error {
+	canonical, positionals, err := normalizeArgsWith(connectSpecs, args)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("alices-mirror connect", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		help     bool
+		user     string
+		password string
+		proxyURL string
+		useUDP   bool
+	)
+	fs.BoolVar(&help, "help", false, "")
+	fs.StringVar(&user, "user", "", "")
+	fs.StringVar(&password, "password", "", "")
+	fs.StringVar(&proxyURL, "proxy", "", "")
+	fs.BoolVar(&useUDP, "udp", false, "")
+	if err := fs.Parse(canonical); err != nil {
+		return err
+	}
+	if help {
+		printConnectHelp()
+		return nil
+	}
+	if len(positionals) != 1 {
+		return errors.New("connect requires exactly one mirror URL")
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("connect requires an interactive terminal on stdin")
+	}
+
+	base, err := parseMirrorURL(positionals[0])
+	if err != nil {
+		return fmt.Errorf("invalid mirror URL %q: %v", positionals[0], err)
+	}
+	if user == "" && base.User != nil {
+		user = base.User.Username()
+		password, _ = base.User.Password()
+	}
+	base.User = nil
+
+	header := http.Header{}
+	if user != "" {
+		header.Set("Authorization", basicAuthHeader(user, password))
+	}
+	proxyFunc, err := proxy.Func(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid value %q for --proxy: %v", proxyURL, err)
+	}
+
+	if useUDP {
+		conn, err := dialUDPSession(base, header, proxyFunc)
+		if err == nil {
+			defer conn.Close()
+			return runTerminal(conn)
+		}
+		fmt.Fprintf(os.Stderr, "UDP transport unavailable (%v); using WebSocket.\n", err)
+	}
+
+	conn, err := dialMirror(base, header, proxyFunc)
+	if err != nil {
+		return err
+	}
+	current := &redirectConn{Conn: conn}
+	defer func() { _ = current.Close() }()
+	return runReconnectingTerminal(current, func(error) (messageConn, error) {
+		if current.target == nil {
+			return nil, nil
+		}
+		next, err := followRedirect(*current.target, proxyFunc)
+		if err != nil {
+			return nil, err
+		}
+		current = &redirectConn{Conn: next}
+		return current, nil
+	}, false)
+}
+
+// dialMirror opens the WebSocket of the mirror at base.
+func dialMirror(base *url.URL, header http.Header, proxyFunc func(*http.Request) (*url.URL, error)) (*websocket.Conn, error) {
+	wsURL := *base
+	wsURL.Scheme = "ws"
+	if base.Scheme == "https" {
+		wsURL.Scheme = "wss"
+	}
+	wsURL.Path = strings.TrimSuffix(base.Path, "/") + "/ws"
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{protocol.Subprotocol}
+	dialer.Proxy = proxyFunc
+	conn, resp, err := dialer.Dial(wsURL.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %s", base.Host, resp.Status)
+		}
+		return nil, fmt.Errorf("failed to connect to %s: %v", base.Host, err)
+	}
+	return conn, nil
+}
+
+// errRedirected ends a connection whose mirror moved the session elsewhere.
+var errRedirected = errors.New("session moved")
+
+// redirectConn is a mirror connection that ends when the mirror sends a
+// redirect, remembering where to.
+type redirectConn struct {
+	*websocket.Conn
+	target *protocol.Redirect
+}
+
+func (c *redirectConn) ReadMessage() (int, []byte, error) {
+	messageType, payload, err := c.Conn.ReadMessage()
+	if err == nil && messageType == websocket.TextMessage {
+		msg, _ := protocol.DecodeFromServer(payload)
+		if redirect, ok := msg.(protocol.Redirect); ok {
+			c.target = &redirect
+			_ = c.Conn.Close()
+			return 0, nil, errRedirected
+		}
+	}
+	return messageType, payload, err
+}
+
+// followRedirect connects to the mirror a session moved to, with the
+// handover token it was given instead of this mirror's credentials.
+func followRedirect(redirect protocol.Redirect, proxyFunc func(*http.Request) (*url.URL, error)) (*websocket.Conn, error) {
+	target, err := parseMirrorURL(redirect.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect to %q: %v", redirect.URL, err)
+	}
+	target.User = nil
+	if redirect.Token != "" {
+		query := target.Query()
+		query.Set("handover", redirect.Token)
+		target.RawQuery = query.Encode()
+	}
+	fmt.Fprintf(os.Stderr, "\r\nThe session moved to %s, reconnecting.\r\n", target.Host)
+	return dialMirror(target, http.Header{}, proxyFunc)
+}
+
+func parseMirrorURL(raw string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, errors.New("missing host")
+	}
+	return u, nil
+}
+
+// dialUDPSession asks the mirror for a datagram session and opens it.
+func dialUDPSession(base *url.URL, header http.Header, proxyFunc func(*http.Request) (*url.URL, error)) (*datagramConn, error) {
+	apiURL := *base
+	apiURL.Path = strings.TrimSuffix(base.Path, "/") + "/api/udp"
+	req, err := http.NewRequest(http.MethodPost, apiURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header.Clone()
+	client := &http.Client{
+		Timeout:   udpDialTimeout,
+		Transport: &http.Transport{Proxy: proxyFunc},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	var session struct {
+		Port int    `json:"port"`
+		ID   string `json:"id"`
+		Key  string `json:"key"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, err
+	}
+	rawID, err := hex.DecodeString(session.ID)
+	if err != nil || len(rawID) != len(datagram.SessionID{}) {
+		return nil, errors.New("invalid session id")
+	}
+	var id datagram.SessionID
+	copy(id[:], rawID)
+	key, err := base64.StdEncoding.DecodeString(session.Key)
+	if err != nil {
+		return nil, errors.New("invalid session key")
+	}
+
+	addr := net.JoinHostPort(base.Hostname(), strconv.Itoa(session.Port))
+	conn, err := datagram.Dial(addr, id, key, udpDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &datagramConn{conn: conn, reader: datagram.NewMessageReader(conn)}, nil
+}
+
+// datagramConn adapts a datagram session to messageConn.
+type datagramConn struct {
+	conn   *datagram.Conn
+	reader *datagram.MessageReader
+
+	mu sync.Mutex
+}
+
+func (c *datagramConn) ReadMessage() (int, []byte, error) {
+	return c.reader.ReadMessage()
+}
+
+func (c *datagramConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return datagram.WriteMessage(c.conn, messageType, data)
+}
+
+func (c *datagramConn) Close() error {
+	return c.conn.Close()
+}
+
+func printConnectHelp() {
+	fmt.Println("Connect options (alices-mirror connect [options] <url>):")
+	fmt.Println("  -h, --help             Show help and exit.")
+	fmt.Println("  -u, --user=<user>      Basic Auth user (or give it in the URL).")
+	fmt.Println("  -P, --password=<password>  Basic Auth password.")
+	fmt.Println("  --proxy=<url>          Proxy for the connection (default from HTTP_PROXY/HTTPS_PROXY/ALL_PROXY).")
+	fmt.Println("  --udp                  Use the mirror's UDP transport if it has --udp-port, falling back to WebSocket.")
+}
@@ -37,3 +37,9 @@ func startDaemon(args []string) (int, error) {
 
 	return cmd.Process.Pid, nil
 }
+
+// runSupervisor reports whether this process is a daemon supervisor. Only
+// Windows daemons are supervised.
+func runSupervisor() bool {
+	return false
+}
@@ -3,11 +3,40 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+
+	"alices-mirror/internal/app"
+	"alices-mirror/internal/logging"
 )
 
+// superviseEnv marks the process started by --daemon as the supervisor,
+// which runs the server as its own child and watches it.
+const superviseEnv = "ALICES_MIRROR_SUPERVISE"
+
+const (
+	restartMinDelay = time.Second
+	restartMaxDelay = time.Minute
+	// restartStableAfter resets the restart delay once a server has run
+	// this long.
+	restartStableAfter = time.Minute
+)
+
+const detachedProcess = 0x00000008
+
+// startDaemon starts the supervisor in the background and returns its PID.
+// Ending the supervisor also ends the server.
 func startDaemon(args []string) (int, error) {
 	exe, err := os.Executable()
 	if err != nil {
@@ -15,7 +44,7 @@ func startDaemon(args []string) (int, error) {
 	}
 
 	cmd := exec.Command(exe, args...)
-	const detachedProcess = 0x00000008
+	cmd.Env = append(os.Environ(), superviseEnv+"=1")
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess,
 	}
@@ -40,3 +69,161 @@ func startDaemon(args []string) (int, error) {
 
 	return cmd.Process.Pid, nil
 }
+
+// daemonState is written to daemon-<port>.json in the state directory each
+// time the supervised server starts or exits.
+type daemonState struct {
+	State         string      `json:"state"`
+	SupervisorPID int         `json:"supervisorPid"`
+	PID           int         `json:"pid,omitempty"`
+	Port          int         `json:"port"`
+	AutoRestart   bool        `json:"autoRestart"`
+	Restarts      int         `json:"restarts"`
+	StartedAt     time.Time   `json:"startedAt"`
+	Log           string      `json:"log"`
+	LastExit      *daemonExit `json:"lastExit,omitempty"`
+}
+
+type daemonExit struct {
+	Code int       `json:"code"`
+	Time time.Time `json:"time"`
+}
+
+// runSupervisor runs the server when this process was started by
+// startDaemon, and reports whether it did. The server's output goes to
+// daemon-<port>.log. With --daemon-restart a server that exits with an
+// error is started again, waiting longer after each quick failure.
+func runSupervisor() bool {
+	if os.Getenv(superviseEnv) == "" {
+		return false
+	}
+	_ = os.Unsetenv(superviseEnv)
+	if err := supervise(os.Args[1:]); err != nil {
+		os.Exit(1)
+	}
+	return true
+}
+
+func supervise(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := app.StateDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	port := 3002
+	for _, arg := range args {
+		if value, ok := strings.CutPrefix(arg, "--port="); ok {
+			if parsed, err := strconv.Atoi(value); err == nil {
+				port = parsed
+			}
+		}
+	}
+	name := fmt.Sprintf("daemon-%d", port)
+	logPath := filepath.Join(dir, name+".log")
+	logFile, err := logging.OpenRotating(logPath, logging.RotateOptions{MaxSize: 16 << 20, MaxFiles: 5})
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	// The server is kept in a job that closes with this process, so ending
+	// the supervisor also ends the server.
+	job, err := newKillOnCloseJob()
+	if err != nil {
+		fmt.Fprintf(logFile, "supervisor: %v\n", err)
+	}
+
+	state := daemonState{
+		SupervisorPID: os.Getpid(),
+		Port:          port,
+		AutoRestart:   flagPresent(args, "daemon-restart"),
+		Log:           logPath,
+	}
+	args = slices.DeleteFunc(slices.Clone(args), func(arg string) bool {
+		return arg == "--daemon-restart" || strings.HasPrefix(arg, "--daemon-restart=")
+	})
+	statePath := filepath.Join(dir, name+".json")
+	delay := restartMinDelay
+	for {
+		cmd := exec.Command(exe, args...)
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess,
+		}
+		if err := cmd.Start(); err != nil {
+			fmt.Fprintf(logFile, "supervisor: failed to start server: %v\n", err)
+			state.State = "failed"
+			writeDaemonState(statePath, state)
+			return err
+		}
+		if job != 0 {
+			if handle, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid)); err == nil {
+				_ = windows.AssignProcessToJobObject(job, handle)
+				_ = windows.CloseHandle(handle)
+			}
+		}
+
+		state.State = "running"
+		state.PID = cmd.Process.Pid
+		state.StartedAt = time.Now()
+		writeDaemonState(statePath, state)
+
+		err := cmd.Wait()
+		code := cmd.ProcessState.ExitCode()
+		state.PID = 0
+		state.LastExit = &daemonExit{Code: code, Time: time.Now()}
+		fmt.Fprintf(logFile, "supervisor: server exited after %s: %v\n", time.Since(state.StartedAt).Round(time.Second), err)
+
+		if code == 0 || !state.AutoRestart {
+			state.State = "exited"
+			writeDaemonState(statePath, state)
+			return err
+		}
+
+		if time.Since(state.StartedAt) >= restartStableAfter {
+			delay = restartMinDelay
+		}
+		state.State = "restarting"
+		state.Restarts++
+		writeDaemonState(statePath, state)
+		fmt.Fprintf(logFile, "supervisor: restarting in %s\n", delay)
+		time.Sleep(delay)
+		delay = min(delay*2, restartMaxDelay)
+	}
+}
+
+func newKillOnCloseJob() (windows.Handle, error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create job object: %w", err)
+	}
+	var info windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		_ = windows.CloseHandle(job)
+		return 0, fmt.Errorf("failed to configure job object: %w", err)
+	}
+	return job, nil
+}
+
+// writeDaemonState replaces path atomically so readers never see a partial
+// file.
+func writeDaemonState(path string, state daemonState) {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, path)
+}
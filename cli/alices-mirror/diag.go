@@ -0,0 +1,268 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"alices-mirror/internal/app"
+)
+
+const (
+	defaultDiagURL = "http://127.0.0.1:3002"
+	diagTimeout    = 30 * time.Second
+)
+
+var diagSpecs = []flagSpec{
+	{Long: "help", Short: "h", ExpectsValue: false, IsBool: true},
+	{Long: "output", Short: "o", ExpectsValue: true, IsBool: false},
+	{Long: "password", Short: "P", ExpectsValue: true, IsBool: false},
+	{Long: "token", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "user", Short: "u", ExpectsValue: true, IsBool: false},
+}
+
+// diagEnvVars are the environment variables reported by diag. Values of
+// the proxy variables have their credentials removed and the OTLP headers
+// are never included.
+var diagEnvVars = []string{
+	"SHELL", "TERM", "LANG", "LC_ALL", "TMUX", "DOCKER_HOST", "CONTAINER_HOST",
+	"XDG_CONFIG_HOME", "XDG_RUNTIME_DIR", "HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "NO_PROXY",
+	"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_SERVICE_NAME",
+}
+
+// runDiag collects what is needed to debug a running mirror into one
+// .tar.gz: its effective configuration, runtime status, recent events,
+// clients and goroutine/heap profiles, plus details about this machine.
+// Parts that cannot be fetched are listed in errors.txt instead of failing
+// the whole bundle.
+func runDiag(args []string) error {
+	canonical, positionals, err := normalizeArgsWith(diagSpecs, args)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("alices-mirror diag", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		help     bool
+		output   string
+		user     string
+		password string
+		token    string
+	)
+	fs.BoolVar(&help, "help", false, "")
+	fs.StringVar(&output, "output", "", "")
+	fs.StringVar(&user, "user", "", "")
+	fs.StringVar(&password, "password", "", "")
+	fs.StringVar(&token, "token", "", "")
+	if err := fs.Parse(canonical); err != nil {
+		return err
+	}
+	if help {
+		printDiagHelp()
+		return nil
+	}
+	if len(positionals) > 1 {
+		return errors.New("diag takes at most one mirror URL")
+	}
+
+	raw := defaultDiagURL
+	if len(positionals) == 1 {
+		raw = positionals[0]
+	}
+	base, err := parseMirrorURL(raw)
+	if err != nil {
+		return fmt.Errorf("invalid mirror URL %q: %v", raw, err)
+	}
+	if user == "" && base.User != nil {
+		user = base.User.Username()
+		password, _ = base.User.Password()
+	}
+	base.User = nil
+
+	now := time.Now()
+	if output == "" {
+		output = "alices-mirror-diag-" + now.Format("20060102-150405") + ".tar.gz"
+	}
+
+	fetch := func(path string) ([]byte, error) {
+		u := *base
+		u.Path = strings.TrimSuffix(base.Path, "/") + path
+		if token != "" {
+			u.RawQuery = url.Values{"token": {token}}.Encode()
+		}
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if user != "" {
+			req.Header.Set("Authorization", basicAuthHeader(user, password))
+		}
+		resp, err := (&http.Client{Timeout: diagTimeout}).Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New(resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	}
+
+	files := map[string][]byte{}
+	var failures []string
+	add := func(name, path string) []byte {
+		data, err := fetch(path)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+			return nil
+		}
+		files[name] = data
+		return data
+	}
+
+	if data := add("diag.json", "/api/diag"); data != nil {
+		var diag struct {
+			Config json.RawMessage `json:"config"`
+			Status json.RawMessage `json:"status"`
+		}
+		if err := json.Unmarshal(data, &diag); err == nil {
+			delete(files, "diag.json")
+			files["config.json"] = indentJSON(diag.Config)
+			files["status.json"] = indentJSON(diag.Status)
+		}
+	}
+	if data := add("events.json", "/api/events"); data != nil {
+		files["events.json"] = indentJSON(data)
+	}
+	if data := add("clients.json", "/api/clients"); data != nil {
+		files["clients.json"] = indentJSON(data)
+	}
+	if data := add("session.json", "/api/session"); data != nil {
+		files["session.json"] = indentJSON(data)
+	}
+	add("goroutine.txt", "/api/diag/goroutine")
+	add("heap.pprof", "/api/diag/heap")
+
+	env, _ := json.MarshalIndent(diagEnvironment(base), "", "  ")
+	files["environment.json"] = env
+	if len(failures) > 0 {
+		files["errors.txt"] = []byte(strings.Join(failures, "\n") + "\n")
+	}
+
+	if err := writeDiagArchive(output, now, files); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", output)
+	for _, failure := range failures {
+		fmt.Fprintf(os.Stderr, "Warning: could not collect %s\n", failure)
+	}
+	return nil
+}
+
+func diagEnvironment(base *url.URL) map[string]any {
+	hostname, _ := os.Hostname()
+	env := map[string]string{}
+	for _, name := range diagEnvVars {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(name, "_PROXY") && name != "NO_PROXY" {
+			if u, err := url.Parse(value); err == nil {
+				value = u.Redacted()
+			}
+		}
+		env[name] = value
+	}
+
+	state := map[string]any{}
+	if dir, err := app.StateDir(); err == nil {
+		state["path"] = dir
+		if entries, err := os.ReadDir(dir); err == nil {
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			state["files"] = names
+		}
+	}
+
+	return map[string]any{
+		"version":   app.Version(),
+		"goVersion": runtime.Version(),
+		"os":        runtime.GOOS,
+		"arch":      runtime.GOARCH,
+		"cpus":      runtime.NumCPU(),
+		"hostname":  hostname,
+		"mirror":    base.String(),
+		"env":       env,
+		"stateDir":  state,
+	}
+}
+
+func indentJSON(data []byte) []byte {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return data
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return data
+	}
+	return append(out, '\n')
+}
+
+func writeDiagArchive(path string, modTime time.Time, files map[string][]byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	dir := strings.TrimSuffix(filepath.Base(path), ".tar.gz")
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		data := files[name]
+		hdr := &tar.Header{Name: dir + "/" + name, Mode: 0o600, Size: int64(len(data)), ModTime: modTime}
+		if err := tw.WriteHeader(hdr); err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func printDiagHelp() {
+	fmt.Println("Diag options (alices-mirror diag [options] [url]):")
+	fmt.Println("  -h, --help             Show help and exit.")
+	fmt.Println("  -o, --output=<file>    Archive to write (default alices-mirror-diag-<time>.tar.gz).")
+	fmt.Println("  -u, --user=<user>      Basic Auth user (or give it in the URL).")
+	fmt.Println("  -P, --password=<password>  Basic Auth password.")
+	fmt.Println("  --token=<token>        Owner token of the shared session; the mirror serves diag data to the owner only.")
+	fmt.Printf("                          The mirror defaults to %s.\n", defaultDiagURL)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+)
+
+var handoverSpecs = []flagSpec{
+	{Long: "accept", Short: "", ExpectsValue: false, IsBool: true},
+	{Long: "help", Short: "h", ExpectsValue: false, IsBool: true},
+	{Long: "port", Short: "p", ExpectsValue: true, IsBool: false},
+	{Long: "session", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "to", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "token", Short: "", ExpectsValue: true, IsBool: false},
+}
+
+// runHandover moves the viewers of a --share daemon to another mirror.
+// With --accept it runs on the mirror they move to and prints the token
+// the other one signs their passes with; with --to it runs on the one they
+// leave.
+func runHandover(args []string) error {
+	canonical, positionals, err := normalizeArgsWith(handoverSpecs, args)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("alices-mirror handover", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		help    bool
+		accept  bool
+		to      string
+		token   string
+		target  shareTarget
+		portSet bool
+	)
+	fs.BoolVar(&help, "help", false, "")
+	fs.BoolVar(&accept, "accept", false, "")
+	fs.StringVar(&to, "to", "", "")
+	fs.StringVar(&token, "token", "", "")
+	fs.IntVar(&target.port, "port", 3002, "")
+	fs.StringVar(&target.session, "session", "", "")
+	if err := fs.Parse(canonical); err != nil {
+		return err
+	}
+	if help {
+		printHandoverHelp()
+		return nil
+	}
+	if len(positionals) > 0 {
+		return fmt.Errorf("unexpected argument %q", positionals[0])
+	}
+	switch {
+	case accept && to != "":
+		return errors.New("--accept cannot be used with --to")
+	case accept && token != "":
+		return errors.New("--token is only used with --to")
+	case !accept && to == "":
+		return errors.New("handover requires --accept or --to")
+	}
+	fs.Visit(func(f *flag.Flag) {
+		portSet = portSet || f.Name == "port"
+	})
+	if target.session != "" {
+		if portSet {
+			return errors.New("--port cannot be used with --session")
+		}
+		if err := checkSessionName(target.session); err != nil {
+			return fmt.Errorf("invalid value %q for --session: %v", target.session, err)
+		}
+	}
+
+	state, err := readShareState(target)
+	if err != nil {
+		return err
+	}
+	if accept {
+		var accepted struct {
+			Token   string    `json:"token"`
+			Expires time.Time `json:"expires"`
+		}
+		if err := postOwnerAPI(state, "/api/handover/accept", nil, &accepted); err != nil {
+			return err
+		}
+		fmt.Println(accepted.Token)
+		fmt.Printf("On the mirror the viewers leave, run: alices-mirror handover --to=<this mirror's URL> --token=%s\n", accepted.Token)
+		fmt.Printf("Use it before %s. Each viewer is then let in once without a password, at the user level it had there.\n", accepted.Expires.Local().Format(time.DateTime))
+		return nil
+	}
+
+	var moved struct {
+		Viewers int `json:"viewers"`
+	}
+	body := map[string]string{"url": to, "token": token}
+	if err := postOwnerAPI(state, "/api/handover", body, &moved); err != nil {
+		return err
+	}
+	fmt.Printf("Sent %d viewer(s) to %s.\n", moved.Viewers, to)
+	return nil
+}
+
+func printHandoverHelp() {
+	fmt.Println("Handover options (alices-mirror handover --accept | --to=<url> [options]):")
+	fmt.Println("  --accept               On the mirror viewers move to: print a token for --to on the other mirror.")
+	fmt.Println("  --to=<url>             On the mirror viewers leave: send them to <url>.")
+	fmt.Println("  --token=<token>        With --to, the token printed by --accept on the other mirror.")
+	fmt.Println("  -h, --help             Show help and exit.")
+	fmt.Println("  -p, --port=<port>      Port of the --share session (default 3002).")
+	fmt.Println("  --session=<name>       Name of the --share --session.")
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"alices-mirror/internal/tunnel"
+)
+
+const defaultHubListen = ":3080"
+
+var hubSpecs = []flagSpec{
+	{Long: "help", Short: "h", ExpectsValue: false, IsBool: true},
+	{Long: "listen", Short: "l", ExpectsValue: true, IsBool: false},
+	{Long: "password", Short: "P", ExpectsValue: true, IsBool: false},
+	{Long: "user", Short: "u", ExpectsValue: true, IsBool: false},
+	{Long: "yolo", Short: "y", ExpectsValue: false, IsBool: true},
+}
+
+// runHub serves one portal for many mirrors: they register with
+// --share-public, are listed on the hub's own host name and are reached
+// through their subdomains, all behind the hub's credentials.
+func runHub(args []string) error {
+	canonical, positionals, err := normalizeArgsWith(hubSpecs, args)
+	if err != nil {
+		return err
+	}
+	if len(positionals) > 0 {
+		return fmt.Errorf("unexpected positional arguments: %s", strings.Join(positionals, " "))
+	}
+
+	fs := flag.NewFlagSet("alices-mirror hub", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		help     bool
+		listen   string
+		user     string
+		password string
+		yolo     bool
+	)
+	fs.BoolVar(&help, "help", false, "")
+	fs.StringVar(&listen, "listen", defaultHubListen, "")
+	fs.StringVar(&user, "user", "", "")
+	fs.StringVar(&password, "password", "", "")
+	fs.BoolVar(&yolo, "yolo", false, "")
+	if err := fs.Parse(canonical); err != nil {
+		return err
+	}
+	if help {
+		printHubHelp()
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(listen); err != nil {
+		return fmt.Errorf("invalid value %q for --listen: %v", listen, err)
+	}
+	if !yolo && (user == "" || password == "") {
+		return errors.New("hub requires --user and --password (or --yolo to disable auth)")
+	}
+	if yolo {
+		user, password = "", ""
+	}
+
+	token := strings.TrimSpace(os.Getenv(relayTokenEnv))
+	if token == "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not set; any mirror may register with this hub.\n", relayTokenEnv)
+	}
+
+	srv := &http.Server{
+		Addr: listen,
+		Handler: tunnel.NewRelay(tunnel.RelayConfig{
+			Token:    token,
+			User:     user,
+			Password: password,
+			Portal:   true,
+		}),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	fmt.Printf("alices mirror hub is listening on %s.\n", listen)
+	fmt.Println("Register mirrors with --share-public=http://<hub host>" + hubPortSuffix(listen) + "?token=<token> and the hub's --user/--password.")
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func hubPortSuffix(listen string) string {
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil || port == "80" {
+		return ""
+	}
+	return ":" + port
+}
+
+func printHubHelp() {
+	fmt.Println("Hub options:")
+	fmt.Println("  -h, --help             Show help and exit.")
+	fmt.Printf("  -l, --listen=<addr>    Address for the hub portal and mirror registrations (default %s).\n", defaultHubListen)
+	fmt.Println("  -u, --user=<user>      Basic Auth user for the portal and every mirror behind it.")
+	fmt.Println("  -P, --password=<password>  Basic Auth password (requires --user).")
+	fmt.Println("  -y, --yolo             Disable hub auth entirely when present.")
+	fmt.Printf("                          Mirrors must present %s when it is set.\n", relayTokenEnv)
+}
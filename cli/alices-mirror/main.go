@@ -11,6 +11,8 @@ import (
 	"strings"
 
 	"alices-mirror/internal/app"
+	"alices-mirror/internal/logging"
+	"alices-mirror/internal/terminal"
 )
 
 type flagSpec struct {
@@ -22,19 +24,80 @@ type flagSpec struct {
 
 var baseSpecs = []flagSpec{
 	{Long: "alias", Short: "a", ExpectsValue: true, IsBool: false},
+	{Long: "accent", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "motd", Short: "", ExpectsValue: true, IsBool: false},
 	{Long: "help", Short: "h", ExpectsValue: false, IsBool: true},
+	{Long: "clipboard", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "osc52-clipboard", Short: "", ExpectsValue: false, IsBool: true},
+	{Long: "resize", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "paste-confirm", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "container", Short: "", ExpectsValue: true, IsBool: false},
 	{Long: "cwd", Short: "cw", ExpectsValue: true, IsBool: false},
+	{Long: "bench", Short: "", ExpectsValue: false, IsBool: true},
+	{Long: "bench-clients", Short: "", ExpectsValue: true, IsBool: false},
 	{Long: "daemon", Short: "d", ExpectsValue: false, IsBool: true},
+	{Long: "debug-pprof", Short: "", ExpectsValue: false, IsBool: true},
 	{Long: "share", Short: "s", ExpectsValue: false, IsBool: true},
 	{Long: "share", Short: "sh", ExpectsValue: false, IsBool: true},
+	{Long: "share-foreground", Short: "", ExpectsValue: false, IsBool: true},
+	{Long: "share-public", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "session", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "setuid-user", Short: "", ExpectsValue: true, IsBool: false},
 	{Long: "bind", Short: "b", ExpectsValue: true, IsBool: false},
+	{Long: "confine", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "alert-email", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "alert-smtp", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "alert-webhook", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "bell-webhook", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "board", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "auth-file", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "snippets", Short: "", ExpectsValue: true, IsBool: false},
 	{Long: "allow-ip", Short: "al", ExpectsValue: true, IsBool: false},
 	{Long: "allow-ips", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "allow-ip-dns", Short: "", ExpectsValue: false, IsBool: true},
+	{Long: "allow-commands", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "deny-commands", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "limit-cpu", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "limit-mem", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "limit-pids", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "log-dest", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "log-format", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "log-input", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "log-level", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "log-max-age", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "log-max-files", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "log-max-size", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "log-output", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "log-output-format", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "max-buffered", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "max-conns-per-ip", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "read-timeout", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "write-timeout", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "ws-write-timeout", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "no-ip-alerts", Short: "", ExpectsValue: false, IsBool: true},
+	{Long: "no-snapshot", Short: "", ExpectsValue: false, IsBool: true},
 	{Long: "origin", Short: "o", ExpectsValue: true, IsBool: false},
+	{Long: "output-queue", Short: "", ExpectsValue: true, IsBool: false},
 	{Long: "user-level", Short: "ul", ExpectsValue: true, IsBool: false},
 	{Long: "password", Short: "P", ExpectsValue: true, IsBool: false},
 	{Long: "port", Short: "p", ExpectsValue: true, IsBool: false},
+	{Long: "proxy", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "qr", Short: "", ExpectsValue: false, IsBool: true},
+	{Long: "qr-credentials", Short: "", ExpectsValue: false, IsBool: true},
+	{Long: "read-buffer", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "relay-listen", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "reset-policy", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "reset-sudo", Short: "", ExpectsValue: false, IsBool: true},
+	{Long: "reset-wait", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "slow-client-policy", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "ssh-host-key", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "ssh-port", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "tmux", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "title-prefix", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "tunnel", Short: "", ExpectsValue: true, IsBool: false},
+	{Long: "udp-port", Short: "", ExpectsValue: true, IsBool: false},
 	{Long: "visible", Short: "vi", ExpectsValue: false, IsBool: true},
+	{Long: "web-root", Short: "", ExpectsValue: true, IsBool: false},
 	{Long: "user", Short: "u", ExpectsValue: true, IsBool: false},
 	{Long: "yolo", Short: "y", ExpectsValue: false, IsBool: true},
 }
@@ -52,6 +115,55 @@ func allSpecs() []flagSpec {
 }
 
 func main() {
+	if terminal.RunConfineHelper() {
+		return
+	}
+	if runSupervisor() {
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "hub" {
+		if err := runHub(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diag" {
+		if err := runDiag(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "attach" {
+		if err := runAttach(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "upgrade" {
+		if err := runUpgrade(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "handover" {
+		if err := runHandover(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "connect" {
+		if err := runConnect(os.Args[2:]); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	canonical, positionals, err := normalizeArgs(os.Args[1:])
 	if err != nil {
 		printError(err)
@@ -67,10 +179,14 @@ func main() {
 
 	var (
 		alias     string
+		accent    string
+		motd      string
 		help      bool
 		cwd       string
 		daemon    bool
 		share     bool
+		shareFg   bool
+		session   string
 		bind      string
 		origin    string
 		allowIPs  string
@@ -80,24 +196,142 @@ func main() {
 		user      string
 		password  string
 		yolo      bool
+		showQR    bool
+		qrCreds   bool
+		webRoot   string
+		clipboard string
+		osc52     bool
+		resize    string
+		paste     string
+		slowMode  string
+		readSize  int
+		queueSize int
+		debugProf bool
+		maxBuf    string
+		maxConns  int
+		benchMode bool
+		benchN    int
+		publicURL string
+		relayAddr string
+		tunnelVia string
+		sshPort   int
+		boardPort int
+		sshKey    string
+		proxyURL  string
+		udpPort   int
+		tmuxName  string
+		container string
+		logLevel  string
+		logDest   string
+		logFormat string
+		logInput  string
+		logOutput string
+		logOutFmt string
+		logMaxSz  string
+		logMaxAge string
+		logMaxN   int
+		noIPAlert bool
+		alertHook string
+		alertMail string
+		alertSMTP string
+		bellHook  string
+		setuidUsr string
+		confine   string
+		limitCPU  string
+		limitMem  string
+		limitPIDs int
+		allowCmds string
+		denyCmds  string
+		authFile  string
+		snippets  string
+		resetWait string
+		resetSudo bool
+		resetBy   string
+		allowDNS  bool
+		noReplay  bool
+		titlePfx  string
+		readTO    string
+		writeTO   string
+		wsWriteTO string
 		shell     = defaultPlatformShell()
 	)
 
 	fs.StringVar(&alias, "alias", "", "")
+	fs.StringVar(&accent, "accent", "", "")
+	fs.StringVar(&motd, "motd", "", "")
 	fs.BoolVar(&help, "help", false, "")
+	fs.StringVar(&clipboard, "clipboard", "owner", "")
+	fs.BoolVar(&osc52, "osc52-clipboard", false, "")
+	fs.StringVar(&resize, "resize", "interact", "")
+	fs.StringVar(&paste, "paste-confirm", "client", "")
 	fs.StringVar(&cwd, "cwd", "", "")
 	fs.BoolVar(&daemon, "daemon", false, "")
 	fs.BoolVar(&share, "share", false, "")
+	fs.BoolVar(&shareFg, "share-foreground", false, "")
+	fs.StringVar(&session, "session", "", "")
 	fs.StringVar(&bind, "bind", defaultBindList, "")
 	fs.StringVar(&origin, "origin", "", "")
 	fs.StringVar(&allowIPs, "allow-ip", defaultAllowIPList, "")
 	fs.StringVar(&allowIPs, "allow-ips", defaultAllowIPList, "")
+	fs.BoolVar(&allowDNS, "allow-ip-dns", false, "")
 	fs.StringVar(&userLevel, "user-level", defaultUserLevel, "")
 	fs.IntVar(&port, "port", 3002, "")
+	fs.StringVar(&slowMode, "slow-client-policy", "drop", "")
+	fs.IntVar(&readSize, "read-buffer", terminal.DefaultReadBufferSize, "")
+	fs.IntVar(&queueSize, "output-queue", terminal.DefaultOutputQueueDepth, "")
+	fs.BoolVar(&debugProf, "debug-pprof", false, "")
+	fs.StringVar(&maxBuf, "max-buffered", "64M", "")
+	fs.IntVar(&maxConns, "max-conns-per-ip", 0, "")
+	fs.StringVar(&readTO, "read-timeout", "0", "")
+	fs.StringVar(&writeTO, "write-timeout", "1m", "")
+	fs.StringVar(&wsWriteTO, "ws-write-timeout", "10s", "")
+	fs.BoolVar(&benchMode, "bench", false, "")
+	fs.IntVar(&benchN, "bench-clients", 8, "")
+	fs.StringVar(&publicURL, "share-public", "", "")
+	fs.StringVar(&relayAddr, "relay-listen", "", "")
+	fs.StringVar(&tunnelVia, "tunnel", "", "")
+	fs.IntVar(&sshPort, "ssh-port", 0, "")
+	fs.IntVar(&boardPort, "board", 0, "")
+	fs.StringVar(&sshKey, "ssh-host-key", "", "")
+	fs.StringVar(&proxyURL, "proxy", "", "")
+	fs.IntVar(&udpPort, "udp-port", 0, "")
+	fs.StringVar(&tmuxName, "tmux", "", "")
+	fs.StringVar(&titlePfx, "title-prefix", os.Getenv(titlePrefixEnv), "")
+	fs.StringVar(&container, "container", "", "")
+	fs.StringVar(&logLevel, "log-level", "info", "")
+	fs.StringVar(&logFormat, "log-format", logging.FormatText, "")
+	fs.StringVar(&logDest, "log-dest", logging.DestStderr, "")
+	fs.StringVar(&logInput, "log-input", "", "")
+	fs.StringVar(&logOutput, "log-output", "", "")
+	fs.StringVar(&logOutFmt, "log-output-format", app.OutputLogRaw, "")
+	fs.StringVar(&logMaxSz, "log-max-size", app.DefaultLogMaxSize, "")
+	fs.StringVar(&logMaxAge, "log-max-age", "", "")
+	fs.IntVar(&logMaxN, "log-max-files", app.DefaultLogMaxFiles, "")
+	fs.BoolVar(&noIPAlert, "no-ip-alerts", false, "")
+	fs.BoolVar(&noReplay, "no-snapshot", false, "")
+	fs.StringVar(&alertHook, "alert-webhook", "", "")
+	fs.StringVar(&alertMail, "alert-email", "", "")
+	fs.StringVar(&alertSMTP, "alert-smtp", "", "")
+	fs.StringVar(&bellHook, "bell-webhook", "", "")
+	fs.StringVar(&setuidUsr, "setuid-user", "", "")
+	fs.StringVar(&confine, "confine", "", "")
+	fs.StringVar(&limitCPU, "limit-cpu", "", "")
+	fs.StringVar(&limitMem, "limit-mem", "", "")
+	fs.IntVar(&limitPIDs, "limit-pids", 0, "")
+	fs.StringVar(&allowCmds, "allow-commands", "", "")
+	fs.StringVar(&denyCmds, "deny-commands", "", "")
+	fs.StringVar(&authFile, "auth-file", "", "")
+	fs.StringVar(&snippets, "snippets", "", "")
+	fs.StringVar(&resetWait, "reset-wait", "", "")
+	fs.BoolVar(&resetSudo, "reset-sudo", false, "")
+	fs.StringVar(&resetBy, "reset-policy", "interact", "")
 	fs.BoolVar(&visible, "visible", false, "")
 	fs.StringVar(&user, "user", "", "")
 	fs.StringVar(&password, "password", "", "")
 	fs.BoolVar(&yolo, "yolo", false, "")
+	fs.BoolVar(&showQR, "qr", false, "")
+	fs.BoolVar(&qrCreds, "qr-credentials", false, "")
+	fs.StringVar(&webRoot, "web-root", "", "")
 	registerPlatformFlags(fs, &shell)
 
 	if err := fs.Parse(canonical); err != nil {
@@ -110,6 +344,39 @@ func main() {
 		return
 	}
 
+	if _, err := logging.ParseLevel(logLevel); err != nil {
+		printError(fmt.Errorf("invalid value %q for --log-level: %v", logLevel, err))
+		os.Exit(1)
+	}
+	if _, err := logging.ParseFormat(logFormat); err != nil {
+		printError(fmt.Errorf("invalid value %q for --log-format: %v", logFormat, err))
+		os.Exit(1)
+	}
+	if err := logging.SetupDest(logDest, logLevel, logFormat); err != nil {
+		printError(fmt.Errorf("invalid value %q for --log-dest: %v", logDest, err))
+		os.Exit(1)
+	}
+	if shareFg && logDest == logging.DestStderr {
+		// Log lines would land in the middle of the shared terminal.
+		_ = logging.Setup(io.Discard, logLevel, logFormat)
+	}
+
+	if benchMode {
+		if err := runBench(benchN); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flagPresent(canonical, "relay-listen") {
+		if err := runRelay(relayAddr); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if port < 1 || port > 65535 {
 		printError(fmt.Errorf("invalid value %q for --port", fmt.Sprintf("%d", port)))
 		os.Exit(1)
@@ -140,6 +407,10 @@ func main() {
 		printError(fmt.Errorf("invalid value %q for --allow-ip", allowIPs))
 		os.Exit(1)
 	}
+	if !allowProvided && strings.TrimSpace(publicURL) != "" {
+		// Relayed clients connect from anywhere; auth is what protects them.
+		allowIPs = "*"
+	}
 	allowList, err := parseHostList(allowIPs, "--allow-ip")
 	if err != nil {
 		printError(err)
@@ -164,14 +435,46 @@ func main() {
 		os.Exit(1)
 	}
 
+	if strings.TrimSpace(confine) != "" {
+		confine, err = filepath.Abs(confine)
+		if err != nil {
+			printError(fmt.Errorf("invalid value %q for --confine: %v", confine, err))
+			os.Exit(1)
+		}
+	}
+
 	workDir, err := resolveWorkDir(cwd, cwdProvided)
 	if err != nil {
 		printError(err)
 		os.Exit(1)
 	}
+	if confine != "" && !cwdProvided {
+		workDir = confine
+	}
+
+	if strings.TrimSpace(logInput) != "" {
+		logInput, err = filepath.Abs(logInput)
+		if err != nil {
+			printError(fmt.Errorf("invalid value %q for --log-input: %v", logInput, err))
+			os.Exit(1)
+		}
+	}
+	if flagPresent(canonical, "log-max-files") && logMaxN < 1 {
+		printError(fmt.Errorf("invalid value %q for --log-max-files (expected at least 1)", fmt.Sprintf("%d", logMaxN)))
+		os.Exit(1)
+	}
+	if strings.TrimSpace(logOutput) != "" {
+		logOutput, err = filepath.Abs(logOutput)
+		if err != nil {
+			printError(fmt.Errorf("invalid value %q for --log-output: %v", logOutput, err))
+			os.Exit(1)
+		}
+	}
 
 	cfg := app.Config{
 		Alias:     alias,
+		Accent:    accent,
+		MOTD:      motd,
 		Port:      port,
 		Origins:   binds,
 		AllowIPs:  allowList,
@@ -182,17 +485,104 @@ func main() {
 		WorkDir:   workDir,
 		Shell:     shell,
 		Visible:   visible,
+		QR:        showQR,
+		QRCreds:   qrCreds,
+		WebRoot:   webRoot,
+		Clipboard: clipboard,
+		OSC52:     osc52,
+		Resize:    resize,
+		Paste:     paste,
+
+		SlowClientPolicy: slowMode,
+		ReadBufferSize:   readSize,
+		OutputQueueDepth: queueSize,
+		DebugPprof:       debugProf,
+		MaxBuffered:      maxBuf,
+		MaxConnsPerIP:    maxConns,
+		ReadTimeout:      readTO,
+		WriteTimeout:     writeTO,
+		WSWriteTimeout:   wsWriteTO,
+		SharePublic:      publicURL,
+		Tunnel:           tunnelVia,
+		SSHPort:          sshPort,
+		SSHHostKey:       sshKey,
+		BoardPort:        boardPort,
+		Proxy:            proxyURL,
+		UDPPort:          udpPort,
+		Tmux:             tmuxName,
+		TitlePrefix:      titlePfx,
+		Container:        container,
+		LogInput:         logInput,
+		LogOutput:        logOutput,
+		LogOutputFormat:  logOutFmt,
+		LogMaxSize:       logMaxSz,
+		LogMaxAge:        logMaxAge,
+		LogMaxFiles:      logMaxN,
+		NoIPAlerts:       noIPAlert,
+		NoSnapshot:       noReplay,
+		AlertWebhook:     alertHook,
+		AlertEmail:       alertMail,
+		AlertSMTP:        alertSMTP,
+		BellWebhook:      bellHook,
+		SetuidUser:       setuidUsr,
+		Confine:          confine,
+		LimitCPU:         limitCPU,
+		LimitMem:         limitMem,
+		LimitPIDs:        limitPIDs,
+		AllowCommands:    allowCmds,
+		DenyCommands:     denyCmds,
+		AuthFile:         authFile,
+		SnippetsFile:     snippets,
+		ResetWait:        resetWait,
+		ResetSudo:        resetSudo,
+		ResetPolicy:      resetBy,
+		AllowIPDNS:       allowDNS,
+	}
+
+	if session != "" && !share {
+		printError(errors.New("--session requires --share"))
+		os.Exit(1)
+	}
+	if shareFg {
+		if share || daemon {
+			printError(errors.New("--share-foreground cannot be used with --share or --daemon"))
+			os.Exit(1)
+		}
+		if err := runShareForeground(cfg); err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		return
 	}
 
 	if share {
-		if err := runShare(cfg, canonical, workDir, cwdProvided); err != nil {
+		if err := runShare(cfg, session, canonical, workDir, cwdProvided); err != nil {
 			printError(err)
 			os.Exit(1)
 		}
 		return
 	}
 
+	debugToken := ""
+	if debugProf {
+		token, err := newOwnerToken()
+		if err != nil {
+			printError(err)
+			os.Exit(1)
+		}
+		debugToken = token
+		_ = os.Setenv(debugTokenEnv, debugToken)
+	}
+
+	if flagPresent(canonical, "daemon-restart") && !daemon {
+		printError(errors.New("--daemon-restart requires --daemon"))
+		os.Exit(1)
+	}
 	if daemon {
+		if strings.TrimSpace(tunnelVia) != "" {
+			printError(errors.New("--tunnel cannot be used with --daemon (the public URL is only known to the running server)"))
+			os.Exit(1)
+		}
 		if err := app.Validate(cfg); err != nil {
 			printError(err)
 			os.Exit(1)
@@ -205,12 +595,18 @@ func main() {
 		}
 		auth := app.BuildAuthConfig(cfg)
 		lines := app.StartupLines(app.StartupInfo{
-			WorkDir: cfg.WorkDir,
-			Port:    cfg.Port,
-			Origins: cfg.Origins,
-			Auth:    auth,
-			PID:     pid,
-			Daemon:  true,
+			WorkDir:   cfg.WorkDir,
+			Port:      cfg.Port,
+			Origins:   cfg.Origins,
+			Auth:      auth,
+			PID:       pid,
+			Daemon:    true,
+			QR:        cfg.QR,
+			SSHPort:   cfg.SSHPort,
+			BoardPort: cfg.BoardPort,
+
+			PprofToken: debugToken,
+			InputLog:   strings.TrimSpace(cfg.LogInput),
 		})
 		for _, line := range lines {
 			fmt.Println(line)
@@ -225,9 +621,13 @@ func main() {
 }
 
 func normalizeArgs(args []string) ([]string, []string, error) {
+	return normalizeArgsWith(allSpecs(), args)
+}
+
+func normalizeArgsWith(specs []flagSpec, args []string) ([]string, []string, error) {
 	longMap := map[string]flagSpec{}
 	shortMap := map[string]flagSpec{}
-	for _, spec := range allSpecs() {
+	for _, spec := range specs {
 		longMap[spec.Long] = spec
 		if spec.Short != "" {
 			shortMap[spec.Short] = spec
@@ -289,27 +689,103 @@ func normalizeArgs(args []string) ([]string, []string, error) {
 
 func printHelp() {
 	binary := filepath.Base(os.Args[0])
-	fmt.Printf("Usage:\n  %s [options]\n\n", binary)
+	fmt.Printf("Usage:\n  %s [options]\n  %s hub [hub options]\n  %s connect [connect options] <url>\n  %s attach [attach options]\n  %s upgrade [upgrade options]\n  %s handover [handover options]\n  %s diag [diag options] [url]\n\n", binary, binary, binary, binary, binary, binary, binary)
 	fmt.Println("Options:")
 	fmt.Println("  -h, --help             Show help and exit.")
 	fmt.Println("  -a, --alias=<alias>    Override the browser title host label.")
+	fmt.Println("  --accent=<color>       Accent color of the web client, #rgb or #rrggbb.")
+	fmt.Println("  --motd=<text>          Message of the day shown to clients when they connect.")
+	fmt.Println("  --alert-webhook=<url>  POST a JSON alert to <url> when a client connects from a new address.")
+	fmt.Println("  --alert-email=<addr>   Email <addr> when a client connects from a new address (requires --alert-smtp).")
+	fmt.Println("  --alert-smtp=<host:port>  SMTP server for --alert-email (credentials from ALICES_MIRROR_SMTP_USER/PASSWORD).")
+	fmt.Println("  --bell-webhook=<url>   POST a JSON notice to <url> when the shell rings the bell (at most every 30s).")
+	fmt.Println("  --auth-file=<file>     More Basic Auth accounts, one user:password (or bcrypt hash) per line.")
+	fmt.Println("  --snippets=<file>      JSON file of commands clients can run from the Run menu; kept up to date by /api/snippets.")
+	fmt.Println("  --clipboard=<policy>   Who may use the host clipboard API: owner, interact or off (default owner).")
+	fmt.Println("  --osc52-clipboard      Copy text that programs in the shell send with OSC 52 to the host clipboard.")
+	fmt.Println("  --resize=<policy>      Who may resize the terminal: interact (owner and level 0) or owner (default interact).")
+	fmt.Println("  --paste-confirm=<mode> Who confirms multi-line or large pastes from viewers: client, owner or off (default client).")
+	fmt.Println("  --confine=<dir>        Confine the shell to <dir> with bubblewrap, Landlock or chroot (starts there unless --cwd is given).")
+	fmt.Println("  --container=<name>     Run the shell inside a running Docker or Podman container (engine from DOCKER_HOST).")
 	fmt.Println("  -cw, --cwd=<path>      Start the shell in the specified working directory.")
+	fmt.Println("  --bench                Measure output throughput with synthetic output and exit.")
+	fmt.Println("  --bench-clients=<n>    Simulated viewers for --bench (default 8).")
+	fmt.Println("  --board=<port>         Also serve a watch-only view without a password on <port>, e.g. for a wall screen (default off).")
 	fmt.Println("  -d, --daemon           Run the server in the background.")
-	fmt.Println("  -s, --share            Share this terminal session (starts server in background).")
+	fmt.Println("  --debug-pprof          Serve Go profiling endpoints at /debug/pprof/ behind a startup token.")
+	fmt.Println("  -s, --share            Share this terminal session (starts server in background; Ctrl+\\ d detaches, see attach).")
+	fmt.Println("  --share-foreground     Share this terminal session from this process, without a background server.")
+	fmt.Println("  --session=<name>       With --share, name the session so 'attach --session=<name>' finds it.")
+	fmt.Println("  --share-public=<url>   Register with a relay at <url> and print a public URL (requires --user and --password).")
+	fmt.Println("                          Allows all client IPs unless --allow-ip is given.")
 	fmt.Printf("  -b, --bind=<list>      Bind to comma-separated IPs/hosts (default %s).\n", defaultBindList)
 	fmt.Printf("  -al, --allow-ip=<list> Allow only matching client IPs (default %s).\n", defaultAllowIPList)
 	fmt.Println("                          Alias: --allow-ips.")
 	fmt.Println("                          Patterns support '*' wildcard.")
+	fmt.Println("  --allow-ip-dns         Also match --allow-ip against clients' (forward-confirmed) DNS and mDNS names.")
+	fmt.Println("  --allow-commands=<list>  Only let clients other than the owner run commands matching these patterns.")
+	fmt.Println("  --deny-commands=<list>   Refuse commands matching these patterns from clients other than the owner.")
+	fmt.Println("                          Patterns are comma-separated, e.g. 'rm,shutdown,curl*|*sh'; '*' is a wildcard.")
+	fmt.Println("  --no-ip-alerts         Do not track client addresses or alert about new ones.")
+	fmt.Println("  --no-snapshot          Start viewers on a blank terminal instead of replaying earlier output.")
 	fmt.Println("  -o, --origin=<list>    Deprecated alias for --bind.")
 	fmt.Printf("  -ul, --user-level=<rules>  Per-IP authorization levels (default %s).\n", defaultUserLevel)
-	fmt.Println("                          Format: <pattern>-<level>[,...] where level 0=interact, 1=watch-only.")
+	fmt.Println("                          Format: <pattern>-<level>[,...] where level 0=interact, 1=watch-only,")
+	fmt.Println("                          2=interact with approval by the owner or a level 0 client.")
+	fmt.Println("                          user:<name>-<level> rules match the Basic Auth user and take precedence over IP rules.")
+	fmt.Println("                          Append @<duration> (e.g. *-0@2h) to drop to watch-only after that long, or @<duration>! to disconnect.")
 	fmt.Println("                          Patterns support '*' wildcard. First match wins. Unmatched IPs default to level 0 with a warning.")
 	fmt.Println("  -P, --password=<password>  Set Basic Auth password (requires --user).")
+	fmt.Println("  --limit-cpu=<cpus>     Cap the shell and its children at this many CPUs, e.g. 0.5 (default no limit).")
+	fmt.Println("  --limit-mem=<size>     Cap their memory, e.g. 512M (default no limit).")
+	fmt.Println("  --limit-pids=<n>       Cap how many processes they may run at once (default no limit).")
+	fmt.Println("  --log-input=<path>     Record every keystroke sent to the shell, with the client that typed it, to <path> (JSON lines).")
+	fmt.Println("  --log-level=<level>    Log level: debug, info, warn or error (default info).")
+	fmt.Println("  --log-format=<format>  Log format: text or json (default text).")
+	fmt.Println("  --log-dest=<dest>      Where logs go: stderr (default), syslog or journald.")
+	fmt.Println("  --log-output=<path>    Append all terminal output to <path>.")
+	fmt.Println("  --log-output-format=<raw|text>  Write --log-output as received (default raw) or with escape sequences stripped.")
+	fmt.Println("  --log-max-size=<size>  Rotate --log-input and --log-output at this size (default 16M, 0 = no limit).")
+	fmt.Println("  --log-max-age=<dur>    Also rotate them once this old, e.g. 24h (default no limit).")
+	fmt.Println("  --log-max-files=<n>    Rotated files kept per log (default 5).")
+	fmt.Println("  --read-timeout=<dur>   Longest time to read an HTTP request, uploads included (default 0, no limit).")
+	fmt.Println("  --write-timeout=<dur>  Longest time to write an HTTP response; streams are bounded per write (default 1m, 0 = no limit).")
+	fmt.Println("  --ws-write-timeout=<dur>  Disconnect a WebSocket or event stream client when one write takes this long (default 10s).")
+	fmt.Println("  --max-buffered=<size>  Output buffered for all clients before the slowest are disconnected (default 64M, 0 = no cap).")
+	fmt.Println("  --max-conns-per-ip=<n> Requests and connections open at once from one address (default 0 = no cap).")
+	fmt.Printf("  --output-queue=<n>     Output chunks buffered between the shell and the server (default %d).\n", terminal.DefaultOutputQueueDepth)
 	fmt.Println("  -p, --port=<port>      Listen on port <port> (default 3002).")
+	fmt.Println("  --proxy=<url>          Proxy for outbound connections, http:// or socks5:// (default from HTTP_PROXY/HTTPS_PROXY/ALL_PROXY).")
+	fmt.Println("  --qr                   Print a QR code of the connection URL on startup.")
+	fmt.Println("  --qr-credentials       Put the Basic Auth login in the /api/qr images requested with the owner token.")
+	fmt.Println("  --reset-wait=<dur>     How long a reset waits after SIGTERM, then SIGKILL, before escalating (default 700ms).")
+	fmt.Println("  --reset-policy=<policy>  Who may reset the shell: owner, interact (owner and level 0) or any (default interact).")
+	fmt.Println("  --reset-sudo           Let a reset end processes that survive SIGKILL with sudo -n kill -9 (Unix).")
+	fmt.Printf("  --read-buffer=<bytes>  Size of each read from the shell (default %d).\n", terminal.DefaultReadBufferSize)
+	fmt.Printf("  --relay-listen=<addr>  Run a relay for --share-public on <addr> instead of a mirror (token from %s).\n", relayTokenEnv)
+	fmt.Println("  --setuid-user=<user>   When started as root, switch to <user> once the ports are bound and run the shell as <user>.")
+	fmt.Println("  --slow-client-policy=<policy>  What to do when a viewer falls behind: drop, coalesce or disconnect (default drop).")
+	fmt.Println("  --ssh-host-key=<path>  SSH host key file, created if missing (default in the user config directory).")
+	fmt.Println("  --ssh-port=<port>      Also accept ssh clients on <port>, e.g. ssh -p <port> mirror@host (default off).")
+	fmt.Printf("  --title-prefix=<text>  Start the shell's window titles with <text> (default from %s, else alices-mirror).\n", titlePrefixEnv)
+	fmt.Println("  --tmux=<session>       Mirror an existing tmux session instead of starting a shell.")
+	fmt.Println("  --tunnel=<provider>    Expose the server through ngrok or cloudflared and print the public URL (requires --user and --password).")
+	fmt.Println("  --udp-port=<port>      Offer the UDP transport for 'connect --udp' on <port> (default off).")
 	fmt.Println("  -vi, --visible         Advertise the server on the LAN for discovery.")
+	fmt.Println("  --web-root=<dir>       Serve files from <dir> before the built-in web assets.")
 	printPlatformHelp()
 	fmt.Println("  -u, --user=<user>      Set Basic Auth user (requires --password).")
 	fmt.Println("  -y, --yolo             Disable auth entirely when present.")
+	fmt.Println()
+	printHubHelp()
+	fmt.Println()
+	printConnectHelp()
+	fmt.Println()
+	printAttachHelp()
+	fmt.Println()
+	printUpgradeHelp()
+	fmt.Println()
+	printHandoverHelp()
 }
 
 func resolveWorkDir(cwd string, cwdProvided bool) (string, error) {
@@ -327,7 +803,13 @@ func resolveWorkDir(cwd string, cwdProvided bool) (string, error) {
 	if filepath.IsAbs(trimmed) {
 		return filepath.Clean(trimmed), nil
 	}
-	return filepath.Clean(filepath.Join(baseDir, trimmed)), nil
+	// Abs also resolves Windows paths that are rooted or carry a drive but
+	// are not absolute, such as \src and D:src.
+	abs, err := filepath.Abs(trimmed)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve working directory %q: %v", trimmed, err)
+	}
+	return abs, nil
 }
 
 func daemonArgs(canonical []string, workDir string, cwdProvided bool) []string {
@@ -6,10 +6,13 @@ import (
 	"flag"
 	"fmt"
 	"strings"
+
+	"alices-mirror/internal/terminal"
 )
 
 func platformSpecs() []flagSpec {
 	return []flagSpec{
+		{Long: "daemon-restart", Short: "", ExpectsValue: false, IsBool: true},
 		{Long: "shell", Short: "S", ExpectsValue: true, IsBool: false},
 	}
 }
@@ -20,21 +23,26 @@ func defaultPlatformShell() string {
 
 func registerPlatformFlags(fs *flag.FlagSet, shell *string) {
 	fs.StringVar(shell, "shell", "powershell", "")
+	// Read by the daemon supervisor from the arguments it is started with.
+	fs.Bool("daemon-restart", false, "")
 }
 
 func normalizePlatformShell(shell string) (string, error) {
-	cleaned := strings.ToLower(strings.TrimSpace(shell))
+	cleaned := strings.TrimSpace(shell)
 	if cleaned == "" {
 		cleaned = "powershell"
 	}
-	switch cleaned {
+	switch lower := strings.ToLower(cleaned); lower {
 	case "powershell", "cmd":
-		return cleaned, nil
-	default:
-		return "", fmt.Errorf("invalid value %q for --shell (allowed: powershell, cmd)", shell)
+		return lower, nil
+	}
+	if err := terminal.CheckWindowsShell(cleaned); err != nil {
+		return "", fmt.Errorf("invalid value %q for --shell (allowed: powershell, cmd, or an absolute path to an executable): %v", shell, err)
 	}
+	return cleaned, nil
 }
 
 func printPlatformHelp() {
-	fmt.Println("  -S, --shell=<shell>    Select Windows shell (powershell or cmd).")
+	fmt.Println("  --daemon-restart       With --daemon, start the server again with backoff when it exits with an error.")
+	fmt.Println("  -S, --shell=<shell>    Select Windows shell: powershell, cmd, or an absolute path to an executable with arguments.")
 }
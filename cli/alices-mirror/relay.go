@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"alices-mirror/internal/tunnel"
+)
+
+// relayTokenEnv holds the token mirrors must present to a relay started
+// with --relay-listen.
+const relayTokenEnv = "ALICES_MIRROR_RELAY_TOKEN"
+
+// runRelay serves the public side of --share-public on addr until the
+// process is stopped.
+func runRelay(addr string) error {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return fmt.Errorf("invalid value %q for --relay-listen", addr)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid value %q for --relay-listen: %v", addr, err)
+	}
+
+	token := strings.TrimSpace(os.Getenv(relayTokenEnv))
+	if token == "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s is not set; any mirror may register with this relay.\n", relayTokenEnv)
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           tunnel.NewRelay(tunnel.RelayConfig{Token: token}),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	fmt.Printf("alices mirror relay is listening on %s.\n", addr)
+	fmt.Println("Point a wildcard DNS record at this host and terminate TLS in front of it.")
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/term"
@@ -21,31 +22,59 @@ import (
 	"github.com/gorilla/websocket"
 
 	"alices-mirror/internal/app"
+	"alices-mirror/internal/protocol"
+	"alices-mirror/internal/proxy"
 	"alices-mirror/internal/server"
 )
 
 const (
 	shareOwnerTokenEnv = "ALICES_MIRROR_OWNER_TOKEN"
 	titlePrefixEnv     = "ALICES_MIRROR_TITLE_PREFIX"
+	debugTokenEnv      = "ALICES_MIRROR_DEBUG_TOKEN"
+
+	// ownerReconnectTimeout is how long the share client tries to get its
+	// connection back; the server waits somewhat longer for it.
+	ownerReconnectTimeout = 20 * time.Second
 )
 
-func runShare(cfg app.Config, canonical []string, workDir string, cwdProvided bool) error {
+// runShare shares this terminal through a daemon. A session name, if any,
+// is how attach finds it instead of by port.
+func runShare(cfg app.Config, session string, canonical []string, workDir string, cwdProvided bool) error {
 	if err := app.Validate(cfg); err != nil {
 		return err
 	}
+	if session != "" {
+		if err := checkSessionName(session); err != nil {
+			return fmt.Errorf("invalid value %q for --session: %v", session, err)
+		}
+	}
+	target := shareTarget{port: cfg.Port, session: session}
 
 	ownerToken, err := newOwnerToken()
 	if err != nil {
 		return err
 	}
 
-	titlePrefix := fmt.Sprintf("alices-mirror(shared:%d)", cfg.Port)
+	titlePrefix := strings.TrimSpace(cfg.TitlePrefix)
+	if titlePrefix == "" && session != "" {
+		titlePrefix = fmt.Sprintf("alices-mirror(shared:%s)", session)
+	} else if titlePrefix == "" {
+		titlePrefix = fmt.Sprintf("alices-mirror(shared:%d)", cfg.Port)
+	}
 	args := shareDaemonArgs(canonical, workDir, cwdProvided)
 
-	restoreEnv, err := withEnv(map[string]string{
+	env := map[string]string{
 		shareOwnerTokenEnv: ownerToken,
 		titlePrefixEnv:     titlePrefix,
-	})
+	}
+	debugToken := ""
+	if cfg.DebugPprof {
+		if debugToken, err = newOwnerToken(); err != nil {
+			return err
+		}
+		env[debugTokenEnv] = debugToken
+	}
+	restoreEnv, err := withEnv(env)
 	if err != nil {
 		return err
 	}
@@ -56,22 +85,68 @@ func runShare(cfg app.Config, canonical []string, workDir string, cwdProvided bo
 	}
 
 	auth := app.BuildAuthConfig(cfg)
-	lines := app.StartupLines(app.StartupInfo{
+	info := app.StartupInfo{
 		WorkDir: cfg.WorkDir,
 		Port:    cfg.Port,
 		Origins: cfg.Origins,
 		Auth:    auth,
 		PID:     pid,
 		Daemon:  true,
-	})
+		QR:      cfg.QR,
+		SSHPort: cfg.SSHPort,
+
+		InputLog: strings.TrimSpace(cfg.LogInput),
+	}
+	if cfg.DebugPprof {
+		info.PprofToken = debugToken
+	}
+
+	// The tunnel agent lives as long as this attached terminal, which is
+	// also how long the shared server lives.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if strings.TrimSpace(cfg.Tunnel) != "" {
+		info.PublicURL, err = app.StartTunnel(ctx, cfg)
+		if err != nil {
+			_ = killProcess(pid)
+			return err
+		}
+	}
+	lines := app.StartupLines(info)
 	for _, line := range lines {
 		fmt.Println(line)
 	}
+	// Detaching would stop the tunnel agent with this process.
+	detachable := strings.TrimSpace(cfg.Tunnel) == ""
 	fmt.Printf("This terminal is now attached to the shared shell (port %d).\n", cfg.Port)
 	fmt.Println("Close the shell (exit / Ctrl+D) to stop the server.")
+	if detachable {
+		fmt.Println("Press Ctrl+\\ then d to detach and leave it running for the viewers.")
+	}
 	fmt.Println()
 
-	if err := attachOwnerShell(cfg, ownerToken); err != nil {
+	state, err := newShareState(cfg, ownerToken)
+	if err != nil {
+		_ = killProcess(pid)
+		return err
+	}
+	if detachable {
+		if err := writeShareState(target, state); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot save the session for attach: %v\n", err)
+		}
+	}
+	proxyFunc, err := proxy.Func(cfg.Proxy)
+	if err != nil {
+		_ = killProcess(pid)
+		return fmt.Errorf("invalid value %q for --proxy: %v", cfg.Proxy, err)
+	}
+	err = attachOwnerShell(state, proxyFunc, detachable)
+	if errors.Is(err, errDetached) {
+		printDetached(target)
+		return nil
+	}
+	removeShareState(target)
+	if err != nil {
 		_ = killProcess(pid)
 		return err
 	}
@@ -79,11 +154,32 @@ func runShare(cfg app.Config, canonical []string, workDir string, cwdProvided bo
 	return nil
 }
 
+// runShareForeground shares this terminal like runShare, but runs the server
+// in this process and attaches the terminal to it directly.
+func runShareForeground(cfg app.Config) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("--share-foreground requires an interactive terminal on stdin")
+	}
+	if strings.TrimSpace(cfg.TitlePrefix) == "" {
+		cfg.TitlePrefix = fmt.Sprintf("alices-mirror(shared:%d)", cfg.Port)
+	}
+	cfg.AttachOwner = func(srv *server.Server) error {
+		// As with --share, only the prompt is worth replaying.
+		conn := srv.ConnectOwner(4 << 10)
+		defer conn.Close()
+		fmt.Printf("This terminal is now attached to the shared shell (port %d).\n", cfg.Port)
+		fmt.Println("Close the shell (exit / Ctrl+D) to stop the server.")
+		fmt.Println()
+		return runTerminal(conn)
+	}
+	return app.Run(cfg)
+}
+
 func shareDaemonArgs(canonical []string, workDir string, cwdProvided bool) []string {
 	args := daemonArgs(canonical, workDir, cwdProvided)
 	out := make([]string, 0, len(args))
 	for _, arg := range args {
-		if arg == "--share" {
+		if arg == "--share" || strings.HasPrefix(arg, "--tunnel=") || strings.HasPrefix(arg, "--session=") {
 			continue
 		}
 		out = append(out, arg)
@@ -91,50 +187,125 @@ func shareDaemonArgs(canonical []string, workDir string, cwdProvided bool) []str
 	return out
 }
 
-func attachOwnerShell(cfg app.Config, ownerToken string) error {
-	fd := int(os.Stdin.Fd())
-	if !term.IsTerminal(fd) {
-		return errors.New("--share requires an interactive terminal on stdin")
-	}
-
+// newShareState returns how the owner terminal reaches the daemon started
+// for cfg.
+func newShareState(cfg app.Config, ownerToken string) (shareState, error) {
 	binds := server.ExpandBindPatterns(cfg.Origins)
 	if len(binds) == 0 {
 		binds = cfg.Origins
 	}
-	ownerURL, err := buildOwnerWSURL(binds, cfg.Port, ownerToken)
+	// The owner's terminal is fresh; only the prompt is worth replaying.
+	// After a reconnect the terminal already shows everything but what
+	// was missed meanwhile.
+	ownerURL, err := buildOwnerWSURL(binds, cfg.Port, ownerToken, "4k")
 	if err != nil {
-		return err
+		return shareState{}, err
 	}
-
-	header := http.Header{}
+	resumeURL, err := buildOwnerWSURL(binds, cfg.Port, ownerToken, "0")
+	if err != nil {
+		return shareState{}, err
+	}
+	state := shareState{OwnerURL: ownerURL, ResumeURL: resumeURL}
 	auth := app.BuildAuthConfig(cfg)
 	if auth.Enabled {
-		header.Set("Authorization", basicAuthHeader(auth.User, auth.Password))
+		state.Authorization = basicAuthHeader(auth.User, auth.Password)
+	}
+	return state, nil
+}
+
+// attachOwnerShell attaches this terminal to the shared shell as its owner
+// and keeps it attached across network blips. It returns errDetached when
+// the owner detached.
+func attachOwnerShell(state shareState, proxyFunc func(*http.Request) (*url.URL, error), detachable bool) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("--share requires an interactive terminal on stdin")
+	}
+
+	header := http.Header{}
+	if state.Authorization != "" {
+		header.Set("Authorization", state.Authorization)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
 	defer cancel()
 
-	conn, err := dialWebsocketWithRetry(ctx, ownerURL, header)
+	conn, err := dialWebsocketWithRetry(ctx, state.OwnerURL, header, proxyFunc)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer func() { _ = conn.Close() }()
+
+	return runReconnectingTerminal(conn, func(lost error) (messageConn, error) {
+		_ = conn.Close()
+		if websocket.IsCloseError(lost, websocket.CloseGoingAway) {
+			return nil, nil
+		}
+		if websocket.IsCloseError(lost, websocket.CloseServiceRestart) {
+			fmt.Print("\r\n[alices-mirror: server restarting, reconnecting]\r\n")
+		} else {
+			fmt.Print("\r\n[alices-mirror: connection to the shared shell lost, reconnecting]\r\n")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), ownerReconnectTimeout)
+		defer cancel()
+		next, err := dialWebsocketWithRetry(ctx, state.ResumeURL, header, proxyFunc)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Print("[alices-mirror: reconnected]\r\n")
+		conn = next
+		return next, nil
+	}, detachable)
+}
+
+// messageConn is a message-oriented connection to a mirror: a WebSocket or
+// the datagram transport.
+type messageConn interface {
+	ReadMessage() (int, []byte, error)
+	WriteMessage(messageType int, data []byte) error
+}
 
+// runTerminal puts the local terminal in raw mode and connects it to conn
+// until the connection closes.
+func runTerminal(conn messageConn) error {
+	return runReconnectingTerminal(conn, nil, false)
+}
+
+// runReconnectingTerminal is runTerminal that, when the connection is lost,
+// carries on with the one redial returns. It stops when redial returns no
+// connection. When detachable, the detach keys make it tell the server and
+// return errDetached.
+func runReconnectingTerminal(conn messageConn, redial func(lost error) (messageConn, error), detachable bool) error {
+	fd := int(os.Stdin.Fd())
 	prevState, err := term.MakeRaw(fd)
 	if err != nil {
 		return fmt.Errorf("failed to set terminal raw mode: %v", err)
 	}
 	defer term.Restore(fd, prevState)
 
-	writer := &wsWriter{conn: conn}
+	writer := &messageWriter{conn: conn}
+	title := &viewerTitle{}
 
+	var detached atomic.Bool
 	go func() {
+		var keys detachKeys
 		buf := make([]byte, 4096)
 		for {
 			n, readErr := os.Stdin.Read(buf)
 			if n > 0 {
-				if writeErr := writer.WriteBinary(buf[:n]); writeErr != nil {
+				input, detach := buf[:n], false
+				if detachable {
+					input, detach = keys.filter(input)
+				}
+				// Input typed while reconnecting is dropped.
+				if len(input) > 0 {
+					if writeErr := writer.WriteBinary(input); writeErr != nil && redial == nil {
+						return
+					}
+				}
+				if detach {
+					detached.Store(true)
+					_ = writer.WriteControl(protocol.Detach{})
 					return
 				}
 			}
@@ -151,56 +322,77 @@ func attachOwnerShell(cfg app.Config, ownerToken string) error {
 	for {
 		messageType, payload, readErr := conn.ReadMessage()
 		if readErr != nil {
-			return nil
+			if detached.Load() {
+				return errDetached
+			}
+			if redial == nil {
+				return nil
+			}
+			next, err := redial(readErr)
+			if err != nil || next == nil {
+				return err
+			}
+			conn = next
+			writer.swap(next)
+			continue
 		}
 		switch messageType {
 		case websocket.BinaryMessage:
-			_, _ = os.Stdout.Write(payload)
+			_, _ = os.Stdout.Write(title.output(payload))
 		case websocket.TextMessage:
-			// Intentionally ignore control/status messages to avoid corrupting the interactive display.
+			// Other control/status messages are ignored to avoid corrupting
+			// the interactive display; the viewer count only goes in the
+			// window title.
+			if seq := title.control(payload); seq != nil {
+				_, _ = os.Stdout.Write(seq)
+			}
 		}
 	}
 }
 
-type wsWriter struct {
+type messageWriter struct {
 	mu   sync.Mutex
-	conn *websocket.Conn
+	conn messageConn
 }
 
-func (w *wsWriter) WriteBinary(p []byte) error {
+// swap makes the writer send on conn from now on.
+func (w *messageWriter) swap(conn messageConn) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.conn.WriteMessage(websocket.BinaryMessage, p)
+	w.conn = conn
 }
 
-func (w *wsWriter) WriteJSON(v any) error {
+func (w *messageWriter) WriteBinary(p []byte) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.conn.WriteJSON(v)
+	return w.conn.WriteMessage(websocket.BinaryMessage, p)
 }
 
-func sendResizeLoop(writer *wsWriter) {
-	type controlMessage struct {
-		Type string `json:"type"`
-		Cols int    `json:"cols"`
-		Rows int    `json:"rows"`
-	}
+func (w *messageWriter) WriteControl(msg protocol.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.conn.WriteMessage(websocket.TextMessage, protocol.Encode(msg))
+}
 
+func sendResizeLoop(writer *messageWriter) {
 	lastCols := -1
 	lastRows := -1
 
 	for {
 		cols, rows, err := term.GetSize(int(os.Stdout.Fd()))
 		if err == nil && cols > 0 && rows > 0 && (cols != lastCols || rows != lastRows) {
-			_ = writer.WriteJSON(controlMessage{Type: "resize", Cols: cols, Rows: rows})
-			lastCols = cols
-			lastRows = rows
+			// A size that could not be sent is tried again, so a resize
+			// made while reconnecting still reaches the shell.
+			if writer.WriteControl(protocol.Resize{Cols: cols, Rows: rows}) == nil {
+				lastCols = cols
+				lastRows = rows
+			}
 		}
 		time.Sleep(250 * time.Millisecond)
 	}
 }
 
-func buildOwnerWSURL(origins []string, port int, ownerToken string) (string, error) {
+func buildOwnerWSURL(origins []string, port int, ownerToken, snapshot string) (string, error) {
 	host := chooseLocalHost(origins)
 	if host == "" {
 		return "", errors.New("no origin host available for owner connection")
@@ -214,6 +406,7 @@ func buildOwnerWSURL(origins []string, port int, ownerToken string) (string, err
 	}
 	q := u.Query()
 	q.Set("token", ownerToken)
+	q.Set("snapshot", snapshot)
 	u.RawQuery = q.Encode()
 	return u.String(), nil
 }
@@ -251,15 +444,22 @@ func chooseLocalHost(origins []string) string {
 	return first
 }
 
-func dialWebsocketWithRetry(ctx context.Context, wsURL string, header http.Header) (*websocket.Conn, error) {
+func dialWebsocketWithRetry(ctx context.Context, wsURL string, header http.Header, proxyFunc func(*http.Request) (*url.URL, error)) (*websocket.Conn, error) {
 	deadline, hasDeadline := ctx.Deadline()
 	backoff := 150 * time.Millisecond
 
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{protocol.Subprotocol}
+	dialer.Proxy = proxyFunc
+
 	for {
-		conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+		conn, resp, err := dialer.Dial(wsURL, header)
 		if err == nil {
 			return conn, nil
 		}
+		if resp != nil && resp.StatusCode == http.StatusUpgradeRequired {
+			return nil, fmt.Errorf("owner session speaks an incompatible protocol (want %s)", protocol.Subprotocol)
+		}
 		if ctx.Err() != nil {
 			if hasDeadline && time.Now().After(deadline) {
 				return nil, fmt.Errorf("failed to connect to owner session: %v", err)
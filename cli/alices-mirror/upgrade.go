@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const ownerAPITimeout = 30 * time.Second
+
+var upgradeSpecs = []flagSpec{
+	{Long: "help", Short: "h", ExpectsValue: false, IsBool: true},
+	{Long: "port", Short: "p", ExpectsValue: true, IsBool: false},
+	{Long: "session", Short: "", ExpectsValue: true, IsBool: false},
+}
+
+// runUpgrade asks a --share daemon to hand its shell and viewers over to a
+// new process started from the binary now installed.
+func runUpgrade(args []string) error {
+	canonical, positionals, err := normalizeArgsWith(upgradeSpecs, args)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("alices-mirror upgrade", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var (
+		help    bool
+		target  shareTarget
+		portSet bool
+	)
+	fs.BoolVar(&help, "help", false, "")
+	fs.IntVar(&target.port, "port", 3002, "")
+	fs.StringVar(&target.session, "session", "", "")
+	if err := fs.Parse(canonical); err != nil {
+		return err
+	}
+	if help {
+		printUpgradeHelp()
+		return nil
+	}
+	if len(positionals) > 0 {
+		return fmt.Errorf("unexpected argument %q", positionals[0])
+	}
+	fs.Visit(func(f *flag.Flag) {
+		portSet = portSet || f.Name == "port"
+	})
+	if target.session != "" {
+		if portSet {
+			return errors.New("--port cannot be used with --session")
+		}
+		if err := checkSessionName(target.session); err != nil {
+			return fmt.Errorf("invalid value %q for --session: %v", target.session, err)
+		}
+	}
+
+	state, err := readShareState(target)
+	if err != nil {
+		return err
+	}
+	if err := postOwnerAPI(state, "/api/upgrade", nil, nil); err != nil {
+		return err
+	}
+	fmt.Println("Upgrading: the new process is taking over the shared shell; connected terminals and browsers reconnect on their own.")
+	return nil
+}
+
+// postOwnerAPI posts body, as JSON unless nil, to path on the daemon
+// behind state with the owner token, and decodes the reply into out
+// unless nil.
+func postOwnerAPI(state shareState, path string, body, out any) error {
+	endpoint, err := ownerAPIURL(state.OwnerURL, path)
+	if err != nil {
+		return fmt.Errorf("invalid session file: %v", err)
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if state.Authorization != "" {
+		req.Header.Set("Authorization", state.Authorization)
+	}
+	resp, err := (&http.Client{Timeout: ownerAPITimeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if message := strings.TrimSpace(string(data)); message != "" {
+			return errors.New(message)
+		}
+		return errors.New(resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ownerAPIURL returns the URL of path on the daemon the owner reaches at
+// ownerURL, with the owner token.
+func ownerAPIURL(ownerURL, path string) (string, error) {
+	u, err := url.Parse(ownerURL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return "", fmt.Errorf("unexpected owner URL scheme %q", u.Scheme)
+	}
+	u.Path = path
+	u.RawQuery = url.Values{"token": {u.Query().Get("token")}}.Encode()
+	return u.String(), nil
+}
+
+func printUpgradeHelp() {
+	fmt.Println("Upgrade options (alices-mirror upgrade [options], Linux only):")
+	fmt.Println("  -h, --help             Show help and exit.")
+	fmt.Println("  -p, --port=<port>      Port of the --share session to upgrade (default 3002).")
+	fmt.Println("  --session=<name>       Name of the --share --session to upgrade.")
+}
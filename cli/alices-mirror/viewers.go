@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"alices-mirror/internal/protocol"
+)
+
+// titleSequence matches the OSC 0 and OSC 2 sequences that set the window
+// title, ended by BEL or ST.
+var titleSequence = regexp.MustCompile(`\x1b\][02];([^\x07\x1b]*)(\x07|\x1b\\)`)
+
+// viewerTitle keeps the owner's window title showing how many viewers are
+// watching. It remembers the last title the shell set and appends the count
+// to it, so the shell's own title is kept.
+type viewerTitle struct {
+	mu      sync.Mutex
+	title   string
+	viewers int
+}
+
+// output returns payload with the titles it sets carrying the viewer count.
+func (v *viewerTitle) output(payload []byte) []byte {
+	if !titleSequence.Match(payload) {
+		return payload
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return titleSequence.ReplaceAllFunc(payload, func(seq []byte) []byte {
+		v.title = string(titleSequence.FindSubmatch(seq)[1])
+		return []byte(v.sequenceLocked())
+	})
+}
+
+// control handles a text message from the server and returns the title
+// sequence to write when the viewer count changed.
+func (v *viewerTitle) control(payload []byte) []byte {
+	msg, _ := protocol.DecodeFromServer(payload)
+	viewers, ok := msg.(protocol.Viewers)
+	if !ok {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if viewers.Count == v.viewers {
+		return nil
+	}
+	v.viewers = viewers.Count
+	return []byte(v.sequenceLocked())
+}
+
+func (v *viewerTitle) sequenceLocked() string {
+	title := v.title
+	switch {
+	case v.viewers == 1:
+		title = withViewers(title, "1 viewer")
+	case v.viewers > 1:
+		title = withViewers(title, fmt.Sprintf("%d viewers", v.viewers))
+	}
+	return "\x1b]2;" + title + "\x07"
+}
+
+func withViewers(title, count string) string {
+	if title == "" {
+		return "alices-mirror (" + count + ")"
+	}
+	return title + " (" + count + ")"
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"alices-mirror/internal/proxy"
+)
+
+const alertTimeout = 10 * time.Second
+
+// bellWebhookInterval is the least time between two --bell-webhook posts,
+// so a program ringing in a loop does not flood the receiver.
+const bellWebhookInterval = 30 * time.Second
+
+// Environment variables with the SMTP credentials and sender for
+// --alert-email.
+const (
+	smtpUserEnv     = "ALICES_MIRROR_SMTP_USER"
+	smtpPasswordEnv = "ALICES_MIRROR_SMTP_PASSWORD"
+	smtpFromEnv     = "ALICES_MIRROR_SMTP_FROM"
+)
+
+// StateDir is where the mirror keeps state between runs.
+func StateDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the state directory: %v", err)
+	}
+	return filepath.Join(dir, "alices-mirror"), nil
+}
+
+func validateAlerts(cfg Config) error {
+	if raw := strings.TrimSpace(cfg.AlertWebhook); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid value %q for --alert-webhook (expected an http:// or https:// URL)", cfg.AlertWebhook)
+		}
+	}
+	if raw := strings.TrimSpace(cfg.BellWebhook); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid value %q for --bell-webhook (expected an http:// or https:// URL)", cfg.BellWebhook)
+		}
+	}
+	email := strings.TrimSpace(cfg.AlertEmail)
+	smtpAddr := strings.TrimSpace(cfg.AlertSMTP)
+	if email != "" && !strings.Contains(email, "@") {
+		return fmt.Errorf("invalid value %q for --alert-email", cfg.AlertEmail)
+	}
+	if email != "" && smtpAddr == "" {
+		return errors.New("--alert-email requires --alert-smtp")
+	}
+	if smtpAddr != "" {
+		if _, _, err := net.SplitHostPort(smtpAddr); err != nil {
+			return fmt.Errorf("invalid value %q for --alert-smtp (expected host:port)", cfg.AlertSMTP)
+		}
+	}
+	return nil
+}
+
+// newIPAlerter returns the OnNewIP callback that sends the configured
+// webhook and email alerts, or nil when there are none.
+func newIPAlerter(cfg Config, alias string) func(ip, transport string) {
+	webhook := strings.TrimSpace(cfg.AlertWebhook)
+	email := strings.TrimSpace(cfg.AlertEmail)
+	if webhook == "" && email == "" {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+	name := alias
+	if name == "" {
+		name = hostname
+	}
+	return func(ip, transport string) {
+		if webhook != "" {
+			if err := postAlert(webhook, cfg.Proxy, map[string]string{
+				"event":     "new-ip",
+				"ip":        ip,
+				"transport": transport,
+				"alias":     alias,
+				"hostname":  hostname,
+				"time":      time.Now().UTC().Format(time.RFC3339),
+			}); err != nil {
+				logger().Warn("new-device webhook failed", "error", err)
+			}
+		}
+		if email != "" {
+			subject := fmt.Sprintf("alices-mirror %s: new device %s", name, ip)
+			body := fmt.Sprintf("A device at %s connected to the mirror %q over %s for the first time, at %s.\r\n",
+				ip, name, transport, time.Now().Format(time.RFC1123))
+			if err := sendAlertEmail(cfg.AlertSMTP, email, subject, body); err != nil {
+				logger().Warn("new-device email failed", "error", err)
+			}
+		}
+	}
+}
+
+// newBellNotifier returns the OnBell callback that posts to --bell-webhook,
+// or nil when it is not set.
+func newBellNotifier(cfg Config, alias string) func() {
+	webhook := strings.TrimSpace(cfg.BellWebhook)
+	if webhook == "" {
+		return nil
+	}
+	hostname, _ := os.Hostname()
+	var mu sync.Mutex
+	var last time.Time
+	return func() {
+		mu.Lock()
+		now := time.Now()
+		if now.Sub(last) < bellWebhookInterval {
+			mu.Unlock()
+			return
+		}
+		last = now
+		mu.Unlock()
+		if err := postAlert(webhook, cfg.Proxy, map[string]string{
+			"event":    "bell",
+			"alias":    alias,
+			"hostname": hostname,
+			"time":     now.UTC().Format(time.RFC3339),
+		}); err != nil {
+			logger().Warn("bell webhook failed", "error", err)
+		}
+	}
+}
+
+func postAlert(target, proxyURL string, payload map[string]string) error {
+	proxyFunc, err := proxy.Func(proxyURL)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(payload)
+	client := &http.Client{Timeout: alertTimeout, Transport: &http.Transport{Proxy: proxyFunc}}
+	resp, err := client.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+func sendAlertEmail(addr, to, subject, body string) error {
+	host, _, _ := net.SplitHostPort(addr)
+	from := strings.TrimSpace(os.Getenv(smtpFromEnv))
+	if from == "" {
+		hostname, _ := os.Hostname()
+		from = "alices-mirror@" + hostname
+	}
+	var auth smtp.Auth
+	if user := os.Getenv(smtpUserEnv); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv(smtpPasswordEnv), host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s", from, to, subject, body)
+	return smtp.SendMail(addr, auth, from, []string{to}, []byte(msg))
+}
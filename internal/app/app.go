@@ -2,21 +2,43 @@ package app
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"golang.org/x/crypto/ssh"
+
+	"alices-mirror/internal/clipboard"
 	"alices-mirror/internal/discovery"
+	"alices-mirror/internal/logging"
+	"alices-mirror/internal/proxy"
+	"alices-mirror/internal/qr"
 	"alices-mirror/internal/server"
+	"alices-mirror/internal/telemetry"
 	"alices-mirror/internal/terminal"
+	"alices-mirror/internal/transcript"
+	"alices-mirror/internal/tunnel"
 )
 
 type Config struct {
 	Alias     string
+	Accent    string
+	MOTD      string
 	Port      int
 	Origins   []string
 	AllowIPs  []string
@@ -27,8 +49,169 @@ type Config struct {
 	WorkDir   string
 	Shell     string
 	Visible   bool
+	QR        bool
+	QRCreds   bool
+	WebRoot   string
+	Clipboard string
+	OSC52     bool
+	Resize    string
+	Paste     string
+
+	SlowClientPolicy string
+	ReadBufferSize   int
+	OutputQueueDepth int
+	DebugPprof       bool
+	MaxBuffered      string
+	MaxConnsPerIP    int
+
+	// SharePublic is the URL of a relay to register with so the mirror is
+	// reachable from outside the LAN.
+	SharePublic string
+
+	// Tunnel names a tunnel.Provider (ngrok or cloudflared) to expose the
+	// mirror through.
+	Tunnel string
+
+	// SSHPort, when non-zero, also serves the session over SSH on the bind
+	// addresses. SSHHostKey is the host key file, created if missing.
+	SSHPort    int
+	SSHHostKey string
+
+	// BoardPort, when non-zero, also serves a watch-only view of the
+	// session without Basic Auth on the bind addresses.
+	BoardPort int
+
+	// Tmux, when set, mirrors this existing tmux session instead of
+	// starting a shell.
+	Tmux string
+
+	// Container, when set, runs the shell inside this running Docker or
+	// Podman container.
+	Container string
+
+	// UDPPort, when non-zero, enables the datagram transport for
+	// "alices-mirror connect --udp" on the bind addresses.
+	UDPPort int
+
+	// Proxy, when set, is used for outbound connections instead of the
+	// HTTP_PROXY, HTTPS_PROXY and ALL_PROXY environment variables.
+	Proxy string
+
+	// LogInput, when set, is a file that records every keystroke sent to
+	// the shell with the client that typed it.
+	LogInput string
+
+	// LogOutput, when set, is a file that all shell output is appended to,
+	// rotated by size. LogOutputFormat is raw (default) or text, which
+	// strips escape sequences.
+	LogOutput       string
+	LogOutputFormat string
+
+	// LogMaxSize, LogMaxAge and LogMaxFiles control rotation of the input
+	// and output logs: a file is rotated once it reaches LogMaxSize (a size
+	// such as "16M", "0" for no limit) or is older than LogMaxAge (a
+	// duration, empty for no limit), and LogMaxFiles rotated files are kept.
+	LogMaxSize  string
+	LogMaxAge   string
+	LogMaxFiles int
+
+	// NoIPAlerts turns off tracking of client addresses. Otherwise the
+	// first connection from an address not seen before is reported to the
+	// owner and, when set, to AlertWebhook (a JSON POST) and to AlertEmail
+	// through the AlertSMTP server (host:port).
+	NoIPAlerts   bool
+	AlertWebhook string
+	AlertEmail   string
+	AlertSMTP    string
+
+	// BellWebhook, when set, receives a JSON POST when the shell rings the
+	// bell, at most once per bellWebhookInterval.
+	BellWebhook string
+
+	// SetuidUser, when set, is the account the mirror switches to once its
+	// ports are bound, and the account the shell runs as. The mirror must
+	// be started as root.
+	SetuidUser string
+
+	// Confine, when set, is a directory the shell is confined to. WorkDir
+	// must be inside it.
+	Confine string
+
+	// LimitCPU (a number of CPUs such as "0.5"), LimitMem (a size such as
+	// "512M") and LimitPIDs cap the resources of the shell and everything
+	// it starts. Empty or zero means unlimited.
+	LimitCPU  string
+	LimitMem  string
+	LimitPIDs int
+
+	// AllowCommands and DenyCommands are comma-separated command patterns
+	// checked against each line typed by clients other than the owner.
+	AllowCommands string
+	DenyCommands  string
+
+	// AuthFile, when set, is a file of further user:password accounts that
+	// may log in besides User, for user:<name> user-level rules.
+	AuthFile string
+
+	// AllowIPDNS also matches AllowIPs against the host names clients'
+	// addresses resolve to.
+	AllowIPDNS bool
+
+	// TitlePrefix starts the titles the shell integrations emit. Empty
+	// means ALICES_MIRROR_TITLE_PREFIX, or "alices-mirror".
+	TitlePrefix string
+
+	// NoSnapshot starts clients other than the owner on a blank terminal
+	// instead of replaying the scrollback.
+	NoSnapshot bool
+
+	// SnippetsFile, when set, is a JSON file of snippets clients can run.
+	// Changes made through /api/snippets are saved back to it.
+	SnippetsFile string
+
+	// ResetWait is how long a reset gives the shell's processes after each
+	// signal before escalating (a duration, empty for the default). With
+	// ResetSudo, processes that survive SIGKILL are killed through
+	// "sudo -n". ResetPolicy says who may reset: owner, interact or any.
+	ResetWait   string
+	ResetSudo   bool
+	ResetPolicy string
+
+	// ReadTimeout and WriteTimeout bound reading an HTTP request and
+	// writing its response, and WSWriteTimeout each write to a WebSocket
+	// or event stream client (durations, empty for the defaults; 0 turns
+	// the first two off).
+	ReadTimeout    string
+	WriteTimeout   string
+	WSWriteTimeout string
+
+	// AttachOwner, when set, runs the owner's terminal in this process once
+	// the server is listening, as --share-foreground does. The mirror then
+	// runs in share mode and stops when AttachOwner returns.
+	AttachOwner func(srv *server.Server) error `json:"-"`
 }
 
+// Formats accepted for Config.LogOutputFormat.
+const (
+	OutputLogRaw  = "raw"
+	OutputLogText = "text"
+)
+
+// Rotation defaults for the input and output logs.
+const (
+	DefaultLogMaxSize  = "16M"
+	DefaultLogMaxFiles = 5
+)
+
+// shellExitGrace is how long the shell has to exit after being hung up on
+// shutdown before it is killed.
+const shellExitGrace = 2 * time.Second
+
+const (
+	maxReadBufferSize   = 4 << 20
+	maxOutputQueueDepth = 1 << 16
+)
+
 type StartupInfo struct {
 	WorkDir string
 	Port    int
@@ -36,6 +219,28 @@ type StartupInfo struct {
 	Auth    server.AuthConfig
 	PID     int
 	Daemon  bool
+	QR      bool
+
+	// PprofToken, when set, adds the /debug/pprof/ URL to the output.
+	PprofToken string
+
+	// PublicURL, when set, is printed as the address reachable through
+	// --tunnel.
+	PublicURL string
+
+	// SSHPort, when non-zero, adds the ssh command line to the output.
+	SSHPort int
+
+	// BoardPort, when non-zero, adds the board URL to the output.
+	BoardPort int
+
+	// InputLog, when set, adds a warning that input is being recorded to
+	// this file.
+	InputLog string
+}
+
+func logger() *slog.Logger {
+	return logging.For("app")
 }
 
 func Validate(cfg Config) error {
@@ -68,6 +273,100 @@ func Validate(cfg Config) error {
 		return errors.New("bind patterns did not match any local IPv4 addresses")
 	}
 
+	if err := server.ValidateAlias(cfg.Alias); err != nil {
+		return fmt.Errorf("invalid value %q for --alias: %v", cfg.Alias, err)
+	}
+	if err := (server.Branding{Accent: cfg.Accent}).Validate(); err != nil {
+		return fmt.Errorf("invalid value %q for --accent: %v", cfg.Accent, err)
+	}
+	if err := (server.Branding{MOTD: cfg.MOTD}).Validate(); err != nil {
+		return fmt.Errorf("invalid value for --motd: %v", err)
+	}
+	if err := terminal.CheckTitlePrefix(strings.TrimSpace(cfg.TitlePrefix)); err != nil {
+		return fmt.Errorf("invalid value %q for --title-prefix: %v", cfg.TitlePrefix, err)
+	}
+	if _, err := server.ParseClipboardPolicy(cfg.Clipboard); err != nil {
+		return fmt.Errorf("invalid value %q for --clipboard: %v", cfg.Clipboard, err)
+	}
+	if _, err := server.ParseResizePolicy(cfg.Resize); err != nil {
+		return fmt.Errorf("invalid value %q for --resize: %v", cfg.Resize, err)
+	}
+	if _, err := server.ParsePastePolicy(cfg.Paste); err != nil {
+		return fmt.Errorf("invalid value %q for --paste-confirm: %v", cfg.Paste, err)
+	}
+	if _, err := server.ParseResetPolicy(cfg.ResetPolicy); err != nil {
+		return fmt.Errorf("invalid value %q for --reset-policy: %v", cfg.ResetPolicy, err)
+	}
+
+	if cfg.ReadBufferSize < 0 || cfg.ReadBufferSize > maxReadBufferSize {
+		return fmt.Errorf("invalid value %d for --read-buffer: must be between 1 and %d bytes", cfg.ReadBufferSize, maxReadBufferSize)
+	}
+	if cfg.OutputQueueDepth < 0 || cfg.OutputQueueDepth > maxOutputQueueDepth {
+		return fmt.Errorf("invalid value %d for --output-queue: must be between 1 and %d", cfg.OutputQueueDepth, maxOutputQueueDepth)
+	}
+
+	if _, err := server.ParseSlowClientPolicy(cfg.SlowClientPolicy); err != nil {
+		return fmt.Errorf("invalid value %q for --slow-client-policy: %v", cfg.SlowClientPolicy, err)
+	}
+	if _, err := server.ParseByteSize(cfg.MaxBuffered); err != nil {
+		return fmt.Errorf("invalid value %q for --max-buffered: %v", cfg.MaxBuffered, err)
+	}
+	if cfg.MaxConnsPerIP < 0 {
+		return fmt.Errorf("invalid value %d for --max-conns-per-ip: must be 0 or more", cfg.MaxConnsPerIP)
+	}
+
+	if strings.TrimSpace(cfg.Proxy) != "" {
+		if _, err := proxy.Parse(cfg.Proxy); err != nil {
+			return fmt.Errorf("invalid value %q for --proxy: %v", cfg.Proxy, err)
+		}
+	}
+
+	if strings.TrimSpace(cfg.SharePublic) != "" {
+		if cfg.Yolo || cfg.User == "" || cfg.Password == "" {
+			return errors.New("--share-public requires --user and --password and cannot be used with --yolo")
+		}
+		if _, err := tunnel.NewClient(cfg.SharePublic, ""); err != nil {
+			return fmt.Errorf("invalid value %q for --share-public: %v", cfg.SharePublic, err)
+		}
+	}
+
+	if cfg.SSHPort < 0 || cfg.SSHPort > 65535 {
+		return fmt.Errorf("invalid value %d for --ssh-port: must be between 1 and 65535", cfg.SSHPort)
+	}
+	if cfg.SSHPort != 0 && cfg.SSHPort == cfg.Port {
+		return fmt.Errorf("invalid value %d for --ssh-port: already used by --port", cfg.SSHPort)
+	}
+
+	if cfg.BoardPort < 0 || cfg.BoardPort > 65535 {
+		return fmt.Errorf("invalid value %d for --board: must be between 1 and 65535", cfg.BoardPort)
+	}
+	if cfg.BoardPort != 0 && cfg.BoardPort == cfg.Port {
+		return fmt.Errorf("invalid value %d for --board: already used by --port", cfg.BoardPort)
+	}
+	if cfg.BoardPort != 0 && cfg.BoardPort == cfg.SSHPort {
+		return fmt.Errorf("invalid value %d for --board: already used by --ssh-port", cfg.BoardPort)
+	}
+
+	if cfg.UDPPort < 0 || cfg.UDPPort > 65535 {
+		return fmt.Errorf("invalid value %d for --udp-port: must be between 1 and 65535", cfg.UDPPort)
+	}
+
+	if strings.TrimSpace(cfg.Tunnel) != "" {
+		if cfg.Yolo || cfg.User == "" || cfg.Password == "" {
+			return errors.New("--tunnel requires --user and --password and cannot be used with --yolo")
+		}
+		if _, err := tunnel.NewProvider(cfg.Tunnel, tunnel.ProviderOptions{}); err != nil {
+			return fmt.Errorf("invalid value %q for --tunnel: %v", cfg.Tunnel, err)
+		}
+	}
+
+	if webRoot := strings.TrimSpace(cfg.WebRoot); webRoot != "" {
+		info, err := os.Stat(webRoot)
+		if err != nil || !info.IsDir() {
+			return fmt.Errorf("invalid value %q for --web-root: not a directory", cfg.WebRoot)
+		}
+	}
+
 	userLevel := strings.TrimSpace(cfg.UserLevel)
 	if userLevel == "" {
 		userLevel = "*-0"
@@ -82,12 +381,228 @@ func Validate(cfg Config) error {
 	if !info.IsDir() {
 		return fmt.Errorf("work directory is not a directory: %s", cfg.WorkDir)
 	}
+	if err := checkLogPath(cfg.LogInput); err != nil {
+		return fmt.Errorf("invalid value %q for --log-input: %v", cfg.LogInput, err)
+	}
+	if err := checkLogPath(cfg.LogOutput); err != nil {
+		return fmt.Errorf("invalid value %q for --log-output: %v", cfg.LogOutput, err)
+	}
+	if _, err := logRotateOptions(cfg); err != nil {
+		return err
+	}
+	if err := validateAlerts(cfg); err != nil {
+		return err
+	}
+	switch strings.TrimSpace(cfg.LogOutputFormat) {
+	case "", OutputLogRaw, OutputLogText:
+	default:
+		return fmt.Errorf("invalid value %q for --log-output-format (expected raw or text)", cfg.LogOutputFormat)
+	}
+	if name := strings.TrimSpace(cfg.SetuidUser); name != "" {
+		if strings.TrimSpace(cfg.Tmux) != "" || strings.TrimSpace(cfg.Container) != "" {
+			return errors.New("--setuid-user cannot be used with --tmux or --container")
+		}
+		if _, err := lookupAccount(name); err != nil {
+			return fmt.Errorf("invalid value %q for --setuid-user: %v", cfg.SetuidUser, err)
+		}
+	}
+	if dir := strings.TrimSpace(cfg.Confine); dir != "" {
+		if strings.TrimSpace(cfg.Tmux) != "" || strings.TrimSpace(cfg.Container) != "" {
+			return errors.New("--confine cannot be used with --tmux or --container")
+		}
+		if _, err := terminal.CheckConfine(dir, cfg.Shell); err != nil {
+			return fmt.Errorf("invalid value %q for --confine: %v", cfg.Confine, err)
+		}
+		if rel, err := filepath.Rel(dir, cfg.WorkDir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("work directory %q is outside --confine %q", cfg.WorkDir, cfg.Confine)
+		}
+	}
+	limits, err := shellLimits(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := commandFilter(cfg); err != nil {
+		return err
+	}
+	if _, err := resetOptions(cfg); err != nil {
+		return err
+	}
+	if _, err := httpTimeouts(cfg); err != nil {
+		return err
+	}
+	if path := strings.TrimSpace(cfg.AuthFile); path != "" {
+		if cfg.Yolo || cfg.User == "" || cfg.Password == "" {
+			return errors.New("--auth-file requires --user and --password and cannot be used with --yolo")
+		}
+		if _, err := server.LoadAccounts(path); err != nil {
+			return fmt.Errorf("invalid value %q for --auth-file: %v", cfg.AuthFile, err)
+		}
+	}
+	if path := strings.TrimSpace(cfg.SnippetsFile); path != "" {
+		if _, err := server.LoadSnippets(path); err != nil {
+			return fmt.Errorf("invalid value %q for --snippets: %v", cfg.SnippetsFile, err)
+		}
+	}
+	if !limits.IsZero() {
+		if strings.TrimSpace(cfg.Tmux) != "" || strings.TrimSpace(cfg.Container) != "" {
+			return errors.New("--limit-cpu, --limit-mem and --limit-pids cannot be used with --tmux or --container")
+		}
+		if err := terminal.CheckLimits(limits); err != nil {
+			return fmt.Errorf("cannot limit the shell's resources: %v", err)
+		}
+	}
+	if name := strings.TrimSpace(cfg.Container); name != "" {
+		if strings.TrimSpace(cfg.Tmux) != "" {
+			return errors.New("--container cannot be used with --tmux")
+		}
+		if err := terminal.CheckContainer(name); err != nil {
+			return fmt.Errorf("invalid value %q for --container: %v", cfg.Container, err)
+		}
+		return nil
+	}
+	if target := strings.TrimSpace(cfg.Tmux); target != "" {
+		if err := terminal.CheckTmux(target); err != nil {
+			return fmt.Errorf("invalid value %q for --tmux: %v", cfg.Tmux, err)
+		}
+		return nil
+	}
 	if err := terminal.CheckShell(cfg.WorkDir, cfg.Shell); err != nil {
 		return fmt.Errorf("failed to start shell in %q: %v", cfg.WorkDir, err)
 	}
 	return nil
 }
 
+// logRotateOptions applies the defaults to the rotation settings in cfg.
+func logRotateOptions(cfg Config) (logging.RotateOptions, error) {
+	opts := logging.RotateOptions{MaxFiles: cfg.LogMaxFiles}
+	rawSize := strings.TrimSpace(cfg.LogMaxSize)
+	if rawSize == "" {
+		rawSize = DefaultLogMaxSize
+	}
+	size, err := server.ParseByteSize(rawSize)
+	if err != nil {
+		return opts, fmt.Errorf("invalid value %q for --log-max-size: %v", cfg.LogMaxSize, err)
+	}
+	opts.MaxSize = size
+	if raw := strings.TrimSpace(cfg.LogMaxAge); raw != "" {
+		age, err := time.ParseDuration(raw)
+		if err != nil || age < 0 {
+			return opts, fmt.Errorf("invalid value %q for --log-max-age (expected a duration such as 24h)", cfg.LogMaxAge)
+		}
+		opts.MaxAge = age
+	}
+	if opts.MaxFiles == 0 {
+		opts.MaxFiles = DefaultLogMaxFiles
+	}
+	if opts.MaxFiles < 0 {
+		return opts, fmt.Errorf("invalid value %q for --log-max-files", fmt.Sprintf("%d", cfg.LogMaxFiles))
+	}
+	return opts, nil
+}
+
+// resetOptions parses --reset-wait and --reset-sudo.
+func resetOptions(cfg Config) (terminal.ResetOptions, error) {
+	opts := terminal.ResetOptions{Sudo: cfg.ResetSudo}
+	if raw := strings.TrimSpace(cfg.ResetWait); raw != "" {
+		wait, err := time.ParseDuration(raw)
+		if err != nil || wait <= 0 {
+			return opts, fmt.Errorf("invalid value %q for --reset-wait (expected a duration such as 2s)", cfg.ResetWait)
+		}
+		opts.Wait = wait
+	}
+	return opts, nil
+}
+
+// httpTimeouts parses --read-timeout, --write-timeout and
+// --ws-write-timeout into the server's timeouts.
+func httpTimeouts(cfg Config) (server.Config, error) {
+	var timeouts server.Config
+	for _, option := range []struct {
+		flag, raw string
+		out       *time.Duration
+		allowZero bool
+	}{
+		{"--read-timeout", cfg.ReadTimeout, &timeouts.ReadTimeout, true},
+		{"--write-timeout", cfg.WriteTimeout, &timeouts.WriteTimeout, true},
+		{"--ws-write-timeout", cfg.WSWriteTimeout, &timeouts.WSWriteTimeout, false},
+	} {
+		raw := strings.TrimSpace(option.raw)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 || (d == 0 && !option.allowZero) {
+			return timeouts, fmt.Errorf("invalid value %q for %s (expected a duration such as 30s)", option.raw, option.flag)
+		}
+		*option.out = d
+	}
+	return timeouts, nil
+}
+
+// shellLimits parses the --limit-* options.
+func shellLimits(cfg Config) (terminal.Limits, error) {
+	var limits terminal.Limits
+	if raw := strings.TrimSpace(cfg.LimitCPU); raw != "" {
+		cpu, err := strconv.ParseFloat(raw, 64)
+		if err != nil || cpu <= 0 || cpu > float64(runtime.NumCPU()) {
+			return limits, fmt.Errorf("invalid value %q for --limit-cpu (expected a number of CPUs between 0 and %d)", cfg.LimitCPU, runtime.NumCPU())
+		}
+		limits.CPU = cpu
+	}
+	memory, err := server.ParseByteSize(cfg.LimitMem)
+	if err != nil {
+		return limits, fmt.Errorf("invalid value %q for --limit-mem: %v", cfg.LimitMem, err)
+	}
+	limits.Memory = memory
+	if cfg.LimitPIDs < 0 {
+		return limits, fmt.Errorf("invalid value %d for --limit-pids", cfg.LimitPIDs)
+	}
+	limits.PIDs = cfg.LimitPIDs
+	return limits, nil
+}
+
+// commandFilter parses --allow-commands and --deny-commands. It returns nil
+// when neither is set.
+func commandFilter(cfg Config) (*server.CommandFilter, error) {
+	split := func(raw string) []string {
+		if strings.TrimSpace(raw) == "" {
+			return nil
+		}
+		return strings.Split(raw, ",")
+	}
+	allow, deny := split(cfg.AllowCommands), split(cfg.DenyCommands)
+	if len(allow) > 0 {
+		if _, err := server.NewCommandFilter(allow, nil); err != nil {
+			return nil, fmt.Errorf("invalid value %q for --allow-commands: %v", cfg.AllowCommands, err)
+		}
+	}
+	if len(deny) > 0 {
+		if _, err := server.NewCommandFilter(nil, deny); err != nil {
+			return nil, fmt.Errorf("invalid value %q for --deny-commands: %v", cfg.DenyCommands, err)
+		}
+	}
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	return server.NewCommandFilter(allow, deny)
+}
+
+// checkLogPath reports whether a log file can be created at path, which may
+// be empty.
+func checkLogPath(path string) error {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return errors.New("is a directory")
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		return errors.New("directory does not exist")
+	}
+	return nil
+}
+
 func BuildAuthConfig(cfg Config) server.AuthConfig {
 	auth := server.AuthConfig{}
 	if !cfg.Yolo && cfg.User != "" && cfg.Password != "" {
@@ -104,7 +619,35 @@ func Run(cfg Config) error {
 	}
 
 	auth := BuildAuthConfig(cfg)
+	if path := strings.TrimSpace(cfg.AuthFile); path != "" && auth.Enabled {
+		accounts, err := server.LoadAccounts(path)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --auth-file: %v", cfg.AuthFile, err)
+		}
+		auth.Accounts = accounts
+	}
 	ownerToken := strings.TrimSpace(os.Getenv("ALICES_MIRROR_OWNER_TOKEN"))
+	if cfg.AttachOwner != nil && ownerToken == "" {
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return err
+		}
+		ownerToken = hex.EncodeToString(token)
+	}
+	shareMode := ownerToken != ""
+	// The profiling token is its own secret: it opens /debug/pprof/ and
+	// nothing else, so it is never used as the owner token.
+	pprofToken := ""
+	if cfg.DebugPprof {
+		pprofToken = strings.TrimSpace(os.Getenv("ALICES_MIRROR_DEBUG_TOKEN"))
+		if pprofToken == "" {
+			token := make([]byte, 16)
+			if _, err := rand.Read(token); err != nil {
+				return err
+			}
+			pprofToken = hex.EncodeToString(token)
+		}
+	}
 	userLevel := strings.TrimSpace(cfg.UserLevel)
 	if userLevel == "" {
 		userLevel = "*-0"
@@ -119,50 +662,372 @@ func Run(cfg Config) error {
 		return errors.New("bind patterns did not match any local IPv4 addresses")
 	}
 
+	clipboardPolicy, err := server.ParseClipboardPolicy(cfg.Clipboard)
+	if err != nil {
+		return fmt.Errorf("invalid value %q for --clipboard: %v", cfg.Clipboard, err)
+	}
+	maxBuffered, err := server.ParseByteSize(cfg.MaxBuffered)
+	if err != nil {
+		return fmt.Errorf("invalid value %q for --max-buffered: %v", cfg.MaxBuffered, err)
+	}
+	timeouts, err := httpTimeouts(cfg)
+	if err != nil {
+		return err
+	}
+
+	// OSC 52 lets anything that writes to the terminal set the host
+	// clipboard, viewers that can type included, so it is only honoured
+	// when asked for.
+	var onClipboard func(string)
+	if cfg.OSC52 {
+		onClipboard = func(text string) {
+			if err := clipboard.Write(text); err != nil {
+				logger().Warn("clipboard write failed", "error", err)
+			}
+		}
+	}
+
+	rotate, err := logRotateOptions(cfg)
+	if err != nil {
+		return err
+	}
+	var outputLog io.Writer
+	if path := strings.TrimSpace(cfg.LogOutput); path != "" {
+		file, err := logging.OpenRotating(path, rotate)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --log-output: %v", cfg.LogOutput, err)
+		}
+		defer file.Close()
+		outputLog = file
+		if strings.TrimSpace(cfg.LogOutputFormat) == OutputLogText {
+			outputLog = transcript.NewStripper(file)
+		}
+	}
+
+	var runAs *terminal.Account
+	var afterListen func() error
+	if name := strings.TrimSpace(cfg.SetuidUser); name != "" {
+		runAs, err = lookupAccount(name)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --setuid-user: %v", cfg.SetuidUser, err)
+		}
+		afterListen = func() error {
+			if err := dropPrivileges(runAs); err != nil {
+				return fmt.Errorf("failed to switch to %s: %v", runAs.Username, err)
+			}
+			logger().Info("dropped root privileges", "user", runAs.Username)
+			return nil
+		}
+	}
+	// The owner's terminal attaches once every address is bound.
+	listening := make(chan struct{})
+	if cfg.AttachOwner != nil {
+		drop := afterListen
+		afterListen = func() error {
+			if drop != nil {
+				if err := drop(); err != nil {
+					return err
+				}
+			}
+			close(listening)
+			return nil
+		}
+	}
+
+	limits, err := shellLimits(cfg)
+	if err != nil {
+		return err
+	}
+	commands, err := commandFilter(cfg)
+	if err != nil {
+		return err
+	}
+	reset, err := resetOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	confine := strings.TrimSpace(cfg.Confine)
+	if confine != "" {
+		method, err := terminal.CheckConfine(confine, cfg.Shell)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --confine: %v", cfg.Confine, err)
+		}
+		logger().Info("confining shell", "dir", confine, "method", method)
+	}
+
+	// A process started by an upgrade takes over the shell and sockets of
+	// the one it replaces.
+	taken, err := takeHandoff()
+	if err != nil {
+		return err
+	}
+	var adopt *terminal.Handoff
+	var inherited map[string]*os.File
+	if taken != nil {
+		adopt = taken.shell
+		inherited = taken.listeners
+		cfg.Alias = taken.alias
+	}
+
 	session, err := terminal.NewSession(terminal.Config{
-		WorkDir:         cfg.WorkDir,
-		BufferSize:      256 * 1024,
-		Shell:           cfg.Shell,
-		ExitOnShellExit: ownerToken != "",
+		WorkDir:          cfg.WorkDir,
+		BufferSize:       256 * 1024,
+		Shell:            cfg.Shell,
+		ExitOnShellExit:  shareMode,
+		OnClipboard:      onClipboard,
+		ReadBufferSize:   cfg.ReadBufferSize,
+		OutputQueueDepth: cfg.OutputQueueDepth,
+		Tmux:             strings.TrimSpace(cfg.Tmux),
+		Container:        strings.TrimSpace(cfg.Container),
+		OutputLog:        outputLog,
+		RunAs:            runAs,
+		Confine:          confine,
+		Limits:           limits,
+		Reset:            reset,
+		TitlePrefix:      cfg.TitlePrefix,
+		Adopt:            adopt,
 	})
 	if err != nil {
 		return err
 	}
+	upgrader := newUpgrader(cfg, session)
 
 	addrs := make([]string, 0, len(resolvedBinds))
 	for _, origin := range resolvedBinds {
 		addrs = append(addrs, net.JoinHostPort(origin, fmt.Sprintf("%d", cfg.Port)))
 	}
 	alias := strings.TrimSpace(cfg.Alias)
+
+	var sshAddrs []string
+	var sshHostKey ssh.Signer
+	if cfg.SSHPort != 0 {
+		keyPath := strings.TrimSpace(cfg.SSHHostKey)
+		if keyPath == "" {
+			keyPath, err = DefaultSSHHostKeyPath()
+			if err != nil {
+				return err
+			}
+		}
+		sshHostKey, err = server.LoadSSHHostKey(keyPath)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --ssh-host-key: %v", keyPath, err)
+		}
+		for _, origin := range resolvedBinds {
+			sshAddrs = append(sshAddrs, net.JoinHostPort(origin, fmt.Sprintf("%d", cfg.SSHPort)))
+		}
+	}
+
+	var boardAddrs []string
+	if cfg.BoardPort != 0 {
+		for _, origin := range resolvedBinds {
+			boardAddrs = append(boardAddrs, net.JoinHostPort(origin, fmt.Sprintf("%d", cfg.BoardPort)))
+		}
+	}
+
+	var udpAddrs []string
+	if cfg.UDPPort != 0 {
+		for _, origin := range resolvedBinds {
+			udpAddrs = append(udpAddrs, net.JoinHostPort(origin, fmt.Sprintf("%d", cfg.UDPPort)))
+		}
+	}
+
+	var relay *tunnel.Client
+	var listeners []net.Listener
+	if relayURL := strings.TrimSpace(cfg.SharePublic); relayURL != "" {
+		name := alias
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+		relay, err = tunnel.NewClient(relayURL, name)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --share-public: %v", cfg.SharePublic, err)
+		}
+		relay.Proxy, err = proxy.Func(cfg.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --proxy: %v", cfg.Proxy, err)
+		}
+		listeners = append(listeners, relay.Listener())
+	}
+
+	var inputLog *server.InputLog
+	if path := strings.TrimSpace(cfg.LogInput); path != "" {
+		file, err := logging.OpenRotating(path, rotate)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --log-input: %v", cfg.LogInput, err)
+		}
+		defer file.Close()
+		inputLog = server.NewInputLog(file)
+	}
+
+	var exporter *telemetry.Exporter
+	if telemetryCfg, ok, err := telemetry.FromEnv(); err != nil {
+		return fmt.Errorf("invalid OpenTelemetry configuration: %v", err)
+	} else if ok {
+		proxyFunc, err := proxy.Func(cfg.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for --proxy: %v", cfg.Proxy, err)
+		}
+		exporter = telemetry.New(telemetryCfg, proxyFunc)
+	}
+
+	var knownIPs *server.KnownIPs
+	if !cfg.NoIPAlerts {
+		dir, err := StateDir()
+		if err != nil {
+			return err
+		}
+		knownIPs, err = server.LoadKnownIPs(filepath.Join(dir, "known_ips.json"))
+		if err != nil {
+			return fmt.Errorf("failed to load known client addresses: %v", err)
+		}
+	}
+
+	var accessRules *server.AccessRules
+	if ownerToken != "" {
+		dir, err := StateDir()
+		if err != nil {
+			return err
+		}
+		accessRules, err = server.LoadAccessRules(filepath.Join(dir, fmt.Sprintf("access_rules-%d.json", cfg.Port)))
+		if err != nil {
+			return fmt.Errorf("failed to load access rules: %v", err)
+		}
+	}
+
+	snippets, err := server.LoadSnippets(strings.TrimSpace(cfg.SnippetsFile))
+	if err != nil {
+		return fmt.Errorf("invalid value %q for --snippets: %v", cfg.SnippetsFile, err)
+	}
+
+	// The discovery service starts after the server, whose alias callback
+	// runs on its own goroutines, so the two share it through svc.
+	var svc atomic.Pointer[discovery.Service]
 	srv, err := server.New(server.Config{
 		Addrs:      addrs,
 		AllowIPs:   cfg.AllowIPs,
+		AllowIPDNS: cfg.AllowIPDNS,
 		Session:    session,
 		Auth:       auth,
 		Alias:      alias,
+		Accent:     cfg.Accent,
+		MOTD:       cfg.MOTD,
 		OwnerToken: ownerToken,
 		UserLevels: userLevels,
+		Version:    readVersion(),
+		WebRoot:    cfg.WebRoot,
+		PprofToken: pprofToken,
+		NoSnapshot: cfg.NoSnapshot,
+		Listeners:  listeners,
+		SSHAddrs:   sshAddrs,
+		SSHHostKey: sshHostKey,
+		BoardAddrs: boardAddrs,
+		UDPAddrs:   udpAddrs,
+		InputLog:   inputLog,
+		Telemetry:  exporter,
+		KnownIPs:   knownIPs,
+		OnNewIP:    newIPAlerter(cfg, alias),
+		OnBell:     newBellNotifier(cfg, alias),
+
+		AccessRules: accessRules,
+		Snippets:    snippets,
+
+		AfterListen:   afterListen,
+		CommandFilter: commands,
+
+		EffectiveConfig: EffectiveConfig(cfg),
+		QRCredentials:   cfg.QRCreds,
+
+		ClipboardPolicy:  clipboardPolicy,
+		ResizePolicy:     server.ResizePolicy(cfg.Resize),
+		PastePolicy:      server.PastePolicy(cfg.Paste),
+		ResetPolicy:      server.ResetPolicy(cfg.ResetPolicy),
+		SlowClientPolicy: server.SlowClientPolicy(cfg.SlowClientPolicy),
+		MaxBufferedBytes: maxBuffered,
+		MaxConnsPerIP:    cfg.MaxConnsPerIP,
+		ReadTimeout:      timeouts.ReadTimeout,
+		WriteTimeout:     timeouts.WriteTimeout,
+		WSWriteTimeout:   timeouts.WSWriteTimeout,
+		OnAliasChanged: func(alias string) {
+			if d := svc.Load(); d != nil {
+				_ = d.SetAlias(alias)
+			}
+		},
+		Inherited: inherited,
+		OnUpgrade: upgrader.upgrade,
 	})
 	if err != nil {
 		return err
 	}
+	upgrader.srv = srv
 
-	lines := StartupLines(StartupInfo{
-		WorkDir: cfg.WorkDir,
-		Port:    cfg.Port,
-		Origins: resolvedBinds,
-		Auth:    auth,
-	})
+	info := StartupInfo{
+		WorkDir:   cfg.WorkDir,
+		Port:      cfg.Port,
+		Origins:   resolvedBinds,
+		Auth:      auth,
+		QR:        cfg.QR,
+		SSHPort:   cfg.SSHPort,
+		BoardPort: cfg.BoardPort,
+
+		InputLog: strings.TrimSpace(cfg.LogInput),
+	}
+	if cfg.DebugPprof && (!shareMode || cfg.AttachOwner != nil) {
+		info.PprofToken = pprofToken
+	}
+
+	// SIGINT and SIGTERM cancel ctx, which stops the server; the shell,
+	// discovery and logs are then shut down below rather than dropped. A
+	// second signal kills the process as usual.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		cancel()
+	}()
+	upgrader.watchSignal(ctx)
+
+	if exporter != nil {
+		// Wait for the final export after ctx is cancelled on return.
+		exported := make(chan struct{})
+		go func() {
+			exporter.Run(ctx)
+			close(exported)
+		}()
+		defer func() {
+			cancel()
+			<-exported
+		}()
+	}
+
+	// Under --share the attached terminal runs the tunnel, so the daemon
+	// never sees --tunnel.
+	if strings.TrimSpace(cfg.Tunnel) != "" {
+		info.PublicURL, err = StartTunnel(ctx, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	lines := StartupLines(info)
 	for _, line := range lines {
 		fmt.Println(line)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	if relay != nil {
+		go func() {
+			err := relay.Run(ctx, func(publicURL string) {
+				fmt.Printf("Public: %s\n", withCredentials(publicURL, auth))
+			})
+			if err != nil && !errors.Is(err, context.Canceled) {
+				logger().Error("public sharing stopped", "error", err)
+			}
+		}()
+	}
 
 	if cfg.Visible {
 		hostname, _ := os.Hostname()
-		_, err := discovery.Start(ctx, discovery.Info{
+		d, err := discovery.Start(ctx, discovery.Info{
 			Alias:        alias,
 			Hosts:        filterLANHosts(buildDisplayHosts(resolvedBinds)),
 			Port:         cfg.Port,
@@ -177,17 +1042,55 @@ func Run(cfg Config) error {
 		if err != nil {
 			return err
 		}
+		svc.Store(d)
 	}
 
-	err = srv.Start(ctx)
+	if cfg.AttachOwner != nil {
+		err = serveWithOwner(ctx, cancel, srv, listening, cfg.AttachOwner)
+	} else {
+		err = srv.Start(ctx)
+	}
+	if ctx.Err() != nil {
+		logger().Info("shutting down")
+	}
+	cancel()
+	if d := svc.Load(); d != nil {
+		d.Close()
+	}
+	// After a handover the shell belongs to the new process and Shutdown
+	// leaves it alone.
+	upgrader.wait()
+	session.Shutdown(shellExitGrace)
 	if err == nil || errors.Is(err, http.ErrServerClosed) || errors.Is(err, context.Canceled) {
 		return nil
 	}
 	return err
 }
 
+// serveWithOwner runs srv while attach runs the owner's terminal, and stops
+// it once attach returns.
+func serveWithOwner(ctx context.Context, cancel context.CancelFunc, srv *server.Server, listening <-chan struct{}, attach func(*server.Server) error) error {
+	served := make(chan error, 1)
+	go func() { served <- srv.Start(ctx) }()
+	select {
+	case err := <-served:
+		return err
+	case <-listening:
+	}
+	attachErr := attach(srv)
+	cancel()
+	err := <-served
+	if attachErr != nil {
+		return attachErr
+	}
+	return err
+}
+
 func StartupLines(info StartupInfo) []string {
 	lines := []string{"alices mirror is running."}
+	if info.InputLog != "" {
+		lines = append(lines, "", "*** INPUT AUDIT LOGGING IS ON ***", fmt.Sprintf("Everything typed by every client is recorded to %s.", info.InputLog), "")
+	}
 	if info.WorkDir != "" {
 		lines = append(lines, fmt.Sprintf("Working directory: %s", info.WorkDir))
 	}
@@ -207,11 +1110,38 @@ func StartupLines(info StartupInfo) []string {
 	}
 
 	for _, host := range hosts {
-		url := fmt.Sprintf("http://%s:%d", host, info.Port)
+		lines = append(lines, fmt.Sprintf("Open: %s", openURL(host, info)))
+	}
+
+	if info.SSHPort != 0 {
+		user := "mirror"
 		if info.Auth.Enabled {
-			url = fmt.Sprintf("http://%s:%s@%s:%d", info.Auth.User, info.Auth.Password, host, info.Port)
+			user = info.Auth.User
+		}
+		lines = append(lines, fmt.Sprintf("SSH: ssh -p %d %s@%s", info.SSHPort, user, hosts[0]))
+	}
+
+	if info.BoardPort != 0 {
+		lines = append(lines, fmt.Sprintf("Board (watch-only, no password): %s", openURL(hosts[0], StartupInfo{Port: info.BoardPort})))
+	}
+
+	if info.PublicURL != "" {
+		lines = append(lines, fmt.Sprintf("Public: %s", withCredentials(info.PublicURL, info.Auth)))
+	}
+
+	if info.QR {
+		qrHost := hosts[0]
+		if lanHosts := filterLANHosts(hosts); len(lanHosts) > 0 {
+			qrHost = lanHosts[0]
 		}
-		lines = append(lines, fmt.Sprintf("Open: %s", url))
+		if code, err := qr.Encode(openURL(qrHost, info)); err == nil {
+			lines = append(lines, fmt.Sprintf("Scan to open %s:", openURL(qrHost, StartupInfo{Port: info.Port})))
+			lines = append(lines, code.Terminal(2)...)
+		}
+	}
+
+	if info.PprofToken != "" {
+		lines = append(lines, fmt.Sprintf("Profiling: %s/debug/pprof/?token=%s", openURL(hosts[0], info), info.PprofToken))
 	}
 
 	if !info.Daemon {
@@ -221,6 +1151,71 @@ func StartupLines(info StartupInfo) []string {
 	return lines
 }
 
+func openURL(host string, info StartupInfo) string {
+	if info.Auth.Enabled {
+		return fmt.Sprintf("http://%s:%s@%s:%d", info.Auth.User, info.Auth.Password, host, info.Port)
+	}
+	return fmt.Sprintf("http://%s:%d", host, info.Port)
+}
+
+// DefaultSSHHostKeyPath is where the SSH host key is kept unless
+// --ssh-host-key is given, so clients see the same key on every start.
+func DefaultSSHHostKeyPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ssh_host_ed25519_key"), nil
+}
+
+// StartTunnel starts the provider selected by cfg.Tunnel in front of the
+// server's local address and returns the public URL. The tunnel is closed
+// when ctx is done.
+func StartTunnel(ctx context.Context, cfg Config) (string, error) {
+	provider, err := tunnel.NewProvider(cfg.Tunnel, tunnel.ProviderOptions{Env: proxy.Env(cfg.Proxy)})
+	if err != nil {
+		return "", fmt.Errorf("invalid value %q for --tunnel: %v", cfg.Tunnel, err)
+	}
+	publicURL, err := provider.Start(ctx, tunnelTarget(server.ExpandBindPatterns(cfg.Origins), cfg.Port))
+	if err != nil {
+		return "", fmt.Errorf("failed to start %s tunnel: %v", cfg.Tunnel, err)
+	}
+	return publicURL, nil
+}
+
+// tunnelTarget picks the address a local tunnel agent should connect to,
+// preferring loopback.
+func tunnelTarget(binds []string, port int) string {
+	host := ""
+	for _, bind := range binds {
+		if ip := net.ParseIP(bind); ip != nil && ip.IsLoopback() {
+			host = bind
+			break
+		}
+	}
+	if host == "" && len(binds) > 0 && binds[0] != "0.0.0.0" {
+		host = binds[0]
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, fmt.Sprintf("%d", port))
+}
+
+// withCredentials adds the Basic Auth user and password to rawURL, the way
+// the LAN URLs are printed.
+func withCredentials(rawURL string, auth server.AuthConfig) string {
+	if !auth.Enabled {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.User = url.UserPassword(auth.User, auth.Password)
+	return u.String()
+}
+
 func buildDisplayHosts(origins []string) []string {
 	var hosts []string
 	for _, origin := range origins {
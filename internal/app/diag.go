@@ -0,0 +1,57 @@
+package app
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+const redacted = "[redacted]"
+
+// EffectiveConfig returns cfg as a map for diagnostics, with the password
+// and any credentials in URLs replaced by a marker. Webhook URLs keep only
+// their scheme and host since services such as Slack put the secret in the
+// path.
+func EffectiveConfig(cfg Config) map[string]any {
+	data, _ := json.Marshal(cfg)
+	out := map[string]any{}
+	_ = json.Unmarshal(data, &out)
+
+	if cfg.Password != "" {
+		out["Password"] = redacted
+	}
+	out["Proxy"] = redactURL(cfg.Proxy, false)
+	out["SharePublic"] = redactURL(cfg.SharePublic, false)
+	out["AlertWebhook"] = redactURL(cfg.AlertWebhook, true)
+	out["BellWebhook"] = redactURL(cfg.BellWebhook, true)
+	out["Version"] = readVersion()
+	return out
+}
+
+// Version returns the version read from the VERSION file, or "unknown".
+func Version() string {
+	return readVersion()
+}
+
+func redactURL(raw string, hidePath bool) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if hidePath && (u.Path != "" || u.RawQuery != "") {
+		u.Path, u.RawPath, u.RawQuery = "/"+redacted, "", ""
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	u.Fragment = ""
+	s, _ := url.PathUnescape(u.String())
+	return s
+}
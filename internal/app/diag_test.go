@@ -0,0 +1,25 @@
+package app
+
+import "testing"
+
+func TestEffectiveConfigRedactsSecrets(t *testing.T) {
+	cfg := Config{
+		Password:     "hunter2",
+		Proxy:        "http://bob:pw@proxy.example:3128",
+		AlertWebhook: "https://hooks.example.com/services/T0/B0/secret?x=1",
+		SharePublic:  "https://relay.example.com",
+	}
+	got := EffectiveConfig(cfg)
+	want := map[string]string{
+		"Password":     "[redacted]",
+		"Proxy":        "http://[redacted]@proxy.example:3128",
+		"AlertWebhook": "https://hooks.example.com/[redacted]",
+		"SharePublic":  "https://relay.example.com",
+		"User":         "",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %q", key, got[key], value)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+//go:build !windows
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"alices-mirror/internal/terminal"
+)
+
+// lookupAccount resolves the --setuid-user account. The mirror must be
+// running as root to switch to it.
+func lookupAccount(name string) (*terminal.Account, error) {
+	if os.Geteuid() != 0 {
+		return nil, errors.New("the mirror must be started as root")
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		u, err = user.LookupId(name)
+		if err != nil {
+			return nil, errors.New("unknown user")
+		}
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported uid %q", u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported gid %q", u.Gid)
+	}
+	if uid == 0 {
+		return nil, errors.New("refusing to switch to another root account")
+	}
+	account := &terminal.Account{
+		Username: u.Username,
+		Home:     u.HomeDir,
+		UID:      uint32(uid),
+		GID:      uint32(gid),
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		ids = []string{u.Gid}
+	}
+	for _, id := range ids {
+		if group, err := strconv.ParseUint(id, 10, 32); err == nil {
+			account.Groups = append(account.Groups, uint32(group))
+		}
+	}
+	return account, nil
+}
+
+// dropPrivileges switches the whole process to account for good. The
+// supplementary groups and the group go first, since they can no longer
+// be changed once the user is.
+func dropPrivileges(account *terminal.Account) error {
+	groups := make([]int, 0, len(account.Groups))
+	for _, id := range account.Groups {
+		groups = append(groups, int(id))
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("failed to set groups: %w", err)
+	}
+	if err := syscall.Setgid(int(account.GID)); err != nil {
+		return fmt.Errorf("failed to set gid: %w", err)
+	}
+	if err := syscall.Setuid(int(account.UID)); err != nil {
+		return fmt.Errorf("failed to set uid: %w", err)
+	}
+	if syscall.Setuid(0) == nil {
+		return errors.New("root privileges could still be regained")
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package app
+
+import (
+	"errors"
+
+	"alices-mirror/internal/terminal"
+)
+
+func lookupAccount(string) (*terminal.Account, error) {
+	return nil, errors.New("not supported on Windows")
+}
+
+func dropPrivileges(*terminal.Account) error {
+	return errors.New("not supported on Windows")
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"alices-mirror/internal/terminal"
+)
+
+// handoffEnv is set for a process started to take over from a running one.
+// The handoff itself arrives on file descriptor 3.
+const handoffEnv = "ALICES_MIRROR_HANDOFF"
+
+// handoffState is what a process sends the one replacing it along with the
+// shell's PTY and the listening sockets, in the order of Listeners.
+type handoffState struct {
+	ShellPID   int      `json:"shellPid"`
+	Cols       int      `json:"cols"`
+	Rows       int      `json:"rows"`
+	Scrollback []byte   `json:"scrollback"`
+	Alias      string   `json:"alias"`
+	Listeners  []string `json:"listeners"`
+}
+
+// handoff is what a new process took over from the one it replaces.
+type handoff struct {
+	shell     *terminal.Handoff
+	listeners map[string]*os.File
+	alias     string
+}
+
+// checkUpgradable returns why a process running cfg cannot be replaced by
+// a new one, if it cannot.
+func checkUpgradable(cfg Config) error {
+	switch {
+	case cfg.AttachOwner != nil:
+		return errors.New("the owner's terminal is attached to this process")
+	case strings.TrimSpace(cfg.SetuidUser) != "":
+		return errors.New("privileges were dropped with --setuid-user")
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"alices-mirror/internal/server"
+	"alices-mirror/internal/terminal"
+)
+
+const (
+	// successorReadyTimeout is how long a new process has to start before
+	// the upgrade is given up and this process carries on.
+	successorReadyTimeout = 10 * time.Second
+	// handoffTimeout bounds the handoff itself once the new process is
+	// ready.
+	handoffTimeout = 30 * time.Second
+	// maxHandoffFiles bounds the file descriptors a handoff carries: the
+	// PTY and one socket per listening address.
+	maxHandoffFiles = 64
+)
+
+// upgrader replaces this process with a new one started from the binary
+// now installed, which takes over the shell and the listening sockets.
+// Clients are asked to reconnect and find the new process.
+type upgrader struct {
+	cfg     Config
+	session *terminal.Session
+	srv     *server.Server
+
+	mu      sync.Mutex
+	started bool
+	done    chan struct{}
+}
+
+func newUpgrader(cfg Config, session *terminal.Session) *upgrader {
+	return &upgrader{cfg: cfg, session: session, done: make(chan struct{})}
+}
+
+// upgrade starts the new process and, once it is ready, hands over to it
+// in the background. Nothing changes if it returns an error. If the
+// handover fails before the shell is handed off, this process carries on;
+// after that, the session ends with it.
+func (u *upgrader) upgrade() error {
+	if err := checkUpgradable(u.cfg); err != nil {
+		return fmt.Errorf("cannot upgrade: %v", err)
+	}
+	if err := u.session.CanHandoff(); err != nil {
+		return fmt.Errorf("cannot upgrade: %v", err)
+	}
+	if !u.start() {
+		return errors.New("an upgrade is already in progress")
+	}
+
+	listeners, err := u.srv.ListenerFiles()
+	if err != nil {
+		u.abort()
+		return err
+	}
+	conn, err := startSuccessor()
+	if err != nil {
+		closeFiles(listeners)
+		u.abort()
+		return err
+	}
+	logger().Info("new process ready, handing over")
+	done := u.done
+	go func() {
+		defer close(done)
+		handedOff, err := u.handOver(conn, listeners)
+		if err == nil {
+			return
+		}
+		logger().Error("handing over to the new process failed", "error", err)
+		if !handedOff {
+			u.abort()
+		}
+	}()
+	return nil
+}
+
+// start marks an upgrade as started, unless one already was.
+func (u *upgrader) start() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.started {
+		return false
+	}
+	u.started = true
+	u.done = make(chan struct{})
+	return true
+}
+
+// abort forgets an upgrade that failed before it could hand over.
+func (u *upgrader) abort() {
+	u.mu.Lock()
+	u.started = false
+	u.mu.Unlock()
+}
+
+// wait waits for a handover in progress to finish.
+func (u *upgrader) wait() {
+	u.mu.Lock()
+	started, done := u.started, u.done
+	u.mu.Unlock()
+	if started {
+		<-done
+	}
+}
+
+// watchSignal upgrades on SIGUSR2 until ctx is done.
+func (u *upgrader) watchSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if err := u.upgrade(); err != nil {
+					logger().Error("upgrade failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// handOver sends the shell and the sockets to the new process and stops
+// serving once it has taken them. Clients stay connected until then, so
+// they are only asked to reconnect when the new process is there to answer.
+// handedOff reports whether the shell had left this process; if it did and
+// handOver fails, the session is over and this process stops serving too.
+func (u *upgrader) handOver(conn *net.UnixConn, listeners map[string]*os.File) (handedOff bool, err error) {
+	defer conn.Close()
+	defer closeFiles(listeners)
+
+	shell, err := u.session.Handoff()
+	if err != nil {
+		return false, err
+	}
+	defer shell.PTY.Close()
+	defer u.srv.Drain()
+
+	state := handoffState{
+		ShellPID:   shell.PID,
+		Cols:       shell.Cols,
+		Rows:       shell.Rows,
+		Scrollback: shell.Scrollback,
+		Alias:      u.srv.Alias(),
+	}
+	fds := []int{int(shell.PTY.Fd())}
+	for key, f := range listeners {
+		state.Listeners = append(state.Listeners, key)
+		fds = append(fds, int(f.Fd()))
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(handoffTimeout))
+	if _, _, err := conn.WriteMsgUnix([]byte{0}, unix.UnixRights(fds...), nil); err != nil {
+		return true, err
+	}
+	if err := json.NewEncoder(conn).Encode(state); err != nil {
+		return true, err
+	}
+	// The new process answers once it holds the shell and the sockets.
+	if _, err := io.ReadFull(conn, make([]byte, 1)); err != nil {
+		return true, errors.New("the new process did not take over; see its log")
+	}
+	return true, nil
+}
+
+// startSuccessor starts this binary again with the same arguments and
+// waits until it is ready to take over. The new process inherits the
+// environment, owner token included, and reaches this one on fd 3.
+func startSuccessor() (*net.UnixConn, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	pair, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	local := os.NewFile(uintptr(pair[0]), "handoff")
+	remote := os.NewFile(uintptr(pair[1]), "handoff")
+	defer remote.Close()
+	fc, err := net.FileConn(local)
+	_ = local.Close()
+	if err != nil {
+		return nil, err
+	}
+	conn := fc.(*net.UnixConn)
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), handoffEnv+"=1")
+	cmd.ExtraFiles = []*os.File{remote}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to start the new process: %v", err)
+	}
+	// Reaped here if it fails; otherwise it outlives this process.
+	go func() { _ = cmd.Wait() }()
+
+	_ = conn.SetReadDeadline(time.Now().Add(successorReadyTimeout))
+	if _, err := io.ReadFull(conn, make([]byte, 1)); err != nil {
+		_ = cmd.Process.Kill()
+		_ = conn.Close()
+		return nil, errors.New("the new process exited or did not get ready in time; see its log")
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	return conn, nil
+}
+
+// takeHandoff takes over the shell and sockets of the process this one
+// replaces. It returns nil when this process was started normally.
+func takeHandoff() (*handoff, error) {
+	if os.Getenv(handoffEnv) == "" {
+		return nil, nil
+	}
+	_ = os.Unsetenv(handoffEnv)
+
+	f := os.NewFile(3, "handoff")
+	fc, err := net.FileConn(f)
+	_ = f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("invalid handoff: %v", err)
+	}
+	defer fc.Close()
+	conn, ok := fc.(*net.UnixConn)
+	if !ok {
+		return nil, errors.New("invalid handoff: not a unix socket")
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(handoffTimeout))
+	if _, err := conn.Write([]byte{1}); err != nil {
+		return nil, fmt.Errorf("handoff failed: %v", err)
+	}
+	oob := make([]byte, unix.CmsgSpace(maxHandoffFiles*4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(make([]byte, 1), oob)
+	if err != nil {
+		return nil, fmt.Errorf("handoff failed: %v", err)
+	}
+	var fds []int
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err == nil {
+		for i := range msgs {
+			if rights, err := unix.ParseUnixRights(&msgs[i]); err == nil {
+				fds = append(fds, rights...)
+			}
+		}
+	}
+
+	var state handoffState
+	if err := json.NewDecoder(conn).Decode(&state); err != nil {
+		closeFDs(fds)
+		return nil, fmt.Errorf("handoff failed: %v", err)
+	}
+	if len(fds) != len(state.Listeners)+1 {
+		closeFDs(fds)
+		return nil, fmt.Errorf("handoff failed: got %d files for %d sockets", len(fds), len(state.Listeners))
+	}
+	// Tell the previous process it can stop serving.
+	if _, err := conn.Write([]byte{1}); err != nil {
+		closeFDs(fds)
+		return nil, fmt.Errorf("handoff failed: %v", err)
+	}
+
+	h := &handoff{
+		shell: &terminal.Handoff{
+			PTY:        os.NewFile(uintptr(fds[0]), "pty"),
+			PID:        state.ShellPID,
+			Scrollback: state.Scrollback,
+			Cols:       state.Cols,
+			Rows:       state.Rows,
+		},
+		listeners: make(map[string]*os.File, len(state.Listeners)),
+		alias:     state.Alias,
+	}
+	for i, key := range state.Listeners {
+		h.listeners[key] = os.NewFile(uintptr(fds[i+1]), key)
+	}
+	logger().Info("took over from the previous process", "shell", state.ShellPID, "sockets", len(state.Listeners))
+	return h, nil
+}
+
+func closeFiles(files map[string]*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+func closeFDs(fds []int) {
+	for _, fd := range fds {
+		_ = unix.Close(fd)
+	}
+}
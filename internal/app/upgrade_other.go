@@ -0,0 +1,40 @@
+//go:build !linux
+
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"alices-mirror/internal/server"
+	"alices-mirror/internal/terminal"
+)
+
+// errNoUpgrade is returned outside Linux, where the shell's PTY cannot be
+// handed to a new process.
+var errNoUpgrade = errors.New("live upgrade is only supported on Linux")
+
+// upgrader refuses every upgrade outside Linux.
+type upgrader struct {
+	srv *server.Server
+}
+
+func newUpgrader(Config, *terminal.Session) *upgrader {
+	return &upgrader{}
+}
+
+func (u *upgrader) upgrade() error {
+	return errNoUpgrade
+}
+
+func (u *upgrader) wait() {}
+
+func (u *upgrader) watchSignal(context.Context) {}
+
+func takeHandoff() (*handoff, error) {
+	if os.Getenv(handoffEnv) != "" {
+		return nil, errNoUpgrade
+	}
+	return nil, nil
+}
@@ -0,0 +1,227 @@
+// Package bench drives synthetic terminal output through the session,
+// broadcast and WebSocket pipeline and measures throughput.
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+	"alices-mirror/internal/server"
+	"alices-mirror/internal/terminal"
+)
+
+// ackEveryBytes matches how often the web client acknowledges output.
+const ackEveryBytes = 32 << 10
+
+// idleTimeout ends a client's measurement when output stops short of the
+// full size, which happens when a slow client had output dropped.
+const idleTimeout = 2 * time.Second
+
+type Config struct {
+	// Clients is the number of simulated WebSocket viewers.
+	Clients int
+	// Bytes is how much output the synthetic shell produces.
+	Bytes int64
+	// ChunkSize is the size of each synthetic write. Defaults to 4096.
+	ChunkSize int
+}
+
+type Result struct {
+	Clients int
+	Bytes   int64
+	// Received is the output that reached the clients, summed over all of
+	// them. It falls short of Clients*Bytes when output was dropped.
+	Received  int64
+	Elapsed   time.Duration
+	Mallocs   uint64
+	AllocSize uint64
+}
+
+// Throughput returns the average output rate in MB/s seen by one client.
+func (r Result) Throughput() float64 {
+	if r.Clients <= 0 {
+		return 0
+	}
+	return r.Delivered() / float64(r.Clients)
+}
+
+// Delivered returns the aggregate rate in MB/s across all clients.
+func (r Result) Delivered() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Received) / r.Elapsed.Seconds() / (1 << 20)
+}
+
+func (r Result) String() string {
+	allocsPerMB := 0.0
+	if r.Bytes > 0 {
+		allocsPerMB = float64(r.Mallocs) / (float64(r.Bytes) / (1 << 20))
+	}
+	deliveredPct := 0.0
+	if r.Bytes > 0 && r.Clients > 0 {
+		deliveredPct = 100 * float64(r.Received) / float64(r.Bytes*int64(r.Clients))
+	}
+	return fmt.Sprintf("%d client(s), %d MB in %s: %.1f MB/s per client, %.1f MB/s delivered (%.1f%% of output), %d allocs (%.0f/MB), %d MB allocated",
+		r.Clients, r.Bytes>>20, r.Elapsed.Round(time.Millisecond), r.Throughput(), r.Delivered(), deliveredPct,
+		r.Mallocs, allocsPerMB, r.AllocSize>>20)
+}
+
+// Run starts a server on a loopback port, connects cfg.Clients viewers and
+// measures how long it takes for all of them to receive cfg.Bytes of output.
+func Run(cfg Config) (Result, error) {
+	if cfg.Clients <= 0 {
+		return Result{}, errors.New("at least one client is required")
+	}
+	if cfg.Bytes <= 0 {
+		return Result{}, errors.New("output size must be positive")
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = terminal.DefaultReadBufferSize
+	}
+
+	gen := newGenerator(cfg.Bytes, cfg.ChunkSize)
+	session := terminal.NewReaderSession(terminal.Config{ReadBufferSize: cfg.ChunkSize}, gen)
+	defer session.Close()
+
+	port, err := freePort()
+	if err != nil {
+		return Result{}, err
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	userLevels, _ := server.ParseUserLevelRules("*-1")
+	srv, err := server.New(server.Config{
+		Addrs:      []string{addr},
+		AllowIPs:   []string{"127.0.0.1"},
+		Session:    session,
+		UserLevels: userLevels,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = srv.Start(ctx)
+	}()
+
+	conns, err := dialClients(ctx, "ws://"+addr+"/ws", cfg.Clients)
+	if err != nil {
+		return Result{}, err
+	}
+	defer func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	gen.start()
+
+	var wg sync.WaitGroup
+	received := make([]int64, len(conns))
+	finished := make([]time.Time, len(conns))
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn *websocket.Conn) {
+			defer wg.Done()
+			received[i], finished[i] = readOutput(conn, cfg.Bytes)
+		}(i, conn)
+	}
+	wg.Wait()
+	runtime.ReadMemStats(&after)
+
+	result := Result{
+		Clients:   cfg.Clients,
+		Bytes:     cfg.Bytes,
+		Mallocs:   after.Mallocs - before.Mallocs,
+		AllocSize: after.TotalAlloc - before.TotalAlloc,
+	}
+	for i, n := range received {
+		result.Received += n
+		result.Elapsed = max(result.Elapsed, finished[i].Sub(start))
+	}
+	return result, nil
+}
+
+func dialClients(ctx context.Context, url string, count int) ([]*websocket.Conn, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{protocol.Subprotocol}
+
+	conns := make([]*websocket.Conn, 0, count)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(conns) < count {
+		conn, _, err := dialer.DialContext(ctx, url, http.Header{})
+		if err != nil {
+			if time.Now().After(deadline) {
+				for _, c := range conns {
+					_ = c.Close()
+				}
+				return nil, fmt.Errorf("failed to connect benchmark client: %v", err)
+			}
+			time.Sleep(20 * time.Millisecond)
+			continue
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// readOutput reads until want bytes of output arrived or the stream went
+// idle, acknowledging output like the web client does. It returns the bytes
+// received and when the last of them arrived.
+func readOutput(conn *websocket.Conn, want int64) (int64, time.Time) {
+	// Messages are discarded without being buffered and acks reuse one
+	// buffer, so allocations measured are the server's.
+	var total, lastAck int64
+	var ack []byte
+	last := time.Now()
+	for total < want {
+		_ = conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		messageType, reader, err := conn.NextReader()
+		if err != nil {
+			break
+		}
+		n, err := io.Copy(io.Discard, reader)
+		if err != nil {
+			break
+		}
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+		total += n
+		last = time.Now()
+		if total-lastAck >= ackEveryBytes {
+			lastAck = total
+			ack = fmt.Appendf(ack[:0], `{"type":"ack","bytes":%d}`, total)
+			if err := conn.WriteMessage(websocket.TextMessage, ack); err != nil {
+				break
+			}
+		}
+	}
+	return total, last
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
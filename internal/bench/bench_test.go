@@ -0,0 +1,27 @@
+package bench
+
+import (
+	"fmt"
+	"testing"
+)
+
+func BenchmarkPipeline(b *testing.B) {
+	const chunkSize = 4096
+
+	for _, clients := range []int{1, 8, 32} {
+		b.Run(fmt.Sprintf("clients=%d", clients), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(chunkSize)
+
+			result, err := Run(Config{Clients: clients, Bytes: int64(b.N) * chunkSize, ChunkSize: chunkSize})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if want := result.Bytes * int64(clients); result.Received < want {
+				b.Logf("clients received %d of %d bytes", result.Received, want)
+			}
+			b.ReportMetric(float64(result.Elapsed.Nanoseconds())/float64(b.N), "ns/op")
+			b.ReportMetric(result.Delivered(), "MB/s-delivered")
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+)
+
+// generator is an io.Reader producing size bytes of colored log-like lines in
+// chunks of at most chunkSize. Reads block until start is called.
+type generator struct {
+	remaining int64
+	chunkSize int
+	pattern   []byte
+	pos       int
+	started   chan struct{}
+}
+
+func newGenerator(size int64, chunkSize int) *generator {
+	var pattern []byte
+	for i := 0; i < 64; i++ {
+		pattern = fmt.Appendf(pattern, "\x1b[32m%04d\x1b[0m build step %02d: compiling package alices-mirror/internal/%c\r\n", i, i%16, 'a'+i%26)
+	}
+	return &generator{
+		remaining: size,
+		chunkSize: chunkSize,
+		pattern:   pattern,
+		started:   make(chan struct{}),
+	}
+}
+
+func (g *generator) start() {
+	close(g.started)
+}
+
+func (g *generator) Read(p []byte) (int, error) {
+	<-g.started
+	if g.remaining <= 0 {
+		return 0, io.EOF
+	}
+	n := min(len(p), g.chunkSize)
+	if int64(n) > g.remaining {
+		n = int(g.remaining)
+	}
+	for i := 0; i < n; {
+		copied := copy(p[i:n], g.pattern[g.pos:])
+		i += copied
+		g.pos = (g.pos + copied) % len(g.pattern)
+	}
+	g.remaining -= int64(n)
+	return n, nil
+}
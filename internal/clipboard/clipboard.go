@@ -0,0 +1,69 @@
+// Package clipboard reads and writes the host clipboard through the platform's
+// command-line clipboard tools.
+package clipboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const commandTimeout = 5 * time.Second
+
+// ErrUnavailable is returned when no supported clipboard tool is installed.
+var ErrUnavailable = errors.New("no clipboard tool available")
+
+type tool struct {
+	read  []string
+	write []string
+}
+
+// Read returns the current clipboard text.
+func Read() (string, error) {
+	for _, t := range tools() {
+		if len(t.read) == 0 || !installed(t.read[0]) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		out, err := exec.CommandContext(ctx, t.read[0], t.read[1:]...).Output()
+		cancel()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", t.read[0], err)
+		}
+		return normalizeRead(string(out)), nil
+	}
+	return "", ErrUnavailable
+}
+
+// Write replaces the clipboard contents with text.
+func Write(text string) error {
+	for _, t := range tools() {
+		if len(t.write) == 0 || !installed(t.write[0]) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		cmd := exec.CommandContext(ctx, t.write[0], t.write[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		cancel()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("%s: %s", t.write[0], msg)
+			}
+			return fmt.Errorf("%s: %w", t.write[0], err)
+		}
+		return nil
+	}
+	return ErrUnavailable
+}
+
+func installed(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
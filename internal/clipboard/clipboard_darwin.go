@@ -0,0 +1,9 @@
+package clipboard
+
+func tools() []tool {
+	return []tool{{read: []string{"pbpaste"}, write: []string{"pbcopy"}}}
+}
+
+func normalizeRead(text string) string {
+	return text
+}
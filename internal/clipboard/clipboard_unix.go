@@ -0,0 +1,22 @@
+//go:build !darwin && !windows
+
+package clipboard
+
+import "os"
+
+func tools() []tool {
+	var out []tool
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		out = append(out, tool{read: []string{"wl-paste", "--no-newline"}, write: []string{"wl-copy"}})
+	}
+	out = append(out,
+		tool{read: []string{"xclip", "-selection", "clipboard", "-o"}, write: []string{"xclip", "-selection", "clipboard", "-i"}},
+		tool{read: []string{"xsel", "--clipboard", "--output"}, write: []string{"xsel", "--clipboard", "--input"}},
+		tool{read: []string{"termux-clipboard-get"}, write: []string{"termux-clipboard-set"}},
+	)
+	return out
+}
+
+func normalizeRead(text string) string {
+	return text
+}
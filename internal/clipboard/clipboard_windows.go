@@ -0,0 +1,15 @@
+package clipboard
+
+import "strings"
+
+func tools() []tool {
+	return []tool{{
+		read:  []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", "[Console]::OutputEncoding=[Text.Encoding]::UTF8; Get-Clipboard -Raw"},
+		write: []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", "$text=[Console]::In.ReadToEnd(); Set-Clipboard -Value $text"},
+	}}
+}
+
+func normalizeRead(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.TrimSuffix(text, "\n")
+}
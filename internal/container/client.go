@@ -0,0 +1,275 @@
+// Package container talks to the Docker Engine API, which Podman also
+// serves, to run an interactive shell inside a running container. Only the
+// handful of exec endpoints the mirror needs are implemented.
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const apiTimeout = 10 * time.Second
+
+// Client is a connection to a container engine.
+type Client struct {
+	network string
+	address string
+	http    *http.Client
+}
+
+// NewClient finds the engine from DOCKER_HOST or CONTAINER_HOST, falling
+// back to the default Docker and Podman sockets.
+func NewClient() (*Client, error) {
+	for _, env := range []string{"DOCKER_HOST", "CONTAINER_HOST"} {
+		if host := strings.TrimSpace(os.Getenv(env)); host != "" {
+			client, err := clientFor(host)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", env, err)
+			}
+			return client, nil
+		}
+	}
+	for _, path := range defaultSockets() {
+		if _, err := os.Stat(path); err == nil {
+			return clientFor("unix://" + path)
+		}
+	}
+	return nil, errors.New("no Docker or Podman socket found (set DOCKER_HOST)")
+}
+
+func defaultSockets() []string {
+	paths := []string{"/var/run/docker.sock"}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "podman", "podman.sock"), filepath.Join(dir, "docker.sock"))
+	}
+	return append(paths, "/run/podman/podman.sock")
+}
+
+func clientFor(host string) (*Client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{}
+	switch u.Scheme {
+	case "unix":
+		c.network, c.address = "unix", u.Path
+	case "tcp", "http":
+		c.network, c.address = "tcp", u.Host
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q (expected unix:// or tcp://)", u.Scheme)
+	}
+	if c.address == "" {
+		return nil, errors.New("missing address")
+	}
+	c.http = &http.Client{
+		Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return c.dial(ctx)
+		}},
+		Timeout: apiTimeout,
+	}
+	return c, nil
+}
+
+func (c *Client) dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, c.network, c.address)
+}
+
+// ExecConfig describes a process to start in a container.
+type ExecConfig struct {
+	Cmd        []string
+	Env        []string
+	WorkingDir string
+	Tty        bool
+	Stdin      bool
+}
+
+// CreateExec prepares cmd in container and returns the exec ID.
+func (c *Client) CreateExec(ctx context.Context, container string, cfg ExecConfig) (string, error) {
+	body := map[string]any{
+		"AttachStdin":  cfg.Stdin,
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Tty":          cfg.Tty,
+		"Cmd":          cfg.Cmd,
+		"Env":          cfg.Env,
+		"WorkingDir":   cfg.WorkingDir,
+	}
+	var resp struct {
+		ID string `json:"Id"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(container)+"/exec", body, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// StartExec starts an exec and returns its attached stream. With a TTY the
+// stream is the raw terminal; without one it is multiplexed (see Demux).
+func (c *Client) StartExec(ctx context.Context, id string, tty bool) (net.Conn, error) {
+	payload, _ := json.Marshal(map[string]bool{"Detach": false, "Tty": tty})
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, _ := http.NewRequest(http.MethodPost, "http://engine/exec/"+url.PathEscape(id)+"/start", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		return nil, apiError(resp)
+	}
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// ResizeExec sets the TTY size of an exec.
+func (c *Client) ResizeExec(ctx context.Context, id string, cols, rows int) error {
+	path := fmt.Sprintf("/exec/%s/resize?h=%d&w=%d", url.PathEscape(id), rows, cols)
+	return c.call(ctx, http.MethodPost, path, nil, nil)
+}
+
+// ExecState is the part of an exec's inspect data the mirror uses.
+type ExecState struct {
+	Running  bool
+	ExitCode int
+}
+
+// InspectExec reports whether an exec is still running.
+func (c *Client) InspectExec(ctx context.Context, id string) (ExecState, error) {
+	var state ExecState
+	err := c.call(ctx, http.MethodGet, "/exec/"+url.PathEscape(id)+"/json", nil, &state)
+	return state, err
+}
+
+// Run runs cmd in container without a TTY and returns its standard output.
+func (c *Client) Run(ctx context.Context, container string, cmd []string) (string, error) {
+	id, err := c.CreateExec(ctx, container, ExecConfig{Cmd: cmd})
+	if err != nil {
+		return "", err
+	}
+	conn, err := c.StartExec(ctx, id, false)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	var stdout, stderr bytes.Buffer
+	if err := Demux(conn, &stdout, &stderr); err != nil {
+		return "", err
+	}
+	if state, err := c.InspectExec(ctx, id); err == nil && state.ExitCode != 0 {
+		return stdout.String(), fmt.Errorf("exit status %d: %s", state.ExitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Demux splits a non-TTY exec stream, whose frames carry an 8-byte header
+// naming the stream and the payload length, into stdout and stderr.
+func Demux(r io.Reader, stdout, stderr io.Writer) error {
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:8]))
+		dst := stdout
+		if header[0] == 2 {
+			dst = stderr
+		}
+		if _, err := io.CopyN(dst, r, size); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) call(ctx context.Context, method, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://engine"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return apiError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func apiError(resp *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(data, &body) == nil && body.Message != "" {
+		return errors.New(body.Message)
+	}
+	if msg := strings.TrimSpace(string(data)); msg != "" {
+		return errors.New(msg)
+	}
+	return errors.New(resp.Status)
+}
+
+// bufferedConn reads through the buffer left over from the HTTP response.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// CloseWrite half-closes the stream so the process sees end of input.
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
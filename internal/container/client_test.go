@@ -0,0 +1,47 @@
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestDemux(t *testing.T) {
+	t.Parallel()
+
+	var stream []byte
+	stream = append(stream, frame(1, "out1 ")...)
+	stream = append(stream, frame(2, "err")...)
+	stream = append(stream, frame(1, "out2")...)
+
+	var stdout, stderr bytes.Buffer
+	if err := Demux(bytes.NewReader(stream), &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "out1 out2" || stderr.String() != "err" {
+		t.Fatalf("stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+
+	if err := Demux(bytes.NewReader(stream[:len(stream)-2]), &stdout, &stderr); err == nil {
+		t.Fatal("truncated stream was accepted")
+	}
+}
+
+func TestClientForRejectsUnknownScheme(t *testing.T) {
+	t.Parallel()
+
+	if _, err := clientFor("npipe:////./pipe/docker_engine"); err == nil {
+		t.Fatal("npipe host was accepted")
+	}
+	c, err := clientFor("tcp://127.0.0.1:2375")
+	if err != nil || c.network != "tcp" || c.address != "127.0.0.1:2375" {
+		t.Fatalf("clientFor(tcp) = %+v, %v", c, err)
+	}
+}
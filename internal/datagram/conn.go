@@ -0,0 +1,337 @@
+package datagram
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// maxInFlight is how many segments may be sent but unacknowledged.
+	maxInFlight = 256
+	// maxReadBuffer bounds data received but not yet read; segments beyond
+	// it are left unacknowledged and come again later.
+	maxReadBuffer = 4 << 20
+
+	initialRTO        = 250 * time.Millisecond
+	minRTO            = 30 * time.Millisecond
+	maxRTO            = 2 * time.Second
+	tickInterval      = 10 * time.Millisecond
+	keepAliveInterval = 2 * time.Second
+	// IdleTimeout closes a session that has heard nothing from its peer,
+	// not even keep-alives, for this long.
+	IdleTimeout = 60 * time.Second
+)
+
+var (
+	// ErrClosed is returned by operations on a closed session.
+	ErrClosed  = errors.New("datagram: session closed")
+	errTimeout = errors.New("datagram: no answer from server")
+)
+
+type segment struct {
+	seq     uint32
+	data    []byte
+	sentAt  time.Time
+	retries int
+}
+
+// Conn is one end of a session. It is safe for one reader and any number of
+// writers.
+type Conn struct {
+	id      SessionID
+	aead    cipher.AEAD
+	sendDir direction
+	recvDir direction
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	pc   net.PacketConn
+	peer net.Addr
+	// roams lets the peer address follow authenticated packets; only the
+	// server side does that.
+	roams bool
+
+	sendCounter uint64
+	recvCounter uint64
+
+	nextSeq uint32
+	unacked []*segment
+
+	recvNext   uint32
+	outOfOrder map[uint32][]byte
+	readBuf    bytes.Buffer
+
+	srtt     time.Duration
+	rto      time.Duration
+	lastRecv time.Time
+	lastSend time.Time
+
+	established     chan struct{}
+	establishedOnce sync.Once
+
+	closed   bool
+	closeErr error
+	done     chan struct{}
+	onClose  func()
+}
+
+func newConn(id SessionID, key []byte, sendDir, recvDir direction) (*Conn, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	c := &Conn{
+		id:          id,
+		aead:        aead,
+		sendDir:     sendDir,
+		recvDir:     recvDir,
+		nextSeq:     1,
+		recvNext:    1,
+		outOfOrder:  make(map[uint32][]byte),
+		rto:         initialRTO,
+		lastRecv:    now,
+		lastSend:    now,
+		established: make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	go c.tickLoop()
+	return c, nil
+}
+
+// Established is closed once the first authenticated packet arrives.
+func (c *Conn) Established() <-chan struct{} {
+	return c.established
+}
+
+// RemoteAddr returns the address packets are currently sent to.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peer
+}
+
+// Write queues p for reliable delivery, blocking while too much is in
+// flight.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		for !c.closed && len(c.unacked) >= maxInFlight {
+			c.cond.Wait()
+		}
+		if c.closed {
+			return written, c.closeErrLocked()
+		}
+		n := min(len(p), maxSegment)
+		seg := &segment{seq: c.nextSeq, data: append([]byte(nil), p[:n]...)}
+		c.nextSeq++
+		c.unacked = append(c.unacked, seg)
+		c.sendSegmentLocked(seg, time.Now())
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Read reads data in order as it arrives.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.readBuf.Len() == 0 && !c.closed {
+		c.cond.Wait()
+	}
+	if c.readBuf.Len() == 0 {
+		return 0, c.closeErrLocked()
+	}
+	return c.readBuf.Read(p)
+}
+
+// Close ends the session and tells the peer.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.sendLocked(packet{ack: c.recvNext - 1, flags: flagClose}, time.Now())
+	c.closeLocked(ErrClosed)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Conn) closeErrLocked() error {
+	if c.closeErr == io.EOF || c.closeErr == nil {
+		return io.EOF
+	}
+	return c.closeErr
+}
+
+func (c *Conn) closeLocked(err error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.closeErr = err
+	close(c.done)
+	c.cond.Broadcast()
+	if c.onClose != nil {
+		go c.onClose()
+	}
+}
+
+func (c *Conn) sendSegmentLocked(seg *segment, now time.Time) {
+	seg.sentAt = now
+	c.sendLocked(packet{seq: seg.seq, ack: c.recvNext - 1, payload: seg.data}, now)
+}
+
+func (c *Conn) sendLocked(p packet, now time.Time) {
+	if c.pc == nil || c.peer == nil {
+		return
+	}
+	c.sendCounter++
+	data := sealPacket(c.aead, c.id, c.sendDir, c.sendCounter, p)
+	_, _ = c.pc.WriteTo(data, c.peer)
+	c.lastSend = now
+}
+
+// handlePacket processes a raw packet received on pc from addr.
+func (c *Conn) handlePacket(pc net.PacketConn, addr net.Addr, data []byte) {
+	p, counter, ok := openPacket(c.aead, c.recvDir, data)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	now := time.Now()
+	c.lastRecv = now
+	// Only a packet newer than any seen before may move the session, so a
+	// replayed packet cannot redirect it.
+	if c.roams && counter > c.recvCounter {
+		c.pc = pc
+		c.peer = addr
+	}
+	if counter > c.recvCounter {
+		c.recvCounter = counter
+	}
+	c.establishedOnce.Do(func() { close(c.established) })
+
+	c.handleAckLocked(p.ack, now)
+
+	if p.flags&flagClose != 0 {
+		c.closeLocked(io.EOF)
+		return
+	}
+	if p.seq == 0 {
+		if p.flags&flagProbe != 0 {
+			c.sendLocked(packet{ack: c.recvNext - 1}, now)
+		}
+		return
+	}
+	c.receiveSegmentLocked(p.seq, p.payload)
+	c.sendLocked(packet{ack: c.recvNext - 1}, now)
+}
+
+func (c *Conn) handleAckLocked(ack uint32, now time.Time) {
+	acked := 0
+	for acked < len(c.unacked) && c.unacked[acked].seq <= ack {
+		seg := c.unacked[acked]
+		if seg.retries == 0 {
+			c.sampleRTTLocked(now.Sub(seg.sentAt))
+		}
+		acked++
+	}
+	if acked == 0 {
+		return
+	}
+	c.unacked = append(c.unacked[:0], c.unacked[acked:]...)
+	c.cond.Broadcast()
+}
+
+func (c *Conn) sampleRTTLocked(sample time.Duration) {
+	if c.srtt == 0 {
+		c.srtt = sample
+	} else {
+		c.srtt = (7*c.srtt + sample) / 8
+	}
+	c.rto = min(max(2*c.srtt+tickInterval, minRTO), maxRTO)
+}
+
+func (c *Conn) receiveSegmentLocked(seq uint32, payload []byte) {
+	if seq < c.recvNext || seq >= c.recvNext+maxInFlight {
+		return
+	}
+	if seq != c.recvNext {
+		if _, ok := c.outOfOrder[seq]; !ok {
+			c.outOfOrder[seq] = append([]byte(nil), payload...)
+		}
+		return
+	}
+	if c.readBuf.Len()+len(payload) > maxReadBuffer {
+		return
+	}
+	c.readBuf.Write(payload)
+	c.recvNext++
+	for {
+		next, ok := c.outOfOrder[c.recvNext]
+		if !ok || c.readBuf.Len()+len(next) > maxReadBuffer {
+			break
+		}
+		delete(c.outOfOrder, c.recvNext)
+		c.readBuf.Write(next)
+		c.recvNext++
+	}
+	c.cond.Broadcast()
+}
+
+func (c *Conn) tickLoop() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			c.tick(now)
+		}
+	}
+}
+
+// tick retransmits overdue segments, keeps an idle session alive and
+// expires a silent one.
+func (c *Conn) tick(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if now.Sub(c.lastRecv) > IdleTimeout {
+		c.closeLocked(os.ErrDeadlineExceeded)
+		return
+	}
+	for _, seg := range c.unacked {
+		backoff := c.rto << min(seg.retries, 6)
+		if now.Sub(seg.sentAt) < min(backoff, maxRTO) {
+			continue
+		}
+		seg.retries++
+		c.sendSegmentLocked(seg, now)
+	}
+	if now.Sub(c.lastSend) > keepAliveInterval {
+		c.sendLocked(packet{ack: c.recvNext - 1}, now)
+	}
+}
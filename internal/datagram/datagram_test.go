@@ -0,0 +1,135 @@
+package datagram
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	mathrand "math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyConn drops a quarter of the packets in each direction.
+type lossyConn struct {
+	net.PacketConn
+	mu  sync.Mutex
+	rnd *mathrand.Rand
+}
+
+func (l *lossyConn) drop() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rnd.Intn(4) == 0
+}
+
+func (l *lossyConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := l.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+		if !l.drop() {
+			return n, addr, nil
+		}
+	}
+}
+
+func (l *lossyConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if l.drop() {
+		return len(p), nil
+	}
+	return l.PacketConn.WriteTo(p, addr)
+}
+
+func TestRoundTripOverLossyLink(t *testing.T) {
+	t.Parallel()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	listener := NewListener()
+	defer listener.Close()
+	go func() { _ = listener.Serve(&lossyConn{PacketConn: pc, rnd: mathrand.New(mathrand.NewSource(1))}) }()
+
+	server, id, key, err := listener.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := Dial(pc.LocalAddr().String(), id, key, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	payload := make([]byte, 200<<10)
+	_, _ = rand.Read(payload)
+	go func() {
+		_ = WriteMessage(server, BinaryMessage, payload)
+		_ = WriteMessage(server, TextMessage, []byte(`{"type":"done"}`))
+	}()
+
+	reader := NewMessageReader(client)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		kind, data, err := reader.ReadMessage()
+		if err != nil || kind != BinaryMessage || !bytes.Equal(data, payload) {
+			t.Errorf("first message: kind=%d len=%d err=%v", kind, len(data), err)
+			return
+		}
+		kind, data, err = reader.ReadMessage()
+		if err != nil || kind != TextMessage || string(data) != `{"type":"done"}` {
+			t.Errorf("second message: kind=%d data=%q err=%v", kind, data, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("messages were not delivered")
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1)
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := server.Read(buf)
+		readErr <- err
+	}()
+	select {
+	case err := <-readErr:
+		if err != io.EOF {
+			t.Fatalf("server read after close = %v, want EOF", err)
+		}
+	case <-time.After(5 * time.Second):
+		// The close packet itself may be lost; the idle timeout covers that.
+	}
+}
+
+func TestOpenRejectsTamperedPacket(t *testing.T) {
+	t.Parallel()
+
+	id, key, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, _ := newAEAD(key)
+	data := sealPacket(aead, id, toServer, 7, packet{seq: 3, ack: 2, payload: []byte("hi")})
+
+	p, counter, ok := openPacket(aead, toServer, data)
+	if !ok || counter != 7 || p.seq != 3 || p.ack != 2 || string(p.payload) != "hi" {
+		t.Fatalf("openPacket = %+v, %d, %v", p, counter, ok)
+	}
+	if _, _, ok := openPacket(aead, toClient, data); ok {
+		t.Fatal("packet opened in the wrong direction")
+	}
+	data[idSize+counterSize-1] ^= 1
+	if _, _, ok := openPacket(aead, toServer, data); ok {
+		t.Fatal("tampered packet was accepted")
+	}
+}
@@ -0,0 +1,64 @@
+package datagram
+
+import (
+	"net"
+	"time"
+)
+
+// Dial opens the client end of a session created on a Listener at addr. It
+// returns once the server has answered, or fails after timeout.
+func Dial(addr string, id SessionID, key []byte, timeout time.Duration) (*Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// An unconnected socket keeps working if the local address changes.
+	pc, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	conn, err := newConn(id, key, toServer, toClient)
+	if err != nil {
+		_ = pc.Close()
+		return nil, err
+	}
+	conn.pc = pc
+	conn.peer = raddr
+	conn.onClose = func() { _ = pc.Close() }
+
+	go func() {
+		buf := make([]byte, 64<<10)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				conn.mu.Lock()
+				conn.closeLocked(err)
+				conn.mu.Unlock()
+				return
+			}
+			conn.handlePacket(pc, from, buf[:n])
+		}
+	}()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	probe := time.NewTicker(200 * time.Millisecond)
+	defer probe.Stop()
+	for {
+		conn.mu.Lock()
+		conn.sendLocked(packet{flags: flagProbe}, time.Now())
+		conn.mu.Unlock()
+		select {
+		case <-conn.established:
+			return conn, nil
+		case <-conn.done:
+			conn.mu.Lock()
+			defer conn.mu.Unlock()
+			return nil, conn.closeErr
+		case <-deadline.C:
+			_ = conn.Close()
+			return nil, errTimeout
+		case <-probe.C:
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package datagram
+
+import (
+	"net"
+	"sync"
+)
+
+// Listener demultiplexes packets from one or more sockets into sessions.
+// Sessions are created ahead of time with NewSession and handed to the
+// client out of band; packets for unknown sessions are dropped.
+type Listener struct {
+	mu       sync.Mutex
+	sessions map[SessionID]*Conn
+}
+
+// NewListener returns a listener with no sessions.
+func NewListener() *Listener {
+	return &Listener{sessions: make(map[SessionID]*Conn)}
+}
+
+// NewSession creates a session and returns its server end with the ID and
+// key the client needs. The session replies to wherever its latest
+// authenticated packet came from.
+func (l *Listener) NewSession() (*Conn, SessionID, []byte, error) {
+	id, key, err := NewSession()
+	if err != nil {
+		return nil, id, nil, err
+	}
+	conn, err := newConn(id, key, toClient, toServer)
+	if err != nil {
+		return nil, id, nil, err
+	}
+	conn.roams = true
+	conn.onClose = func() {
+		l.mu.Lock()
+		if l.sessions[id] == conn {
+			delete(l.sessions, id)
+		}
+		l.mu.Unlock()
+	}
+	l.mu.Lock()
+	l.sessions[id] = conn
+	l.mu.Unlock()
+	return conn, id, key, nil
+}
+
+// Serve reads packets from pc until it is closed. It may be called for
+// several sockets at once; a session can roam between them.
+func (l *Listener) Serve(pc net.PacketConn) error {
+	buf := make([]byte, 64<<10)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		id, ok := peekSessionID(buf[:n])
+		if !ok {
+			continue
+		}
+		l.mu.Lock()
+		conn := l.sessions[id]
+		l.mu.Unlock()
+		if conn != nil {
+			conn.handlePacket(pc, addr, buf[:n])
+		}
+	}
+}
+
+// Close closes every session.
+func (l *Listener) Close() {
+	l.mu.Lock()
+	conns := make([]*Conn, 0, len(l.sessions))
+	for _, conn := range l.sessions {
+		conns = append(conns, conn)
+	}
+	l.mu.Unlock()
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+}
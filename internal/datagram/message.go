@@ -0,0 +1,56 @@
+package datagram
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Message kinds match the WebSocket message types so the same handlers can
+// serve both transports.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+const maxMessageSize = 8 << 20
+
+var errMessageTooLarge = errors.New("datagram: message too large")
+
+// WriteMessage frames one message on w.
+func WriteMessage(w io.Writer, kind int, data []byte) error {
+	frame := make([]byte, 5+len(data))
+	frame[0] = byte(kind)
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	_, err := w.Write(frame)
+	return err
+}
+
+// MessageReader reads the messages written by WriteMessage.
+type MessageReader struct {
+	r *bufio.Reader
+}
+
+// NewMessageReader returns a reader of framed messages from r.
+func NewMessageReader(r io.Reader) *MessageReader {
+	return &MessageReader{r: bufio.NewReader(r)}
+}
+
+// ReadMessage returns the next message and its kind.
+func (m *MessageReader) ReadMessage() (int, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(m.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:5])
+	if size > maxMessageSize {
+		return 0, nil, errMessageTooLarge
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(m.r, data); err != nil {
+		return 0, nil, err
+	}
+	return int(header[0]), data, nil
+}
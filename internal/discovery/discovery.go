@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"runtime"
 	"strconv"
@@ -15,16 +16,21 @@ import (
 	"time"
 
 	"github.com/grandcat/zeroconf"
+
+	"alices-mirror/internal/logging"
 )
 
 const (
 	mdnsService  = "_alices-mirror._tcp"
 	mdnsDomain   = "local."
 	udpPort      = 3003
-	udpInterval  = 2 * time.Second
+	udpInterval  = DefaultInterval
 	defaultProto = "http"
 )
 
+// DefaultInterval is the UDP broadcast interval used unless overridden.
+const DefaultInterval = 2 * time.Second
+
 type Info struct {
 	ID           string
 	Alias        string
@@ -46,6 +52,9 @@ type Service struct {
 	mdns      *zeroconf.Server
 	udp       *udpBroadcaster
 	closeOnce sync.Once
+
+	mu   sync.Mutex
+	info Info
 }
 
 type payload struct {
@@ -78,7 +87,7 @@ func Start(ctx context.Context, info Info) (*Service, error) {
 		return nil, err
 	}
 
-	svc := &Service{}
+	svc := &Service{info: normalized}
 	mdnsServer, mdnsErr := startMDNS(normalized)
 	svc.mdns = mdnsServer
 	udpBroadcaster, udpErr := startUDP(ctx, normalized)
@@ -87,6 +96,12 @@ func Start(ctx context.Context, info Info) (*Service, error) {
 	if mdnsErr != nil && udpErr != nil {
 		return nil, fmt.Errorf("discovery failed: mdns: %v; udp: %v", mdnsErr, udpErr)
 	}
+	if mdnsErr != nil {
+		logger().Warn("mDNS announcement unavailable", "error", mdnsErr)
+	}
+	if udpErr != nil {
+		logger().Warn("UDP broadcast unavailable", "error", udpErr)
+	}
 
 	go func() {
 		<-ctx.Done()
@@ -96,6 +111,10 @@ func Start(ctx context.Context, info Info) (*Service, error) {
 	return svc, nil
 }
 
+func logger() *slog.Logger {
+	return logging.For("discovery")
+}
+
 func (s *Service) Close() {
 	s.closeOnce.Do(func() {
 		if s.mdns != nil {
@@ -107,6 +126,49 @@ func (s *Service) Close() {
 	})
 }
 
+// SetAlias updates the alias advertised over mDNS TXT records and UDP. The
+// mDNS instance name keeps the value it was registered with.
+func (s *Service) SetAlias(alias string) error {
+	s.mu.Lock()
+	info := s.info
+	info.Alias = alias
+	info.DisplayName = ""
+	info.UniqueName = ""
+	normalized, err := normalizeInfo(info)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.info = normalized
+	s.mu.Unlock()
+
+	if s.mdns != nil {
+		s.mdns.SetText(buildTXT(normalized))
+	}
+	if s.udp != nil {
+		data, err := marshalPayload(normalized)
+		if err != nil {
+			return err
+		}
+		s.udp.SetPayload(data)
+	}
+	return nil
+}
+
+// SetInterval changes how often the UDP announcement is broadcast.
+func (s *Service) SetInterval(interval time.Duration) {
+	if s.udp != nil {
+		s.udp.SetInterval(interval)
+	}
+}
+
+// SetPaused pauses or resumes the UDP announcement. mDNS keeps answering queries.
+func (s *Service) SetPaused(paused bool) {
+	if s.udp != nil {
+		s.udp.SetPaused(paused)
+	}
+}
+
 func normalizeInfo(info Info) (Info, error) {
 	info.Alias = strings.TrimSpace(info.Alias)
 	info.DisplayName = strings.TrimSpace(info.DisplayName)
@@ -185,17 +247,21 @@ func buildPayload(info Info) (payload, error) {
 	}, nil
 }
 
+func marshalPayload(info Info) ([]byte, error) {
+	payloadValue, err := buildPayload(info)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(payloadValue)
+}
+
 func startMDNS(info Info) (*zeroconf.Server, error) {
 	records := buildTXT(info)
 	return zeroconf.Register(info.UniqueName, mdnsService, mdnsDomain, info.Port, records, nil)
 }
 
 func startUDP(ctx context.Context, info Info) (*udpBroadcaster, error) {
-	payloadValue, err := buildPayload(info)
-	if err != nil {
-		return nil, err
-	}
-	data, err := json.Marshal(payloadValue)
+	data, err := marshalPayload(info)
 	if err != nil {
 		return nil, err
 	}
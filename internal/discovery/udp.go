@@ -12,9 +12,13 @@ import (
 type udpBroadcaster struct {
 	conn      *net.UDPConn
 	addrs     []*net.UDPAddr
-	payload   []byte
-	interval  time.Duration
+	wake      chan struct{}
 	closeOnce sync.Once
+
+	mu       sync.Mutex
+	payload  []byte
+	interval time.Duration
+	paused   bool
 }
 
 func newUDPBroadcaster(payload []byte, port int, interval time.Duration) (*udpBroadcaster, error) {
@@ -47,6 +51,7 @@ func newUDPBroadcaster(payload []byte, port int, interval time.Duration) (*udpBr
 		conn:     conn,
 		addrs:    addrs,
 		payload:  payload,
+		wake:     make(chan struct{}, 1),
 		interval: interval,
 	}, nil
 }
@@ -63,9 +68,55 @@ func (b *udpBroadcaster) Close() {
 	})
 }
 
+// SetPayload replaces the announcement sent on the next broadcast.
+func (b *udpBroadcaster) SetPayload(payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.payload = payload
+	b.mu.Unlock()
+}
+
+// SetInterval changes the broadcast interval, taking effect immediately.
+func (b *udpBroadcaster) SetInterval(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	b.mu.Lock()
+	b.interval = interval
+	b.mu.Unlock()
+	b.notify()
+}
+
+// SetPaused stops or resumes broadcasting without closing the socket.
+func (b *udpBroadcaster) SetPaused(paused bool) {
+	b.mu.Lock()
+	changed := b.paused != paused
+	b.paused = paused
+	b.mu.Unlock()
+	if changed && !paused {
+		b.sendOnce()
+	}
+	b.notify()
+}
+
+func (b *udpBroadcaster) notify() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *udpBroadcaster) currentInterval() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.interval
+}
+
 func (b *udpBroadcaster) loop(ctx context.Context) {
-	ticker := time.NewTicker(b.interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(b.currentInterval())
+	defer timer.Stop()
 
 	b.sendOnce()
 	for {
@@ -73,14 +124,20 @@ func (b *udpBroadcaster) loop(ctx context.Context) {
 		case <-ctx.Done():
 			b.Close()
 			return
-		case <-ticker.C:
+		case <-b.wake:
+		case <-timer.C:
 			b.sendOnce()
 		}
+		timer.Reset(b.currentInterval())
 	}
 }
 
 func (b *udpBroadcaster) sendOnce() {
-	if b.conn == nil || len(b.payload) == 0 {
+	b.mu.Lock()
+	payload := b.payload
+	paused := b.paused
+	b.mu.Unlock()
+	if b.conn == nil || len(payload) == 0 || paused {
 		return
 	}
 	_ = b.conn.SetWriteDeadline(time.Now().Add(500 * time.Millisecond))
@@ -88,7 +145,9 @@ func (b *udpBroadcaster) sendOnce() {
 		if addr == nil {
 			continue
 		}
-		_, _ = b.conn.WriteToUDP(b.payload, addr)
+		if _, err := b.conn.WriteToUDP(payload, addr); err != nil {
+			logger().Debug("broadcast failed", "addr", addr.String(), "error", err)
+		}
 	}
 }
 
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Destinations accepted by SetupDest.
+const (
+	DestStderr   = "stderr"
+	DestSyslog   = "syslog"
+	DestJournald = "journald"
+)
+
+const identifier = "alices-mirror"
+
+// systemSink delivers one formatted record to the system log at a level.
+type systemSink interface {
+	write(level slog.Level, line []byte) error
+}
+
+// ParseDest accepts stderr, syslog and journald. Empty means stderr.
+func ParseDest(raw string) (string, error) {
+	switch dest := strings.ToLower(strings.TrimSpace(raw)); dest {
+	case "":
+		return DestStderr, nil
+	case DestStderr, DestSyslog, DestJournald:
+		return dest, nil
+	default:
+		return "", fmt.Errorf("unknown destination %q (expected stderr, syslog or journald)", raw)
+	}
+}
+
+// SetupDest is Setup for a named destination. syslog and journald records
+// leave out the time and level, which the system log keeps itself.
+func SetupDest(dest, level, format string) error {
+	d, err := ParseDest(dest)
+	if err != nil {
+		return err
+	}
+	if d == DestStderr {
+		return Setup(os.Stderr, level, format)
+	}
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	f, err := ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	sink, err := openSystemSink(d)
+	if err != nil {
+		return fmt.Errorf("%s unavailable: %v", d, err)
+	}
+	slog.SetDefault(slog.New(newSinkHandler(sink, lvl, f)))
+	return nil
+}
+
+// sinkHandler formats records with the standard handlers and hands each
+// one to a systemSink together with its level.
+type sinkHandler struct {
+	inner  slog.Handler
+	target *sinkWriter
+}
+
+// sinkWriter is shared by a sinkHandler and every handler derived from it.
+// The standard handlers format a record into a single Write.
+type sinkWriter struct {
+	mu    sync.Mutex
+	sink  systemSink
+	level slog.Level
+}
+
+func (w *sinkWriter) Write(p []byte) (int, error) {
+	if err := w.sink.write(w.level, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func newSinkHandler(sink systemSink, level slog.Level, format string) *sinkHandler {
+	target := &sinkWriter{sink: sink}
+	opts := &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}
+	var inner slog.Handler
+	if format == FormatJSON {
+		inner = slog.NewJSONHandler(target, opts)
+	} else {
+		inner = slog.NewTextHandler(target, opts)
+	}
+	return &sinkHandler{inner: inner, target: target}
+}
+
+func (h *sinkHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.target.mu.Lock()
+	defer h.target.mu.Unlock()
+	h.target.level = r.Level
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sinkHandler{inner: h.inner.WithAttrs(attrs), target: h.target}
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	return &sinkHandler{inner: h.inner.WithGroup(name), target: h.target}
+}
@@ -0,0 +1,95 @@
+//go:build !windows
+
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"log/syslog"
+	"net"
+	"strconv"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+func openSystemSink(dest string) (systemSink, error) {
+	if dest == DestJournald {
+		return openJournal()
+	}
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, identifier)
+	if err != nil {
+		return nil, err
+	}
+	return syslogSink{w}, nil
+}
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func (s syslogSink) write(level slog.Level, line []byte) error {
+	msg := string(bytes.TrimSuffix(line, []byte("\n")))
+	switch {
+	case level >= slog.LevelError:
+		return s.w.Err(msg)
+	case level >= slog.LevelWarn:
+		return s.w.Warning(msg)
+	case level >= slog.LevelInfo:
+		return s.w.Info(msg)
+	default:
+		return s.w.Debug(msg)
+	}
+}
+
+// journalSink speaks journald's native protocol: one datagram of
+// KEY=value fields per entry.
+type journalSink struct {
+	conn *net.UnixConn
+}
+
+func openJournal() (journalSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return journalSink{}, err
+	}
+	return journalSink{conn}, nil
+}
+
+func (s journalSink) write(level slog.Level, line []byte) error {
+	var b bytes.Buffer
+	journalField(&b, "PRIORITY", []byte(strconv.Itoa(journalPriority(level))))
+	journalField(&b, "SYSLOG_IDENTIFIER", []byte(identifier))
+	journalField(&b, "MESSAGE", bytes.TrimSuffix(line, []byte("\n")))
+	_, err := s.conn.Write(b.Bytes())
+	return err
+}
+
+// journalField appends one field; values containing a newline use the
+// length-prefixed binary form.
+func journalField(b *bytes.Buffer, key string, value []byte) {
+	b.WriteString(key)
+	if bytes.IndexByte(value, '\n') < 0 {
+		b.WriteByte('=')
+		b.Write(value)
+		b.WriteByte('\n')
+		return
+	}
+	b.WriteByte('\n')
+	_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.Write(value)
+	b.WriteByte('\n')
+}
+
+func journalPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3
+	case level >= slog.LevelWarn:
+		return 4
+	case level >= slog.LevelInfo:
+		return 6
+	default:
+		return 7
+	}
+}
@@ -0,0 +1,7 @@
+package logging
+
+import "errors"
+
+func openSystemSink(dest string) (systemSink, error) {
+	return nil, errors.New("not supported on Windows")
+}
@@ -0,0 +1,72 @@
+// Package logging configures the process-wide slog logger. Packages log
+// through For, which tags records with the component they come from and
+// always uses the logger installed by the most recent Setup.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Formats accepted by Setup.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// ParseLevel accepts debug, info, warn (or warning) and error.
+func ParseLevel(raw string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown level %q (expected debug, info, warn or error)", raw)
+	}
+}
+
+// ParseFormat accepts text and json. Empty means text.
+func ParseFormat(raw string) (string, error) {
+	switch format := strings.ToLower(strings.TrimSpace(raw)); format {
+	case "":
+		return FormatText, nil
+	case FormatText, FormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown format %q (expected text or json)", raw)
+	}
+}
+
+// Setup installs a logger writing to w at level in format as the slog
+// default.
+func Setup(w io.Writer, level, format string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	f, err := ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	if f == FormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// For returns the default logger tagged with component.
+func For(component string) *slog.Logger {
+	return slog.Default().With("component", component)
+}
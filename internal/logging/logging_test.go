@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"":        slog.LevelInfo,
+		"debug":   slog.LevelDebug,
+		"WARNING": slog.LevelWarn,
+		"error":   slog.LevelError,
+	}
+	for raw, want := range cases {
+		got, err := ParseLevel(raw)
+		if err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", raw, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) succeeded")
+	}
+}
+
+func TestSetupJSON(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	var buf bytes.Buffer
+	if err := Setup(&buf, "warn", "json"); err != nil {
+		t.Fatal(err)
+	}
+	For("server").Info("hidden")
+	For("server").Warn("shown", "n", 1)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("output %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "shown" || record["component"] != "server" {
+		t.Fatalf("record = %v", record)
+	}
+	if err := Setup(&buf, "info", "xml"); err == nil {
+		t.Fatal("Setup accepted format xml")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	f, err := OpenRotating(path, RotateOptions{MaxSize: 10, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range []string{"aaaaaa", "bbbbbb", "cccccc", "dddddd"} {
+		if _, err := f.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{path: "dddddd", path + ".1": "cccccc", path + ".2": "bbbbbb"} {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", filepath.Base(name), data, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists", filepath.Base(path))
+	}
+}
+
+type recordedSink struct {
+	levels []slog.Level
+	lines  []string
+}
+
+func (s *recordedSink) write(level slog.Level, line []byte) error {
+	s.levels = append(s.levels, level)
+	s.lines = append(s.lines, string(line))
+	return nil
+}
+
+func TestSinkHandlerPassesLevel(t *testing.T) {
+	sink := &recordedSink{}
+	log := slog.New(newSinkHandler(sink, slog.LevelInfo, FormatText)).With("component", "server")
+	log.Debug("hidden")
+	log.Info("started", "port", 3002)
+	log.Error("failed")
+
+	if len(sink.lines) != 2 || sink.levels[0] != slog.LevelInfo || sink.levels[1] != slog.LevelError {
+		t.Fatalf("levels = %v, lines = %q", sink.levels, sink.lines)
+	}
+	if want := "msg=started component=server port=3002\n"; sink.lines[0] != want {
+		t.Fatalf("line = %q, want %q", sink.lines[0], want)
+	}
+}
+
+func TestRotatingFileByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	f, err := OpenRotating(path, RotateOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, _ = f.Write([]byte("old"))
+	f.started = time.Now().Add(-2 * time.Hour)
+	_, _ = f.Write([]byte("new"))
+
+	if data, _ := os.ReadFile(path + ".1"); string(data) != "old" {
+		t.Fatalf("rotated file = %q, want old", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Fatalf("current file = %q, want new", data)
+	}
+}
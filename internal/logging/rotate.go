@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// RotateOptions limit how large and how old a log file grows and how many
+// old files are kept.
+type RotateOptions struct {
+	// MaxSize rotates the file before a write would take it past this many
+	// bytes. Zero disables size-based rotation.
+	MaxSize int64
+	// MaxAge rotates the file once it is this old. Zero disables it.
+	MaxAge time.Duration
+	// MaxFiles is how many rotated files are kept. Values below 1 keep one.
+	MaxFiles int
+}
+
+// RotatingFile is an append-only log file that is rotated by size or age:
+// path is renamed to path.1, path.1 to path.2 and so on, and the oldest
+// file beyond MaxFiles is removed.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	started time.Time
+}
+
+// OpenRotating opens path for appending, creating it readable by the owner
+// only.
+func OpenRotating(path string, opts RotateOptions) (*RotatingFile, error) {
+	if opts.MaxFiles < 1 {
+		opts.MaxFiles = 1
+	}
+	f := &RotatingFile{path: path, opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	// An existing file is dated by its last write, which errs towards
+	// rotating it sooner.
+	f.started = time.Now()
+	if f.size > 0 {
+		f.started = info.ModTime()
+	}
+	return nil
+}
+
+// Write appends p, rotating first if the file is older than MaxAge or p
+// would take it past MaxSize. A single write is never split across files.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	tooBig := f.opts.MaxSize > 0 && f.size+int64(len(p)) > f.opts.MaxSize
+	tooOld := f.opts.MaxAge > 0 && time.Since(f.started) > f.opts.MaxAge
+	if f.size > 0 && (tooBig || tooOld) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	_ = os.Remove(f.backup(f.opts.MaxFiles))
+	for i := f.opts.MaxFiles - 1; i >= 1; i-- {
+		_ = os.Rename(f.backup(i), f.backup(i+1))
+	}
+	if err := os.Rename(f.path, f.backup(1)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *RotatingFile) backup(n int) string {
+	return fmt.Sprintf("%s.%d", f.path, n)
+}
+
+// Close closes the current file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,126 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+)
+
+// MaxTerminalSize is the most columns or rows a resize may ask for, the
+// largest size a PTY window can hold.
+const MaxTerminalSize = math.MaxUint16
+
+var clientMessages = map[string]decoder{
+	TypeAck:          decodeAs[Ack],
+	TypeResize:       decodeAs[Resize],
+	TypeReset:        decodeAs[Reset],
+	TypeResetSoft:    decodeAs[ResetSoft],
+	TypeSetAlias:     decodeAs[SetAlias],
+	TypeEvents:       decodeAs[EventsRequest],
+	TypeApproval:     decodeAs[ApprovalDecision],
+	TypePasteConfirm: decodeAs[PasteDecision],
+	TypeRunSnippet:   decodeAs[RunSnippet],
+	TypeDetach:       decodeAs[Detach],
+}
+
+// Ack acknowledges terminal output: Bytes is the total the client has
+// processed so far. Clients that send it get flow control.
+type Ack struct {
+	Bytes int64 `json:"bytes"`
+}
+
+// Resize asks for a new terminal size.
+type Resize struct {
+	Cols int `json:"cols"`
+	Rows int `json:"rows"`
+}
+
+// Reset asks for the shell to be ended and started again.
+type Reset struct{}
+
+// ResetSoft asks for the terminal state to be reset, keeping the shell.
+type ResetSoft struct{}
+
+// SetAlias renames the session. Only the owner may send it.
+type SetAlias struct {
+	Alias string `json:"alias"`
+}
+
+// EventsRequest turns the event feed on or off. When turned on, events
+// after Since are sent first.
+type EventsRequest struct {
+	On    bool  `json:"on"`
+	Since int64 `json:"since"`
+}
+
+// ApprovalDecision approves or denies input held for approval.
+type ApprovalDecision struct {
+	ID      int64 `json:"id"`
+	Approve bool  `json:"approve"`
+}
+
+// PasteDecision confirms or cancels a large paste.
+type PasteDecision struct {
+	ID      int64 `json:"id"`
+	Approve bool  `json:"approve"`
+}
+
+// RunSnippet types the named snippet into the shell.
+type RunSnippet struct {
+	Name string `json:"name"`
+}
+
+// Detach ends the owner's connection without ending a shared session.
+type Detach struct{}
+
+func (Ack) MessageType() string              { return TypeAck }
+func (Resize) MessageType() string           { return TypeResize }
+func (Reset) MessageType() string            { return TypeReset }
+func (ResetSoft) MessageType() string        { return TypeResetSoft }
+func (SetAlias) MessageType() string         { return TypeSetAlias }
+func (EventsRequest) MessageType() string    { return TypeEvents }
+func (ApprovalDecision) MessageType() string { return TypeApproval }
+func (PasteDecision) MessageType() string    { return TypePasteConfirm }
+func (RunSnippet) MessageType() string       { return TypeRunSnippet }
+func (Detach) MessageType() string           { return TypeDetach }
+
+func (m Ack) validate() error {
+	if m.Bytes < 0 {
+		return errors.New("negative byte count")
+	}
+	return nil
+}
+
+func (m Resize) validate() error {
+	if m.Cols < 1 || m.Rows < 1 || m.Cols > MaxTerminalSize || m.Rows > MaxTerminalSize {
+		return errors.New("terminal size out of range")
+	}
+	return nil
+}
+
+func (m EventsRequest) validate() error {
+	if m.Since < 0 {
+		return errors.New("negative event ID")
+	}
+	return nil
+}
+
+func (m ApprovalDecision) validate() error {
+	if m.ID < 1 {
+		return errors.New("missing request ID")
+	}
+	return nil
+}
+
+func (m PasteDecision) validate() error {
+	if m.ID < 1 {
+		return errors.New("missing paste ID")
+	}
+	return nil
+}
+
+func (m RunSnippet) validate() error {
+	if m.Name == "" {
+		return errors.New("missing snippet name")
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Package protocol defines the messages spoken over a session's WebSocket.
+// Terminal input and output travel as binary messages. Everything else is
+// a JSON text message whose "type" field names one of the types here, so
+// the server and the command-line clients share one definition of each.
+//
+// Receivers ignore fields they do not know, so a message may gain fields
+// without a new Version. Removing a field or changing what one means needs
+// a new Version, which both ends agree on through Subprotocol.
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Version identifies the message format. The server reports it in the
+// hello message.
+const Version = 1
+
+// Subprotocol is the Sec-WebSocket-Protocol value for Version.
+var Subprotocol = fmt.Sprintf("alices-mirror.v%d", Version)
+
+// Message types sent by clients.
+const (
+	TypeAck          = "ack"
+	TypeResize       = "resize"
+	TypeReset        = "reset"
+	TypeResetSoft    = "reset-soft"
+	TypeSetAlias     = "set-alias"
+	TypeEvents       = "events"
+	TypeApproval     = "approval"
+	TypePasteConfirm = "paste-confirm"
+	TypeRunSnippet   = "run-snippet"
+	TypeDetach       = "detach"
+)
+
+// Message types sent by the server. The events and paste-confirm types
+// are used in both directions.
+const (
+	TypeHello            = "hello"
+	TypeSnapshot         = "snapshot"
+	TypeStatus           = "status"
+	TypeResetProgress    = "reset-progress"
+	TypeResetFailed      = "reset-failed"
+	TypeAlias            = "alias"
+	TypeMOTD             = "motd"
+	TypeLatency          = "latency"
+	TypeApprovalRequest  = "approval-request"
+	TypeApprovalResolved = "approval-resolved"
+	TypeEvent            = "event"
+	TypeSnippets         = "snippets"
+	TypeViewers          = "viewers"
+	TypeBell             = "bell"
+	TypeActivity         = "activity"
+	TypeRedirect         = "redirect"
+)
+
+// Message is a text message of one of the types above.
+type Message interface {
+	MessageType() string
+}
+
+// ErrUnknownType is returned for a message of a type the receiver does not
+// know. A newer peer may send one; receivers should ignore it.
+var ErrUnknownType = errors.New("unknown message type")
+
+// Encode returns msg as a text message, with its type first.
+func Encode(msg Message) []byte {
+	fields, _ := json.Marshal(msg)
+	data, _ := json.Marshal(struct {
+		Type string `json:"type"`
+	}{msg.MessageType()})
+	if len(fields) <= 2 {
+		return data
+	}
+	data[len(data)-1] = ','
+	return append(data, fields[1:]...)
+}
+
+// DecodeFromClient decodes a text message a client sent.
+func DecodeFromClient(data []byte) (Message, error) {
+	return decode(data, clientMessages)
+}
+
+// DecodeFromServer decodes a text message the server sent.
+func DecodeFromServer(data []byte) (Message, error) {
+	return decode(data, serverMessages)
+}
+
+type decoder func([]byte) (Message, error)
+
+func decode(data []byte, decoders map[string]decoder) (Message, error) {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+	if head.Type == "" {
+		return nil, errors.New("message has no type")
+	}
+	decode, ok := decoders[head.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownType, head.Type)
+	}
+	return decode(data)
+}
+
+// decodeAs decodes data into a T and checks its fields, for messages that
+// can be wrong in more ways than JSON types catch.
+func decodeAs[T Message](data []byte) (Message, error) {
+	var msg T
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("invalid %s message: %w", msg.MessageType(), err)
+	}
+	if v, ok := any(msg).(interface{ validate() error }); ok {
+		if err := v.validate(); err != nil {
+			return nil, fmt.Errorf("invalid %s message: %w", msg.MessageType(), err)
+		}
+	}
+	return msg, nil
+}
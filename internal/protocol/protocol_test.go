@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		msg  Message
+		want string
+	}{
+		{Viewers{Count: 2}, `{"type":"viewers","count":2}`},
+		{Detach{}, `{"type":"detach"}`},
+		{Status{Message: `say "hi"`}, `{"type":"status","message":"say \"hi\""}`},
+	}
+	for _, tc := range cases {
+		if got := string(Encode(tc.msg)); got != tc.want {
+			t.Errorf("Encode(%#v) = %s, want %s", tc.msg, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeFromClient(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		data    string
+		want    Message
+		wantErr bool
+	}{
+		{data: `{"type":"resize","cols":80,"rows":24}`, want: Resize{Cols: 80, Rows: 24}},
+		{data: `{"type":"resize","cols":80,"rows":24,"dpi":2}`, want: Resize{Cols: 80, Rows: 24}},
+		{data: `{"type":"reset"}`, want: Reset{}},
+		{data: `{"type":"ack","bytes":4096}`, want: Ack{Bytes: 4096}},
+		{data: `{"type":"paste-confirm","id":3,"approve":true}`, want: PasteDecision{ID: 3, Approve: true}},
+		{data: `{"type":"resize","cols":0,"rows":24}`, wantErr: true},
+		{data: `{"type":"resize","cols":"80","rows":24}`, wantErr: true},
+		{data: `{"type":"ack","bytes":-1}`, wantErr: true},
+		{data: `{"type":"approval","approve":true}`, wantErr: true},
+		{data: `{"type":"run-snippet"}`, wantErr: true},
+		{data: `{"type":"viewers","count":1}`, wantErr: true},
+		{data: `{"cols":80}`, wantErr: true},
+		{data: `resize`, wantErr: true},
+	}
+	for _, tc := range cases {
+		got, err := DecodeFromClient([]byte(tc.data))
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("DecodeFromClient(%s) = %#v, %v", tc.data, got, err)
+		}
+	}
+
+	if _, err := DecodeFromClient([]byte(`{"type":"chat","text":"hi"}`)); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("unknown type: got %v, want ErrUnknownType", err)
+	}
+}
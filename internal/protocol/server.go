@@ -0,0 +1,197 @@
+package protocol
+
+import (
+	"errors"
+	"time"
+)
+
+var serverMessages = map[string]decoder{
+	TypeHello:            decodeAs[Hello],
+	TypeSnapshot:         decodeAs[Snapshot],
+	TypeStatus:           decodeAs[Status],
+	TypeResetProgress:    decodeAs[ResetProgress],
+	TypeResetFailed:      decodeAs[ResetFailed],
+	TypeAlias:            decodeAs[Alias],
+	TypeMOTD:             decodeAs[MOTD],
+	TypeLatency:          decodeAs[Latency],
+	TypeApprovalRequest:  decodeAs[ApprovalRequest],
+	TypeApprovalResolved: decodeAs[ApprovalResolved],
+	TypePasteConfirm:     decodeAs[PasteConfirm],
+	TypeEvent:            decodeAs[NewEvent],
+	TypeEvents:           decodeAs[Events],
+	TypeSnippets:         decodeAs[Snippets],
+	TypeViewers:          decodeAs[Viewers],
+	TypeBell:             decodeAs[Bell],
+	TypeActivity:         decodeAs[Activity],
+	TypeRedirect:         decodeAs[Redirect],
+}
+
+// Hello is the first message sent on every connection and tells the
+// client what it is allowed to do. It is sent again when that changes.
+type Hello struct {
+	UserLevel       int    `json:"userLevel"`
+	ReadOnly        bool   `json:"readOnly"`
+	CanResize       bool   `json:"canResize"`
+	CanReset        bool   `json:"canReset"`
+	SnapshotBytes   int    `json:"snapshotBytes"`
+	Version         string `json:"version"`
+	ProtocolVersion int    `json:"protocolVersion"`
+	FlowControl     bool   `json:"flowControl"`
+	// NeedsApproval is set for user level 2: input is shown to the owner
+	// and level 0 clients, and only sent to the shell once approved.
+	NeedsApproval bool `json:"needsApproval,omitempty"`
+}
+
+// Snapshot announces a compressed snapshot. It is followed by
+// CompressedBytes of binary frames that decode to Bytes of output.
+type Snapshot struct {
+	Encoding        string `json:"encoding"`
+	Bytes           int    `json:"bytes"`
+	CompressedBytes int    `json:"compressedBytes"`
+}
+
+// Status is a line for the client's status bar.
+type Status struct {
+	Message string `json:"message"`
+}
+
+// ResetProgress reports a step of a reset that is taking a while.
+type ResetProgress struct {
+	Step    string `json:"step"`
+	PIDs    []int  `json:"pids"`
+	Message string `json:"message"`
+}
+
+// ResetFailed reports a reset that left processes running.
+type ResetFailed struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// Alias is the session's new name.
+type Alias struct {
+	Alias string `json:"alias"`
+}
+
+// MOTD is the message of the day.
+type MOTD struct {
+	Message string `json:"message"`
+}
+
+// Latency is the last round-trip time measured to the client.
+type Latency struct {
+	RTTMillis float64 `json:"rttMs"`
+}
+
+// ApprovalRequest asks an admin to approve input from a level 2 client.
+type ApprovalRequest struct {
+	ID      int64  `json:"id"`
+	Remote  string `json:"remote"`
+	Input   string `json:"input"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Approve string `json:"approve"`
+	Deny    string `json:"deny"`
+}
+
+// ApprovalResolved tells admins that a request was approved or denied.
+type ApprovalResolved struct {
+	ID       int64 `json:"id"`
+	Approved bool  `json:"approved"`
+}
+
+// PasteConfirm asks the client to confirm a large paste.
+type PasteConfirm struct {
+	ID      int64  `json:"id"`
+	Bytes   int    `json:"bytes"`
+	Lines   int    `json:"lines"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Confirm string `json:"confirm"`
+	Cancel  string `json:"cancel"`
+}
+
+// Event is one entry of the server's recent history. IDs increase by one
+// per event, so a client can ask for what it has not seen yet.
+type Event struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Remote  string    `json:"remote,omitempty"`
+	Message string    `json:"message"`
+}
+
+// NewEvent is an event sent to clients that turned the feed on.
+type NewEvent struct {
+	Event Event `json:"event"`
+}
+
+// Events answers an EventsRequest with the events the client missed.
+type Events struct {
+	Events []Event `json:"events"`
+}
+
+// Snippet is a predefined command clients can run with one click. Each
+// line of Command is typed into the shell followed by Enter.
+type Snippet struct {
+	Name        string `json:"name"`
+	Command     string `json:"command"`
+	Description string `json:"description,omitempty"`
+}
+
+// Snippets is the list of snippets, sent when it changes.
+type Snippets struct {
+	Snippets []Snippet `json:"snippets"`
+}
+
+// Viewers tells the owner how many others are connected.
+type Viewers struct {
+	Count int `json:"count"`
+}
+
+// Bell tells clients the shell rang the bell, for example when a command
+// finished or wants input, so they can notify a user who is not looking.
+type Bell struct{}
+
+// Activity tells clients when the shell last printed output and when it
+// last got input, omitted if never. It is sent on connect and when either
+// changes, at most every few seconds.
+type Activity struct {
+	LastOutput *time.Time `json:"lastOutput,omitempty"`
+	LastInput  *time.Time `json:"lastInput,omitempty"`
+}
+
+// Redirect tells a viewer the session moved to another mirror at URL.
+// Token, when set, is a pass that lets this viewer in there once without a
+// password, at the user level it had here: clients pass it as the handover
+// query parameter.
+type Redirect struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+}
+
+func (Hello) MessageType() string            { return TypeHello }
+func (Snapshot) MessageType() string         { return TypeSnapshot }
+func (Status) MessageType() string           { return TypeStatus }
+func (ResetProgress) MessageType() string    { return TypeResetProgress }
+func (ResetFailed) MessageType() string      { return TypeResetFailed }
+func (Alias) MessageType() string            { return TypeAlias }
+func (MOTD) MessageType() string             { return TypeMOTD }
+func (Latency) MessageType() string          { return TypeLatency }
+func (ApprovalRequest) MessageType() string  { return TypeApprovalRequest }
+func (ApprovalResolved) MessageType() string { return TypeApprovalResolved }
+func (PasteConfirm) MessageType() string     { return TypePasteConfirm }
+func (NewEvent) MessageType() string         { return TypeEvent }
+func (Events) MessageType() string           { return TypeEvents }
+func (Snippets) MessageType() string         { return TypeSnippets }
+func (Viewers) MessageType() string          { return TypeViewers }
+func (Bell) MessageType() string             { return TypeBell }
+func (Activity) MessageType() string         { return TypeActivity }
+func (Redirect) MessageType() string         { return TypeRedirect }
+
+func (m Viewers) validate() error {
+	if m.Count < 0 {
+		return errors.New("negative viewer count")
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package proxy picks the proxy for connections the mirror makes itself,
+// such as the relay tunnel and the --share owner connection. An explicit
+// --proxy URL wins; otherwise HTTP_PROXY, HTTPS_PROXY and ALL_PROXY are used,
+// honoring NO_PROXY. Loopback destinations are never proxied.
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Parse validates a --proxy value. http:// and socks5:// proxies are
+// supported; socks5h:// is accepted as a synonym since host names are always
+// resolved by the SOCKS server.
+func Parse(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("expected a URL such as http://proxy:3128 or socks5://proxy:1080")
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		u.Scheme = "http"
+	case "socks5", "socks5h":
+		u.Scheme = "socks5"
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (expected http or socks5)", u.Scheme)
+	}
+	return u, nil
+}
+
+// Func returns the proxy selector for explicit, or for the environment when
+// explicit is empty, in the form used by websocket.Dialer and
+// http.Transport.
+func Func(explicit string) (func(*http.Request) (*url.URL, error), error) {
+	cfg := httpproxy.FromEnvironment()
+	if explicit = strings.TrimSpace(explicit); explicit != "" {
+		u, err := Parse(explicit)
+		if err != nil {
+			return nil, err
+		}
+		cfg.HTTPProxy = u.String()
+		cfg.HTTPSProxy = u.String()
+	} else if all := getEnvAny("ALL_PROXY", "all_proxy"); all != "" {
+		if cfg.HTTPProxy == "" {
+			cfg.HTTPProxy = all
+		}
+		if cfg.HTTPSProxy == "" {
+			cfg.HTTPSProxy = all
+		}
+	}
+	proxyForURL := cfg.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyForURL(req.URL)
+	}, nil
+}
+
+// Env returns environment entries that point a helper process, such as a
+// tunnel agent, at explicit. It returns nil when explicit is empty, leaving
+// the inherited environment as it is.
+func Env(explicit string) []string {
+	explicit = strings.TrimSpace(explicit)
+	if explicit == "" {
+		return nil
+	}
+	u, err := Parse(explicit)
+	if err != nil {
+		return nil
+	}
+	value := u.String()
+	return []string{
+		"HTTP_PROXY=" + value,
+		"HTTPS_PROXY=" + value,
+		"ALL_PROXY=" + value,
+		"http_proxy=" + value,
+		"https_proxy=" + value,
+		"all_proxy=" + value,
+	}
+}
+
+func getEnvAny(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
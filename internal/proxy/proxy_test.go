@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestFuncExplicit(t *testing.T) {
+	proxyFor, err := Func("socks5h://proxy.example:1080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		target string
+		want   string
+	}{
+		{target: "https://relay.example.com/_tunnel", want: "socks5://proxy.example:1080"},
+		{target: "http://relay.example.com:8080/_tunnel", want: "socks5://proxy.example:1080"},
+		{target: "http://127.0.0.1:3002/ws-owner", want: ""},
+		{target: "http://localhost:3002/ws-owner", want: ""},
+	}
+	for _, tc := range cases {
+		target, _ := url.Parse(tc.target)
+		got, err := proxyFor(&http.Request{URL: target})
+		if err != nil {
+			t.Fatalf("proxy for %s: %v", tc.target, err)
+		}
+		gotString := ""
+		if got != nil {
+			gotString = got.String()
+		}
+		if gotString != tc.want {
+			t.Errorf("proxy for %s = %q, want %q", tc.target, gotString, tc.want)
+		}
+	}
+}
+
+func TestParseRejectsUnsupportedSchemes(t *testing.T) {
+	t.Parallel()
+
+	for _, raw := range []string{"https://proxy:443", "ftp://proxy", "proxy:3128", ""} {
+		if _, err := Parse(raw); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", raw)
+		}
+	}
+}
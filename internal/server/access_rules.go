@@ -0,0 +1,345 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRulesBodyBytes = 4 << 10
+
+// AccessRules are the allow-ip and user-level rules the owner added while
+// the mirror runs. They are kept in a file so they outlive a restart, and
+// are tried before the rules given by flags.
+type AccessRules struct {
+	path string
+
+	mu         sync.Mutex
+	allowIPs   []storedAllowIP
+	userLevels []storedUserLevel
+}
+
+type storedAllowIP struct {
+	Pattern string    `json:"pattern"`
+	AddedAt time.Time `json:"addedAt"`
+
+	matcher *regexp.Regexp
+}
+
+type storedUserLevel struct {
+	Rule      string     `json:"rule"`
+	AddedAt   time.Time  `json:"addedAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	rule UserLevelRule
+}
+
+// LoadAccessRules reads the rules from path. A missing file has no rules;
+// an empty path keeps rules in memory only.
+func LoadAccessRules(path string) (*AccessRules, error) {
+	a := &AccessRules{path: path}
+	if path == "" {
+		return a, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored struct {
+		AllowIPs   []storedAllowIP   `json:"allowIPs"`
+		UserLevels []storedUserLevel `json:"userLevels"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	for _, entry := range stored.AllowIPs {
+		matchers, err := compileAllowIPMatchers([]string{entry.Pattern})
+		if err != nil {
+			return nil, err
+		}
+		entry.matcher = matchers[0]
+		a.allowIPs = append(a.allowIPs, entry)
+	}
+	for _, entry := range stored.UserLevels {
+		rules, err := ParseUserLevelRules(entry.Rule)
+		if err != nil || len(rules) != 1 {
+			return nil, fmt.Errorf("invalid user-level rule %q", entry.Rule)
+		}
+		entry.rule = rules[0]
+		if entry.ExpiresAt != nil {
+			entry.rule.expires = *entry.ExpiresAt
+		}
+		a.userLevels = append(a.userLevels, entry)
+	}
+	return a, nil
+}
+
+func (a *AccessRules) allowsIP(ip string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, entry := range a.allowIPs {
+		if entry.matcher.MatchString(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AccessRules) userLevelRules() []UserLevelRule {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rules := make([]UserLevelRule, 0, len(a.userLevels))
+	for _, entry := range a.userLevels {
+		rules = append(rules, entry.rule)
+	}
+	return rules
+}
+
+// addAllowIP adds pattern unless it is already there.
+func (a *AccessRules) addAllowIP(pattern string) error {
+	matchers, err := compileAllowIPMatchers([]string{pattern})
+	if err != nil {
+		return err
+	}
+	pattern = strings.TrimSpace(pattern)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, entry := range a.allowIPs {
+		if entry.Pattern == pattern {
+			return nil
+		}
+	}
+	allowIPs := append(a.allowIPs[:len(a.allowIPs):len(a.allowIPs)], storedAllowIP{Pattern: pattern, AddedAt: time.Now().UTC(), matcher: matchers[0]})
+	return a.replaceLocked(allowIPs, a.userLevels)
+}
+
+// addUserLevel puts rule before the other runtime rules, so the latest grant
+// wins. A rule with the same text is replaced, which restarts its window.
+func (a *AccessRules) addUserLevel(rule UserLevelRule) error {
+	now := time.Now().UTC()
+	entry := storedUserLevel{Rule: rule.String(), AddedAt: now, rule: rule}
+	if rule.Duration > 0 {
+		expires := now.Add(rule.Duration)
+		entry.ExpiresAt = &expires
+		entry.rule.expires = expires
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	kept := []storedUserLevel{entry}
+	for _, existing := range a.userLevels {
+		if existing.Rule != entry.Rule {
+			kept = append(kept, existing)
+		}
+	}
+	return a.replaceLocked(a.allowIPs, kept)
+}
+
+// remove deletes the allow-ip pattern or user-level rule with this text and
+// reports whether there was one.
+func (a *AccessRules) remove(allowIP, userLevel string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	allowIPs, userLevels := a.allowIPs, a.userLevels
+	removed := false
+	if allowIP != "" {
+		for i, entry := range allowIPs {
+			if entry.Pattern == allowIP {
+				allowIPs = append(allowIPs[:i:i], allowIPs[i+1:]...)
+				removed = true
+				break
+			}
+		}
+	}
+	if userLevel != "" {
+		for i, entry := range userLevels {
+			if entry.Rule == userLevel {
+				userLevels = append(userLevels[:i:i], userLevels[i+1:]...)
+				removed = true
+				break
+			}
+		}
+	}
+	if !removed {
+		return false, nil
+	}
+	return true, a.replaceLocked(allowIPs, userLevels)
+}
+
+// replaceLocked makes allowIPs and userLevels the rules and saves them. If
+// they cannot be saved the rules are left as they were. a.mu must be held.
+func (a *AccessRules) replaceLocked(allowIPs []storedAllowIP, userLevels []storedUserLevel) error {
+	oldAllowIPs, oldUserLevels := a.allowIPs, a.userLevels
+	a.allowIPs, a.userLevels = allowIPs, userLevels
+	if err := a.saveLocked(); err != nil {
+		a.allowIPs, a.userLevels = oldAllowIPs, oldUserLevels
+		return err
+	}
+	return nil
+}
+
+// saveLocked writes the rules through a temporary file so a crash cannot
+// leave them truncated.
+func (a *AccessRules) saveLocked() error {
+	if a.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(map[string]any{
+		"allowIPs":   a.allowIPs,
+		"userLevels": a.userLevels,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(a.path), 0o700); err != nil {
+		return err
+	}
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.path)
+}
+
+// userLevelRules returns the user-level rules in the order they are tried:
+// those added at runtime, then those given by --user-level.
+func (s *Server) userLevelRules() []UserLevelRule {
+	return append(s.accessRules.userLevelRules(), s.userLevels...)
+}
+
+type ruleStatus struct {
+	Rule       string     `json:"rule"`
+	Level      *int       `json:"level,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	Disconnect bool       `json:"disconnect,omitempty"`
+	Runtime    bool       `json:"runtime"`
+}
+
+type rulesRequest struct {
+	AllowIP   string `json:"allowIp"`
+	UserLevel string `json:"userLevel"`
+}
+
+// handleRules lets the owner manage access rules while the mirror runs:
+// GET /api/rules?token=<owner token> lists them, POST adds and DELETE
+// removes the rule in a {"allowIp": "..."} or {"userLevel": "..."} body.
+// Only rules added this way can be removed.
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	if !s.ownerTokenMatches(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.writeRules(w)
+		return
+	case http.MethodPost, http.MethodDelete:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body rulesRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRulesBodyBytes)).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	body.AllowIP = strings.TrimSpace(body.AllowIP)
+	body.UserLevel = strings.TrimSpace(body.UserLevel)
+	if (body.AllowIP == "") == (body.UserLevel == "") {
+		http.Error(w, "Give exactly one of allowIp and userLevel", http.StatusBadRequest)
+		return
+	}
+
+	var rule UserLevelRule
+	if body.UserLevel != "" {
+		rules, err := ParseUserLevelRules(body.UserLevel)
+		if err != nil || len(rules) != 1 {
+			http.Error(w, fmt.Sprintf("Invalid user-level rule %q", body.UserLevel), http.StatusBadRequest)
+			return
+		}
+		rule = rules[0]
+		body.UserLevel = rule.String()
+	}
+
+	var err error
+	var event string
+	if r.Method == http.MethodPost {
+		if body.AllowIP != "" {
+			if _, err := compileAllowIPMatchers([]string{body.AllowIP}); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			err = s.accessRules.addAllowIP(body.AllowIP)
+			event = "allow-ip rule " + body.AllowIP + " added"
+		} else {
+			err = s.accessRules.addUserLevel(rule)
+			event = "user-level rule " + body.UserLevel + " added"
+		}
+	} else {
+		var removed bool
+		removed, err = s.accessRules.remove(body.AllowIP, body.UserLevel)
+		if err == nil && !removed {
+			http.Error(w, "No such rule added at runtime", http.StatusNotFound)
+			return
+		}
+		event = "rule " + body.AllowIP + body.UserLevel + " removed"
+	}
+	// The rule only takes effect once it is saved, so a restart cannot
+	// quietly undo what the owner was told had changed.
+	if err != nil {
+		logger().Warn("failed to save access rules", "error", err)
+		http.Error(w, "Could not save the access rules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.recordEvent(EventAccess, "", "%s", event)
+
+	s.rulesChanged()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) writeRules(w http.ResponseWriter) {
+	var allowIPs, userLevels []ruleStatus
+	s.accessRules.mu.Lock()
+	for _, entry := range s.accessRules.allowIPs {
+		allowIPs = append(allowIPs, ruleStatus{Rule: entry.Pattern, Runtime: true})
+	}
+	for _, entry := range s.accessRules.userLevels {
+		userLevels = append(userLevels, userLevelStatus(entry.rule, true))
+	}
+	s.accessRules.mu.Unlock()
+	for _, pattern := range s.allowIPPatterns {
+		allowIPs = append(allowIPs, ruleStatus{Rule: pattern})
+	}
+	for _, rule := range s.userLevels {
+		userLevels = append(userLevels, userLevelStatus(rule, false))
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"allowIPs":   allowIPs,
+		"userLevels": userLevels,
+	})
+}
+
+func userLevelStatus(rule UserLevelRule, runtime bool) ruleStatus {
+	level := int(rule.Level)
+	status := ruleStatus{Rule: rule.String(), Level: &level, Disconnect: rule.Disconnect, Runtime: runtime}
+	if !rule.expires.IsZero() {
+		expires := rule.expires.UTC()
+		status.ExpiresAt = &expires
+	}
+	return status
+}
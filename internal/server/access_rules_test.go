@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAccessRulesPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "access_rules.json")
+	rules, err := LoadAccessRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rules.addAllowIP("10.0.0.*"); err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{"user:bob-1", "192.168.1.*-0@1h30m!"} {
+		parsed, err := ParseUserLevelRules(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rules.addUserLevel(parsed[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reloaded, err := LoadAccessRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.allowsIP("10.0.0.7") || reloaded.allowsIP("10.0.1.7") {
+		t.Fatal("allow-ip rule not restored")
+	}
+	got := reloaded.userLevelRules()
+	if len(got) != 2 || got[0].String() != "192.168.1.*-0@1h30m!" || got[1].String() != "user:bob-1" {
+		t.Fatalf("user-level rules after reload = %v", got)
+	}
+	if got[0].expires.IsZero() {
+		t.Fatal("expiry not restored")
+	}
+
+	if removed, err := reloaded.remove("", "user:bob-1"); !removed || err != nil {
+		t.Fatalf("remove = %v, %v", removed, err)
+	}
+	if removed, _ := reloaded.remove("10.9.9.9", ""); removed {
+		t.Fatal("removed a rule that was never added")
+	}
+}
+
+func TestRulesNotSavedAreRolledBack(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	rules, err := LoadAccessRules(filepath.Join(dir, "access_rules.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rules.addAllowIP("10.0.0.*"); err != nil {
+		t.Fatal(err)
+	}
+	// A file where the rules' directory should be makes every save fail.
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules.path = filepath.Join(blocker, "access_rules.json")
+
+	s := &Server{ownerToken: "owner-token", accessRules: rules}
+	send := func(method, body string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleRules(rec, httptest.NewRequest(method, "/api/rules?token=owner-token", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := send(http.MethodPost, `{"allowIp": "192.168.1.*"}`); code != http.StatusInternalServerError {
+		t.Errorf("add allow-ip: got %d, want 500", code)
+	}
+	if rules.allowsIP("192.168.1.7") {
+		t.Error("allow-ip rule kept although it was not saved")
+	}
+	if code := send(http.MethodPost, `{"userLevel": "user:bob-1"}`); code != http.StatusInternalServerError {
+		t.Errorf("add user-level: got %d, want 500", code)
+	}
+	if got := rules.userLevelRules(); len(got) != 0 {
+		t.Errorf("user-level rules kept although they were not saved: %v", got)
+	}
+	if code := send(http.MethodDelete, `{"allowIp": "10.0.0.*"}`); code != http.StatusInternalServerError {
+		t.Errorf("remove allow-ip: got %d, want 500", code)
+	}
+	if !rules.allowsIP("10.0.0.7") {
+		t.Error("allow-ip rule dropped although the removal was not saved")
+	}
+}
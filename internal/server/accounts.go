@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// LoadAccounts reads extra Basic Auth accounts from path, one user:password
+// per line. Blank lines and lines starting with # are skipped. A password
+// starting with $2a$, $2b$ or $2y$ is a bcrypt hash, as written by
+// htpasswd -B.
+func LoadAccounts(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	accounts := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, password, ok := strings.Cut(line, ":")
+		if !ok || user == "" || password == "" {
+			return nil, fmt.Errorf("line %d: expected user:password", n)
+		}
+		if _, dup := accounts[user]; dup {
+			return nil, fmt.Errorf("line %d: duplicate user %q", n, user)
+		}
+		accounts[user] = password
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("no accounts in %s", path)
+	}
+	return accounts, nil
+}
+
+// Check reports whether user and password match the main account or one of
+// Accounts.
+func (a AuthConfig) Check(user, password string) bool {
+	if subtle.ConstantTimeCompare([]byte(user), []byte(a.User)) == 1 {
+		return subtle.ConstantTimeCompare([]byte(password), []byte(a.Password)) == 1
+	}
+	stored, ok := a.Accounts[user]
+	if !ok {
+		return false
+	}
+	if isBcryptHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(password), []byte(stored)) == 1
+}
+
+func isBcryptHash(password string) bool {
+	return strings.HasPrefix(password, "$2a$") || strings.HasPrefix(password, "$2b$") || strings.HasPrefix(password, "$2y$")
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthConfigCheck(t *testing.T) {
+	t.Parallel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "accounts")
+	content := "# viewers\nalice:plain\n\nbob:" + string(hash) + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write accounts: %v", err)
+	}
+	accounts, err := LoadAccounts(path)
+	if err != nil {
+		t.Fatalf("LoadAccounts: %v", err)
+	}
+
+	auth := AuthConfig{Enabled: true, User: "owner", Password: "pw", Accounts: accounts}
+	cases := []struct {
+		user, password string
+		want           bool
+	}{
+		{user: "owner", password: "pw", want: true},
+		{user: "owner", password: "plain", want: false},
+		{user: "alice", password: "plain", want: true},
+		{user: "bob", password: "secret", want: true},
+		{user: "bob", password: string(hash), want: false},
+		{user: "carol", password: "", want: false},
+	}
+	for _, tc := range cases {
+		if got := auth.Check(tc.user, tc.password); got != tc.want {
+			t.Errorf("Check(%q, %q) = %v, want %v", tc.user, tc.password, got, tc.want)
+		}
+	}
+}
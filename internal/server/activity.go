@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+// activityInterval is how often clients are told about new shell activity.
+const activityInterval = 10 * time.Second
+
+// activityPayload encodes when the shell last printed output and got
+// input. The times are also returned so callers can tell if they changed.
+func (s *Server) activityPayload() ([]byte, time.Time, time.Time) {
+	info := s.session.Info()
+	var msg protocol.Activity
+	if !info.LastOutputAt.IsZero() {
+		msg.LastOutput = &info.LastOutputAt
+	}
+	if !info.LastInputAt.IsZero() {
+		msg.LastInput = &info.LastInputAt
+	}
+	return protocol.Encode(msg), info.LastOutputAt, info.LastInputAt
+}
+
+// broadcastActivity tells clients when the shell was last active, every
+// activityInterval while it is, so a dashboard can tell an idle shell from
+// a hung one.
+func (s *Server) broadcastActivity(ctx context.Context) {
+	ticker := time.NewTicker(activityInterval)
+	defer ticker.Stop()
+	var lastOutput, lastInput time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.session.Done():
+			return
+		case <-ticker.C:
+		}
+		payload, output, input := s.activityPayload()
+		if output.Equal(lastOutput) && input.Equal(lastInput) {
+			continue
+		}
+		lastOutput, lastInput = output, input
+		s.broadcast(wsMessage{messageType: websocket.TextMessage, data: payload})
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+const maxAliasBodyBytes = 4 << 10
+
+// Alias returns the alias currently advertised to clients.
+func (s *Server) Alias() string {
+	s.aliasMu.Lock()
+	defer s.aliasMu.Unlock()
+	return s.alias
+}
+
+// SetAlias changes the alias at runtime. Connected clients receive an alias
+// control message so they can retitle without reloading.
+func (s *Server) SetAlias(alias string) error {
+	if err := ValidateAlias(alias); err != nil {
+		return err
+	}
+	alias = strings.TrimSpace(alias)
+
+	s.aliasMu.Lock()
+	if s.alias == alias {
+		s.aliasMu.Unlock()
+		return nil
+	}
+	s.alias = alias
+	s.aliasMu.Unlock()
+
+	payload := protocol.Encode(protocol.Alias{Alias: alias})
+	s.broadcast(wsMessage{messageType: websocket.TextMessage, data: payload})
+
+	if s.onAliasChanged != nil {
+		s.onAliasChanged(alias)
+	}
+	return nil
+}
+
+// handleAlias lets the owner change the alias with
+// POST /api/alias?token=<owner token> and a {"alias": "..."} body.
+func (s *Server) handleAlias(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.ownerTokenMatches(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Alias string `json:"alias"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAliasBodyBytes)).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.SetAlias(body.Alias); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
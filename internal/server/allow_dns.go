@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dnsLookupTimeout = 2 * time.Second
+	// dnsNameTTL is how long the names found for an address are trusted,
+	// and dnsFailureTTL how long an address without one is left alone.
+	dnsNameTTL    = 5 * time.Minute
+	dnsFailureTTL = time.Minute
+)
+
+// dnsNames finds the host names of client addresses for allow-ip patterns
+// such as *.corp.example.com. A name counts only when it resolves back to
+// the address, so whoever controls the reverse zone of an address cannot
+// claim any name they like. Lookups go through the system resolver, which
+// also answers for mDNS (.local) names where it is set up to.
+type dnsNames struct {
+	mu      sync.Mutex
+	entries map[string]dnsNamesEntry
+}
+
+type dnsNamesEntry struct {
+	names   []string
+	expires time.Time
+}
+
+func newDNSNames() *dnsNames {
+	return &dnsNames{entries: make(map[string]dnsNamesEntry)}
+}
+
+// lookup returns the confirmed names of ip, lowercase and without the
+// trailing dot.
+func (d *dnsNames) lookup(ip string) []string {
+	now := time.Now()
+	d.mu.Lock()
+	entry, ok := d.entries[ip]
+	d.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.names
+	}
+
+	names := confirmedNames(ip)
+	ttl := dnsNameTTL
+	if len(names) == 0 {
+		ttl = dnsFailureTTL
+	}
+	d.mu.Lock()
+	for key, old := range d.entries {
+		if now.After(old.expires) {
+			delete(d.entries, key)
+		}
+	}
+	d.entries[ip] = dnsNamesEntry{names: names, expires: now.Add(ttl)}
+	d.mu.Unlock()
+	return names
+}
+
+func confirmedNames(ip string) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+	candidates, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, name := range candidates {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if name == "" || slices.Contains(names, name) {
+			continue
+		}
+		addrs, err := net.DefaultResolver.LookupHost(ctx, name)
+		if err != nil || !slices.Contains(addrs, ip) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+const (
+	// approvalBurstDelay is how long a user level 2 client must stop typing
+	// before input without a line end is sent for approval on its own.
+	approvalBurstDelay = 700 * time.Millisecond
+	// maxPendingApprovals bounds the requests one client may have waiting.
+	maxPendingApprovals = 32
+	// maxApprovalInput bounds the input buffered for one request.
+	maxApprovalInput = 16 << 10
+)
+
+// approvalRequest is input from a user level 2 client waiting for the
+// owner or a level 0 client to approve or deny it.
+type approvalRequest struct {
+	id   int64
+	from *client
+	data []byte
+	// paste marks a large paste held by the paste policy.
+	paste bool
+}
+
+// approvalQueue holds the input of user level 2 clients: what they are
+// still typing, and what waits for a decision.
+type approvalQueue struct {
+	mu      sync.Mutex
+	nextID  int64
+	pending []*approvalRequest
+	typing  map[*client]*approvalBuffer
+}
+
+type approvalBuffer struct {
+	data  []byte
+	timer *time.Timer
+}
+
+// queueForApproval buffers input from a user level 2 client. Each complete
+// line becomes its own request; what is left becomes one once the client
+// pauses for approvalBurstDelay.
+func (s *Server) queueForApproval(c *client, payload []byte) {
+	q := &s.approvals
+	q.mu.Lock()
+	if q.typing == nil {
+		q.typing = make(map[*client]*approvalBuffer)
+	}
+	buf := q.typing[c]
+	if buf == nil {
+		buf = &approvalBuffer{}
+		q.typing[c] = buf
+	}
+	buf.data = append(buf.data, payload...)
+	var lines [][]byte
+	for {
+		end := strings.IndexAny(string(buf.data), "\r\n")
+		if end < 0 {
+			break
+		}
+		lines = append(lines, buf.data[:end+1])
+		buf.data = buf.data[end+1:]
+	}
+	if len(buf.data) >= maxApprovalInput {
+		lines = append(lines, buf.data)
+		buf.data = nil
+	}
+	if buf.timer != nil {
+		buf.timer.Stop()
+		buf.timer = nil
+	}
+	if len(buf.data) > 0 {
+		buf.timer = time.AfterFunc(approvalBurstDelay, func() { s.flushApprovalBurst(c) })
+	}
+	q.mu.Unlock()
+
+	for _, line := range lines {
+		s.requestApproval(c, line, false)
+	}
+}
+
+func (s *Server) flushApprovalBurst(c *client) {
+	q := &s.approvals
+	q.mu.Lock()
+	buf := q.typing[c]
+	var data []byte
+	if buf != nil {
+		data, buf.data, buf.timer = buf.data, nil, nil
+	}
+	q.mu.Unlock()
+	if len(data) > 0 {
+		s.requestApproval(c, data, false)
+	}
+}
+
+// requestApproval queues data and asks the owner and level 0 clients to
+// decide on it.
+func (s *Server) requestApproval(c *client, data []byte, paste bool) {
+	q := &s.approvals
+	q.mu.Lock()
+	waiting := 0
+	for _, req := range q.pending {
+		if req.from == c {
+			waiting++
+		}
+	}
+	if waiting >= maxPendingApprovals {
+		q.mu.Unlock()
+		s.sendStatus(c, translate(c.lang, "approval.full"))
+		return
+	}
+	q.nextID++
+	req := &approvalRequest{id: q.nextID, from: c, data: append([]byte(nil), data...), paste: paste}
+	q.pending = append(q.pending, req)
+	q.mu.Unlock()
+
+	s.notifyAdmins(c, func(lang string) []byte {
+		return approvalRequestPayload(lang, req)
+	})
+}
+
+// resolveApproval applies the decision of admin on request id. Approved
+// input is written to the shell; the client that typed it is told either
+// way. A client cannot decide on its own request, such as a paste held by
+// --paste-confirm=owner, even though it may decide on those of others.
+func (s *Server) resolveApproval(admin *client, id int64, approve bool) {
+	q := &s.approvals
+	q.mu.Lock()
+	var req *approvalRequest
+	for i, pending := range q.pending {
+		if pending.id != id {
+			continue
+		}
+		if pending.from == admin {
+			q.mu.Unlock()
+			s.recordEvent(EventRefused, admin.remoteIP, "decision on its own request %d refused", id)
+			return
+		}
+		req = pending
+		q.pending = append(q.pending[:i], q.pending[i+1:]...)
+		break
+	}
+	q.mu.Unlock()
+	if req == nil {
+		return
+	}
+
+	input := displayInput(req.data)
+	if approve {
+		if req.paste {
+			s.writePaste(req.from, req.data)
+		} else {
+			s.inputLog.record(req.from, req.data)
+			_ = s.session.WriteInput(req.data)
+		}
+		s.recordEvent(EventApproval, req.from.remoteIP, "input approved by %s: %s", admin.remoteIP, input)
+		s.sendStatus(req.from, translate(req.from.lang, "approval.approved", input))
+	} else {
+		s.recordEvent(EventApproval, req.from.remoteIP, "input denied by %s: %s", admin.remoteIP, input)
+		s.sendStatus(req.from, translate(req.from.lang, "approval.denied", input))
+	}
+	s.broadcastApprovalResolved(req.id, approve)
+}
+
+// dropApprovals forgets the input of a client that disconnected.
+func (s *Server) dropApprovals(c *client) {
+	q := &s.approvals
+	q.mu.Lock()
+	if buf := q.typing[c]; buf != nil && buf.timer != nil {
+		buf.timer.Stop()
+	}
+	delete(q.typing, c)
+	var dropped []int64
+	kept := q.pending[:0]
+	for _, req := range q.pending {
+		if req.from == c {
+			dropped = append(dropped, req.id)
+			continue
+		}
+		kept = append(kept, req)
+	}
+	clear(q.pending[len(kept):])
+	q.pending = kept
+	q.mu.Unlock()
+
+	for _, id := range dropped {
+		s.broadcastApprovalResolved(id, false)
+	}
+}
+
+// sendPendingApprovals shows a newly connected owner or level 0 client the
+// requests that are already waiting.
+func (s *Server) sendPendingApprovals(c *client) {
+	q := &s.approvals
+	q.mu.Lock()
+	pending := append([]*approvalRequest(nil), q.pending...)
+	q.mu.Unlock()
+	for _, req := range pending {
+		c.trySend(wsMessage{messageType: websocket.TextMessage, data: approvalRequestPayload(c.lang, req)})
+	}
+}
+
+func (s *Server) broadcastApprovalResolved(id int64, approved bool) {
+	payload := protocol.Encode(protocol.ApprovalResolved{ID: id, Approved: approved})
+	s.notifyAdmins(nil, func(string) []byte { return payload })
+}
+
+func approvalRequestPayload(lang string, req *approvalRequest) []byte {
+	input := displayInput(req.data)
+	return protocol.Encode(protocol.ApprovalRequest{
+		ID:      req.id,
+		Remote:  req.from.remoteIP,
+		Input:   input,
+		Title:   translate(lang, "approval.title"),
+		Message: translate(lang, "approval.body", req.from.remoteIP, input),
+		Approve: translate(lang, "approval.approve"),
+		Deny:    translate(lang, "approval.deny"),
+	})
+}
+
+// sendStatus shows message to c: in the status bar of the browser, or as a
+// line of output for SSH clients, which have no other place for it.
+func (s *Server) sendStatus(c *client, message string) {
+	if c.transport == "ssh" {
+		c.trySend(wsMessage{messageType: websocket.BinaryMessage, data: []byte("\r\n" + message + "\r\n")})
+		return
+	}
+	payload := protocol.Encode(protocol.Status{Message: message})
+	c.trySend(wsMessage{messageType: websocket.TextMessage, data: payload})
+}
+
+// displayInput renders terminal input for a person to read: line ends as
+// ⏎ and other control characters in caret notation, such as ^C.
+func displayInput(data []byte) string {
+	var b strings.Builder
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		switch {
+		case r == '\r' || r == '\n':
+			b.WriteString("⏎")
+		case r == 0x7f:
+			b.WriteString("^?")
+		case r < 0x20:
+			fmt.Fprintf(&b, "^%c", r+'@')
+		case r == utf8.RuneError && size == 1:
+			b.WriteString("�")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+	"alices-mirror/internal/terminal"
+)
+
+// startApprovalServer is startPipeServer for tests that look at the queue
+// of input waiting for approval.
+func startApprovalServer(t *testing.T, userLevels string, pastePolicy PastePolicy) (*Server, *PipeListener, *terminal.ScriptedPTY) {
+	t.Helper()
+	pty := terminal.NewScriptedPTY(nil)
+	session := terminal.NewScriptedSession(terminal.Config{}, pty)
+	t.Cleanup(session.Close)
+
+	rules, err := ParseUserLevelRules(userLevels)
+	if err != nil {
+		t.Fatalf("ParseUserLevelRules: %v", err)
+	}
+	listener := NewPipeListener()
+	srv, err := New(Config{
+		AllowIPs:    []string{"*"},
+		Session:     session,
+		UserLevels:  rules,
+		PastePolicy: pastePolicy,
+		Listeners:   []net.Listener{listener},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = srv.Start(ctx) }()
+	return srv, listener, pty
+}
+
+func pendingApprovals(s *Server) int {
+	s.approvals.mu.Lock()
+	defer s.approvals.mu.Unlock()
+	return len(s.approvals.pending)
+}
+
+func sendInput(t *testing.T, conn *websocket.Conn, input string) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte(input)); err != nil {
+		t.Fatalf("send %q: %v", input, err)
+	}
+}
+
+func sendControl(t *testing.T, conn *websocket.Conn, msg protocol.Message) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, protocol.Encode(msg)); err != nil {
+		t.Fatalf("send %s: %v", msg.MessageType(), err)
+	}
+}
+
+func TestApprovalOwnPasteCannotBeApproved(t *testing.T) {
+	t.Parallel()
+
+	srv, listener, pty := startApprovalServer(t, "*-0", PasteOwner)
+	admin := dialPipe(t, listener, "10.0.0.1")
+	readServerMessage[protocol.Hello](t, admin)
+	viewer := dialPipe(t, listener, "10.0.0.2")
+	readServerMessage[protocol.Hello](t, viewer)
+
+	const paste = "echo one\recho two\r"
+	sendInput(t, viewer, paste)
+	request := readServerMessage[protocol.ApprovalRequest](t, admin)
+
+	sendControl(t, viewer, protocol.ApprovalDecision{ID: request.ID, Approve: true})
+	// Input from the same client is handled in order, so once this reaches
+	// the shell the decision above has been handled too.
+	sendInput(t, viewer, "x")
+	waitFor(t, "the viewer's keystroke", func() bool { return bytes.Contains(pty.Input(), []byte("x")) })
+	if bytes.Contains(pty.Input(), []byte("echo one")) {
+		t.Fatal("the viewer approved its own paste")
+	}
+	if n := pendingApprovals(srv); n != 1 {
+		t.Fatalf("pending approvals = %d, want 1", n)
+	}
+
+	sendControl(t, admin, protocol.ApprovalDecision{ID: request.ID, Approve: true})
+	waitFor(t, "the approved paste", func() bool { return bytes.Contains(pty.Input(), []byte("echo two")) })
+	if resolved := readServerMessage[protocol.ApprovalResolved](t, admin); resolved.ID != request.ID || !resolved.Approved {
+		t.Errorf("resolved = %+v", resolved)
+	}
+}
+
+func TestApprovalOneRequestPerLine(t *testing.T) {
+	t.Parallel()
+
+	srv, listener, pty := startApprovalServer(t, "10.0.0.2-2,*-0", PasteClient)
+	admin := dialPipe(t, listener, "10.0.0.1")
+	readServerMessage[protocol.Hello](t, admin)
+	typist := dialPipe(t, listener, "10.0.0.2")
+	readServerMessage[protocol.Hello](t, typist)
+
+	sendInput(t, typist, "ls\rpwd\r")
+	for _, want := range []string{"ls⏎", "pwd⏎"} {
+		if request := readServerMessage[protocol.ApprovalRequest](t, admin); request.Input != want || request.Remote != "10.0.0.2" {
+			t.Errorf("request = %+v, want input %q from 10.0.0.2", request, want)
+		}
+	}
+	if n := pendingApprovals(srv); n != 2 {
+		t.Errorf("pending approvals = %d, want 2", n)
+	}
+	if input := pty.Input(); len(input) != 0 {
+		t.Errorf("input reached the shell before it was approved: %q", input)
+	}
+}
+
+func TestApprovalBurstEndsOnPause(t *testing.T) {
+	t.Parallel()
+
+	srv, listener, _ := startApprovalServer(t, "10.0.0.2-2,*-0", PasteClient)
+	admin := dialPipe(t, listener, "10.0.0.1")
+	readServerMessage[protocol.Hello](t, admin)
+	typist := dialPipe(t, listener, "10.0.0.2")
+	readServerMessage[protocol.Hello](t, typist)
+
+	for _, keystroke := range []string{"e", "ch", "o"} {
+		sendInput(t, typist, keystroke)
+	}
+	if request := readServerMessage[protocol.ApprovalRequest](t, admin); request.Input != "echo" {
+		t.Errorf("request input = %q, want %q", request.Input, "echo")
+	}
+	if n := pendingApprovals(srv); n != 1 {
+		t.Errorf("pending approvals = %d, want 1", n)
+	}
+}
+
+func TestApprovalPendingCap(t *testing.T) {
+	t.Parallel()
+
+	srv, listener, _ := startApprovalServer(t, "10.0.0.2-2,*-0", PasteClient)
+	typist := dialPipe(t, listener, "10.0.0.2")
+	readServerMessage[protocol.Hello](t, typist)
+
+	sendInput(t, typist, strings.Repeat("ls\r", maxPendingApprovals+1))
+	if status := readServerMessage[protocol.Status](t, typist); status.Message != translate(defaultLanguage, "approval.full") {
+		t.Errorf("status = %q", status.Message)
+	}
+	if n := pendingApprovals(srv); n != maxPendingApprovals {
+		t.Errorf("pending approvals = %d, want %d", n, maxPendingApprovals)
+	}
+}
+
+func TestApprovalLevelTwoCannotDecide(t *testing.T) {
+	t.Parallel()
+
+	srv, listener, pty := startApprovalServer(t, "10.0.0.2-2,10.0.0.3-2,*-0", PasteClient)
+	admin := dialPipe(t, listener, "10.0.0.1")
+	readServerMessage[protocol.Hello](t, admin)
+	typist := dialPipe(t, listener, "10.0.0.2")
+	readServerMessage[protocol.Hello](t, typist)
+	other := dialPipe(t, listener, "10.0.0.3")
+	readServerMessage[protocol.Hello](t, other)
+
+	sendInput(t, typist, "ls\r")
+	request := readServerMessage[protocol.ApprovalRequest](t, admin)
+
+	sendControl(t, other, protocol.ApprovalDecision{ID: request.ID, Approve: true})
+	// Once the next line of the same client is queued, the decision above
+	// has been handled too.
+	sendInput(t, other, "pwd\r")
+	waitFor(t, "the second request", func() bool { return pendingApprovals(srv) == 2 })
+	if input := pty.Input(); len(input) != 0 {
+		t.Errorf("a user level 2 client approved input: %q reached the shell", input)
+	}
+}
+
+func TestApprovalDroppedOnDisconnect(t *testing.T) {
+	t.Parallel()
+
+	srv, listener, _ := startApprovalServer(t, "10.0.0.2-2,*-0", PasteClient)
+	admin := dialPipe(t, listener, "10.0.0.1")
+	readServerMessage[protocol.Hello](t, admin)
+	typist := dialPipe(t, listener, "10.0.0.2")
+	readServerMessage[protocol.Hello](t, typist)
+
+	sendInput(t, typist, "ls\rpw")
+	request := readServerMessage[protocol.ApprovalRequest](t, admin)
+	_ = typist.Close()
+
+	if resolved := readServerMessage[protocol.ApprovalResolved](t, admin); resolved.ID != request.ID || resolved.Approved {
+		t.Errorf("resolved = %+v, want request %d denied", resolved, request.ID)
+	}
+	waitFor(t, "the dropped input", func() bool {
+		srv.approvals.mu.Lock()
+		defer srv.approvals.mu.Unlock()
+		return len(srv.approvals.pending) == 0 && len(srv.approvals.typing) == 0
+	})
+}
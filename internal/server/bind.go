@@ -1,13 +1,30 @@
 package server
 
-import "strings"
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// bindLookupTimeout bounds the DNS lookup of a host name in the bind list.
+const bindLookupTimeout = 3 * time.Second
 
 // ExpandBindPatterns replaces wildcard patterns (containing '*') with matching
-// local IPv4 addresses. Patterns that match nothing are removed.
+// local IPv4 addresses, and host names such as myhost.lan with the local
+// addresses they resolve to. Patterns that match nothing are removed.
 func ExpandBindPatterns(patterns []string) []string {
 	localIPs := LocalIPv4s()
 	seen := make(map[string]struct{}, len(patterns))
 	out := make([]string, 0, len(patterns))
+	add := func(ip string) {
+		if _, ok := seen[ip]; ok {
+			return
+		}
+		seen[ip] = struct{}{}
+		out = append(out, ip)
+	}
 
 	for _, pattern := range patterns {
 		cleaned := strings.TrimSpace(pattern)
@@ -22,23 +39,45 @@ func ExpandBindPatterns(patterns []string) []string {
 			}
 			for _, ip := range localIPs {
 				if matcher.MatchString(ip) {
-					if _, ok := seen[ip]; ok {
-						continue
-					}
-					seen[ip] = struct{}{}
-					out = append(out, ip)
+					add(ip)
 				}
 			}
 			continue
 		}
 
-		if _, ok := seen[cleaned]; ok {
+		if net.ParseIP(cleaned) == nil {
+			for _, ip := range resolveLocalHost(cleaned, localIPs) {
+				add(ip)
+			}
 			continue
 		}
-		seen[cleaned] = struct{}{}
-		out = append(out, cleaned)
+
+		add(cleaned)
 	}
 
 	return out
 }
 
+// resolveLocalHost returns the IPv4 addresses host resolves to that belong
+// to this machine: one of localIPs or a loopback address. Addresses on
+// other machines are skipped, since they cannot be bound.
+func resolveLocalHost(host string, localIPs []string) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), bindLookupTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		logger().Warn("bind host name did not resolve", "host", host, "error", err)
+		return nil
+	}
+	var out []string
+	for _, addr := range addrs {
+		ip := addr.String()
+		if addr.IsLoopback() || slices.Contains(localIPs, ip) {
+			out = append(out, ip)
+		}
+	}
+	if len(out) == 0 {
+		logger().Warn("bind host name resolves to no local address", "host", host, "addresses", addrs)
+	}
+	return out
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+// boardKey marks requests that came in on a board address.
+type boardKey struct{}
+
+// isBoardRequest reports whether r came in on a board address.
+func isBoardRequest(r *http.Request) bool {
+	board, _ := r.Context().Value(boardKey{}).(bool)
+	return board
+}
+
+// boardHandler serves the public board: the web UI and a watch-only
+// WebSocket, without Basic Auth. Only the allow-ip list applies. Input,
+// uploads, resizes and the rest of the API are not served here.
+func (s *Server) boardHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.handleWS)
+	mux.HandleFunc("/api/config.json", s.handleConfig)
+	mux.HandleFunc("/api/i18n/", s.handleI18n)
+	mux.Handle("/", s.staticHandler())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAllowedIP(r) || s.accessExpired(extractRemoteIP(r), "") {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), boardKey{}, true)))
+	})
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+	"alices-mirror/internal/terminal"
+)
+
+func TestBoardWatchOnly(t *testing.T) {
+	t.Parallel()
+
+	pty := terminal.NewScriptedPTY(func(input []byte) []byte { return input })
+	session := terminal.NewScriptedSession(terminal.Config{}, pty)
+	t.Cleanup(session.Close)
+	rules, err := ParseUserLevelRules("*-0")
+	if err != nil {
+		t.Fatalf("ParseUserLevelRules: %v", err)
+	}
+	srv, err := New(Config{
+		AllowIPs:     []string{"*"},
+		Session:      session,
+		Auth:         AuthConfig{Enabled: true, User: "alice", Password: "secret"},
+		UserLevels:   rules,
+		Listeners:    []net.Listener{NewPipeListener()},
+		ResizePolicy: ResizeInteract,
+		ResetPolicy:  ResetAny,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = srv.Start(ctx) }()
+	board := httptest.NewServer(srv.boardHandler())
+	t.Cleanup(board.Close)
+
+	for _, path := range []string{"/upload", "/api/session", "/events"} {
+		resp, err := http.Get(board.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s on the board: got %d, want 404", path, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(board.URL + "/api/config.json")
+	if err != nil {
+		t.Fatalf("GET /api/config.json: %v", err)
+	}
+	var cfg frontendConfig
+	err = json.NewDecoder(resp.Body).Decode(&cfg)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatalf("decoding the config: %v", err)
+	}
+	if !cfg.ReadOnly || cfg.Features.Uploads {
+		t.Errorf("board config: readOnly %v, uploads %v; want read-only without uploads", cfg.ReadOnly, cfg.Features.Uploads)
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{protocol.Subprotocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(board.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dialing the board without credentials: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, payload, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("reading hello: %v", err)
+	}
+	msg, err := protocol.DecodeFromServer(payload)
+	if err != nil {
+		t.Fatalf("decoding hello: %v", err)
+	}
+	hello, ok := msg.(protocol.Hello)
+	if !ok {
+		t.Fatalf("first message is not hello: %s", payload)
+	}
+	if !hello.ReadOnly || hello.CanResize || hello.CanReset {
+		t.Errorf("board hello: %+v; want read-only without resize or reset", hello)
+	}
+
+	cols, rows := pty.Size()
+	_ = conn.WriteMessage(websocket.BinaryMessage, []byte("ls\r"))
+	_ = conn.WriteMessage(websocket.TextMessage, protocol.Encode(protocol.Resize{Cols: 100, Rows: 30}))
+	_ = conn.WriteMessage(websocket.TextMessage, protocol.Encode(protocol.Reset{}))
+	// Messages are handled in order, so the pong comes after them.
+	pong := make(chan struct{})
+	conn.SetPongHandler(func(string) error {
+		close(pong)
+		return nil
+	})
+	_ = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-pong:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pong from the board")
+	}
+
+	if input := pty.Input(); len(input) > 0 {
+		t.Errorf("board input reached the shell: %q", input)
+	}
+	if c, r := pty.Size(); c != cols || r != rows {
+		t.Errorf("board resized the terminal to %dx%d", c, r)
+	}
+	if resets := pty.Resets(); resets != 0 {
+		t.Errorf("board reset the shell %d times", resets)
+	}
+}
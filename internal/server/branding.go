@@ -0,0 +1,73 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+const (
+	maxAliasLength = 64
+	maxMOTDBytes   = 2 << 10
+)
+
+var accentPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Branding is how the mirror presents itself to clients: the alias used in
+// titles and discovery, an accent color for the web client, and a message
+// of the day shown when a client connects. Empty fields keep the defaults.
+type Branding struct {
+	Alias  string
+	Accent string
+	MOTD   string
+}
+
+// Validate reports the first field that cannot be shown safely.
+func (b Branding) Validate() error {
+	if err := ValidateAlias(b.Alias); err != nil {
+		return err
+	}
+	if accent := strings.TrimSpace(b.Accent); accent != "" && !accentPattern.MatchString(accent) {
+		return fmt.Errorf("invalid accent color %q (expected #rgb or #rrggbb)", b.Accent)
+	}
+	if len(b.MOTD) > maxMOTDBytes {
+		return fmt.Errorf("message of the day is longer than %d bytes", maxMOTDBytes)
+	}
+	if !utf8.ValidString(b.MOTD) || strings.ContainsFunc(b.MOTD, func(r rune) bool {
+		return unicode.IsControl(r) && r != '\n' && r != '\t'
+	}) {
+		return errors.New("message of the day may only contain text, tabs and line breaks")
+	}
+	return nil
+}
+
+// ValidateAlias checks an alias: at most 64 characters of text on one line.
+func ValidateAlias(alias string) error {
+	alias = strings.TrimSpace(alias)
+	if utf8.RuneCountInString(alias) > maxAliasLength {
+		return fmt.Errorf("alias is longer than %d characters", maxAliasLength)
+	}
+	if !utf8.ValidString(alias) || strings.ContainsFunc(alias, unicode.IsControl) {
+		return errors.New("alias may not contain control characters")
+	}
+	return nil
+}
+
+// sendMOTD shows the message of the day to c: in a motd message, or as text
+// in the terminal for ssh clients.
+func (s *Server) sendMOTD(c *client) {
+	if c.transport == "ssh" {
+		text := strings.ReplaceAll(s.motd, "\n", "\r\n")
+		c.trySend(wsMessage{messageType: websocket.BinaryMessage, data: []byte(text + "\r\n")})
+		return
+	}
+	payload := protocol.Encode(protocol.MOTD{Message: s.motd})
+	c.trySend(wsMessage{messageType: websocket.TextMessage, data: payload})
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBrandingValidate(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		branding Branding
+		ok       bool
+	}{
+		{branding: Branding{}, ok: true},
+		{branding: Branding{Alias: "Studio Mac", Accent: "#56d39f", MOTD: "Be nice.\nNo rm -rf."}, ok: true},
+		{branding: Branding{Accent: "#FA0"}, ok: true},
+		{branding: Branding{Alias: strings.Repeat("é", 64)}, ok: true},
+		{branding: Branding{Alias: strings.Repeat("é", 65)}},
+		{branding: Branding{Alias: "lab\x1b]0;pwned\x07"}},
+		{branding: Branding{Accent: "red"}},
+		{branding: Branding{Accent: "#56d39"}},
+		{branding: Branding{MOTD: "\x1b[2J"}},
+		{branding: Branding{MOTD: strings.Repeat("x", maxMOTDBytes+1)}},
+	}
+	for _, tc := range cases {
+		if err := tc.branding.Validate(); (err == nil) != tc.ok {
+			t.Errorf("Validate(%+v) = %v, want ok %v", tc.branding, err, tc.ok)
+		}
+	}
+}
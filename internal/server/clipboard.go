@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"alices-mirror/internal/clipboard"
+)
+
+// ClipboardPolicy controls who may use the host clipboard endpoints.
+type ClipboardPolicy string
+
+const (
+	ClipboardOwner    ClipboardPolicy = "owner"
+	ClipboardInteract ClipboardPolicy = "interact"
+	ClipboardOff      ClipboardPolicy = "off"
+)
+
+const maxClipboardBytes = 1 << 20
+
+// ParseClipboardPolicy validates a --clipboard value. Empty means owner.
+func ParseClipboardPolicy(raw string) (ClipboardPolicy, error) {
+	switch policy := ClipboardPolicy(strings.ToLower(strings.TrimSpace(raw))); policy {
+	case "":
+		return ClipboardOwner, nil
+	case ClipboardOwner, ClipboardInteract, ClipboardOff:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid clipboard policy %q (expected owner, interact or off)", raw)
+	}
+}
+
+// clipboardAllowed reports whether r may read and write the host clipboard.
+// The owner authenticates with the owner token; with the interact policy any
+// level-0 client is allowed too.
+func (s *Server) clipboardAllowed(r *http.Request) bool {
+	if isBoardRequest(r) {
+		return false
+	}
+	switch s.clipboardPolicy {
+	case ClipboardOwner:
+		return s.ownerTokenMatches(r)
+	case ClipboardInteract:
+		return s.ownerTokenMatches(r) || s.requestUserLevel(r) == UserLevelInteract
+	default:
+		return false
+	}
+}
+
+func (s *Server) handleClipboard(w http.ResponseWriter, r *http.Request) {
+	if !s.clipboardAllowed(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		text, err := clipboard.Read()
+		if err != nil {
+			writeClipboardError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(map[string]string{"text": text})
+	case http.MethodPost:
+		var body struct {
+			Text string `json:"text"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxClipboardBytes)).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := clipboard.Write(body.Text); err != nil {
+			writeClipboardError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeClipboardError(w http.ResponseWriter, err error) {
+	if errors.Is(err, clipboard.ErrUnavailable) {
+		http.Error(w, "Host clipboard not available", http.StatusNotImplemented)
+		return
+	}
+	http.Error(w, "Clipboard error: "+err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxCommandLine bounds the characters tracked for one line; further input
+// on the line is dropped.
+const maxCommandLine = 4096
+
+// CommandFilter decides which command lines clients other than the owner
+// may run. A pattern names a command and the start of its arguments, with
+// * as a wildcard: "rm" matches "rm -rf /tmp/x" and "/bin/rm x", and
+// "curl*|*sh" matches a whole line that pipes curl into a shell. It reads
+// the line the way a person would and is no substitute for --confine.
+type CommandFilter struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// NewCommandFilter compiles the allow and deny patterns. With allow
+// patterns, every command on a line must match one of them.
+func NewCommandFilter(allow, deny []string) (*CommandFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, errors.New("no command patterns given")
+	}
+	f := &CommandFilter{}
+	for _, list := range []struct {
+		patterns []string
+		out      *[]*regexp.Regexp
+	}{{allow, &f.allow}, {deny, &f.deny}} {
+		for _, pattern := range list.patterns {
+			pattern = strings.Join(strings.Fields(pattern), " ")
+			if pattern == "" {
+				return nil, errors.New("command pattern cannot be empty")
+			}
+			escaped := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+			matcher, err := regexp.Compile("^" + escaped + `(\s.*)?$`)
+			if err != nil {
+				return nil, fmt.Errorf("invalid command pattern %q: %v", pattern, err)
+			}
+			*list.out = append(*list.out, matcher)
+		}
+	}
+	return f, nil
+}
+
+// Check reports whether line may run. When it may not, it also returns the
+// part of the line that was refused.
+func (f *CommandFilter) Check(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", true
+	}
+	commands := splitCommands(line)
+	for _, deny := range f.deny {
+		if deny.MatchString(line) {
+			return line, false
+		}
+		for _, command := range commands {
+			if deny.MatchString(command) {
+				return command, false
+			}
+		}
+	}
+	if len(f.allow) == 0 {
+		return "", true
+	}
+	for _, command := range commands {
+		allowed := false
+		for _, allow := range f.allow {
+			if allow.MatchString(command) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return command, false
+		}
+	}
+	return "", true
+}
+
+// splitCommands breaks a shell line into its simple commands at ;, &, |,
+// parentheses, backquotes and line ends outside quotes. Each command has
+// leading variable assignments removed and its program reduced to the base
+// name, so "FOO=1 /bin/rm x" becomes "rm x".
+func splitCommands(line string) []string {
+	var commands []string
+	var current strings.Builder
+	flush := func() {
+		if command := normalizeCommand(current.String()); command != "" {
+			commands = append(commands, command)
+		}
+		current.Reset()
+	}
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case strings.ContainsRune(";&|()`\n", r):
+			flush()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	flush()
+	return commands
+}
+
+func normalizeCommand(command string) string {
+	words := strings.Fields(command)
+	for len(words) > 0 && isAssignment(words[0]) {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return ""
+	}
+	program := unquote.Replace(words[0])
+	if strings.Contains(program, "/") {
+		program = path.Base(program)
+	}
+	words[0] = program
+	return strings.Join(words, " ")
+}
+
+// unquote removes the quoting that leaves a program name unchanged for the
+// shell, as in "rm" or \rm.
+var unquote = strings.NewReplacer(`\`, "", "'", "", `"`, "")
+
+func isAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// commandLine follows what a filtered client types, so each line can be
+// checked before its Enter reaches the shell. Keys that could change the
+// shell's line without the filter seeing it, such as Tab, arrows and other
+// escape sequences, are dropped; a refused line is cleared with ^U instead
+// of being submitted.
+type commandLine struct {
+	mu      sync.Mutex
+	text    []rune
+	earlier string // lines continued with a trailing backslash
+	escape  int
+	partial []byte
+}
+
+// Escape sequence states of commandLine.
+const (
+	escNone = iota
+	escStart
+	escCSI
+	escSS3
+)
+
+// filter returns the part of data to pass on to the shell and the commands
+// it refused.
+func (l *commandLine) filter(f *CommandFilter, data []byte) ([]byte, []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.partial) > 0 {
+		data = append(l.partial, data...)
+		l.partial = nil
+	}
+	out := make([]byte, 0, len(data))
+	var refused []string
+	for len(data) > 0 {
+		if !utf8.FullRune(data) {
+			l.partial = append([]byte(nil), data...)
+			break
+		}
+		r, size := utf8.DecodeRune(data)
+		raw := data[:size]
+		data = data[size:]
+
+		switch l.escape {
+		case escStart:
+			switch r {
+			case '[':
+				l.escape = escCSI
+			case 'O':
+				l.escape = escSS3
+			default:
+				l.escape = escNone
+			}
+			continue
+		case escCSI:
+			if r >= 0x40 && r <= 0x7e {
+				l.escape = escNone
+			}
+			continue
+		case escSS3:
+			l.escape = escNone
+			continue
+		}
+
+		switch {
+		case r == 0x1b:
+			l.escape = escStart
+		case r == '\r' || r == '\n':
+			line := l.earlier + string(l.text)
+			l.text = l.text[:0]
+			if continued, ok := strings.CutSuffix(line, `\`); ok {
+				l.earlier = continued
+				out = append(out, raw...)
+				continue
+			}
+			if command, ok := f.Check(line); !ok {
+				refused = append(refused, command)
+				out = append(out, 0x15)
+				continue
+			}
+			l.earlier = ""
+			out = append(out, raw...)
+		case r == 0x7f || r == 0x08:
+			if len(l.text) > 0 {
+				l.text = l.text[:len(l.text)-1]
+			}
+			out = append(out, raw...)
+		case r == 0x03:
+			l.text = l.text[:0]
+			l.earlier = ""
+			out = append(out, raw...)
+		case r == 0x15:
+			l.text = l.text[:0]
+			out = append(out, raw...)
+		case r < 0x20:
+		default:
+			if len(l.text) < maxCommandLine {
+				l.text = append(l.text, r)
+				out = append(out, raw...)
+			}
+		}
+	}
+	return out, refused
+}
+
+// filterCommands passes input from a client other than the owner through
+// the command filter and tells the client about every refused command.
+func (s *Server) filterCommands(c *client, payload []byte) []byte {
+	out, refused := c.commands.filter(s.commandFilter, payload)
+	for _, command := range refused {
+		s.recordEvent(EventRefused, c.remoteIP, "command refused: %s", command)
+		s.sendStatus(c, translate(c.lang, "command.refused", command))
+	}
+	return out
+}
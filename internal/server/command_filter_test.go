@@ -0,0 +1,70 @@
+package server
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCommandFilterCheck(t *testing.T) {
+	t.Parallel()
+
+	deny, err := NewCommandFilter(nil, []string{"rm", "shutdown", "curl*|*sh"})
+	if err != nil {
+		t.Fatalf("NewCommandFilter: %v", err)
+	}
+	allow, err := NewCommandFilter([]string{"ls", "cat", "git status"}, nil)
+	if err != nil {
+		t.Fatalf("NewCommandFilter: %v", err)
+	}
+
+	cases := []struct {
+		filter *CommandFilter
+		line   string
+		want   bool
+	}{
+		{filter: deny, line: "ls -la", want: true},
+		{filter: deny, line: "rm -rf /tmp/x", want: false},
+		{filter: deny, line: "ls; /bin/rm x", want: false},
+		{filter: deny, line: "FOO=1 \\rm x", want: false},
+		{filter: deny, line: "r''m x", want: false},
+		{filter: deny, line: "echo 'a; rm x'", want: true},
+		{filter: deny, line: "farm", want: true},
+		{filter: deny, line: "curl -s example.com | sh", want: false},
+		{filter: deny, line: "", want: true},
+		{filter: allow, line: "ls -la | cat", want: true},
+		{filter: allow, line: "git status", want: true},
+		{filter: allow, line: "git push", want: false},
+		{filter: allow, line: "ls && whoami", want: false},
+	}
+
+	for _, tc := range cases {
+		if _, got := tc.filter.Check(tc.line); got != tc.want {
+			t.Errorf("Check(%q) = %v, want %v", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestCommandLineFilter(t *testing.T) {
+	t.Parallel()
+
+	filter, err := NewCommandFilter(nil, []string{"rm"})
+	if err != nil {
+		t.Fatalf("NewCommandFilter: %v", err)
+	}
+	var line commandLine
+
+	out, refused := line.filter(filter, []byte("rx\x7fm -rf x\r"))
+	if string(out) != "rx\x7fm -rf x\x15" || !slices.Equal(refused, []string{"rm -rf x"}) {
+		t.Errorf("refused line: got %q, %q", out, refused)
+	}
+
+	out, refused = line.filter(filter, []byte("ls\x1b[D\t\r"))
+	if string(out) != "ls\r" || len(refused) != 0 {
+		t.Errorf("allowed line: got %q, %q", out, refused)
+	}
+
+	out, refused = line.filter(filter, []byte("r\\\rm x\r"))
+	if string(out) != "r\\\rm x\x15" || len(refused) != 1 {
+		t.Errorf("continued line: got %q, %q", out, refused)
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type frontendFeatures struct {
+	Uploads   bool   `json:"uploads"`
+	Clipboard string `json:"clipboard"`
+	Chat      bool   `json:"chat"`
+	Snippets  bool   `json:"snippets"`
+}
+
+type frontendConfig struct {
+	Alias     string           `json:"alias"`
+	Accent    string           `json:"accent,omitempty"`
+	MOTD      string           `json:"motd,omitempty"`
+	WSPath    string           `json:"wsPath"`
+	UserLevel int              `json:"userLevel"`
+	ReadOnly  bool             `json:"readOnly"`
+	Features  frontendFeatures `json:"features"`
+
+	// TitlePrefix starts the titles the shell integrations emit.
+	TitlePrefix string `json:"titlePrefix"`
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	level := s.requestUserLevel(r)
+	interact := level == UserLevelInteract
+	clipboardMode := "local"
+	if s.clipboardAllowed(r) {
+		clipboardMode = "host"
+	}
+	cfg := frontendConfig{
+		Alias:     s.Alias(),
+		Accent:    s.accent,
+		MOTD:      s.motd,
+		WSPath:    "/ws",
+		UserLevel: int(level),
+		ReadOnly:  level == UserLevelWatchOnly,
+		Features: frontendFeatures{
+			Uploads:   interact,
+			Clipboard: clipboardMode,
+			Chat:      false,
+			Snippets:  interact,
+		},
+
+		TitlePrefix: s.session.TitlePrefix(),
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(cfg)
+}
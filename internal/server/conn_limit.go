@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+)
+
+// connLimiter caps the requests in flight from each client address. A
+// WebSocket or event stream counts for as long as it stays open.
+type connLimiter struct {
+	max int
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newConnLimiter(max int) *connLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &connLimiter{max: max, counts: make(map[string]int)}
+}
+
+// acquire counts a new request from ip, unless ip is at the limit.
+func (l *connLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[ip] >= l.max {
+		return false
+	}
+	l.counts[ip]++
+	return true
+}
+
+func (l *connLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.counts[ip] <= 1 {
+		delete(l.counts, ip)
+		return
+	}
+	l.counts[ip]--
+}
+
+// limitConnsPerIP answers 429 to requests from an address that already
+// has MaxConnsPerIP in flight. Requests with the owner token are neither
+// limited nor counted, so viewers on the host cannot lock the owner out.
+func (s *Server) limitConnsPerIP(next http.Handler) http.Handler {
+	if s.connLimit == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.ownerToken != "" && s.ownerTokenMatches(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ip := extractRemoteIP(r)
+		if !s.connLimit.acquire(ip) {
+			s.metrics.refused.Add(1)
+			logger().Debug("too many connections", "remote", ip, "max", s.connLimit.max)
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, translate(requestLanguage(r), "conns.tooMany"), http.StatusTooManyRequests)
+			return
+		}
+		defer s.connLimit.release(ip)
+		next.ServeHTTP(w, r)
+	})
+}
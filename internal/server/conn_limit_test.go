@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLimitConnsPerIP(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{connLimit: newConnLimiter(1)}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := s.limitConnsPerIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws" {
+			close(started)
+			<-release
+		}
+	}))
+	get := func(path, remote string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	done := make(chan struct{})
+	go func() {
+		get("/ws", "10.0.0.1:40000")
+		close(done)
+	}()
+	<-started
+
+	if code := get("/", "10.0.0.1:40001"); code != http.StatusTooManyRequests {
+		t.Errorf("second request from the same address: got %d, want 429", code)
+	}
+	if code := get("/", "10.0.0.2:40000"); code != http.StatusOK {
+		t.Errorf("request from another address: got %d, want 200", code)
+	}
+
+	close(release)
+	<-done
+	if code := get("/", "10.0.0.1:40002"); code != http.StatusOK {
+		t.Errorf("request after the first finished: got %d, want 200", code)
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// diagStatus is the runtime part of GET /api/diag.
+type diagStatus struct {
+	Version     string    `json:"version"`
+	StartedAt   time.Time `json:"startedAt"`
+	Uptime      string    `json:"uptime"`
+	GoVersion   string    `json:"goVersion"`
+	OS          string    `json:"os"`
+	Arch        string    `json:"arch"`
+	Goroutines  int       `json:"goroutines"`
+	HeapAlloc   uint64    `json:"heapAllocBytes"`
+	HeapSys     uint64    `json:"heapSysBytes"`
+	NumGC       uint32    `json:"numGC"`
+	Clients     int       `json:"clients"`
+	WorkDir     string    `json:"workDir"`
+	Accepting   bool      `json:"acceptingClients"`
+	OutputBytes int64     `json:"bufferedOutputBytes"`
+}
+
+// handleDiag serves the data collected by "alices-mirror diag": GET
+// /api/diag for the effective configuration and runtime status, and
+// /api/diag/goroutine and /api/diag/heap for profiles. Goroutine dumps and
+// heap profiles show what the shell and every viewer are doing, so only the
+// owner token gets them.
+func (s *Server) handleDiag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.ownerTokenMatches(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.URL.Path {
+	case "/api/diag/goroutine":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_ = pprof.Lookup("goroutine").WriteTo(w, 2)
+	case "/api/diag/heap":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_ = pprof.Lookup("heap").WriteTo(w, 0)
+	case "/api/diag":
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		var buffered int64
+		clients := s.snapshotClients()
+		for _, c := range clients {
+			buffered += int64(c.bufferedBytes())
+		}
+		status := diagStatus{
+			Version:     s.version,
+			StartedAt:   s.startedAt,
+			Uptime:      time.Since(s.startedAt).Round(time.Second).String(),
+			GoVersion:   runtime.Version(),
+			OS:          runtime.GOOS,
+			Arch:        runtime.GOARCH,
+			Goroutines:  runtime.NumGoroutine(),
+			HeapAlloc:   mem.HeapAlloc,
+			HeapSys:     mem.HeapSys,
+			NumGC:       mem.NumGC,
+			Clients:     len(clients),
+			WorkDir:     s.session.WorkDir(),
+			Accepting:   s.AcceptingClients(),
+			OutputBytes: buffered,
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string]any{"config": s.effectiveConfig, "status": status})
+	default:
+		http.NotFound(w, r)
+	}
+}
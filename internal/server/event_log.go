@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+// eventLogSize is how many recent events the server keeps.
+const eventLogSize = 256
+
+// Event kinds recorded in the event log.
+const (
+	EventConnect    = "connect"
+	EventDisconnect = "disconnect"
+	EventReset      = "reset"
+	EventUpload     = "upload"
+	EventStatus     = "status"
+	EventError      = "error"
+	EventNewIP      = "new-ip"
+	EventApproval   = "approval"
+	EventRefused    = "refused"
+	EventAccess     = "access"
+)
+
+// Event is one entry of the server's recent history.
+type Event = protocol.Event
+
+// eventLog is a ring of the most recent events.
+type eventLog struct {
+	mu     sync.Mutex
+	events []Event
+	next   int64
+}
+
+func (l *eventLog) add(kind, remote, message string) Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.next++
+	event := Event{ID: l.next, Time: time.Now().UTC(), Kind: kind, Remote: remote, Message: message}
+	if len(l.events) == eventLogSize {
+		copy(l.events, l.events[1:])
+		l.events = l.events[:eventLogSize-1]
+	}
+	l.events = append(l.events, event)
+	return event
+}
+
+// since returns the events with an ID above id, oldest first.
+func (l *eventLog) since(id int64) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]Event, 0, len(l.events))
+	for _, event := range l.events {
+		if event.ID > id {
+			out = append(out, event)
+		}
+	}
+	return out
+}
+
+// RecentEvents returns the events the server still holds with an ID above
+// since, oldest first.
+func (s *Server) RecentEvents(since int64) []Event {
+	return s.events.since(since)
+}
+
+// recordEvent adds an event and sends it to clients subscribed with an
+// events control message.
+func (s *Server) recordEvent(kind, remote, format string, args ...any) {
+	event := s.events.add(kind, remote, fmt.Sprintf(format, args...))
+	payload := protocol.Encode(protocol.NewEvent{Event: event})
+	msg := wsMessage{messageType: websocket.TextMessage, data: payload}
+	for _, c := range s.snapshotClients() {
+		if c.subscribedToEvents() {
+			c.trySend(msg)
+		}
+	}
+}
+
+func (c *client) subscribedToEvents() bool {
+	c.eventsMu.Lock()
+	defer c.eventsMu.Unlock()
+	return c.eventsOn
+}
+
+// subscribeEvents turns the event feed on or off for c. Turning it on first
+// replays the events after since. The log names other viewers and their
+// addresses, so only the owner can turn it on.
+func (s *Server) subscribeEvents(c *client, on bool, since int64) {
+	if on && !c.isOwner {
+		return
+	}
+	c.eventsMu.Lock()
+	c.eventsOn = on
+	c.eventsMu.Unlock()
+	if !on {
+		return
+	}
+	payload := protocol.Encode(protocol.Events{Events: s.events.since(since)})
+	c.trySend(wsMessage{messageType: websocket.TextMessage, data: payload})
+}
+
+// handleEventLog serves GET /api/events?since=<id>&token=<owner token>.
+func (s *Server) handleEventLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.ownerTokenMatches(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var since int64
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value < 0 {
+			http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+			return
+		}
+		since = value
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]any{"events": s.events.since(since)})
+}
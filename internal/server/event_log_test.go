@@ -0,0 +1,17 @@
+package server
+
+import "testing"
+
+func TestEventLogKeepsNewest(t *testing.T) {
+	var l eventLog
+	for i := 0; i < eventLogSize+10; i++ {
+		l.add(EventStatus, "", "status")
+	}
+	all := l.since(0)
+	if len(all) != eventLogSize || all[0].ID != 11 || all[len(all)-1].ID != eventLogSize+10 {
+		t.Fatalf("got %d events from %d to %d", len(all), all[0].ID, all[len(all)-1].ID)
+	}
+	if newer := l.since(eventLogSize + 8); len(newer) != 2 {
+		t.Fatalf("since(%d) returned %d events, want 2", eventLogSize+8, len(newer))
+	}
+}
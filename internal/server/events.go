@@ -0,0 +1,188 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// The event-stream transport is a fallback for networks that block
+// WebSockets. Output arrives over Server-Sent Events on /events (terminal
+// data base64-encoded in "output" events, control messages as plain
+// "message" events) and input is POSTed to /events/input?id=<session id>.
+const (
+	eventKeepAlive     = 15 * time.Second
+	maxEventInputBytes = 1 << 20
+)
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.AcceptingClients() {
+		http.Error(w, translate(requestLanguage(r), "sharing.paused"), http.StatusServiceUnavailable)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	snapshotLimit, err := parseSnapshotLimit(r.URL.Query().Get("snapshot"))
+	if err != nil {
+		http.Error(w, "Invalid snapshot parameter", http.StatusBadRequest)
+		return
+	}
+
+	id, err := newEventClientID()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	c := &client{
+		send:      make(chan wsMessage, 128),
+		kick:      make(chan struct{}),
+		remoteIP:  extractRemoteIP(r),
+		user:      s.requestUser(r),
+		lang:      requestLanguage(r),
+		transport: "events",
+		joinedAt:  time.Now(),
+		levelCap:  handoverLevel(r),
+
+		snapshotLimit: snapshotLimit,
+	}
+	c.setLevel(s.requestUserLevel(r))
+
+	// The stream outlives the server's WriteTimeout, so each write gets
+	// wsWriteTimeout instead and no deadline is pending in between.
+	rc := http.NewResponseController(w)
+	arm := func() { _ = rc.SetWriteDeadline(time.Now().Add(s.wsWriteTimeout)) }
+	disarm := func() { _ = rc.SetWriteDeadline(time.Time{}) }
+
+	arm()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sessionPayload, _ := json.Marshal(map[string]string{"id": id})
+	if err := writeEvent(w, "session", sessionPayload); err != nil {
+		return
+	}
+	flusher.Flush()
+	disarm()
+
+	s.clientsMu.Lock()
+	s.eventClients[id] = c
+	s.clientsMu.Unlock()
+	s.addClient(c)
+	defer func() {
+		c.disconnect()
+		s.removeClient(c)
+		s.clientsMu.Lock()
+		delete(s.eventClients, id)
+		s.clientsMu.Unlock()
+	}()
+	go s.greetClient(c)
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.kick:
+			return
+		case msg := <-c.send:
+			c.written(len(msg.data))
+			arm()
+			var err error
+			if msg.messageType == websocket.BinaryMessage {
+				err = writeEvent(w, "output", []byte(base64.StdEncoding.EncodeToString(msg.data)))
+			} else {
+				err = writeEvent(w, "", msg.data)
+			}
+			msg.chunk.Release()
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+			disarm()
+			c.drainBacklog()
+			s.resumeIfCaughtUp(c)
+		case <-keepAlive.C:
+			arm()
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			disarm()
+		}
+	}
+}
+
+// handleEventsInput accepts input for an event-stream client: JSON control
+// messages with Content-Type application/json, raw terminal input otherwise.
+func (s *Server) handleEventsInput(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	s.clientsMu.Lock()
+	c := s.eventClients[id]
+	s.clientsMu.Unlock()
+	if c == nil || c.remoteIP != extractRemoteIP(r) {
+		http.Error(w, "Unknown session", http.StatusNotFound)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEventInputBytes))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	messageType := websocket.BinaryMessage
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		messageType = websocket.TextMessage
+	}
+	s.handleClientMessage(c, messageType, payload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeEvent(w io.Writer, event string, data []byte) error {
+	var b strings.Builder
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func newEventClientID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
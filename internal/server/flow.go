@@ -0,0 +1,218 @@
+package server
+
+import (
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/terminal"
+)
+
+// Clients that send ack messages get output paced by how much they have
+// actually processed. Once more than flowHighWatermark bytes are unacked, new
+// output is held in a per-client queue until the client catches up to
+// flowLowWatermark. Clients that never ack keep the old best-effort behavior.
+const (
+	flowHighWatermark = 512 << 10
+	flowLowWatermark  = 128 << 10
+	maxPendingOutput  = 4 << 20
+)
+
+type flowState struct {
+	enabled      bool
+	paused       bool
+	sent         int64
+	acked        int64
+	pending      []terminal.OutputChunk
+	pendingHead  int
+	pendingBytes int
+	dropped      int64
+	// queuedBytes is the size of the messages waiting in the send channel.
+	queuedBytes int
+
+	// Best-effort delivery state for clients without flow control.
+	overflow []byte
+	skipped  bool
+
+	// Sequencing state: until ready, live output is parked in early. base is
+	// the stream offset the client has already been given.
+	ready      bool
+	base       int64
+	early      []terminal.OutputChunk
+	earlyBytes int
+}
+
+// queueOutput delivers a chunk of terminal output.
+func (c *client) queueOutput(chunk terminal.OutputChunk, policy SlowClientPolicy) {
+	if c.disconnected() {
+		return
+	}
+
+	c.flowMu.Lock()
+	defer c.flowMu.Unlock()
+
+	if !c.flow.ready {
+		if c.flow.earlyBytes+len(chunk.Data) > maxPendingOutput {
+			c.flow.dropped++
+			c.flow.skipped = true
+			return
+		}
+		chunk.Retain()
+		c.flow.early = append(c.flow.early, chunk)
+		c.flow.earlyBytes += len(chunk.Data)
+		return
+	}
+	c.queueOutputLocked(chunk, policy)
+}
+
+// markReady releases output held back while the snapshot was sent. offset is
+// the stream position the snapshot ended at.
+func (c *client) markReady(offset int64, policy SlowClientPolicy) {
+	c.flowMu.Lock()
+	defer c.flowMu.Unlock()
+
+	c.flow.base = offset
+	c.flow.ready = true
+	early := c.flow.early
+	c.flow.early = nil
+	c.flow.earlyBytes = 0
+	for _, chunk := range early {
+		c.queueOutputLocked(chunk, policy)
+		chunk.Release()
+	}
+}
+
+func (c *client) queueOutputLocked(chunk terminal.OutputChunk, policy SlowClientPolicy) {
+	end := chunk.Offset + int64(len(chunk.Data))
+	if end <= c.flow.base {
+		return
+	}
+	if chunk.Offset < c.flow.base {
+		chunk.Data = chunk.Data[c.flow.base-chunk.Offset:]
+		chunk.Offset = c.flow.base
+	}
+	c.flow.base = end
+
+	if !c.flow.enabled {
+		c.deliverBestEffortLocked(chunk, policy)
+		return
+	}
+
+	if c.flow.pendingBytes+len(chunk.Data) > maxPendingOutput {
+		c.flow.dropped++
+		return
+	}
+	chunk.Retain()
+	c.flow.pending = append(c.flow.pending, chunk)
+	c.flow.pendingBytes += len(chunk.Data)
+	c.flushOutputLocked()
+}
+
+func (c *client) flushOutputLocked() {
+	for c.flow.pendingHead < len(c.flow.pending) {
+		unacked := c.flow.sent - c.flow.acked
+		if c.flow.paused && unacked > flowLowWatermark {
+			return
+		}
+		c.flow.paused = false
+		if unacked >= flowHighWatermark {
+			c.flow.paused = true
+			return
+		}
+		chunk := c.flow.pending[c.flow.pendingHead]
+		select {
+		case c.send <- wsMessage{messageType: websocket.BinaryMessage, data: chunk.Data, chunk: chunk}:
+		default:
+			return
+		}
+		c.flow.pending[c.flow.pendingHead] = terminal.OutputChunk{}
+		c.flow.pendingHead++
+		if c.flow.pendingHead == len(c.flow.pending) {
+			// Reuse the backing array instead of growing a new one.
+			c.flow.pending = c.flow.pending[:0]
+			c.flow.pendingHead = 0
+		}
+		c.flow.pendingBytes -= len(chunk.Data)
+		c.flow.queuedBytes += len(chunk.Data)
+		c.flow.sent += int64(len(chunk.Data))
+	}
+}
+
+// handleAck records that the client has processed total bytes of output.
+func (s *Server) handleAck(c *client, total int64) {
+	c.flowMu.Lock()
+	c.flow.enabled = true
+	if total > c.flow.acked && total <= c.flow.sent {
+		c.flow.acked = total
+	}
+	c.flushOutputLocked()
+	c.flowMu.Unlock()
+
+	s.updateOutputPause()
+}
+
+// trySend queues msg without blocking and counts it as dropped when the
+// client's queue is full.
+func (c *client) trySend(msg wsMessage) bool {
+	select {
+	case c.send <- msg:
+		c.queued(len(msg.data))
+		return true
+	default:
+		c.flowMu.Lock()
+		c.flow.dropped++
+		c.flowMu.Unlock()
+		return false
+	}
+}
+
+func (c *client) droppedMessages() int64 {
+	c.flowMu.Lock()
+	defer c.flowMu.Unlock()
+	return c.flow.dropped
+}
+
+// saturated reports whether c cannot take more output right now: it is
+// paused by flow control, or its send queue is filling up faster than its
+// connection drains it.
+func (c *client) saturated() bool {
+	if len(c.send) >= cap(c.send)/2 {
+		return true
+	}
+	c.flowMu.Lock()
+	defer c.flowMu.Unlock()
+	if c.flow.enabled {
+		return c.flow.paused || c.flow.pendingHead < len(c.flow.pending)
+	}
+	return len(c.flow.overflow) > 0
+}
+
+// updateOutputPause throttles reading from the PTY while most connected
+// clients are saturated, so output is paced to what the connections can
+// carry instead of piling up or being dropped. A few slow clients do not
+// hold back the rest; they fall under the slow-client policy instead.
+func (s *Server) updateOutputPause() {
+	clients := s.snapshotClients()
+	saturated := 0
+	for _, c := range clients {
+		if c.saturated() {
+			saturated++
+		}
+	}
+	paused := saturated > 0 && saturated*2 > len(clients)
+
+	s.pauseMu.Lock()
+	s.outputPaused = paused
+	s.pauseMu.Unlock()
+	s.session.SetOutputPaused(paused)
+}
+
+// resumeIfCaughtUp is called by a client's writer after each message and
+// re-evaluates the pause as soon as that client has room again, rather than
+// waiting for the next ack or chunk of output.
+func (s *Server) resumeIfCaughtUp(c *client) {
+	s.pauseMu.Lock()
+	paused := s.outputPaused
+	s.pauseMu.Unlock()
+	if paused && !c.saturated() {
+		s.updateOutputPause()
+	}
+}
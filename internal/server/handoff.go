@@ -0,0 +1,136 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/websocket"
+)
+
+// fileSocket is a bound socket that can be handed to another process.
+// *net.TCPListener and *net.UDPConn implement it.
+type fileSocket interface {
+	File() (*os.File, error)
+}
+
+// socketKey names a socket in Config.Inherited and ListenerFiles.
+func socketKey(network, addr string) string {
+	return network + "/" + addr
+}
+
+// listen takes over the inherited TCP socket for addr, or binds a new one.
+func (s *Server) listen(addr string) (net.Listener, error) {
+	key := socketKey("tcp", addr)
+	if f, ok := s.inherited[key]; ok {
+		delete(s.inherited, key)
+		listener, err := net.FileListener(f)
+		_ = f.Close()
+		if err == nil {
+			s.recordBound(key, listener)
+			return listener, nil
+		}
+		logger().Warn("inherited listener unusable, binding again", "addr", addr, "err", err)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s.recordBound(key, listener)
+	return listener, nil
+}
+
+// listenPacket is listen for UDP.
+func (s *Server) listenPacket(addr string) (net.PacketConn, error) {
+	key := socketKey("udp", addr)
+	if f, ok := s.inherited[key]; ok {
+		delete(s.inherited, key)
+		pc, err := net.FilePacketConn(f)
+		_ = f.Close()
+		if err == nil {
+			s.recordBound(key, pc)
+			return pc, nil
+		}
+		logger().Warn("inherited UDP socket unusable, binding again", "addr", addr, "err", err)
+	}
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s.recordBound(key, pc)
+	return pc, nil
+}
+
+func (s *Server) recordBound(key string, socket any) {
+	fs, ok := socket.(fileSocket)
+	if !ok {
+		return
+	}
+	s.boundMu.Lock()
+	s.bound[key] = fs
+	s.boundMu.Unlock()
+}
+
+// closeInherited closes inherited sockets for addresses no longer listened
+// on, for example after the port changed between versions.
+func (s *Server) closeInherited() {
+	for key, f := range s.inherited {
+		_ = f.Close()
+		delete(s.inherited, key)
+	}
+}
+
+// ListenerFiles returns a copy of every socket the server listens on, for
+// Config.Inherited of the process that replaces this one. The caller owns
+// the files.
+func (s *Server) ListenerFiles() (map[string]*os.File, error) {
+	s.boundMu.Lock()
+	defer s.boundMu.Unlock()
+
+	files := make(map[string]*os.File, len(s.bound))
+	for key, socket := range s.bound {
+		f, err := socket.File()
+		if err != nil {
+			for _, opened := range files {
+				_ = opened.Close()
+			}
+			return nil, fmt.Errorf("failed to copy %s: %w", key, err)
+		}
+		files[key] = f
+	}
+	return files, nil
+}
+
+// Drain stops the server for a restart: clients are told to reconnect,
+// listeners are closed and Start returns. Unlike a shutdown, the terminal
+// session is left running for the next process to take over.
+func (s *Server) Drain() {
+	s.shutdownOnce.Do(func() {
+		s.recordEvent(EventStatus, "", "server restarting")
+		s.sayGoodbye(websocket.CloseServiceRestart, "server restarting")
+		if s.shutdownFunc != nil {
+			s.shutdownFunc()
+		}
+	})
+}
+
+// handleUpgrade lets the owner replace the running binary without ending
+// the session with POST /api/upgrade?token=<owner token>.
+func (s *Server) handleUpgrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.ownerTokenMatches(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := s.onUpgrade(); err != nil {
+		logger().Warn("upgrade failed", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
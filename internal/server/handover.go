@@ -0,0 +1,361 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+const (
+	// handoverKeyTTL is how long the key from AcceptHandover is good for:
+	// the other mirror has this long to send its viewers here.
+	handoverKeyTTL = 15 * time.Minute
+	// handoverPassTTL is how long the pass each viewer is given with the
+	// redirect is good for. A pass also works only once.
+	handoverPassTTL = 5 * time.Minute
+	// handoverSessionTTL is how long a viewer that came in with a pass
+	// stays signed in, long enough for a demo to carry on after it moved.
+	handoverSessionTTL = 24 * time.Hour
+	// handoverCookie keeps a viewer that came in with a pass signed in for
+	// the requests its page makes afterwards.
+	handoverCookie       = "alices_mirror_handover"
+	maxHandoverBodyBytes = 4 << 10
+)
+
+// handoverLevelKey carries the user level a viewer had on the mirror it
+// was moved from.
+type handoverLevelKey struct{}
+
+// handoverLevel returns the user level r brought from the mirror it was
+// moved from, or UserLevelInteract when it was not moved here.
+func handoverLevel(r *http.Request) UserLevel {
+	level, ok := r.Context().Value(handoverLevelKey{}).(UserLevel)
+	if !ok {
+		return UserLevelInteract
+	}
+	return level
+}
+
+// handoverSession is a viewer signed in with a pass.
+type handoverSession struct {
+	level   UserLevel
+	expires time.Time
+}
+
+// handoverState is what lets viewers moved here from another mirror in
+// without a password: the keys given out by AcceptHandover, the passes
+// already used, and the viewers signed in with one.
+type handoverState struct {
+	mu       sync.Mutex
+	keys     map[string]time.Time
+	spent    map[string]time.Time
+	sessions map[string]handoverSession
+}
+
+// pruneLocked forgets what expired. h.mu must be held.
+func (h *handoverState) pruneLocked(now time.Time) {
+	for key, expires := range h.keys {
+		if !expires.After(now) {
+			delete(h.keys, key)
+		}
+	}
+	for nonce, expires := range h.spent {
+		if !expires.After(now) {
+			delete(h.spent, nonce)
+		}
+	}
+	for id, session := range h.sessions {
+		if !session.expires.After(now) {
+			delete(h.sessions, id)
+		}
+	}
+}
+
+func (h *handoverState) addKey(key string, expires time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pruneLocked(time.Now())
+	if h.keys == nil {
+		h.keys = make(map[string]time.Time)
+	}
+	h.keys[key] = expires
+}
+
+// redeem checks pass, signed with one of the live keys, and uses it up.
+// It returns the user level the pass carries.
+func (h *handoverState) redeem(pass string) (UserLevel, bool) {
+	fields := strings.Split(pass, ".")
+	if len(fields) != 4 {
+		return 0, false
+	}
+	level, ok := parseHandoverLevel(fields[0])
+	if !ok {
+		return 0, false
+	}
+	unix, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	expires := time.Unix(unix, 0)
+	mac, err := hex.DecodeString(fields[3])
+	if err != nil {
+		return 0, false
+	}
+	body := strings.Join(fields[:3], ".")
+
+	now := time.Now()
+	if !expires.After(now) {
+		return 0, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pruneLocked(now)
+	if _, used := h.spent[fields[2]]; used {
+		return 0, false
+	}
+	for key := range h.keys {
+		if hmac.Equal(mac, signHandoverPass(key, body)) {
+			if h.spent == nil {
+				h.spent = make(map[string]time.Time)
+			}
+			h.spent[fields[2]] = expires
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+// startSession signs in a viewer that redeemed a pass for level, and
+// returns the cookie value that keeps it signed in.
+func (h *handoverState) startSession(level UserLevel) (string, time.Time, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(handoverSessionTTL)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sessions == nil {
+		h.sessions = make(map[string]handoverSession)
+	}
+	h.sessions[id] = handoverSession{level: level, expires: expires}
+	return id, expires, nil
+}
+
+// session returns the user level of the viewer signed in as id.
+func (h *handoverState) session(id string) (UserLevel, bool) {
+	if id == "" {
+		return 0, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	session, ok := h.sessions[id]
+	if !ok || !session.expires.After(time.Now()) {
+		return 0, false
+	}
+	return session.level, true
+}
+
+// mintHandoverPass returns a pass for one viewer at level, signed with the
+// key the other mirror's AcceptHandover gave out: level, expiry and a
+// nonce, then their HMAC.
+func mintHandoverPass(key string, level UserLevel) (string, error) {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	body := strconv.Itoa(int(level)) + "." + strconv.FormatInt(time.Now().Add(handoverPassTTL).Unix(), 10) + "." + nonce
+	return body + "." + hex.EncodeToString(signHandoverPass(key, body)), nil
+}
+
+func signHandoverPass(key, body string) []byte {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
+
+func parseHandoverLevel(raw string) (UserLevel, bool) {
+	switch raw {
+	case "0":
+		return UserLevelInteract, true
+	case "1":
+		return UserLevelWatchOnly, true
+	case "2":
+		return UserLevelApproval, true
+	}
+	return 0, false
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// AcceptHandover returns a new key for handoverKeyTTL. Another mirror
+// passes it to MoveViewers, which gives each viewer it sends here a pass
+// signed with it.
+func (s *Server) AcceptHandover() (string, time.Time, error) {
+	key, err := randomHex(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(handoverKeyTTL)
+	s.handover.addKey(key, expires)
+	s.recordEvent(EventAccess, "", "handover key issued, valid until %s", expires.Format(time.RFC3339))
+	return key, expires, nil
+}
+
+// MoveViewers tells every viewer that the session moved to target, an
+// http or https URL. With the key from the other mirror's AcceptHandover,
+// each browser and connect client gets its own pass, good once and only at
+// the user level it has here; they go there on their own. SSH clients are
+// shown the address. The owner and the board stay. It returns how many
+// viewers were told.
+func (s *Server) MoveViewers(target, key string) (int, error) {
+	u, err := url.Parse(strings.TrimSpace(target))
+	if err != nil {
+		return 0, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return 0, errors.New("the URL must start with http:// or https://")
+	}
+	if u.Host == "" {
+		return 0, errors.New("the URL has no host")
+	}
+	u.User = nil
+	target = u.String()
+	key = strings.TrimSpace(key)
+
+	moved := 0
+	for _, c := range s.snapshotClients() {
+		switch {
+		case c.isOwner, c.transport == "board":
+			continue
+		case c.transport == "ssh":
+			s.sendStatus(c, translate(c.lang, "handover.moved", target))
+		default:
+			redirect := protocol.Redirect{URL: target}
+			if key != "" {
+				if redirect.Token, err = mintHandoverPass(key, c.level()); err != nil {
+					return moved, err
+				}
+			}
+			c.trySend(wsMessage{messageType: websocket.TextMessage, data: protocol.Encode(redirect)})
+		}
+		moved++
+	}
+	s.recordEvent(EventStatus, "", "session moved to %s, %d viewer(s) sent there", target, moved)
+	return moved, nil
+}
+
+// handedOver reports whether r comes from a viewer moved here from another
+// mirror, with a pass in the handover query parameter or the cookie set
+// when it redeemed one, and returns r carrying the level it brought.
+func (s *Server) handedOver(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	level, ok := UserLevelInteract, false
+	if pass := r.URL.Query().Get("handover"); pass != "" {
+		if level, ok = s.handover.redeem(pass); ok {
+			id, expires, err := s.handover.startSession(level)
+			if err != nil {
+				return r, false
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     handoverCookie,
+				Value:    id,
+				Path:     "/",
+				Expires:  expires,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			s.recordEvent(EventAccess, extractRemoteIP(r), "viewer moved here from another mirror at user level %d", level)
+		}
+	}
+	// A pass already used, such as on a reload, falls back to the cookie.
+	if !ok {
+		cookie, err := r.Cookie(handoverCookie)
+		if err != nil {
+			return r, false
+		}
+		if level, ok = s.handover.session(cookie.Value); !ok {
+			return r, false
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), handoverLevelKey{}, level)), true
+}
+
+// handleHandoverAccept serves POST /api/handover/accept?token=<owner token>
+// on the mirror the session moves to. It answers {"token": ..., "expires":
+// ...} with the key for the other mirror's /api/handover.
+func (s *Server) handleHandoverAccept(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.ownerTokenMatches(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	key, expires, err := s.AcceptHandover()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(struct {
+		Token   string    `json:"token"`
+		Expires time.Time `json:"expires"`
+	}{key, expires})
+}
+
+// handleHandover serves POST /api/handover?token=<owner token> with a
+// {"url": ..., "token": ...} body: it sends the viewers to the mirror at
+// url, with passes from its handover key, and answers {"viewers": n}.
+func (s *Server) handleHandover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.ownerTokenMatches(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		URL   string `json:"url"`
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHandoverBodyBytes)).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	moved, err := s.MoveViewers(body.URL, body.Token)
+	if err != nil {
+		http.Error(w, "Invalid URL: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(struct {
+		Viewers int `json:"viewers"`
+	}{moved})
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+	"alices-mirror/internal/terminal"
+)
+
+func TestHandoverPass(t *testing.T) {
+	t.Parallel()
+
+	session := terminal.NewScriptedSession(terminal.Config{}, terminal.NewScriptedPTY(nil))
+	t.Cleanup(session.Close)
+	srv, err := New(Config{
+		AllowIPs:  []string{"*"},
+		Session:   session,
+		Auth:      AuthConfig{Enabled: true, User: "alice", Password: "secret"},
+		Listeners: []net.Listener{NewPipeListener()},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	key, _, err := srv.AcceptHandover()
+	if err != nil {
+		t.Fatalf("AcceptHandover: %v", err)
+	}
+	pass, err := mintHandoverPass(key, UserLevelWatchOnly)
+	if err != nil {
+		t.Fatalf("mintHandoverPass: %v", err)
+	}
+	forged, err := mintHandoverPass("not the key", UserLevelInteract)
+	if err != nil {
+		t.Fatalf("mintHandoverPass: %v", err)
+	}
+
+	var user string
+	var level UserLevel
+	handler := srv.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user = srv.requestUser(r)
+		level = srv.requestUserLevel(r)
+	}))
+	get := func(path string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:40000"
+		if prepare != nil {
+			prepare(req)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/?handover="+url.QueryEscape(forged), nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("pass signed with another key: got %d, want 401", rec.Code)
+	}
+	rec := get("/?handover="+url.QueryEscape(pass), func(r *http.Request) { r.SetBasicAuth("alice", "guess") })
+	if rec.Code != http.StatusOK {
+		t.Fatalf("handover pass: got %d, want 200", rec.Code)
+	}
+	if user != "" {
+		t.Errorf("handover viewer got the unchecked user %q", user)
+	}
+	if level != UserLevelWatchOnly {
+		t.Errorf("handover viewer got user level %d, want %d", level, UserLevelWatchOnly)
+	}
+	if rec := get("/?handover="+url.QueryEscape(pass), nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("pass used twice: got %d, want 401", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != handoverCookie || cookies[0].Value == pass {
+		t.Fatalf("handover cookie: got %v", cookies)
+	}
+	level = UserLevelInteract
+	if rec := get("/api/config.json", func(r *http.Request) { r.AddCookie(cookies[0]) }); rec.Code != http.StatusOK {
+		t.Errorf("request with the handover cookie: got %d, want 200", rec.Code)
+	}
+	if level != UserLevelWatchOnly {
+		t.Errorf("request with the handover cookie got user level %d, want %d", level, UserLevelWatchOnly)
+	}
+}
+
+// startHandoverMirror serves a scripted shell through a PipeListener and
+// returns the server, for tests that move viewers between two of them.
+func startHandoverMirror(t *testing.T, userLevels string, auth AuthConfig) (*Server, *PipeListener) {
+	t.Helper()
+	session := terminal.NewScriptedSession(terminal.Config{}, terminal.NewScriptedPTY(nil))
+	t.Cleanup(session.Close)
+	rules, err := ParseUserLevelRules(userLevels)
+	if err != nil {
+		t.Fatalf("ParseUserLevelRules: %v", err)
+	}
+	listener := NewPipeListener()
+	srv, err := New(Config{
+		AllowIPs:   []string{"*"},
+		Session:    session,
+		Auth:       auth,
+		UserLevels: rules,
+		Listeners:  []net.Listener{listener},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = srv.Start(ctx) }()
+	return srv, listener
+}
+
+// readServerMessage reads from conn until a message of type T arrives.
+func readServerMessage[T protocol.Message](t *testing.T, conn *websocket.Conn) T {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		messageType, payload, err := conn.ReadMessage()
+		if err != nil {
+			var zero T
+			t.Fatalf("waiting for %s: %v", zero.MessageType(), err)
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		if msg, err := protocol.DecodeFromServer(payload); err == nil {
+			if want, ok := msg.(T); ok {
+				return want
+			}
+		}
+	}
+}
+
+func TestHandoverKeepsWatchOnly(t *testing.T) {
+	t.Parallel()
+
+	source, sourceListener := startHandoverMirror(t, "*-1", AuthConfig{})
+	target, targetListener := startHandoverMirror(t, "*-0", AuthConfig{Enabled: true, User: "alice", Password: "secret"})
+
+	viewer := dialPipe(t, sourceListener, "10.0.0.5")
+	if hello := readServerMessage[protocol.Hello](t, viewer); hello.UserLevel != int(UserLevelWatchOnly) {
+		t.Fatalf("viewer is at user level %d on the source", hello.UserLevel)
+	}
+	key, _, err := target.AcceptHandover()
+	if err != nil {
+		t.Fatalf("AcceptHandover: %v", err)
+	}
+	if moved, err := source.MoveViewers("http://desktop:3002", key); err != nil || moved != 1 {
+		t.Fatalf("MoveViewers = %d, %v", moved, err)
+	}
+	redirect := readServerMessage[protocol.Redirect](t, viewer)
+	if redirect.URL != "http://desktop:3002" || redirect.Token == "" {
+		t.Fatalf("redirect = %+v", redirect)
+	}
+
+	dial := func() (*websocket.Conn, error) {
+		dialer := websocket.Dialer{
+			Subprotocols: []string{protocol.Subprotocol},
+			NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return targetListener.Dial(ctx, "10.0.0.5")
+			},
+		}
+		conn, _, err := dialer.Dial("ws://mirror/ws?handover="+url.QueryEscape(redirect.Token), nil)
+		return conn, err
+	}
+	moved, err := dial()
+	if err != nil {
+		t.Fatalf("dial the target with the pass: %v", err)
+	}
+	t.Cleanup(func() { _ = moved.Close() })
+	if hello := readServerMessage[protocol.Hello](t, moved); hello.UserLevel != int(UserLevelWatchOnly) {
+		t.Errorf("moved viewer is at user level %d on the target, want %d", hello.UserLevel, UserLevelWatchOnly)
+	}
+	if conn, err := dial(); err == nil {
+		_ = conn.Close()
+		t.Error("the pass let a second connection in")
+	}
+}
+
+func TestStricterLevel(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct{ a, b, want UserLevel }{
+		{UserLevelInteract, UserLevelInteract, UserLevelInteract},
+		{UserLevelInteract, UserLevelApproval, UserLevelApproval},
+		{UserLevelWatchOnly, UserLevelApproval, UserLevelWatchOnly},
+		{UserLevelApproval, UserLevelWatchOnly, UserLevelWatchOnly},
+		{UserLevelWatchOnly, UserLevelInteract, UserLevelWatchOnly},
+	}
+	for _, tc := range cases {
+		if got := stricterLevel(tc.a, tc.b); got != tc.want {
+			t.Errorf("stricterLevel(%d, %d) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestMoveViewersRejectsBadURLs(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{}
+	for _, target := range []string{"", "desktop:3002", "ftp://desktop/", "javascript:alert(1)", "http://"} {
+		if _, err := s.MoveViewers(target, ""); err == nil {
+			t.Errorf("MoveViewers(%q) succeeded", target)
+		}
+	}
+}
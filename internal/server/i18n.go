@@ -0,0 +1,275 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultLanguage = "en"
+
+// catalogs holds the user-facing strings the server generates itself. Keys
+// missing from a language fall back to English.
+var catalogs = map[string]map[string]string{
+	"en": {
+		"reset.failed.title":     "Reset failed",
+		"reset.failed.body":      "The shell could not be fully reset.",
+		"reset.failed.reason":    "Reason: %s",
+		"reset.failed.processes": "The following processes could not be terminated:",
+		"reset.failed.process":   "PID %d - %s",
+		"reset.progress.term":    "Resetting: asked the shell's processes to exit, waiting up to %s.",
+		"reset.progress.kill":    "Resetting: %d process(es) still running, killing them: %s",
+		"reset.progress.sudo":    "Resetting: %d process(es) survived, killing them with sudo: %s",
+		"reset.soft.failed":      "The terminal could not be reset: %s",
+		"reset.denied":           "You may not reset this shell.",
+		"alias.invalid":          "The alias was not changed: %s",
+		"process.unknown":        "unknown",
+		"sharing.paused":         "Sharing is paused",
+		"conns.tooMany":          "Too many connections from your address",
+		"upload.forbidden":       "Forbidden",
+		"upload.noDirectory":     "Shell directory not available",
+		"upload.invalid":         "Invalid multipart upload",
+		"upload.failed":          "Upload failed",
+		"upload.createFailed":    "Failed to create upload file",
+		"upload.noFiles":         "No files received",
+		"alert.newIP":            "New device: %s connected for the first time.",
+		"approval.title":         "Approve input?",
+		"approval.body":          "%s wants to type:\n\n%s",
+		"approval.approve":       "Approve",
+		"approval.deny":          "Deny",
+		"approval.approved":      "Input approved: %s",
+		"approval.denied":        "Input denied: %s",
+		"approval.full":          "Too much input is waiting for approval; this input was dropped.",
+		"command.refused":        "Command refused: %s",
+		"snippet.unknown":        "There is no snippet called %s.",
+		"input.watchOnly":        "You can only watch this session; your input is ignored.",
+		"resize.denied":          "You may not resize this terminal; your window size is ignored.",
+		"paste.title":            "Paste into the shared shell?",
+		"paste.body":             "You are pasting %d line(s), %d bytes:\n\n%s",
+		"paste.confirm":          "Paste",
+		"paste.cancel":           "Cancel",
+		"paste.waiting":          "Your paste is waiting for the host to approve it.",
+		"access.expired":         "Your access has expired; you can now only watch.",
+		"access.changed":         "The host changed your access.",
+		"handover.moved":         "This session moved to %s.",
+	},
+	"es": {
+		"reset.failed.title":     "Error al reiniciar",
+		"reset.failed.body":      "No se pudo reiniciar la shell por completo.",
+		"reset.failed.reason":    "Motivo: %s",
+		"reset.failed.processes": "No se pudieron terminar los siguientes procesos:",
+		"reset.failed.process":   "PID %d - %s",
+		"reset.progress.term":    "Reiniciando: se pidió a los procesos de la shell que terminen, esperando hasta %s.",
+		"reset.progress.kill":    "Reiniciando: %d proceso(s) siguen en ejecución, forzando su cierre: %s",
+		"reset.progress.sudo":    "Reiniciando: %d proceso(s) resistieron, cerrándolos con sudo: %s",
+		"reset.soft.failed":      "No se pudo restablecer el terminal: %s",
+		"reset.denied":           "No puedes reiniciar esta shell.",
+		"alias.invalid":          "No se cambió el alias: %s",
+		"process.unknown":        "desconocido",
+		"sharing.paused":         "La sesión compartida está en pausa",
+		"conns.tooMany":          "Demasiadas conexiones desde tu dirección",
+		"upload.forbidden":       "Prohibido",
+		"upload.noDirectory":     "El directorio de la shell no está disponible",
+		"upload.invalid":         "Subida multipart no válida",
+		"upload.failed":          "Error al subir",
+		"upload.createFailed":    "No se pudo crear el archivo subido",
+		"upload.noFiles":         "No se recibieron archivos",
+		"alert.newIP":            "Nuevo dispositivo: %s se conectó por primera vez.",
+		"approval.title":         "¿Aprobar entrada?",
+		"approval.body":          "%s quiere escribir:\n\n%s",
+		"approval.approve":       "Aprobar",
+		"approval.deny":          "Rechazar",
+		"approval.approved":      "Entrada aprobada: %s",
+		"approval.denied":        "Entrada rechazada: %s",
+		"approval.full":          "Hay demasiada entrada esperando aprobación; esta entrada se descartó.",
+		"command.refused":        "Comando rechazado: %s",
+		"snippet.unknown":        "No hay ningún fragmento llamado %s.",
+		"input.watchOnly":        "Solo puedes ver esta sesión; tu entrada se ignora.",
+		"resize.denied":          "No puedes cambiar el tamaño de esta terminal; se ignora el tamaño de tu ventana.",
+		"paste.title":            "¿Pegar en la terminal compartida?",
+		"paste.body":             "Vas a pegar %d línea(s), %d bytes:\n\n%s",
+		"paste.confirm":          "Pegar",
+		"paste.cancel":           "Cancelar",
+		"paste.waiting":          "Tu pegado espera la aprobación del anfitrión.",
+		"access.expired":         "Tu acceso ha caducado; ahora solo puedes mirar.",
+		"access.changed":         "El anfitrión cambió tu acceso.",
+		"handover.moved":         "Esta sesión se movió a %s.",
+	},
+	"fr": {
+		"reset.failed.title":     "Échec de la réinitialisation",
+		"reset.failed.body":      "Le shell n'a pas pu être entièrement réinitialisé.",
+		"reset.failed.reason":    "Raison : %s",
+		"reset.failed.processes": "Les processus suivants n'ont pas pu être arrêtés :",
+		"reset.failed.process":   "PID %d - %s",
+		"reset.progress.term":    "Réinitialisation : les processus du shell doivent se terminer, attente jusqu'à %s.",
+		"reset.progress.kill":    "Réinitialisation : %d processus encore actifs, arrêt forcé : %s",
+		"reset.progress.sudo":    "Réinitialisation : %d processus ont résisté, arrêt avec sudo : %s",
+		"reset.soft.failed":      "Le terminal n'a pas pu être réinitialisé : %s",
+		"reset.denied":           "Vous ne pouvez pas réinitialiser ce shell.",
+		"alias.invalid":          "L'alias n'a pas été modifié : %s",
+		"process.unknown":        "inconnu",
+		"sharing.paused":         "Le partage est en pause",
+		"conns.tooMany":          "Trop de connexions depuis votre adresse",
+		"upload.forbidden":       "Interdit",
+		"upload.noDirectory":     "Répertoire du shell indisponible",
+		"upload.invalid":         "Envoi multipart invalide",
+		"upload.failed":          "Échec de l'envoi",
+		"upload.createFailed":    "Impossible de créer le fichier envoyé",
+		"upload.noFiles":         "Aucun fichier reçu",
+		"alert.newIP":            "Nouvel appareil : %s s'est connecté pour la première fois.",
+		"approval.title":         "Approuver la saisie ?",
+		"approval.body":          "%s veut taper :\n\n%s",
+		"approval.approve":       "Approuver",
+		"approval.deny":          "Refuser",
+		"approval.approved":      "Saisie approuvée : %s",
+		"approval.denied":        "Saisie refusée : %s",
+		"approval.full":          "Trop de saisies attendent une approbation ; celle-ci a été ignorée.",
+		"command.refused":        "Commande refusée : %s",
+		"snippet.unknown":        "Aucun extrait ne s'appelle %s.",
+		"input.watchOnly":        "Vous pouvez seulement regarder cette session ; votre saisie est ignorée.",
+		"resize.denied":          "Vous ne pouvez pas redimensionner ce terminal ; la taille de votre fenêtre est ignorée.",
+		"paste.title":            "Coller dans le terminal partagé ?",
+		"paste.body":             "Vous collez %d ligne(s), %d octets :\n\n%s",
+		"paste.confirm":          "Coller",
+		"paste.cancel":           "Annuler",
+		"paste.waiting":          "Votre collage attend l'approbation de l'hôte.",
+		"access.expired":         "Votre accès a expiré ; vous pouvez seulement regarder.",
+		"access.changed":         "L'hôte a modifié votre accès.",
+		"handover.moved":         "Cette session a été déplacée vers %s.",
+	},
+	"de": {
+		"reset.failed.title":     "Zurücksetzen fehlgeschlagen",
+		"reset.failed.body":      "Die Shell konnte nicht vollständig zurückgesetzt werden.",
+		"reset.failed.reason":    "Grund: %s",
+		"reset.failed.processes": "Die folgenden Prozesse konnten nicht beendet werden:",
+		"reset.failed.process":   "PID %d - %s",
+		"reset.progress.term":    "Zurücksetzen: Die Prozesse der Shell wurden zum Beenden aufgefordert, Wartezeit bis zu %s.",
+		"reset.progress.kill":    "Zurücksetzen: %d Prozess(e) laufen noch und werden beendet: %s",
+		"reset.progress.sudo":    "Zurücksetzen: %d Prozess(e) haben überlebt und werden mit sudo beendet: %s",
+		"reset.soft.failed":      "Das Terminal konnte nicht zurückgesetzt werden: %s",
+		"reset.denied":           "Du darfst diese Shell nicht zurücksetzen.",
+		"alias.invalid":          "Der Alias wurde nicht geändert: %s",
+		"process.unknown":        "unbekannt",
+		"sharing.paused":         "Freigabe ist pausiert",
+		"conns.tooMany":          "Zu viele Verbindungen von deiner Adresse",
+		"upload.forbidden":       "Verboten",
+		"upload.noDirectory":     "Shell-Verzeichnis nicht verfügbar",
+		"upload.invalid":         "Ungültiger Multipart-Upload",
+		"upload.failed":          "Upload fehlgeschlagen",
+		"upload.createFailed":    "Upload-Datei konnte nicht erstellt werden",
+		"upload.noFiles":         "Keine Dateien empfangen",
+		"alert.newIP":            "Neues Gerät: %s hat sich zum ersten Mal verbunden.",
+		"approval.title":         "Eingabe genehmigen?",
+		"approval.body":          "%s möchte eingeben:\n\n%s",
+		"approval.approve":       "Genehmigen",
+		"approval.deny":          "Ablehnen",
+		"approval.approved":      "Eingabe genehmigt: %s",
+		"approval.denied":        "Eingabe abgelehnt: %s",
+		"approval.full":          "Zu viele Eingaben warten auf Genehmigung; diese Eingabe wurde verworfen.",
+		"command.refused":        "Befehl abgelehnt: %s",
+		"snippet.unknown":        "Es gibt kein Snippet namens %s.",
+		"input.watchOnly":        "Du kannst diese Sitzung nur ansehen; deine Eingaben werden ignoriert.",
+		"resize.denied":          "Du darfst die Größe dieses Terminals nicht ändern; deine Fenstergröße wird ignoriert.",
+		"paste.title":            "In die geteilte Shell einfügen?",
+		"paste.body":             "Du fügst %d Zeile(n), %d Bytes ein:\n\n%s",
+		"paste.confirm":          "Einfügen",
+		"paste.cancel":           "Abbrechen",
+		"paste.waiting":          "Dein Einfügen wartet auf die Genehmigung des Hosts.",
+		"access.expired":         "Dein Zugriff ist abgelaufen; du kannst jetzt nur noch zusehen.",
+		"access.changed":         "Der Host hat deinen Zugriff geändert.",
+		"handover.moved":         "Diese Sitzung ist nach %s umgezogen.",
+	},
+}
+
+// translate returns the catalog entry for key in lang, formatted with args.
+func translate(lang, key string, args ...any) string {
+	text, ok := catalogs[lang][key]
+	if !ok {
+		text, ok = catalogs[defaultLanguage][key]
+	}
+	if !ok {
+		text = key
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// requestLanguage picks the best supported language from Accept-Language.
+func requestLanguage(r *http.Request) string {
+	return negotiateLanguage(r.Header.Get("Accept-Language"))
+}
+
+func negotiateLanguage(header string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if value, ok := strings.CutPrefix(param, "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		base, _, _ := strings.Cut(tag, "-")
+		candidates = append(candidates, candidate{lang: base, q: q})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	for _, c := range candidates {
+		if _, ok := catalogs[c.lang]; ok {
+			return c.lang
+		}
+	}
+	return defaultLanguage
+}
+
+func (s *Server) handleI18n(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/i18n/")
+	lang, ok := strings.CutSuffix(name, ".json")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	lang = strings.ToLower(lang)
+	catalog, ok := catalogs[lang]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	merged := make(map[string]string, len(catalogs[defaultLanguage]))
+	for key, value := range catalogs[defaultLanguage] {
+		merged[key] = value
+	}
+	for key, value := range catalog {
+		merged[key] = value
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(merged)
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// InputLog is an audit trail of terminal input. Every keystroke or paste
+// forwarded to the shell is appended as one JSON object per line naming the
+// client that sent it.
+type InputLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type inputLogEntry struct {
+	Time      string `json:"time"`
+	Remote    string `json:"remote"`
+	Transport string `json:"transport"`
+	Owner     bool   `json:"owner"`
+	Input     string `json:"input"`
+}
+
+// NewInputLog returns an InputLog writing to w.
+func NewInputLog(w io.Writer) *InputLog {
+	return &InputLog{enc: json.NewEncoder(w)}
+}
+
+func (l *InputLog) record(c *client, data []byte) {
+	if l == nil {
+		return
+	}
+	entry := inputLogEntry{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Remote:    c.remoteIP,
+		Transport: c.transport,
+		Owner:     c.isOwner,
+		Input:     string(data),
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(entry); err != nil {
+		logger().Error("input log write failed", "error", err)
+	}
+}
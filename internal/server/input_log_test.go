@@ -0,0 +1,48 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInputLogRecordsClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.log")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := NewInputLog(file)
+	log.record(&client{remoteIP: "192.168.1.7", transport: "websocket"}, []byte("ls\r"))
+	log.record(&client{remoteIP: "127.0.0.1", transport: "ssh", isOwner: true}, []byte("\x03"))
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), data)
+	}
+	var first, second inputLogEntry
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if first.Remote != "192.168.1.7" || first.Input != "ls\r" || first.Owner {
+		t.Fatalf("first entry = %+v", first)
+	}
+	if second.Transport != "ssh" || second.Input != "\x03" || !second.Owner {
+		t.Fatalf("second entry = %+v", second)
+	}
+
+	var nilLog *InputLog
+	nilLog.record(&client{}, []byte("x"))
+}
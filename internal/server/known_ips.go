@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+// KnownIPs is the persisted set of client addresses that have connected
+// before. Loopback addresses are always considered known.
+type KnownIPs struct {
+	path string
+
+	mu  sync.Mutex
+	ips map[string]knownIP
+}
+
+type knownIP struct {
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// LoadKnownIPs reads the set from path. A missing file is an empty set.
+func LoadKnownIPs(path string) (*KnownIPs, error) {
+	k := &KnownIPs{path: path, ips: map[string]knownIP{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored struct {
+		IPs map[string]knownIP `json:"ips"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, err
+	}
+	if stored.IPs != nil {
+		k.ips = stored.IPs
+	}
+	return k, nil
+}
+
+// observe records a connection from ip and reports whether ip had never
+// connected before.
+func (k *KnownIPs) observe(ip string) (bool, error) {
+	if parsed := net.ParseIP(ip); parsed == nil || parsed.IsLoopback() {
+		return false, nil
+	}
+	now := time.Now().UTC()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	entry, seen := k.ips[ip]
+	if !seen {
+		entry.FirstSeen = now
+	}
+	entry.LastSeen = now
+	k.ips[ip] = entry
+	return !seen, k.saveLocked()
+}
+
+// saveLocked writes the set through a temporary file so a crash cannot
+// leave it truncated.
+func (k *KnownIPs) saveLocked() error {
+	data, err := json.MarshalIndent(map[string]any{"ips": k.ips}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.path), 0o700); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, k.path)
+}
+
+// checkNewIP alerts the owner when c comes from an address that has never
+// connected before.
+func (s *Server) checkNewIP(c *client) {
+	if s.knownIPs == nil {
+		return
+	}
+	isNew, err := s.knownIPs.observe(c.remoteIP)
+	if err != nil {
+		logger().Warn("failed to save known client addresses", "error", err)
+	}
+	if !isNew {
+		return
+	}
+	logger().Warn("first connection from a new address", "remote", c.remoteIP, "transport", c.transport)
+	s.recordEvent(EventNewIP, c.remoteIP, "first connection from %s (%s)", c.remoteIP, c.transport)
+	s.notifyAdmins(c, func(lang string) []byte {
+		return protocol.Encode(protocol.Status{Message: translate(lang, "alert.newIP", c.remoteIP)})
+	})
+	if s.onNewIP != nil {
+		go s.onNewIP(c.remoteIP, c.transport)
+	}
+}
+
+// notifyAdmins sends a localized message to the owner and to clients at
+// user level 0, other than except.
+func (s *Server) notifyAdmins(except *client, build func(lang string) []byte) {
+	payloads := make(map[string][]byte)
+	for _, c := range s.snapshotClients() {
+		if c == except || (!c.isOwner && c.level() != UserLevelInteract) {
+			continue
+		}
+		payload, ok := payloads[c.lang]
+		if !ok {
+			payload = build(c.lang)
+			payloads[c.lang] = payload
+		}
+		c.trySend(wsMessage{messageType: websocket.TextMessage, data: payload})
+	}
+}
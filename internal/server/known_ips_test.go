@@ -0,0 +1,35 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestKnownIPsPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "known_ips.json")
+	known, err := LoadKnownIPs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		ip   string
+		want bool
+	}{
+		{"192.168.1.20", true},
+		{"192.168.1.20", false},
+		{"127.0.0.1", false},
+		{"10.0.0.5", true},
+	} {
+		if got, err := known.observe(tc.ip); err != nil || got != tc.want {
+			t.Fatalf("observe(%s) = %v, %v; want %v", tc.ip, got, err, tc.want)
+		}
+	}
+
+	reloaded, err := LoadKnownIPs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isNew, _ := reloaded.observe("10.0.0.5"); isNew {
+		t.Fatal("10.0.0.5 is new after reload")
+	}
+}
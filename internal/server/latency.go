@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+const (
+	pingInterval     = 10 * time.Second
+	pingWriteTimeout = 5 * time.Second
+)
+
+type clientStatus struct {
+	IP        string    `json:"ip,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Owner     bool      `json:"owner"`
+	UserLevel int       `json:"userLevel"`
+	Transport string    `json:"transport"`
+	JoinedAt  time.Time `json:"joinedAt"`
+	RTTMillis *float64  `json:"rttMs"`
+	Dropped   int64     `json:"dropped"`
+	Buffered  int       `json:"bufferedBytes"`
+}
+
+// sendPing writes a ping carrying the send time so the pong can be turned
+// into a round-trip measurement.
+func (c *client) sendPing() error {
+	stamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return c.conn.WriteControl(websocket.PingMessage, []byte(stamp), time.Now().Add(pingWriteTimeout))
+}
+
+func (c *client) handlePong(appData string) error {
+	sent, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil {
+		return nil
+	}
+	rtt := time.Since(time.Unix(0, sent))
+	if rtt < 0 {
+		return nil
+	}
+
+	c.rttMu.Lock()
+	c.rtt = rtt
+	c.rttMu.Unlock()
+
+	payload := protocol.Encode(protocol.Latency{RTTMillis: durationMillis(rtt)})
+	c.trySend(wsMessage{messageType: websocket.TextMessage, data: payload})
+	return nil
+}
+
+// lastRTT returns the last measured round-trip time, or zero before the first
+// pong arrives.
+func (c *client) lastRTT() time.Duration {
+	c.rttMu.Lock()
+	defer c.rttMu.Unlock()
+	return c.rtt
+}
+
+// handleClients serves GET /api/clients. Who is watching from where is for
+// the owner: without the owner token, addresses and user names are left
+// out.
+func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	owner := s.ownerTokenMatches(r)
+	clients := s.snapshotClients()
+	statuses := make([]clientStatus, 0, len(clients))
+	for _, c := range clients {
+		status := clientStatus{
+			IP:        c.remoteIP,
+			User:      c.user,
+			Owner:     c.isOwner,
+			UserLevel: int(c.level()),
+			Transport: c.transport,
+			JoinedAt:  c.joinedAt,
+			Dropped:   c.droppedMessages(),
+			Buffered:  c.bufferedBytes(),
+		}
+		if rtt := c.lastRTT(); rtt > 0 {
+			ms := durationMillis(rtt)
+			status.RTTMillis = &ms
+		}
+		if !owner {
+			status.IP, status.User = "", ""
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].JoinedAt.Before(statuses[j].JoinedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]any{"clients": statuses})
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
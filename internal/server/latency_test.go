@@ -0,0 +1,35 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientsHidesAddressesFromViewers(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{ownerToken: "owner-token"}
+	s.clientList = []*client{{remoteIP: "10.0.0.7", user: "bob", transport: "websocket"}}
+
+	list := func(path string) clientStatus {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.handleClients(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body struct {
+			Clients []clientStatus `json:"clients"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil || len(body.Clients) != 1 {
+			t.Fatalf("GET %s: %v, %d clients", path, err, len(body.Clients))
+		}
+		return body.Clients[0]
+	}
+
+	if got := list("/api/clients"); got.IP != "" || got.User != "" {
+		t.Errorf("viewer sees ip %q and user %q", got.IP, got.User)
+	}
+	if got := list("/api/clients?token=owner-token"); got.IP != "10.0.0.7" || got.User != "bob" {
+		t.Errorf("owner sees ip %q and user %q", got.IP, got.User)
+	}
+}
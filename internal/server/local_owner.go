@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// LocalConn connects the owner's own terminal to the session inside the
+// mirror's process, for sharing without a daemon. It carries the same
+// messages as a WebSocket to /ws-owner: binary messages are terminal data
+// and text messages JSON control messages.
+type LocalConn struct {
+	s *Server
+	c *client
+
+	closeOnce sync.Once
+}
+
+// ConnectOwner attaches the owner's terminal and replays at most
+// snapshotLimit bytes of scrollback to it.
+func (s *Server) ConnectOwner(snapshotLimit int) *LocalConn {
+	s.ownerJoined()
+
+	c := &client{
+		send:      make(chan wsMessage, 128),
+		kick:      make(chan struct{}),
+		isOwner:   true,
+		remoteIP:  "127.0.0.1",
+		lang:      negotiateLanguage(""),
+		transport: "local",
+		joinedAt:  time.Now(),
+
+		snapshotLimit: snapshotLimit,
+	}
+	c.setLevel(UserLevelInteract)
+	s.addClient(c)
+	go s.greetClient(c)
+	return &LocalConn{s: s, c: c}
+}
+
+// ReadMessage returns the next message for the owner's terminal. It fails
+// with io.EOF once the session has ended and its last output was read.
+func (l *LocalConn) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-l.c.send:
+		return l.take(msg)
+	case <-l.c.kick:
+		return 0, nil, io.EOF
+	case <-l.s.session.Done():
+		select {
+		case msg := <-l.c.send:
+			return l.take(msg)
+		default:
+			return 0, nil, io.EOF
+		}
+	}
+}
+
+func (l *LocalConn) take(msg wsMessage) (int, []byte, error) {
+	l.c.written(len(msg.data))
+	data := append([]byte(nil), msg.data...)
+	msg.chunk.Release()
+	l.c.drainBacklog()
+	l.s.resumeIfCaughtUp(l.c)
+	return msg.messageType, data, nil
+}
+
+// WriteMessage handles a message from the owner's terminal.
+func (l *LocalConn) WriteMessage(messageType int, data []byte) error {
+	if l.c.disconnected() {
+		return io.ErrClosedPipe
+	}
+	if messageType != websocket.BinaryMessage && messageType != websocket.TextMessage {
+		return errors.New("unsupported message type")
+	}
+	l.s.handleClientMessage(l.c, messageType, data)
+	return nil
+}
+
+// Close detaches the owner's terminal.
+func (l *LocalConn) Close() error {
+	l.closeOnce.Do(func() {
+		l.c.disconnect()
+		l.s.removeClient(l.c)
+		l.s.ownerMu.Lock()
+		l.s.owners--
+		l.s.ownerMu.Unlock()
+	})
+	return nil
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseByteSize parses a size such as "64M", "512k" or "1048576". Suffixes
+// are binary (k = 1024). Empty means 0.
+func ParseByteSize(raw string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(raw))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "b"), "i")
+	if value == "" {
+		return 0, nil
+	}
+
+	shift := 0
+	switch value[len(value)-1] {
+	case 'k':
+		shift = 10
+	case 'm':
+		shift = 20
+	case 'g':
+		shift = 30
+	}
+	if shift > 0 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected bytes or a k, m or g suffix)", raw)
+	}
+	if n > (1<<62)>>shift {
+		return 0, errors.New("size is too large")
+	}
+	return n << shift, nil
+}
+
+// queued records that n bytes were put on c.send.
+func (c *client) queued(n int) {
+	c.flowMu.Lock()
+	c.flow.queuedBytes += n
+	c.flowMu.Unlock()
+}
+
+// written records that a writer took n bytes off c.send.
+func (c *client) written(n int) {
+	c.flowMu.Lock()
+	c.flow.queuedBytes -= n
+	c.flowMu.Unlock()
+}
+
+// bufferedBytes returns how much output the server is holding for c, both in
+// its send queue and in the flow-control and slow-client backlogs.
+func (c *client) bufferedBytes() int {
+	c.flowMu.Lock()
+	defer c.flowMu.Unlock()
+	return max(c.flow.queuedBytes, 0) + c.flow.pendingBytes + c.flow.earlyBytes + len(c.flow.overflow)
+}
+
+// shed disconnects c and releases its backlog right away rather than when the
+// client is finally removed.
+func (c *client) shed() {
+	c.disconnect()
+	c.flowMu.Lock()
+	for _, chunk := range c.flow.pending[c.flow.pendingHead:] {
+		chunk.Release()
+	}
+	for _, chunk := range c.flow.early {
+		chunk.Release()
+	}
+	c.flow.pending = nil
+	c.flow.pendingHead = 0
+	c.flow.pendingBytes = 0
+	c.flow.early = nil
+	c.flow.earlyBytes = 0
+	c.flow.overflow = nil
+	c.flowMu.Unlock()
+}
+
+func (c *client) disconnected() bool {
+	select {
+	case <-c.kick:
+		return true
+	default:
+		return false
+	}
+}
+
+// enforceMemoryCap disconnects the clients with the most buffered output
+// until the total across all clients fits in maxBufferedBytes. The owner is
+// never shed.
+func (s *Server) enforceMemoryCap() {
+	if s.maxBufferedBytes <= 0 {
+		return
+	}
+
+	type usage struct {
+		c     *client
+		bytes int
+	}
+	var total int64
+	var candidates []usage
+	for _, c := range s.snapshotClients() {
+		n := c.bufferedBytes()
+		total += int64(n)
+		if !c.isOwner && n > 0 {
+			candidates = append(candidates, usage{c: c, bytes: n})
+		}
+	}
+	if total <= s.maxBufferedBytes {
+		return
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].bytes > candidates[j].bytes
+	})
+	for _, u := range candidates {
+		if total <= s.maxBufferedBytes {
+			break
+		}
+		if u.c.disconnected() {
+			continue
+		}
+		logger().Warn("disconnecting slow client", "remote", u.c.remoteIP, "buffered", u.bytes, "cap", s.maxBufferedBytes)
+		s.recordEvent(EventError, u.c.remoteIP, "slow client disconnected: %d bytes buffered (cap %d)", u.bytes, s.maxBufferedBytes)
+		u.c.shed()
+		total -= int64(u.bytes)
+	}
+}
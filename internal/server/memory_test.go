@@ -0,0 +1,33 @@
+package server
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in   string
+		want int64
+	}{
+		{in: "", want: 0},
+		{in: "4096", want: 4096},
+		{in: "512k", want: 512 << 10},
+		{in: "64M", want: 64 << 20},
+		{in: "64MiB", want: 64 << 20},
+		{in: " 1kb ", want: 1 << 10},
+		{in: "2g", want: 2 << 30},
+	}
+
+	for _, tc := range cases {
+		got, err := ParseByteSize(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d", tc.in, got, err, tc.want)
+		}
+	}
+
+	for _, in := range []string{"-1", "12x", "m", "1.5m"} {
+		if _, err := ParseByteSize(in); err == nil {
+			t.Errorf("ParseByteSize(%q) succeeded, want error", in)
+		}
+	}
+}
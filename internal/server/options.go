@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"time"
+)
+
+// Option extends a Server beyond its Config with code of the caller's, for
+// custom auth, logging or filtering without changing this package.
+type Option func(*hooks)
+
+// ClientInfo describes a connected client to hooks and interceptors.
+type ClientInfo struct {
+	RemoteIP  string
+	User      string
+	Transport string
+	Owner     bool
+	UserLevel UserLevel
+	JoinedAt  time.Time
+}
+
+type hooks struct {
+	middleware   []func(http.Handler) http.Handler
+	onConnect    []func(ClientInfo)
+	onDisconnect []func(ClientInfo)
+	input        []func(ClientInfo, []byte) []byte
+	output       []func([]byte)
+}
+
+// WithMiddleware wraps every HTTP request, WebSocket upgrades included. It
+// runs before the server's own Basic Auth and allow-ip checks, so it can
+// refuse requests those would let through. Middleware given first is
+// outermost.
+func WithMiddleware(middleware func(http.Handler) http.Handler) Option {
+	return func(h *hooks) { h.middleware = append(h.middleware, middleware) }
+}
+
+// WithConnectHook calls hook when a client joins the session, over any
+// transport.
+func WithConnectHook(hook func(ClientInfo)) Option {
+	return func(h *hooks) { h.onConnect = append(h.onConnect, hook) }
+}
+
+// WithDisconnectHook calls hook when a client leaves the session.
+func WithDisconnectHook(hook func(ClientInfo)) Option {
+	return func(h *hooks) { h.onDisconnect = append(h.onDisconnect, hook) }
+}
+
+// WithInputInterceptor passes terminal input from every client through
+// intercept before the server's own checks. What it returns is used
+// instead; returning nothing drops the input.
+func WithInputInterceptor(intercept func(client ClientInfo, input []byte) []byte) Option {
+	return func(h *hooks) { h.input = append(h.input, intercept) }
+}
+
+// WithOutputObserver shows observe each piece of shell output before it is
+// sent to clients. It must not keep or change output: offsets into the
+// stream line live output up with the scrollback, so output is changed in
+// the terminal session instead.
+func WithOutputObserver(observe func(output []byte)) Option {
+	return func(h *hooks) { h.output = append(h.output, observe) }
+}
+
+func (c *client) info() ClientInfo {
+	return ClientInfo{
+		RemoteIP:  c.remoteIP,
+		User:      c.user,
+		Transport: c.transport,
+		Owner:     c.isOwner,
+		UserLevel: c.level(),
+		JoinedAt:  c.joinedAt,
+	}
+}
+
+// wrapHandler applies the middleware to handler.
+func (h *hooks) wrapHandler(handler http.Handler) http.Handler {
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		handler = h.middleware[i](handler)
+	}
+	return handler
+}
+
+// interceptInput runs the input interceptors and returns what is left.
+func (h *hooks) interceptInput(c *client, input []byte) []byte {
+	if len(h.input) == 0 {
+		return input
+	}
+	info := c.info()
+	for _, intercept := range h.input {
+		input = intercept(info, input)
+		if len(input) == 0 {
+			return nil
+		}
+	}
+	return input
+}
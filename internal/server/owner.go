@@ -0,0 +1,85 @@
+package server
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+// ownerReconnectGrace is how long the session outlives the owner's
+// connection, so the share client can reconnect after a network blip.
+const ownerReconnectGrace = 30 * time.Second
+
+// ownerJoined counts a new owner connection. Several may be connected at
+// once, for example from the host's laptop and desktop.
+func (s *Server) ownerJoined() {
+	s.ownerMu.Lock()
+	s.owners++
+	s.ownerMu.Unlock()
+}
+
+// ownerLeft shuts the server down when the last owner connection is gone
+// and no owner connects again within ownerReconnectGrace. An owner that
+// detached is waited for as long as the shell runs.
+func (s *Server) ownerLeft(detached bool) {
+	s.ownerMu.Lock()
+	s.owners--
+	remaining := s.owners
+	s.ownerSeq++
+	seq := s.ownerSeq
+	s.ownerMu.Unlock()
+
+	if remaining > 0 {
+		return
+	}
+
+	if detached {
+		s.recordEvent(EventDisconnect, "", "owner detached, session keeps running")
+		return
+	}
+	logger().Info("owner disconnected, waiting for it to reconnect", "grace", ownerReconnectGrace)
+	time.AfterFunc(ownerReconnectGrace, func() {
+		s.ownerMu.Lock()
+		gone := s.owners == 0 && s.ownerSeq == seq
+		s.ownerMu.Unlock()
+		if gone {
+			s.requestShutdown()
+		}
+	})
+}
+
+// sayGoodbye closes every WebSocket client with code: going away tells the
+// share client the session is over and not to reconnect.
+func (s *Server) sayGoodbye(code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	deadline := time.Now().Add(time.Second)
+	for _, c := range s.snapshotClients() {
+		if c.conn != nil {
+			_ = c.conn.WriteControl(websocket.CloseMessage, message, deadline)
+		}
+	}
+}
+
+// viewersPayload encodes how many clients other than the owner are
+// connected.
+func (s *Server) viewersPayload() []byte {
+	viewers := 0
+	for _, c := range s.snapshotClients() {
+		if !c.isOwner {
+			viewers++
+		}
+	}
+	return protocol.Encode(protocol.Viewers{Count: viewers})
+}
+
+// announceViewers tells the owner how many viewers are watching now.
+func (s *Server) announceViewers() {
+	msg := wsMessage{messageType: websocket.TextMessage, data: s.viewersPayload()}
+	for _, c := range s.snapshotClients() {
+		if c.isOwner {
+			c.trySend(msg)
+		}
+	}
+}
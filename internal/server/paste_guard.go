@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+// PastePolicy controls how large pastes from clients other than the owner
+// are confirmed before they reach the shell.
+type PastePolicy string
+
+const (
+	// PasteClient asks the client that pasted to confirm.
+	PasteClient PastePolicy = "client"
+	// PasteOwner asks the owner and level 0 clients, as for level 2 input.
+	PasteOwner PastePolicy = "owner"
+	PasteOff   PastePolicy = "off"
+)
+
+// largePasteBytes is the size from which input counts as a large paste
+// even on a single line.
+const largePasteBytes = 1 << 10
+
+var (
+	bracketedPasteStart = []byte("\x1b[200~")
+	bracketedPasteEnd   = []byte("\x1b[201~")
+)
+
+// ParsePastePolicy validates a --paste-confirm value. Empty means client.
+func ParsePastePolicy(raw string) (PastePolicy, error) {
+	switch policy := PastePolicy(strings.ToLower(strings.TrimSpace(raw))); policy {
+	case "":
+		return PasteClient, nil
+	case PasteClient, PasteOwner, PasteOff:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid paste policy %q (expected client, owner or off)", raw)
+	}
+}
+
+// isLargePaste reports whether input arrived as a burst that would run
+// more than one line, or is large enough to be a paste anyway. A single
+// line followed by Enter is not.
+func isLargePaste(data []byte) bool {
+	if len(data) >= largePasteBytes {
+		return true
+	}
+	return bytes.ContainsAny(bytes.TrimRight(data, "\r\n"), "\r\n")
+}
+
+// pasteLines counts the lines of text, whichever line ends it uses.
+func pasteLines(text []byte) int {
+	text = bytes.ReplaceAll(bytes.TrimRight(text, "\r\n"), []byte("\r\n"), []byte("\n"))
+	return bytes.Count(text, []byte("\n")) + bytes.Count(text, []byte("\r")) + 1
+}
+
+// pendingPaste is a large paste waiting for its client to confirm it. A
+// client has at most one; a new paste replaces it.
+type pendingPaste struct {
+	mu   sync.Mutex
+	id   int64
+	data []byte
+}
+
+// guardPaste holds a large paste from c until it is confirmed. Clients that
+// cannot answer a dialog, such as SSH sessions, always go through the owner.
+func (s *Server) guardPaste(c *client, data []byte) {
+	if s.pastePolicy == PasteOwner || c.transport == "ssh" {
+		s.requestApproval(c, data, true)
+		s.sendStatus(c, translate(c.lang, "paste.waiting"))
+		return
+	}
+
+	c.paste.mu.Lock()
+	c.paste.id = s.pasteIDs.Add(1)
+	c.paste.data = append([]byte(nil), data...)
+	id := c.paste.id
+	c.paste.mu.Unlock()
+
+	text := bytes.TrimSuffix(bytes.TrimPrefix(data, bracketedPasteStart), bracketedPasteEnd)
+	lines := pasteLines(text)
+	payload := protocol.Encode(protocol.PasteConfirm{
+		ID:      id,
+		Bytes:   len(text),
+		Lines:   lines,
+		Title:   translate(c.lang, "paste.title"),
+		Message: translate(c.lang, "paste.body", lines, len(text), displayInput(text[:min(len(text), 200)])),
+		Confirm: translate(c.lang, "paste.confirm"),
+		Cancel:  translate(c.lang, "paste.cancel"),
+	})
+	c.trySend(wsMessage{messageType: websocket.TextMessage, data: payload})
+}
+
+// resolvePaste writes the paste c confirmed, or forgets the one it refused.
+func (s *Server) resolvePaste(c *client, id int64, confirm bool) {
+	c.paste.mu.Lock()
+	if c.paste.id != id || c.paste.data == nil {
+		c.paste.mu.Unlock()
+		return
+	}
+	data := c.paste.data
+	c.paste.data = nil
+	c.paste.mu.Unlock()
+
+	if !confirm {
+		s.recordEvent(EventRefused, c.remoteIP, "paste of %d bytes cancelled", len(data))
+		return
+	}
+	s.writePaste(c, data)
+}
+
+// writePaste writes a confirmed paste to the shell, wrapped in bracketed
+// paste markers when the program in the shell asked for them, so the lines
+// are inserted rather than run one by one.
+func (s *Server) writePaste(c *client, data []byte) {
+	if s.session.BracketedPaste() && !bytes.HasPrefix(data, bracketedPasteStart) {
+		data = bytes.Join([][]byte{bracketedPasteStart, data, bracketedPasteEnd}, nil)
+	}
+	s.inputLog.record(c, data)
+	_ = s.session.WriteInput(data)
+}
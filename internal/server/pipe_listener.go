@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// PipeListener is a net.Listener whose connections are in-memory pipes
+// opened with Dial, so a server given it in Config.Listeners can be driven
+// without opening a port.
+type PipeListener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPipeListener returns a listener with no connections yet.
+func NewPipeListener() *PipeListener {
+	return &PipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+// Dial connects to the listener as a client at remoteIP, which is the
+// address allow-ip and user-level rules see.
+func (l *PipeListener) Dial(ctx context.Context, remoteIP string) (net.Conn, error) {
+	client, server := net.Pipe()
+	conn := &pipeConn{Conn: server, remote: &net.TCPAddr{IP: net.ParseIP(remoteIP), Port: 40000}}
+	select {
+	case l.conns <- conn:
+		return client, nil
+	case <-l.done:
+	case <-ctx.Done():
+		_ = client.Close()
+		_ = server.Close()
+		return nil, ctx.Err()
+	}
+	_ = client.Close()
+	_ = server.Close()
+	return nil, net.ErrClosed
+}
+
+// DialContext connects from 127.0.0.1. It fits http.Transport.DialContext
+// and websocket.Dialer.NetDialContext; network and addr are ignored.
+func (l *PipeListener) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return l.Dial(ctx, "127.0.0.1")
+}
+
+func (l *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *PipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *PipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// pipeConn is the server's end of a pipe, reporting the client address
+// given to Dial.
+type pipeConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+	"alices-mirror/internal/terminal"
+)
+
+// startPipeServer serves a scripted shell that echoes its input through a
+// PipeListener.
+func startPipeServer(t *testing.T, userLevels string, opts ...Option) (*PipeListener, *terminal.ScriptedPTY) {
+	t.Helper()
+	pty := terminal.NewScriptedPTY(func(input []byte) []byte { return input })
+	session := terminal.NewScriptedSession(terminal.Config{}, pty)
+	t.Cleanup(session.Close)
+
+	rules, err := ParseUserLevelRules(userLevels)
+	if err != nil {
+		t.Fatalf("ParseUserLevelRules: %v", err)
+	}
+	listener := NewPipeListener()
+	srv, err := New(Config{
+		AllowIPs:   []string{"*"},
+		Session:    session,
+		UserLevels: rules,
+		Listeners:  []net.Listener{listener},
+	}, opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = srv.Start(ctx) }()
+	return listener, pty
+}
+
+func dialPipe(t *testing.T, listener *PipeListener, remoteIP string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{
+		Subprotocols: []string{protocol.Subprotocol},
+		NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return listener.Dial(ctx, remoteIP)
+		},
+	}
+	conn, _, err := dialer.Dial("ws://mirror/ws", nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// readOutputUntil reads terminal output from conn until it contains want.
+func readOutputUntil(t *testing.T, conn *websocket.Conn, want string) {
+	t.Helper()
+	var output []byte
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for !bytes.Contains(output, []byte(want)) {
+		messageType, payload, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %q, got %q: %v", want, output, err)
+		}
+		if messageType == websocket.BinaryMessage {
+			output = append(output, payload...)
+		}
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPipelineSnapshotAndBroadcast(t *testing.T) {
+	t.Parallel()
+
+	listener, pty := startPipeServer(t, "*-0")
+	pty.Emit([]byte("welcome\r\n"))
+
+	first := dialPipe(t, listener, "10.0.0.1")
+	readOutputUntil(t, first, "welcome")
+	second := dialPipe(t, listener, "10.0.0.2")
+	readOutputUntil(t, second, "welcome")
+
+	if err := first.WriteMessage(websocket.BinaryMessage, []byte("ls\r")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	readOutputUntil(t, first, "ls")
+	readOutputUntil(t, second, "ls")
+
+	if err := second.WriteMessage(websocket.TextMessage, []byte(`{"type":"resize","cols":100,"rows":30}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	waitFor(t, "resize", func() bool {
+		cols, rows := pty.Size()
+		return cols == 100 && rows == 30
+	})
+}
+
+func TestPipelineWatchOnlyInputDropped(t *testing.T) {
+	t.Parallel()
+
+	listener, pty := startPipeServer(t, "10.0.0.9-1,*-0")
+	watcher := dialPipe(t, listener, "10.0.0.9")
+	typist := dialPipe(t, listener, "10.0.0.1")
+
+	if err := watcher.WriteMessage(websocket.BinaryMessage, []byte("rm x\r")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := typist.WriteMessage(websocket.BinaryMessage, []byte("pwd\r")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	readOutputUntil(t, watcher, "pwd")
+	if input := string(pty.Input()); strings.Contains(input, "rm") {
+		t.Errorf("watch-only input reached the shell: %q", input)
+	}
+}
+
+func TestPipelineReset(t *testing.T) {
+	t.Parallel()
+
+	listener, pty := startPipeServer(t, "*-0")
+	conn := dialPipe(t, listener, "10.0.0.1")
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"reset"}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	waitFor(t, "reset", func() bool { return pty.Resets() == 1 })
+
+	// The next shell's output still reaches the client.
+	pty.Emit([]byte("again\r\n"))
+	readOutputUntil(t, conn, "again")
+}
+
+func TestPipelineBell(t *testing.T) {
+	t.Parallel()
+
+	listener, pty := startPipeServer(t, "*-0")
+	conn := dialPipe(t, listener, "10.0.0.1")
+	pty.Emit([]byte("done\a"))
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		messageType, payload, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for the bell: %v", err)
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		if msg, err := protocol.DecodeFromServer(payload); err == nil && msg == (protocol.Bell{}) {
+			return
+		}
+	}
+}
+
+func TestPipelineActivityOnConnect(t *testing.T) {
+	t.Parallel()
+
+	listener, pty := startPipeServer(t, "*-0")
+	first := dialPipe(t, listener, "10.0.0.1")
+	pty.Emit([]byte("working\r\n"))
+	readOutputUntil(t, first, "working")
+
+	conn := dialPipe(t, listener, "10.0.0.2")
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		messageType, payload, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for the activity message: %v", err)
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		msg, err := protocol.DecodeFromServer(payload)
+		if err != nil {
+			continue
+		}
+		if activity, ok := msg.(protocol.Activity); ok {
+			if activity.LastOutput == nil {
+				t.Error("activity without the last output time")
+			}
+			if activity.LastInput != nil {
+				t.Errorf("activity with a last input time, but nothing was typed: %v", activity.LastInput)
+			}
+			return
+		}
+	}
+}
+
+func TestPipelineHooks(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var joined, left []string
+	listener, pty := startPipeServer(t, "*-0",
+		WithMiddleware(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Team") != "blue" {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		}),
+		WithConnectHook(func(c ClientInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			joined = append(joined, c.RemoteIP)
+		}),
+		WithDisconnectHook(func(c ClientInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			left = append(left, c.RemoteIP)
+		}),
+		WithInputInterceptor(func(c ClientInfo, input []byte) []byte {
+			return bytes.ToUpper(input)
+		}),
+	)
+
+	dialer := websocket.Dialer{
+		Subprotocols:   []string{protocol.Subprotocol},
+		NetDialContext: listener.DialContext,
+	}
+	if _, resp, err := dialer.Dial("ws://mirror/ws", nil); err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("dial without header: got %v, %v", resp, err)
+	}
+	conn, _, err := dialer.Dial("ws://mirror/ws", http.Header{"X-Team": {"blue"}})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("ls\r")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	readOutputUntil(t, conn, "LS")
+	if input := string(pty.Input()); input != "LS\r" {
+		t.Errorf("input = %q, want LS\\r", input)
+	}
+	_ = conn.Close()
+
+	waitFor(t, "disconnect hook", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(left) == 1
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if len(joined) != 1 || joined[0] != "127.0.0.1" || left[0] != "127.0.0.1" {
+		t.Errorf("hooks saw joined %v, left %v", joined, left)
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+const pprofCookieName = "alices_mirror_pprof"
+
+// pprofHandler serves the net/http/pprof endpoints under /debug/pprof/ to
+// requests that carry the profiling token, which is not the owner token. It
+// may be given once as a query parameter; it is then kept in a cookie so the
+// links on the index page keep working.
+func (s *Server) pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tokenMatches(strings.TrimSpace(r.URL.Query().Get("token")), s.pprofToken) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     pprofCookieName,
+				Value:    s.pprofToken,
+				Path:     "/debug/pprof/",
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			})
+		} else if cookie, err := r.Cookie(pprofCookieName); err != nil || !tokenMatches(cookie.Value, s.pprofToken) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPprofNeedsToken(t *testing.T) {
+	t.Parallel()
+
+	s := &Server{pprofToken: "debug-token"}
+	handler := s.pprofHandler()
+	get := func(target string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, target := range []string{"/debug/pprof/", "/debug/pprof/?token=", "/debug/pprof/?token=debug-toke", "/debug/pprof/?token=debug-token2"} {
+		if rec := get(target, nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s: got %d, want 401", target, rec.Code)
+		}
+	}
+	if rec := get("/debug/pprof/", &http.Cookie{Name: pprofCookieName, Value: "guess"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong cookie: got %d, want 401", rec.Code)
+	}
+
+	rec := get("/debug/pprof/?token=debug-token", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("with the token: got %d, want 200", rec.Code)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != pprofCookieName {
+		t.Fatalf("cookies = %v", cookies)
+	}
+	if rec := get("/debug/pprof/", cookies[0]); rec.Code != http.StatusOK {
+		t.Errorf("with the cookie: got %d, want 200", rec.Code)
+	}
+}
+
+func TestTokenMatches(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		given, want string
+		match       bool
+	}{
+		{"secret", "secret", true},
+		{"secreT", "secret", false},
+		{"secre", "secret", false},
+		{"secrets", "secret", false},
+		{"", "secret", false},
+		{"", "", false},
+	}
+	for _, tc := range cases {
+		if got := tokenMatches(tc.given, tc.want); got != tc.match {
+			t.Errorf("tokenMatches(%q, %q) = %v, want %v", tc.given, tc.want, got, tc.match)
+		}
+	}
+}
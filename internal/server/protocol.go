@@ -0,0 +1,27 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/protocol"
+)
+
+// checkSubprotocol rejects clients that only offer protocol versions this
+// server does not speak. Clients that offer no subprotocol at all predate
+// negotiation and are treated as version 1.
+func checkSubprotocol(w http.ResponseWriter, r *http.Request) bool {
+	offered := websocket.Subprotocols(r)
+	if len(offered) == 0 {
+		return true
+	}
+	for _, proto := range offered {
+		if proto == protocol.Subprotocol {
+			return true
+		}
+	}
+	http.Error(w, fmt.Sprintf("Unsupported protocol version (server speaks %s)", protocol.Subprotocol), http.StatusUpgradeRequired)
+	return false
+}
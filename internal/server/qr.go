@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"alices-mirror/internal/qr"
+)
+
+func (s *Server) handleQR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code, err := qr.Encode(s.bestEndpointURL(r))
+	if err != nil {
+		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if strings.HasSuffix(r.URL.Path, ".svg") {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		_, _ = w.Write([]byte(code.SVG(4)))
+		return
+	}
+
+	data, err := code.PNG(8, 4)
+	if err != nil {
+		http.Error(w, "Failed to generate QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	_, _ = w.Write(data)
+}
+
+// bestEndpointURL picks the URL a device on the LAN should open: the first
+// non-loopback bound address, falling back to the host the request used.
+// The Basic Auth user and password are only embedded with QRCredentials and
+// for the owner: anyone else who may fetch the image, a watch-only account
+// or a viewer moved here without a password, must not learn them from it.
+func (s *Server) bestEndpointURL(r *http.Request) string {
+	hostPort := ""
+	for _, addr := range s.addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			continue
+		}
+		candidates := []string{host}
+		if host == "0.0.0.0" || host == "" {
+			candidates = LocalIPv4s()
+		}
+		for _, candidate := range candidates {
+			if ip := net.ParseIP(candidate); ip != nil && ip.IsLoopback() {
+				continue
+			}
+			if strings.EqualFold(candidate, "localhost") {
+				continue
+			}
+			hostPort = net.JoinHostPort(candidate, port)
+			break
+		}
+		if hostPort != "" {
+			break
+		}
+	}
+	if hostPort == "" && r != nil {
+		hostPort = r.Host
+	}
+	if hostPort == "" && len(s.addrs) > 0 {
+		hostPort = s.addrs[0]
+	}
+
+	u := url.URL{Scheme: "http", Host: hostPort, Path: "/"}
+	if r != nil && r.TLS != nil {
+		u.Scheme = "https"
+	}
+	if s.auth.Enabled && s.qrCredentials && r != nil && s.ownerTokenMatches(r) {
+		u.User = url.UserPassword(s.auth.User, s.auth.Password)
+	}
+	return u.String()
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResetPolicy controls who may reset the shell, which ends every process
+// running in it.
+type ResetPolicy string
+
+const (
+	ResetOwner    ResetPolicy = "owner"
+	ResetInteract ResetPolicy = "interact"
+	ResetAny      ResetPolicy = "any"
+)
+
+// ParseResetPolicy validates a --reset-policy value. Empty means interact.
+func ParseResetPolicy(raw string) (ResetPolicy, error) {
+	switch policy := ResetPolicy(strings.ToLower(strings.TrimSpace(raw))); policy {
+	case "":
+		return ResetInteract, nil
+	case ResetOwner, ResetInteract, ResetAny:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid reset policy %q (expected owner, interact or any)", raw)
+	}
+}
+
+// resetAllowed reports whether c may send reset and reset-soft. The owner
+// always may; with the interact policy level-0 clients may too, and with
+// any every client but the board may.
+func (s *Server) resetAllowed(c *client) bool {
+	switch {
+	case c.transport == "board":
+		return false
+	case c.isOwner, s.resetPolicy == ResetAny:
+		return true
+	case s.resetPolicy == ResetInteract:
+		return c.level() == UserLevelInteract
+	default:
+		return false
+	}
+}
+
+// denyReset tells c that its reset was refused.
+func (s *Server) denyReset(c *client) {
+	s.recordEvent(EventRefused, c.remoteIP, "reset refused for %s client at user level %d", c.transport, c.level())
+	s.sendStatus(c, translate(c.lang, "reset.denied"))
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResizePolicy controls who may resize the shared terminal.
+type ResizePolicy string
+
+const (
+	ResizeInteract ResizePolicy = "interact"
+	ResizeOwner    ResizePolicy = "owner"
+)
+
+// ParseResizePolicy validates a --resize value. Empty means interact.
+func ParseResizePolicy(raw string) (ResizePolicy, error) {
+	switch policy := ResizePolicy(strings.ToLower(strings.TrimSpace(raw))); policy {
+	case "":
+		return ResizeInteract, nil
+	case ResizeInteract, ResizeOwner:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid resize policy %q (expected interact or owner)", raw)
+	}
+}
+
+// resizeAllowed reports whether c may resize the terminal. The owner always
+// may; with the interact policy level-0 clients may too.
+func (s *Server) resizeAllowed(c *client) bool {
+	if c.isOwner {
+		return true
+	}
+	return s.resizePolicy == ResizeInteract && c.level() == UserLevelInteract
+}
+
+// denyResize tells c, once, that its resize requests are ignored.
+func (s *Server) denyResize(c *client) {
+	if c.resizeDenied.Swap(true) {
+		return
+	}
+	s.recordEvent(EventRefused, c.remoteIP, "resize refused for %s client at user level %d", c.transport, c.level())
+	s.sendStatus(c, translate(c.lang, "resize.denied"))
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"alices-mirror/internal/transcript"
+)
+
+const (
+	defaultSearchLimit = 200
+	maxSearchLimit     = 2000
+	maxSearchQueryLen  = 512
+)
+
+type searchMatch struct {
+	Line  int    `json:"line"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+}
+
+type searchResponse struct {
+	Query     string        `json:"query"`
+	Regex     bool          `json:"regex"`
+	Lines     int           `json:"lines"`
+	Matches   []searchMatch `json:"matches"`
+	Truncated bool          `json:"truncated"`
+}
+
+// handleSearch scans the retained scrollback for q, either as a literal
+// case-insensitive string or, with regex=1, as a Go regular expression.
+// Line numbers count from the oldest retained line; start and end are
+// character offsets within the line.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.historyAllowed(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	q := query.Get("q")
+	if q == "" {
+		http.Error(w, "Missing q parameter", http.StatusBadRequest)
+		return
+	}
+	if len(q) > maxSearchQueryLen {
+		http.Error(w, "Query too long", http.StatusBadRequest)
+		return
+	}
+	useRegex := query.Get("regex") == "1"
+	limit := defaultSearchLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxSearchLimit)
+	}
+
+	pattern := "(?i)" + regexp.QuoteMeta(q)
+	if useRegex {
+		pattern = q
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		http.Error(w, "Invalid regular expression: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lines := transcript.Lines(s.session.Snapshot())
+	resp := searchResponse{
+		Query:   q,
+		Regex:   useRegex,
+		Lines:   len(lines),
+		Matches: []searchMatch{},
+	}
+	for i, line := range lines {
+		for _, loc := range re.FindAllStringIndex(line, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			if len(resp.Matches) >= limit {
+				resp.Truncated = true
+				break
+			}
+			resp.Matches = append(resp.Matches, searchMatch{
+				Line:  i,
+				Start: utf8.RuneCountInString(line[:loc[0]]),
+				End:   utf8.RuneCountInString(line[:loc[1]]),
+				Text:  strings.TrimRight(line, " "),
+			})
+		}
+		if resp.Truncated {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
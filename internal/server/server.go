@@ -1,23 +1,31 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
 	"embed"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"html"
 	"io/fs"
+	"log/slog"
+	"math"
 	"net"
 	"net/http"
 	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/ssh"
 
+	"alices-mirror/internal/datagram"
+	"alices-mirror/internal/logging"
+	"alices-mirror/internal/protocol"
+	"alices-mirror/internal/telemetry"
 	"alices-mirror/internal/terminal"
 )
 
@@ -25,6 +33,10 @@ type AuthConfig struct {
 	Enabled  bool
 	User     string
 	Password string
+
+	// Accounts are more users that may log in, mapped to their password
+	// or its bcrypt hash. They are only checked when Enabled is set.
+	Accounts map[string]string
 }
 
 type Config struct {
@@ -35,51 +47,329 @@ type Config struct {
 	Alias      string
 	OwnerToken string
 	UserLevels []UserLevelRule
+	Version    string
+
+	// AllowIPDNS also matches AllowIPs against the host names that clients'
+	// addresses resolve to.
+	AllowIPDNS bool
+
+	// Accent and MOTD complete the branding started by Alias: the web
+	// client's accent color (#rgb or #rrggbb) and a message shown to
+	// clients when they connect.
+	Accent string
+	MOTD   string
+
+	// AccessRules, when set, holds the allow-ip and user-level rules added
+	// through /api/rules, which are tried before AllowIPs and UserLevels.
+	AccessRules *AccessRules
+
+	// CommandFilter, when set, checks each line typed by clients other than
+	// the owner and keeps refused lines from reaching the shell.
+	CommandFilter *CommandFilter
+
+	// SlowClientPolicy selects what happens to output for clients whose
+	// send queue is full. Empty means drop.
+	SlowClientPolicy SlowClientPolicy
+
+	// ClipboardPolicy selects who may use /api/clipboard. Empty means owner.
+	ClipboardPolicy ClipboardPolicy
+
+	// ResizePolicy selects who may resize the terminal. Empty means
+	// interact.
+	ResizePolicy ResizePolicy
+
+	// ResetPolicy selects who may reset the shell. Empty means interact.
+	ResetPolicy ResetPolicy
+
+	// Snippets, when set, are the commands clients can run with
+	// run-snippet.
+	Snippets *Snippets
+
+	// NoSnapshot starts clients other than the owner on a blank terminal
+	// instead of replaying the scrollback, and keeps the transcript and
+	// search to the owner.
+	NoSnapshot bool
+
+	// PastePolicy selects how large pastes from clients other than the
+	// owner are confirmed. Empty means client.
+	PastePolicy PastePolicy
+
+	// WebRoot, when set, is a directory whose files take precedence over the
+	// embedded web assets.
+	WebRoot string
+
+	// MaxBufferedBytes caps the output held in memory for all clients
+	// together. When it is exceeded the clients with the largest backlog are
+	// disconnected. Zero means no cap.
+	MaxBufferedBytes int64
+
+	// MaxConnsPerIP caps the HTTP requests, WebSockets and event streams
+	// open at once from one client address. Zero means no cap.
+	MaxConnsPerIP int
+
+	// ReadTimeout and WriteTimeout bound reading a whole HTTP request and
+	// writing its response. Zero means no limit. WebSocket connections are
+	// not affected, and event streams are bounded by WSWriteTimeout per
+	// event instead.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// WSWriteTimeout bounds each write to a WebSocket or event stream
+	// client, which is disconnected when it passes. Zero means 10s.
+	WSWriteTimeout time.Duration
+
+	// QRCredentials puts the Basic Auth user and password in the URL of
+	// /api/qr.png and /api/qr.svg, for requests that carry the owner token.
+	QRCredentials bool
+
+	// PprofToken, when set, mounts net/http/pprof under /debug/pprof/ for
+	// requests that carry it. It is separate from the owner token and
+	// grants nothing else.
+	PprofToken string
+
+	// Listeners are served in addition to Addrs, for connections that do
+	// not arrive on a local socket such as those forwarded by a relay or
+	// made by tests through a PipeListener. Addrs may be empty when they
+	// are given.
+	Listeners []net.Listener
+
+	// AfterListen, when set, runs once every address is bound and before
+	// any connection is served. If it fails the server does not start. It
+	// is used to drop root privileges.
+	AfterListen func() error
+
+	// SSHAddrs, when set, are addresses to accept SSH clients on. They use
+	// the same Basic Auth credentials, allow-ip and user-level rules as the
+	// browser. SSHHostKey is required with them.
+	SSHAddrs   []string
+	SSHHostKey ssh.Signer
+
+	// BoardAddrs, when set, are addresses to serve a public board on: a
+	// watch-only view of the session without Basic Auth, for a screen on
+	// the wall. Only the allow-ip list applies there.
+	BoardAddrs []string
+
+	// UDPAddrs, when set, are addresses for the datagram transport used by
+	// terminal clients on lossy links. Sessions are handed out on /api/udp.
+	UDPAddrs []string
+
+	// InputLog, when set, records all terminal input with the client that
+	// sent it. The caller closes it.
+	InputLog *InputLog
+
+	// KnownIPs, when set, is the record of client addresses seen before.
+	// The first connection from any other address is reported to the
+	// owner, recorded as an event and passed to OnNewIP.
+	KnownIPs *KnownIPs
+	OnNewIP  func(ip, transport string)
+
+	// EffectiveConfig is reported by /api/diag. Secrets must already be
+	// redacted.
+	EffectiveConfig map[string]any
+
+	// Telemetry, when set, receives a span per HTTP request and per client
+	// session, and the server's counters.
+	Telemetry *telemetry.Exporter
+
+	// OnClientsChanged, when set, is called with the number of connected
+	// clients every time a client joins or leaves.
+	OnClientsChanged func(count int)
+
+	// OnAliasChanged, when set, is called after the owner changes the alias.
+	OnAliasChanged func(alias string)
+
+	// OnBell, when set, is called when the shell rings the bell, at most
+	// once per bellInterval.
+	OnBell func()
+
+	// Inherited are listening sockets handed down by the process this one
+	// replaces, keyed as by ListenerFiles. Their addresses are taken over
+	// instead of bound again; sockets for other addresses are closed.
+	Inherited map[string]*os.File
+
+	// OnUpgrade, when set, replaces this process with a new one on
+	// POST /api/upgrade from the owner. It returns once the new process is
+	// ready, and hands over to it afterwards; see Drain.
+	OnUpgrade func() error
 }
 
 type Server struct {
-	addrs      []string
-	allowIPs   []*regexp.Regexp
-	session    *terminal.Session
-	auth       AuthConfig
-	alias      string
-	ownerToken string
-	userLevels []UserLevelRule
+	addrs    []string
+	allowIPs []*regexp.Regexp
+	// allowDNS, when set, also matches allowIPs against the client's host
+	// names.
+	allowDNS *dnsNames
+	// allowIPPatterns are the patterns behind allowIPs, for /api/rules.
+	allowIPPatterns []string
+	accessRules     *AccessRules
+	snippets        *Snippets
+	rulesChangedCh  chan struct{}
+	session         *terminal.Session
+	auth            AuthConfig
+	ownerToken      string
+	userLevels      []UserLevelRule
+	commandFilter   *CommandFilter
+	version         string
+	webRoot         string
+	pprofToken      string
+	qrCredentials   bool
+	noSnapshot      bool
+	extraLns        []net.Listener
+	afterListen     func() error
+	sshAddrs        []string
+	sshHostKey      ssh.Signer
+	boardAddrs      []string
+	udpAddrs        []string
+	udp             *datagram.Listener
+	udpPort         int
+	inputLog        *InputLog
+	telemetry       *telemetry.Exporter
+	metrics         serverMetrics
+	events          eventLog
+	knownIPs        *KnownIPs
+	onNewIP         func(ip, transport string)
+	startedAt       time.Time
+
+	effectiveConfig map[string]any
+
+	clipboardPolicy  ClipboardPolicy
+	resizePolicy     ResizePolicy
+	resetPolicy      ResetPolicy
+	pastePolicy      PastePolicy
+	pasteIDs         atomic.Int64
+	slowClientPolicy SlowClientPolicy
+	maxBufferedBytes int64
+	connLimit        *connLimiter
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+	wsWriteTimeout   time.Duration
+
+	aliasMu        sync.Mutex
+	alias          string
+	onAliasChanged func(alias string)
+	accent         string
+	motd           string
 
 	warnedNoUserLevelMatchMu sync.Mutex
 	warnedNoUserLevelMatch   map[string]struct{}
 
-	clientsMu sync.Mutex
-	clients   map[*client]struct{}
+	clientsMu        sync.Mutex
+	clients          map[*client]struct{}
+	clientList       []*client
+	eventClients     map[string]*client
+	onClientsChanged func(count int)
+
+	// hooks are the caller's extensions given as options to New.
+	hooks hooks
+
+	ownerMu sync.Mutex
+	// owners counts the connected owner terminals; the server shuts down
+	// when the last one leaves.
+	owners int
+	// ownerSeq counts owner disconnects, so that reconnecting cancels the
+	// pending shutdown.
+	ownerSeq int
+
+	acceptMu       sync.Mutex
+	rejectingNewWS bool
+
+	pauseMu      sync.Mutex
+	outputPaused bool
 
-	ownerMu        sync.Mutex
-	ownerConnected bool
+	approvals approvalQueue
 
 	shutdownOnce sync.Once
 	shutdownFunc func()
+
+	// inherited holds the sockets from Config.Inherited not yet taken
+	// over, and bound every socket listened on by address.
+	inherited map[string]*os.File
+	boundMu   sync.Mutex
+	bound     map[string]fileSocket
+	onUpgrade func() error
+	onBell    func()
+
+	handover handoverState
 }
 
 type client struct {
 	conn      *websocket.Conn
 	send      chan wsMessage
+	done      chan struct{}
+	kick      chan struct{}
+	kickOnce  sync.Once
 	isOwner   bool
-	userLevel UserLevel
+	remoteIP  string
+	user      string
+	lang      string
+	transport string
+	joinedAt  time.Time
+
+	// snapshotLimit caps the scrollback sent on connect; negative means all
+	// of it.
+	snapshotLimit int
+	// snapshotEncoding, when set, is how the snapshot is compressed.
+	snapshotEncoding string
+
+	// userLevel changes when a time-boxed user-level rule expires.
+	userLevel atomic.Int32
+	// levelCap is the level a viewer moved here from another mirror had
+	// there; the rules never give it more.
+	levelCap UserLevel
+	// watchOnlyNotice is when a watch-only client was last told its input
+	// is ignored, in Unix nanoseconds.
+	watchOnlyNotice atomic.Int64
+	// resizeDenied is set once the client was told it may not resize.
+	resizeDenied atomic.Bool
+	// detached is set when the owner left on purpose, so the session keeps
+	// running until it attaches again.
+	detached atomic.Bool
+	// paste is a large paste waiting for the client to confirm it.
+	paste pendingPaste
+
+	rttMu sync.Mutex
+	rtt   time.Duration
+
+	flowMu sync.Mutex
+	flow   flowState
+
+	// span covers the client's session from join to leave.
+	span *telemetry.Span
+
+	eventsMu sync.Mutex
+	eventsOn bool
+
+	// commands follows the client's input for the command filter.
+	commands commandLine
 }
 
 type wsMessage struct {
 	messageType int
 	data        []byte
+	// chunk, when data is terminal output, holds the reference to its
+	// pooled buffer. The writer releases it once data has been written.
+	chunk terminal.OutputChunk
 }
 
-type controlMessage struct {
-	Type string `json:"type"`
-	Cols int    `json:"cols"`
-	Rows int    `json:"rows"`
-}
+const (
+	// writeWait is the default bound on a single WebSocket write, so a
+	// stalled connection cannot block its writer forever.
+	writeWait = 10 * time.Second
+	// snapshotFrameSize is the largest frame used to send the scrollback
+	// snapshot to a new client.
+	snapshotFrameSize = 32 << 10
+	// watchOnlyNoticeInterval is how often a watch-only client that keeps
+	// typing is reminded that its input is ignored.
+	watchOnlyNoticeInterval = 30 * time.Second
+	// bellInterval is the least time between two bell notifications, so a
+	// program ringing in a loop does not flood clients.
+	bellInterval = time.Second
+)
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    []string{protocol.Subprotocol},
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
@@ -88,16 +378,21 @@ var upgrader = websocket.Upgrader{
 //go:embed web/* web/vendor/*
 var webFS embed.FS
 
-func New(cfg Config) (*Server, error) {
+// New checks cfg and returns a server for its session. opts add the
+// caller's own hooks; see Option.
+func New(cfg Config, opts ...Option) (*Server, error) {
 	if cfg.Session == nil {
 		return nil, errors.New("session is required")
 	}
-	if len(cfg.Addrs) == 0 {
+	if len(cfg.Addrs) == 0 && len(cfg.Listeners) == 0 {
 		return nil, errors.New("addrs are required")
 	}
 	if len(cfg.AllowIPs) == 0 {
 		return nil, errors.New("allow-ip patterns are required")
 	}
+	if err := (Branding{Alias: cfg.Alias, Accent: cfg.Accent, MOTD: cfg.MOTD}).Validate(); err != nil {
+		return nil, err
+	}
 
 	userLevels := cfg.UserLevels
 	if len(userLevels) == 0 {
@@ -108,22 +403,26 @@ func New(cfg Config) (*Server, error) {
 		userLevels = parsed
 	}
 
+	now := time.Now()
 	compiledUserLevels := make([]UserLevelRule, 0, len(userLevels))
 	for _, rule := range userLevels {
 		if strings.TrimSpace(rule.Pattern) == "" {
 			return nil, errors.New("user-level pattern cannot be empty")
 		}
-		if rule.Level != UserLevelInteract && rule.Level != UserLevelWatchOnly {
-			return nil, fmt.Errorf("invalid user-level %d for pattern %q (expected 0 or 1)", int(rule.Level), rule.Pattern)
+		if rule.Level < UserLevelInteract || rule.Level > UserLevelApproval {
+			return nil, fmt.Errorf("invalid user-level %d for pattern %q (expected 0, 1 or 2)", int(rule.Level), rule.Pattern)
 		}
 		compiled := rule
 		if compiled.matcher == nil {
-			matcher, err := compileUserLevelPattern(rule.Pattern)
+			matcher, err := compileUserLevelPattern(strings.TrimPrefix(rule.Pattern, userRulePrefix))
 			if err != nil {
 				return nil, fmt.Errorf("invalid user-level pattern %q: %v", rule.Pattern, err)
 			}
 			compiled.matcher = matcher
 		}
+		if rule.Duration > 0 {
+			compiled.expires = now.Add(rule.Duration)
+		}
 		compiledUserLevels = append(compiledUserLevels, compiled)
 	}
 
@@ -136,26 +435,128 @@ func New(cfg Config) (*Server, error) {
 		addrs = append(addrs, trimmed)
 	}
 	addrs = uniqueStrings(addrs)
-	if len(addrs) == 0 {
-		return nil, errors.New("addrs are required")
-	}
 
 	allowMatchers, err := compileAllowIPMatchers(cfg.AllowIPs)
 	if err != nil {
 		return nil, err
 	}
+	snippets := cfg.Snippets
+	if snippets == nil {
+		snippets, _ = LoadSnippets("")
+	}
+	allowPatterns := make([]string, 0, len(cfg.AllowIPs))
+	for _, pattern := range cfg.AllowIPs {
+		allowPatterns = append(allowPatterns, strings.TrimSpace(pattern))
+	}
+	allowPatterns = uniqueStrings(allowPatterns)
+	accessRules := cfg.AccessRules
+	if accessRules == nil {
+		accessRules, _ = LoadAccessRules("")
+	}
+
+	clipboardPolicy, err := ParseClipboardPolicy(string(cfg.ClipboardPolicy))
+	if err != nil {
+		return nil, err
+	}
+
+	resizePolicy, err := ParseResizePolicy(string(cfg.ResizePolicy))
+	if err != nil {
+		return nil, err
+	}
+
+	resetPolicy, err := ParseResetPolicy(string(cfg.ResetPolicy))
+	if err != nil {
+		return nil, err
+	}
+
+	pastePolicy, err := ParsePastePolicy(string(cfg.PastePolicy))
+	if err != nil {
+		return nil, err
+	}
+
+	slowClientPolicy, err := ParseSlowClientPolicy(string(cfg.SlowClientPolicy))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.SSHAddrs) > 0 && cfg.SSHHostKey == nil {
+		return nil, errors.New("an SSH host key is required")
+	}
+
+	webRoot := strings.TrimSpace(cfg.WebRoot)
+	if webRoot != "" {
+		info, err := os.Stat(webRoot)
+		if err != nil {
+			return nil, fmt.Errorf("invalid web root %q: %v", webRoot, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("invalid web root %q: not a directory", webRoot)
+		}
+	}
 
 	s := &Server{
 		addrs:                  addrs,
 		allowIPs:               allowMatchers,
+		allowIPPatterns:        allowPatterns,
+		accessRules:            accessRules,
+		snippets:               snippets,
+		rulesChangedCh:         make(chan struct{}, 1),
 		session:                cfg.Session,
 		auth:                   cfg.Auth,
-		alias:                  cfg.Alias,
+		alias:                  strings.TrimSpace(cfg.Alias),
+		accent:                 strings.TrimSpace(cfg.Accent),
+		motd:                   strings.TrimSpace(cfg.MOTD),
 		ownerToken:             strings.TrimSpace(cfg.OwnerToken),
 		userLevels:             compiledUserLevels,
+		commandFilter:          cfg.CommandFilter,
+		version:                strings.TrimSpace(cfg.Version),
+		webRoot:                webRoot,
+		pprofToken:             strings.TrimSpace(cfg.PprofToken),
+		qrCredentials:          cfg.QRCredentials,
+		noSnapshot:             cfg.NoSnapshot,
+		extraLns:               cfg.Listeners,
+		afterListen:            cfg.AfterListen,
+		sshAddrs:               cfg.SSHAddrs,
+		sshHostKey:             cfg.SSHHostKey,
+		boardAddrs:             cfg.BoardAddrs,
+		udpAddrs:               cfg.UDPAddrs,
+		inputLog:               cfg.InputLog,
+		telemetry:              cfg.Telemetry,
+		knownIPs:               cfg.KnownIPs,
+		onNewIP:                cfg.OnNewIP,
+		startedAt:              now,
+		effectiveConfig:        cfg.EffectiveConfig,
+		udp:                    datagram.NewListener(),
+		clipboardPolicy:        clipboardPolicy,
+		resizePolicy:           resizePolicy,
+		resetPolicy:            resetPolicy,
+		pastePolicy:            pastePolicy,
+		slowClientPolicy:       slowClientPolicy,
+		maxBufferedBytes:       cfg.MaxBufferedBytes,
+		connLimit:              newConnLimiter(cfg.MaxConnsPerIP),
+		readTimeout:            cfg.ReadTimeout,
+		writeTimeout:           cfg.WriteTimeout,
+		wsWriteTimeout:         cfg.WSWriteTimeout,
 		warnedNoUserLevelMatch: make(map[string]struct{}),
 		clients:                make(map[*client]struct{}),
+		eventClients:           make(map[string]*client),
+		onClientsChanged:       cfg.OnClientsChanged,
+		onAliasChanged:         cfg.OnAliasChanged,
+		inherited:              cfg.Inherited,
+		bound:                  make(map[string]fileSocket),
+		onUpgrade:              cfg.OnUpgrade,
+		onBell:                 cfg.OnBell,
 	}
+	if cfg.AllowIPDNS {
+		s.allowDNS = newDNSNames()
+	}
+	if s.wsWriteTimeout <= 0 {
+		s.wsWriteTimeout = writeWait
+	}
+	for _, opt := range opts {
+		opt(&s.hooks)
+	}
+	s.registerMetrics()
 
 	return s, nil
 }
@@ -165,35 +566,136 @@ func (s *Server) Start(ctx context.Context) error {
 	mux.Handle("/ws", s.authMiddleware(http.HandlerFunc(s.handleWS)))
 	if s.ownerToken != "" {
 		mux.Handle("/ws-owner", s.authMiddleware(http.HandlerFunc(s.handleWSOwner)))
+		mux.Handle("/api/alias", s.authMiddleware(http.HandlerFunc(s.handleAlias)))
+		mux.Handle("/api/rules", s.authMiddleware(http.HandlerFunc(s.handleRules)))
+		mux.Handle("/api/handover", s.authMiddleware(http.HandlerFunc(s.handleHandover)))
+		mux.Handle("/api/handover/accept", s.authMiddleware(http.HandlerFunc(s.handleHandoverAccept)))
+		if s.onUpgrade != nil {
+			mux.Handle("/api/upgrade", s.authMiddleware(http.HandlerFunc(s.handleUpgrade)))
+		}
 	}
+	mux.Handle("/events", s.authMiddleware(http.HandlerFunc(s.handleEvents)))
+	mux.Handle("/events/input", s.authMiddleware(http.HandlerFunc(s.handleEventsInput)))
 	mux.Handle("/upload", s.authMiddleware(http.HandlerFunc(s.handleUpload)))
+	mux.Handle("/api/config.json", s.authMiddleware(http.HandlerFunc(s.handleConfig)))
+	mux.Handle("/api/i18n/", s.authMiddleware(http.HandlerFunc(s.handleI18n)))
+	mux.Handle("/api/transcript", s.authMiddleware(http.HandlerFunc(s.handleTranscript)))
+	if s.clipboardPolicy != ClipboardOff {
+		mux.Handle("/api/clipboard", s.authMiddleware(http.HandlerFunc(s.handleClipboard)))
+	}
+	mux.Handle("/api/snippets", s.authMiddleware(http.HandlerFunc(s.handleSnippets)))
+	mux.Handle("/api/search", s.authMiddleware(http.HandlerFunc(s.handleSearch)))
+	mux.Handle("/api/clients", s.authMiddleware(http.HandlerFunc(s.handleClients)))
+	mux.Handle("/api/session", s.authMiddleware(http.HandlerFunc(s.handleSessionInfo)))
+	mux.Handle("/api/events", s.authMiddleware(http.HandlerFunc(s.handleEventLog)))
+	mux.Handle("/api/diag", s.authMiddleware(http.HandlerFunc(s.handleDiag)))
+	mux.Handle("/api/diag/", s.authMiddleware(http.HandlerFunc(s.handleDiag)))
+	mux.Handle("/api/qr.png", s.authMiddleware(http.HandlerFunc(s.handleQR)))
+	mux.Handle("/api/qr.svg", s.authMiddleware(http.HandlerFunc(s.handleQR)))
+	if len(s.udpAddrs) > 0 {
+		mux.Handle("/api/udp", s.authMiddleware(http.HandlerFunc(s.handleUDPSession)))
+	}
+	if s.pprofToken != "" {
+		mux.Handle("/debug/pprof/", s.authMiddleware(s.pprofHandler()))
+	}
 	mux.Handle("/", s.authMiddleware(s.staticHandler()))
 
 	srv := &http.Server{
-		Addr:              s.addrs[0],
-		Handler:           mux,
+		Handler:           s.telemetry.Handler(s.hooks.wrapHandler(s.limitConnsPerIP(mux))),
 		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       s.readTimeout,
+		WriteTimeout:      s.writeTimeout,
 	}
 
-	listeners, err := listenAll(s.addrs)
+	listeners, err := s.listenAll(s.addrs)
 	if err != nil {
 		return err
 	}
+	listeners = append(listeners, s.extraLns...)
+
+	sshListeners, err := s.listenAll(s.sshAddrs)
+	if err != nil {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+		return err
+	}
+	boardListeners, err := s.listenAll(s.boardAddrs)
+	if err != nil {
+		for _, listener := range append(listeners, sshListeners...) {
+			_ = listener.Close()
+		}
+		return err
+	}
+	udpConns, err := s.listenAllUDP(s.udpAddrs)
+	if err != nil {
+		for _, listener := range append(append(listeners, sshListeners...), boardListeners...) {
+			_ = listener.Close()
+		}
+		return err
+	}
+	s.closeInherited()
+	if s.afterListen != nil {
+		if err := s.afterListen(); err != nil {
+			for _, listener := range append(append(listeners, sshListeners...), boardListeners...) {
+				_ = listener.Close()
+			}
+			for _, pc := range udpConns {
+				_ = pc.Close()
+			}
+			return err
+		}
+	}
+	if len(sshListeners) > 0 {
+		sshConfig := s.sshConfig()
+		for _, listener := range sshListeners {
+			go s.serveSSH(listener, sshConfig)
+		}
+	}
+	if len(udpConns) > 0 {
+		s.udpPort = udpPortOf(udpConns[0])
+		for _, pc := range udpConns {
+			go func(pc net.PacketConn) { _ = s.udp.Serve(pc) }(pc)
+		}
+	}
 
 	go s.broadcastOutput()
 	go s.broadcastStatus()
+	go s.broadcastBells()
+	go s.broadcastActivity(ctx)
+	go s.expireUserLevels(ctx)
+
+	boardSrv := &http.Server{
+		Handler:           s.telemetry.Handler(s.hooks.wrapHandler(s.limitConnsPerIP(s.boardHandler()))),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       s.readTimeout,
+		WriteTimeout:      s.writeTimeout,
+	}
 
-	errCh := make(chan error, len(listeners))
+	errCh := make(chan error, len(listeners)+len(boardListeners))
 	for _, listener := range listeners {
 		go func(listener net.Listener) {
 			errCh <- srv.Serve(listener)
 		}(listener)
 	}
+	for _, listener := range boardListeners {
+		go func(listener net.Listener) {
+			errCh <- boardSrv.Serve(listener)
+		}(listener)
+	}
 
 	shutdown := func() {
+		for _, listener := range sshListeners {
+			_ = listener.Close()
+		}
+		for _, pc := range udpConns {
+			_ = pc.Close()
+		}
+		s.udp.Close()
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		_ = srv.Shutdown(shutdownCtx)
+		_ = boardSrv.Shutdown(shutdownCtx)
 	}
 	s.shutdownFunc = shutdown
 
@@ -216,7 +718,7 @@ func (s *Server) Start(ctx context.Context) error {
 	defer close(done)
 
 	var serveErr error
-	for i := 0; i < len(listeners); i++ {
+	for i := 0; i < len(listeners)+len(boardListeners); i++ {
 		err := <-errCh
 		if err == nil || errors.Is(err, http.ErrServerClosed) {
 			continue
@@ -236,10 +738,10 @@ func (s *Server) Start(ctx context.Context) error {
 	return http.ErrServerClosed
 }
 
-func listenAll(addrs []string) ([]net.Listener, error) {
+func (s *Server) listenAll(addrs []string) ([]net.Listener, error) {
 	listeners := make([]net.Listener, 0, len(addrs))
 	for _, addr := range addrs {
-		listener, err := net.Listen("tcp", addr)
+		listener, err := s.listen(addr)
 		if err != nil {
 			for _, opened := range listeners {
 				_ = opened.Close()
@@ -252,34 +754,70 @@ func listenAll(addrs []string) ([]net.Listener, error) {
 }
 
 func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
+	if !s.AcceptingClients() {
+		http.Error(w, translate(requestLanguage(r), "sharing.paused"), http.StatusServiceUnavailable)
+		return
+	}
+	if !checkSubprotocol(w, r) {
+		return
+	}
 	s.handleWSWithOwnerFlag(w, r, false)
 }
 
+// SetAcceptingClients controls whether new viewer WebSocket connections are
+// accepted. Existing clients and the owner connection are not affected.
+func (s *Server) SetAcceptingClients(accepting bool) {
+	s.acceptMu.Lock()
+	s.rejectingNewWS = !accepting
+	s.acceptMu.Unlock()
+}
+
+// AcceptingClients reports whether new viewer connections are accepted.
+func (s *Server) AcceptingClients() bool {
+	s.acceptMu.Lock()
+	defer s.acceptMu.Unlock()
+	return !s.rejectingNewWS
+}
+
+// ownerTokenMatches reports whether r carries the owner token in its token
+// query parameter.
+func (s *Server) ownerTokenMatches(r *http.Request) bool {
+	return tokenMatches(strings.TrimSpace(r.URL.Query().Get("token")), s.ownerToken)
+}
+
+// tokenMatches reports whether given is the secret token want, in constant
+// time so the comparison does not tell how much of a guess was right. An
+// empty want, a token that was never set, matches nothing.
+func tokenMatches(given, want string) bool {
+	return want != "" && subtle.ConstantTimeCompare([]byte(given), []byte(want)) == 1
+}
+
 func (s *Server) handleWSOwner(w http.ResponseWriter, r *http.Request) {
-	token := strings.TrimSpace(r.URL.Query().Get("token"))
-	if token == "" || token != s.ownerToken {
+	if !s.ownerTokenMatches(r) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-
-	s.ownerMu.Lock()
-	if s.ownerConnected {
-		s.ownerMu.Unlock()
-		http.Error(w, "Owner already connected", http.StatusConflict)
+	if !checkSubprotocol(w, r) {
 		return
 	}
-	s.ownerConnected = true
-	s.ownerMu.Unlock()
 
+	s.ownerJoined()
 	s.handleWSWithOwnerFlag(w, r, true)
 }
 
 func (s *Server) handleWSWithOwnerFlag(w http.ResponseWriter, r *http.Request, isOwner bool) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	snapshotLimit, err := parseSnapshotLimit(r.URL.Query().Get("snapshot"))
+	if err != nil {
+		http.Error(w, "Invalid snapshot parameter", http.StatusBadRequest)
+	}
+	var conn *websocket.Conn
+	if err == nil {
+		conn, err = upgrader.Upgrade(w, r, nil)
+	}
 	if err != nil {
 		if isOwner {
 			s.ownerMu.Lock()
-			s.ownerConnected = false
+			s.owners--
 			s.ownerMu.Unlock()
 		}
 		return
@@ -287,49 +825,187 @@ func (s *Server) handleWSWithOwnerFlag(w http.ResponseWriter, r *http.Request, i
 
 	userLevel := UserLevelInteract
 	if !isOwner {
-		remoteIP := extractRemoteIP(r)
-		level, matched := MatchUserLevel(s.userLevels, remoteIP)
-		if matched {
-			userLevel = level
-		} else {
-			s.warnNoUserLevelMatch(remoteIP)
-		}
+		userLevel = s.requestUserLevel(r)
+	}
+	transport := "websocket"
+	if isBoardRequest(r) {
+		transport = "board"
 	}
 
 	c := &client{
 		conn:      conn,
 		send:      make(chan wsMessage, 128),
+		done:      make(chan struct{}),
+		kick:      make(chan struct{}),
 		isOwner:   isOwner,
-		userLevel: userLevel,
+		remoteIP:  extractRemoteIP(r),
+		user:      s.requestUser(r),
+		lang:      requestLanguage(r),
+		transport: transport,
+		joinedAt:  time.Now(),
+		levelCap:  handoverLevel(r),
+
+		snapshotLimit:    snapshotLimit,
+		snapshotEncoding: parseSnapshotEncoding(r.URL.Query().Get("snapshotEncoding")),
 	}
+	c.setLevel(userLevel)
+	conn.SetPongHandler(c.handlePong)
 
 	s.addClient(c)
+	go c.writePump(s)
+	s.greetClient(c)
+	c.readPump(s)
+}
 
-	readOnly := !c.isOwner && c.userLevel != UserLevelInteract
-	infoPayload, _ := json.Marshal(map[string]any{
-		"type":      "client-info",
-		"userLevel": int(c.userLevel),
-		"readOnly":  readOnly,
-	})
-	c.send <- wsMessage{messageType: websocket.TextMessage, data: infoPayload}
+// parseSnapshotLimit reads the snapshot query parameter clients use to limit
+// the scrollback replayed on connect: empty or "all" for everything, 0 for
+// none, otherwise a byte count such as 4096 or 64k.
+func parseSnapshotLimit(raw string) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.EqualFold(raw, "all") {
+		return -1, nil
+	}
+	limit, err := ParseByteSize(raw)
+	if err != nil {
+		return 0, err
+	}
+	return int(min(limit, math.MaxInt32)), nil
+}
 
-	snapshot := s.session.Snapshot()
-	if len(snapshot) > 0 {
-		c.send <- wsMessage{messageType: websocket.BinaryMessage, data: snapshot}
+// greetClient queues the hello message, the scrollback snapshot split into
+// frames of at most snapshotFrameSize, and the shell's last activity for a
+// newly registered client.
+// When noSnapshot is set only the owner gets the scrollback.
+// Live output that arrives meanwhile is held back and released afterwards,
+// trimmed to what the snapshot did not already cover. The client's writer
+// must already be running.
+func (s *Server) greetClient(c *client) {
+	admin := c.isOwner || c.level() == UserLevelInteract
+	limit := c.snapshotLimit
+	if s.noSnapshot && !c.isOwner {
+		limit = 0
+	}
+	snapshot, offset := s.session.SnapshotTail(limit)
+	if limit > 0 && len(snapshot) == limit {
+		// Start a cut snapshot at a line boundary so it does not begin in
+		// the middle of an escape sequence.
+		if i := bytes.IndexByte(snapshot, '\n'); i >= 0 {
+			snapshot = snapshot[i+1:]
+		}
+	}
+	if !c.sendBlocking(wsMessage{messageType: websocket.TextMessage, data: s.helloPayload(c, len(snapshot))}) {
+		return
 	}
 
-	go c.writePump(s)
-	c.readPump(s)
+	// A compressed snapshot is announced first and counted as sent up
+	// front, since the client acks the decoded output once the last frame
+	// is in.
+	frames, plain := snapshot, true
+	if c.snapshotEncoding != "" && len(snapshot) > 0 {
+		if compressed, ok := compressSnapshot(snapshot); ok {
+			announce := protocol.Encode(protocol.Snapshot{
+				Encoding:        c.snapshotEncoding,
+				Bytes:           len(snapshot),
+				CompressedBytes: len(compressed),
+			})
+			if !c.sendBlocking(wsMessage{messageType: websocket.TextMessage, data: announce}) {
+				return
+			}
+			c.flowMu.Lock()
+			c.flow.sent += int64(len(snapshot))
+			c.flowMu.Unlock()
+			frames, plain = compressed, false
+		}
+	}
+
+	for len(frames) > 0 {
+		frame := frames[:min(len(frames), snapshotFrameSize)]
+		frames = frames[len(frame):]
+		if !c.sendBlocking(wsMessage{messageType: websocket.BinaryMessage, data: frame}) {
+			return
+		}
+		if plain {
+			c.flowMu.Lock()
+			c.flow.sent += int64(len(frame))
+			c.flowMu.Unlock()
+		}
+	}
+
+	if s.motd != "" {
+		s.sendMOTD(c)
+	}
+	c.markReady(offset, s.slowClientPolicy)
+	activity, _, _ := s.activityPayload()
+	c.trySend(wsMessage{messageType: websocket.TextMessage, data: activity})
+	if c.isOwner {
+		c.trySend(wsMessage{messageType: websocket.TextMessage, data: s.viewersPayload()})
+	}
+	if admin {
+		s.sendPendingApprovals(c)
+	}
+}
+
+// helloPayload encodes the hello message for c. It is sent again when the
+// client's user level changes.
+func (s *Server) helloPayload(c *client, snapshotBytes int) []byte {
+	level := c.level()
+	return protocol.Encode(protocol.Hello{
+		UserLevel:       int(level),
+		ReadOnly:        !c.isOwner && level == UserLevelWatchOnly,
+		CanResize:       s.resizeAllowed(c),
+		CanReset:        s.resetAllowed(c),
+		SnapshotBytes:   snapshotBytes,
+		Version:         s.version,
+		ProtocolVersion: protocol.Version,
+		FlowControl:     true,
+		NeedsApproval:   !c.isOwner && level == UserLevelApproval,
+	})
+}
+
+func (c *client) level() UserLevel {
+	return UserLevel(c.userLevel.Load())
+}
+
+func (c *client) setLevel(level UserLevel) {
+	c.userLevel.Store(int32(level))
+}
+
+// sendBlocking queues msg, waiting for room unless the client is being
+// disconnected.
+func (c *client) sendBlocking(msg wsMessage) bool {
+	select {
+	case c.send <- msg:
+		c.queued(len(msg.data))
+		return true
+	case <-c.kick:
+		return false
+	}
 }
 
 func (c *client) writePump(s *Server) {
-	defer func() {
-		c.conn.Close()
-	}()
+	defer c.disconnect()
 
-	for msg := range c.send {
-		if err := c.conn.WriteMessage(msg.messageType, msg.data); err != nil {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
 			return
+		case msg := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(s.wsWriteTimeout))
+			c.written(len(msg.data))
+			err := c.conn.WriteMessage(msg.messageType, msg.data)
+			msg.chunk.Release()
+			if err != nil {
+				return
+			}
+			c.drainBacklog()
+			s.resumeIfCaughtUp(c)
+		case <-ticker.C:
+			if err := c.sendPing(); err != nil {
+				return
+			}
 		}
 	}
 }
@@ -337,10 +1013,10 @@ func (c *client) writePump(s *Server) {
 func (c *client) readPump(s *Server) {
 	defer func() {
 		s.removeClient(c)
-		close(c.send)
+		close(c.done)
 		c.conn.Close()
 		if c.isOwner {
-			s.requestShutdown()
+			s.ownerLeft(c.detached.Load())
 		}
 	}()
 
@@ -349,26 +1025,92 @@ func (c *client) readPump(s *Server) {
 		if err != nil {
 			return
 		}
-		switch messageType {
-		case websocket.BinaryMessage:
-			if c.isOwner || c.userLevel == UserLevelInteract {
-				_ = s.session.WriteInput(payload)
+		s.handleClientMessage(c, messageType, payload)
+	}
+}
+
+// handleClientMessage applies a message received from a client over any
+// transport: binary messages are terminal input, text messages are JSON
+// control messages.
+func (s *Server) handleClientMessage(c *client, messageType int, payload []byte) {
+	switch messageType {
+	case websocket.BinaryMessage:
+		if c.transport == "board" {
+			return
+		}
+		if payload = s.hooks.interceptInput(c, payload); len(payload) == 0 {
+			return
+		}
+		if s.commandFilter != nil && !c.isOwner && c.level() != UserLevelWatchOnly {
+			payload = s.filterCommands(c, payload)
+			if len(payload) == 0 {
+				return
 			}
-		case websocket.TextMessage:
-			if !c.isOwner && c.userLevel != UserLevelInteract {
-				continue
+		}
+		switch {
+		case !c.isOwner && c.level() == UserLevelInteract && s.pastePolicy != PasteOff && isLargePaste(payload):
+			s.guardPaste(c, payload)
+		case c.isOwner || c.level() == UserLevelInteract:
+			s.inputLog.record(c, payload)
+			_ = s.session.WriteInput(payload)
+		case c.level() == UserLevelApproval:
+			s.queueForApproval(c, payload)
+		default:
+			s.noticeWatchOnly(c)
+		}
+	case websocket.TextMessage:
+		// Messages that are malformed, or of types from a newer client,
+		// are ignored.
+		control, err := protocol.DecodeFromClient(payload)
+		if err != nil {
+			return
+		}
+		// The board only watches; flow control is all it may send.
+		if _, ack := control.(protocol.Ack); c.transport == "board" && !ack {
+			return
+		}
+		switch control := control.(type) {
+		case protocol.Ack:
+			s.handleAck(c, control.Bytes)
+			return
+		case protocol.Resize:
+			if !s.resizeAllowed(c) {
+				s.denyResize(c)
+				return
 			}
-			var control controlMessage
-			if err := json.Unmarshal(payload, &control); err != nil {
-				continue
+		case protocol.Reset, protocol.ResetSoft:
+			if !s.resetAllowed(c) {
+				s.denyReset(c)
+				return
 			}
-			s.handleControl(control)
+			s.handleControl(c, control)
+			return
 		}
+		if !c.isOwner && c.level() != UserLevelInteract {
+			return
+		}
+		s.handleControl(c, control)
+	}
+}
+
+// noticeWatchOnly tells a watch-only client that its input was dropped, at
+// most once per watchOnlyNoticeInterval, so keystrokes do not seem to
+// vanish.
+func (s *Server) noticeWatchOnly(c *client) {
+	now := time.Now().UnixNano()
+	last := c.watchOnlyNotice.Load()
+	if last != 0 && now-last < int64(watchOnlyNoticeInterval) {
+		return
 	}
+	if !c.watchOnlyNotice.CompareAndSwap(last, now) {
+		return
+	}
+	s.sendStatus(c, translate(c.lang, "input.watchOnly"))
 }
 
 func (s *Server) requestShutdown() {
 	s.shutdownOnce.Do(func() {
+		s.sayGoodbye(websocket.CloseGoingAway, "session ended")
 		s.session.Close()
 		if s.shutdownFunc != nil {
 			s.shutdownFunc()
@@ -376,80 +1118,232 @@ func (s *Server) requestShutdown() {
 	})
 }
 
-func (s *Server) handleControl(control controlMessage) {
-	switch control.Type {
-	case "resize":
+func (s *Server) handleControl(c *client, control protocol.Message) {
+	switch control := control.(type) {
+	case protocol.Detach:
+		if c.isOwner {
+			c.detached.Store(true)
+			c.disconnect()
+		}
+	case protocol.SetAlias:
+		if c.isOwner {
+			if err := s.SetAlias(control.Alias); err != nil {
+				s.sendStatus(c, translate(c.lang, "alias.invalid", err.Error()))
+			}
+		}
+	case protocol.Resize:
 		_ = s.session.Resize(control.Cols, control.Rows)
-	case "reset":
-		remaining, err := s.session.Reset()
+	case protocol.Reset:
+		s.recordEvent(EventReset, c.remoteIP, "terminal reset requested")
+		remaining, err := s.session.ResetWithProgress(s.broadcastResetProgress)
 		if err != nil || len(remaining) > 0 {
+			s.recordEvent(EventError, c.remoteIP, "reset failed: %d process(es) left, error: %v", len(remaining), err)
 			s.broadcastResetFailure(remaining, err)
 		}
+	case protocol.ResetSoft:
+		s.recordEvent(EventReset, c.remoteIP, "soft terminal reset requested")
+		if err := s.session.SoftReset(); err != nil {
+			s.recordEvent(EventError, c.remoteIP, "soft reset failed: %v", err)
+			s.sendStatus(c, translate(c.lang, "reset.soft.failed", err.Error()))
+		}
+	case protocol.EventsRequest:
+		s.subscribeEvents(c, control.On, control.Since)
+	case protocol.ApprovalDecision:
+		s.resolveApproval(c, control.ID, control.Approve)
+	case protocol.PasteDecision:
+		s.resolvePaste(c, control.ID, control.Approve)
+	case protocol.RunSnippet:
+		s.runSnippet(c, control.Name)
+	}
+}
+
+// broadcastResetProgress tells every client about a step of a reset, so one
+// that takes a while does not look like a hung page.
+func (s *Server) broadcastResetProgress(progress terminal.ResetProgress) {
+	pids := make([]int, 0, len(progress.Remaining))
+	names := make([]string, 0, len(progress.Remaining))
+	for _, proc := range progress.Remaining {
+		pids = append(pids, proc.PID)
+		names = append(names, fmt.Sprintf("%d (%s)", proc.PID, strings.TrimSpace(proc.Name)))
+	}
+	if progress.Step != terminal.ResetTerminating {
+		s.recordEvent(EventReset, "", "reset escalated to %s, %d process(es) left", progress.Step, len(pids))
 	}
+	s.broadcastLocalized(func(lang string) []byte {
+		var message string
+		switch progress.Step {
+		case terminal.ResetTerminating:
+			message = translate(lang, "reset.progress.term", progress.Wait)
+		case terminal.ResetKilling:
+			message = translate(lang, "reset.progress.kill", len(pids), strings.Join(names, ", "))
+		default:
+			message = translate(lang, "reset.progress.sudo", len(pids), strings.Join(names, ", "))
+		}
+		return protocol.Encode(protocol.ResetProgress{
+			Step:    string(progress.Step),
+			PIDs:    pids,
+			Message: message,
+		})
+	})
 }
 
 func (s *Server) broadcastResetFailure(remaining []terminal.ProcessInfo, err error) {
-	title := "Reset failed"
-	lines := []string{"The shell could not be fully reset."}
-	if err != nil {
-		lines = append(lines, fmt.Sprintf("Reason: %s", err.Error()))
-	}
-	if len(remaining) > 0 {
-		lines = append(lines, "The following processes could not be terminated:")
-		for _, proc := range remaining {
-			name := strings.TrimSpace(proc.Name)
-			if name == "" {
-				name = "unknown"
+	s.broadcastLocalized(func(lang string) []byte {
+		lines := []string{translate(lang, "reset.failed.body")}
+		if err != nil {
+			lines = append(lines, translate(lang, "reset.failed.reason", err.Error()))
+		}
+		if len(remaining) > 0 {
+			lines = append(lines, translate(lang, "reset.failed.processes"))
+			for _, proc := range remaining {
+				name := strings.TrimSpace(proc.Name)
+				if name == "" {
+					name = translate(lang, "process.unknown")
+				}
+				lines = append(lines, translate(lang, "reset.failed.process", proc.PID, name))
 			}
-			lines = append(lines, fmt.Sprintf("PID %d - %s", proc.PID, name))
 		}
-	}
 
-	payload, _ := json.Marshal(map[string]string{
-		"type":    "reset-failed",
-		"title":   title,
-		"message": strings.Join(lines, "\n"),
+		return protocol.Encode(protocol.ResetFailed{
+			Title:   translate(lang, "reset.failed.title"),
+			Message: strings.Join(lines, "\n"),
+		})
 	})
-	s.broadcast(wsMessage{messageType: websocket.TextMessage, data: payload})
 }
 
 func (s *Server) addClient(c *client) {
+	s.startClientSpan(c)
 	s.clientsMu.Lock()
 	s.clients[c] = struct{}{}
+	s.rebuildClientListLocked()
+	count := len(s.clients)
 	s.clientsMu.Unlock()
+	logger().Debug("client connected", "remote", c.remoteIP, "user", c.user, "transport", c.transport, "level", c.level(), "clients", count)
+	if c.user != "" {
+		s.recordEvent(EventConnect, c.remoteIP, "%s client connected as %s (level %d, %d connected)", c.transport, c.user, c.level(), count)
+	} else {
+		s.recordEvent(EventConnect, c.remoteIP, "%s client connected (level %d, %d connected)", c.transport, c.level(), count)
+	}
+	s.checkNewIP(c)
+	s.updateOutputPause()
+	s.notifyClientsChanged(count)
+	if !c.isOwner {
+		s.announceViewers()
+	}
+	for _, hook := range s.hooks.onConnect {
+		hook(c.info())
+	}
 }
 
 func (s *Server) removeClient(c *client) {
 	s.clientsMu.Lock()
 	delete(s.clients, c)
+	s.rebuildClientListLocked()
+	count := len(s.clients)
 	s.clientsMu.Unlock()
+	s.dropApprovals(c)
+	logger().Debug("client disconnected", "remote", c.remoteIP, "transport", c.transport, "clients", count)
+	s.recordEvent(EventDisconnect, c.remoteIP, "%s client disconnected (%d connected)", c.transport, count)
+	s.endClientSpan(c)
+	s.updateOutputPause()
+	s.notifyClientsChanged(count)
+	if !c.isOwner {
+		s.announceViewers()
+	}
+	for _, hook := range s.hooks.onDisconnect {
+		hook(c.info())
+	}
+}
+
+func logger() *slog.Logger {
+	return logging.For("server")
+}
+
+// rebuildClientListLocked replaces the copy-on-write client list. Broadcasts
+// iterate a snapshot of it without holding clientsMu, so it is never mutated
+// in place.
+func (s *Server) rebuildClientListLocked() {
+	list := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		list = append(list, c)
+	}
+	s.clientList = list
+}
+
+// snapshotClients returns the current client list. Clients in it may already
+// have disconnected; sends to them are dropped harmlessly.
+func (s *Server) snapshotClients() []*client {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	return s.clientList
+}
+
+// ClientCount returns the number of connected WebSocket clients.
+func (s *Server) ClientCount() int {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	return len(s.clients)
+}
+
+func (s *Server) notifyClientsChanged(count int) {
+	if s.onClientsChanged != nil {
+		s.onClientsChanged(count)
+	}
 }
 
 func (s *Server) broadcastOutput() {
-	for data := range s.session.Output() {
-		s.broadcast(wsMessage{messageType: websocket.BinaryMessage, data: data})
+	for chunk := range s.session.Output() {
+		for _, observe := range s.hooks.output {
+			observe(chunk.Data)
+		}
+		for _, c := range s.snapshotClients() {
+			c.queueOutput(chunk, s.slowClientPolicy)
+		}
+		s.metrics.outputBytes.Add(int64(len(chunk.Data)))
+		chunk.Release()
+		s.enforceMemoryCap()
+		s.updateOutputPause()
 	}
 }
 
 func (s *Server) broadcastStatus() {
 	for message := range s.session.Status() {
-		payload, _ := json.Marshal(map[string]string{
-			"type":    "status",
-			"message": message,
-		})
+		s.recordEvent(EventStatus, "", "%s", message)
+		payload := protocol.Encode(protocol.Status{Message: message})
 		s.broadcast(wsMessage{messageType: websocket.TextMessage, data: payload})
 	}
 }
 
+// broadcastBells tells clients when the shell rings the bell. Bells rung
+// within bellInterval of the last one are merged into one.
+func (s *Server) broadcastBells() {
+	payload := protocol.Encode(protocol.Bell{})
+	for range s.session.Bells() {
+		s.broadcast(wsMessage{messageType: websocket.TextMessage, data: payload})
+		if s.onBell != nil {
+			go s.onBell()
+		}
+		time.Sleep(bellInterval)
+	}
+}
+
 func (s *Server) broadcast(msg wsMessage) {
-	s.clientsMu.Lock()
-	defer s.clientsMu.Unlock()
+	for _, c := range s.snapshotClients() {
+		c.trySend(msg)
+	}
+}
 
-	for c := range s.clients {
-		select {
-		case c.send <- msg:
-		default:
+// broadcastLocalized sends each client a text message rendered in its own
+// language, building each language's payload once.
+func (s *Server) broadcastLocalized(build func(lang string) []byte) {
+	payloads := make(map[string][]byte)
+	for _, c := range s.snapshotClients() {
+		data, ok := payloads[c.lang]
+		if !ok {
+			data = build(c.lang)
+			payloads[c.lang] = data
 		}
+		c.trySend(wsMessage{messageType: websocket.TextMessage, data: data})
 	}
 }
 
@@ -461,35 +1355,40 @@ func (s *Server) staticHandler() http.Handler {
 		})
 	}
 
-	fileServer := http.FileServer(http.FS(webRoot))
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "" || r.URL.Path == "/" || r.URL.Path == "/index.html" {
-			data, err := fs.ReadFile(webRoot, "index.html")
-			if err != nil {
-				http.Error(w, "Index not available", http.StatusInternalServerError)
-				return
-			}
-			alias := ""
-			if strings.TrimSpace(s.alias) != "" {
-				alias = html.EscapeString(s.alias)
-			}
-			content := strings.ReplaceAll(string(data), "__ALICES_MIRROR_ALIAS__", alias)
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte(content))
-			return
-		}
-		fileServer.ServeHTTP(w, r)
-	})
+	if s.webRoot != "" {
+		return http.FileServer(http.FS(overlayFS{primary: os.DirFS(s.webRoot), fallback: webRoot}))
+	}
+	return http.FileServer(http.FS(webRoot))
+}
+
+// overlayFS serves files from primary and falls back to fallback for anything
+// primary does not have.
+type overlayFS struct {
+	primary  fs.FS
+	fallback fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	file, err := o.primary.Open(name)
+	if err == nil {
+		return file, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.fallback.Open(name)
 }
 
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	if !s.auth.Enabled {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !s.isAllowedIP(r) {
+			if !s.isAllowedIP(r) || s.accessExpired(extractRemoteIP(r), "") {
 				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
+			// No password is asked, but a viewer moved here keeps the
+			// level it had.
+			r, _ = s.handedOver(w, r)
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -500,11 +1399,30 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		user, pass, ok := r.BasicAuth()
-		if !ok || user != s.auth.User || pass != s.auth.Password {
+		ok = ok && s.auth.Check(user, pass)
+		if !ok {
+			if moved, handedOver := s.handedOver(w, r); handedOver {
+				// A viewer moved here from another mirror: it is let in
+				// without a user, whatever it claims, at no more than the
+				// level it had there.
+				moved.Header.Del("Authorization")
+				if s.accessExpired(extractRemoteIP(moved), "") {
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, moved)
+				return
+			}
+		}
+		if !ok {
 			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=\"%s\"", "alices mirror"))
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if s.accessExpired(extractRemoteIP(r), user) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -534,19 +1452,39 @@ func compileAllowIPMatchers(patterns []string) ([]*regexp.Regexp, error) {
 }
 
 func (s *Server) isAllowedIP(r *http.Request) bool {
-	remoteIP := extractRemoteIP(r)
+	return s.allowedIP(extractRemoteIP(r))
+}
+
+func (s *Server) allowedIP(remoteIP string) bool {
 	trimmed := strings.TrimSpace(remoteIP)
 	if trimmed == "" {
 		return false
 	}
-	for _, matcher := range s.allowIPs {
-		if matcher != nil && matcher.MatchString(trimmed) {
+	if s.allowsAddress(trimmed) {
+		return true
+	}
+	if s.allowDNS == nil {
+		return false
+	}
+	for _, name := range s.allowDNS.lookup(trimmed) {
+		if s.allowsAddress(name) {
 			return true
 		}
 	}
 	return false
 }
 
+// allowsAddress reports whether an allow-ip pattern, given by flag or added
+// at runtime, matches address, which is an IP or a host name.
+func (s *Server) allowsAddress(address string) bool {
+	for _, matcher := range s.allowIPs {
+		if matcher != nil && matcher.MatchString(address) {
+			return true
+		}
+	}
+	return s.accessRules.allowsIP(address)
+}
+
 func extractRemoteIP(r *http.Request) string {
 	if r == nil {
 		return ""
@@ -562,6 +1500,31 @@ func extractRemoteIP(r *http.Request) string {
 	return remoteAddr
 }
 
+// requestUserLevel resolves the user level for the Basic Auth user and
+// client IP of r, warning once per IP when no rule matches.
+func (s *Server) requestUserLevel(r *http.Request) UserLevel {
+	if isBoardRequest(r) {
+		return UserLevelWatchOnly
+	}
+	remoteIP := extractRemoteIP(r)
+	level, matched := MatchUserLevel(s.userLevelRules(), remoteIP, s.requestUser(r))
+	if !matched {
+		s.warnNoUserLevelMatch(remoteIP)
+	}
+	return stricterLevel(level, handoverLevel(r))
+}
+
+// requestUser returns the Basic Auth username of r, or "" when auth is off
+// or r came in on the board. The auth middleware has already checked the
+// password.
+func (s *Server) requestUser(r *http.Request) string {
+	if !s.auth.Enabled || isBoardRequest(r) {
+		return ""
+	}
+	user, _, _ := r.BasicAuth()
+	return user
+}
+
 func (s *Server) warnNoUserLevelMatch(remoteIP string) {
 	trimmed := strings.TrimSpace(remoteIP)
 	if trimmed == "" {
@@ -576,7 +1539,7 @@ func (s *Server) warnNoUserLevelMatch(remoteIP string) {
 	s.warnedNoUserLevelMatch[trimmed] = struct{}{}
 	s.warnedNoUserLevelMatchMu.Unlock()
 
-	fmt.Fprintf(os.Stderr, "Warning: no --user-level rule matched %q; defaulting to level 0 (interact).\n", trimmed)
+	logger().Warn("no --user-level rule matched; defaulting to level 0 (interact)", "remote", trimmed)
 }
 
 func LocalIPv4s() []string {
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// sessionStatus is the body of GET /api/session.
+type sessionStatus struct {
+	PID            int        `json:"pid,omitempty"`
+	Cwd            string     `json:"cwd,omitempty"`
+	Process        string     `json:"process,omitempty"`
+	StartedAt      time.Time  `json:"startedAt"`
+	Uptime         string     `json:"uptime"`
+	ShellStartedAt *time.Time `json:"shellStartedAt,omitempty"`
+	ShellUptime    string     `json:"shellUptime,omitempty"`
+	Respawns       int        `json:"respawns"`
+	Cols           int        `json:"cols,omitempty"`
+	Rows           int        `json:"rows,omitempty"`
+	Alive          bool       `json:"alive"`
+	LastOutputAt   *time.Time `json:"lastOutputAt,omitempty"`
+	OutputIdle     string     `json:"outputIdle,omitempty"`
+	LastInputAt    *time.Time `json:"lastInputAt,omitempty"`
+	InputIdle      string     `json:"inputIdle,omitempty"`
+}
+
+// handleSessionInfo serves GET /api/session: the shell's PID, working
+// directory and running program, how long the session and shell have been
+// up, how often the shell was respawned, the terminal size, whether the
+// PTY is open and when the shell last printed output and got input. Like /api/diag it is limited to the owner and clients at
+// user level 0.
+func (s *Server) handleSessionInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.ownerTokenMatches(r) && s.requestUserLevel(r) != UserLevelInteract {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	info := s.session.Info()
+	status := sessionStatus{
+		PID:       info.PID,
+		Cwd:       info.Cwd,
+		Process:   info.Process,
+		StartedAt: info.StartedAt,
+		Uptime:    time.Since(info.StartedAt).Round(time.Second).String(),
+		Respawns:  info.Respawns,
+		Cols:      info.Cols,
+		Rows:      info.Rows,
+		Alive:     info.Alive,
+	}
+	if !info.ShellStartedAt.IsZero() {
+		status.ShellStartedAt = &info.ShellStartedAt
+		status.ShellUptime = time.Since(info.ShellStartedAt).Round(time.Second).String()
+	}
+	if !info.LastOutputAt.IsZero() {
+		status.LastOutputAt = &info.LastOutputAt
+		status.OutputIdle = time.Since(info.LastOutputAt).Round(time.Second).String()
+	}
+	if !info.LastInputAt.IsZero() {
+		status.LastInputAt = &info.LastInputAt
+		status.InputIdle = time.Since(info.LastInputAt).Round(time.Second).String()
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"alices-mirror/internal/terminal"
+)
+
+// SlowClientPolicy decides what happens to terminal output for a client whose
+// send queue is full.
+type SlowClientPolicy string
+
+const (
+	// SlowClientDrop drops output and shows an "[output skipped]" marker
+	// once the client catches up.
+	SlowClientDrop SlowClientPolicy = "drop"
+	// SlowClientCoalesce merges the backlog into a single frame that is sent
+	// as soon as there is room.
+	SlowClientCoalesce SlowClientPolicy = "coalesce"
+	// SlowClientDisconnect closes the connection.
+	SlowClientDisconnect SlowClientPolicy = "disconnect"
+)
+
+const outputSkippedMarker = "\r\n\x1b[0;7m[output skipped]\x1b[0m\r\n"
+
+// ParseSlowClientPolicy validates a --slow-client-policy value. Empty means
+// drop.
+func ParseSlowClientPolicy(raw string) (SlowClientPolicy, error) {
+	switch policy := SlowClientPolicy(strings.ToLower(strings.TrimSpace(raw))); policy {
+	case "":
+		return SlowClientDrop, nil
+	case SlowClientDrop, SlowClientCoalesce, SlowClientDisconnect:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid slow client policy %q (expected drop, coalesce or disconnect)", raw)
+	}
+}
+
+// deliverBestEffortLocked sends output to a client without flow control,
+// applying policy when its queue is full. The caller holds c.flowMu.
+func (c *client) deliverBestEffortLocked(chunk terminal.OutputChunk, policy SlowClientPolicy) {
+	out := wsMessage{messageType: websocket.BinaryMessage, data: chunk.Data, chunk: chunk}
+	switch {
+	case len(c.flow.overflow) > 0:
+		out = wsMessage{messageType: websocket.BinaryMessage, data: append(c.flow.overflow, chunk.Data...)}
+	case c.flow.skipped:
+		out = wsMessage{messageType: websocket.BinaryMessage, data: append([]byte(outputSkippedMarker), chunk.Data...)}
+	}
+	msg := out.data
+
+	out.chunk.Retain()
+	select {
+	case c.send <- out:
+		c.flow.sent += int64(len(msg))
+		c.flow.queuedBytes += len(msg)
+		c.flow.overflow = nil
+		c.flow.skipped = false
+		return
+	default:
+		out.chunk.Release()
+	}
+
+	switch policy {
+	case SlowClientCoalesce:
+		if len(msg) <= maxPendingOutput {
+			if len(c.flow.overflow) == 0 {
+				msg = append([]byte(nil), msg...)
+			}
+			c.flow.overflow = msg
+			return
+		}
+		c.flow.overflow = nil
+		c.flow.skipped = true
+	case SlowClientDisconnect:
+		c.disconnect()
+	default:
+		c.flow.skipped = true
+	}
+	c.flow.dropped++
+}
+
+// drainBacklog is called by a client's writer after each message so that a
+// coalesced frame, a skipped-output marker or flow-controlled output does
+// not wait for the next chunk of terminal output.
+func (c *client) drainBacklog() {
+	c.flowMu.Lock()
+	defer c.flowMu.Unlock()
+
+	var msg []byte
+	switch {
+	case len(c.flow.overflow) > 0:
+		msg = c.flow.overflow
+	case c.flow.skipped:
+		msg = []byte(outputSkippedMarker)
+	}
+	if msg != nil {
+		select {
+		case c.send <- wsMessage{messageType: websocket.BinaryMessage, data: msg}:
+			c.flow.sent += int64(len(msg))
+			c.flow.queuedBytes += len(msg)
+			c.flow.overflow = nil
+			c.flow.skipped = false
+		default:
+		}
+	}
+	if c.flow.enabled {
+		c.flushOutputLocked()
+	}
+}
+
+// disconnect drops a client from the server side.
+func (c *client) disconnect() {
+	c.kickOnce.Do(func() {
+		close(c.kick)
+		if c.conn != nil {
+			_ = c.conn.Close()
+		}
+	})
+}
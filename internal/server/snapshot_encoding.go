@@ -0,0 +1,40 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+)
+
+// SnapshotEncodingGzip is the snapshot encoding clients can ask for with
+// snapshotEncoding=gzip on /ws. Terminal history tends to shrink ten times
+// or more, which makes joining over a slow link much quicker.
+const SnapshotEncodingGzip = "gzip"
+
+// parseSnapshotEncoding picks the encoding for the scrollback snapshot from
+// the comma-separated list a client accepts. Empty means uncompressed.
+func parseSnapshotEncoding(raw string) string {
+	for _, encoding := range strings.Split(raw, ",") {
+		if strings.EqualFold(strings.TrimSpace(encoding), SnapshotEncodingGzip) {
+			return SnapshotEncodingGzip
+		}
+	}
+	return ""
+}
+
+// compressSnapshot gzips snapshot. It reports false when that does not make
+// it smaller, in which case the snapshot is better sent as is.
+func compressSnapshot(snapshot []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(snapshot); err != nil {
+		return nil, false
+	}
+	if err := zw.Close(); err != nil {
+		return nil, false
+	}
+	if buf.Len() >= len(snapshot) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestCompressSnapshot(t *testing.T) {
+	t.Parallel()
+
+	if got := parseSnapshotEncoding("br, GZIP"); got != SnapshotEncodingGzip {
+		t.Fatalf("parseSnapshotEncoding = %q, want gzip", got)
+	}
+	if got := parseSnapshotEncoding("zstd"); got != "" {
+		t.Fatalf("parseSnapshotEncoding(zstd) = %q, want none", got)
+	}
+
+	snapshot := bytes.Repeat([]byte("\x1b[32muser@host\x1b[0m:~$ ls -la\r\n"), 500)
+	compressed, ok := compressSnapshot(snapshot)
+	if !ok || len(compressed)*10 > len(snapshot) {
+		t.Fatalf("compressSnapshot: ok=%v, %d -> %d bytes", ok, len(snapshot), len(compressed))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil || !bytes.Equal(decoded, snapshot) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+
+	if _, ok := compressSnapshot([]byte("x")); ok {
+		t.Fatal("compressing a tiny snapshot should not pay off")
+	}
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"alices-mirror/internal/protocol"
+)
+
+const (
+	maxSnippetName    = 64
+	maxSnippetCommand = 4 << 10
+	maxSnippetsBody   = 8 << 10
+)
+
+// Snippet is a predefined command clients can run with one click.
+type Snippet = protocol.Snippet
+
+// Snippets holds the snippets clients may run. Changes the owner makes
+// through /api/snippets are written back to the file they came from.
+type Snippets struct {
+	path string
+
+	mu   sync.Mutex
+	list []Snippet
+}
+
+// LoadSnippets reads a JSON array of snippets from path. A missing file has
+// no snippets; an empty path keeps them in memory only.
+func LoadSnippets(path string) (*Snippets, error) {
+	s := &Snippets{path: path}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Snippet
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	for i, snippet := range list {
+		if err := validateSnippet(snippet); err != nil {
+			return nil, fmt.Errorf("snippet %d: %v", i+1, err)
+		}
+		if slices.ContainsFunc(list[:i], func(other Snippet) bool { return other.Name == snippet.Name }) {
+			return nil, fmt.Errorf("duplicate snippet %q", snippet.Name)
+		}
+	}
+	s.list = list
+	return s, nil
+}
+
+func validateSnippet(sn Snippet) error {
+	switch {
+	case strings.TrimSpace(sn.Name) == "":
+		return errors.New("name is required")
+	case len(sn.Name) > maxSnippetName:
+		return fmt.Errorf("name is longer than %d bytes", maxSnippetName)
+	case strings.IndexFunc(sn.Name, unicode.IsControl) >= 0:
+		return errors.New("name contains control characters")
+	case strings.TrimSpace(sn.Command) == "":
+		return errors.New("command is required")
+	case len(sn.Command) > maxSnippetCommand:
+		return fmt.Errorf("command is longer than %d bytes", maxSnippetCommand)
+	}
+	return nil
+}
+
+func (s *Snippets) all() []Snippet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.list)
+}
+
+func (s *Snippets) get(name string) (Snippet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.list, func(sn Snippet) bool { return sn.Name == name })
+	if i < 0 {
+		return Snippet{}, false
+	}
+	return s.list[i], true
+}
+
+// set adds snippet, or replaces the one with the same name in place.
+func (s *Snippets) set(snippet Snippet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := slices.IndexFunc(s.list, func(sn Snippet) bool { return sn.Name == snippet.Name }); i >= 0 {
+		s.list[i] = snippet
+	} else {
+		s.list = append(s.list, snippet)
+	}
+	return s.saveLocked()
+}
+
+// remove deletes the snippet called name and reports whether there was one.
+func (s *Snippets) remove(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.list, func(sn Snippet) bool { return sn.Name == name })
+	if i < 0 {
+		return false, nil
+	}
+	s.list = slices.Delete(s.list, i, i+1)
+	return true, s.saveLocked()
+}
+
+func (s *Snippets) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// runSnippet types the snippet called name into the shell for c. For
+// clients other than the owner, each line must pass the command filter.
+func (s *Server) runSnippet(c *client, name string) {
+	snippet, ok := s.snippets.get(name)
+	if !ok {
+		s.sendStatus(c, translate(c.lang, "snippet.unknown", name))
+		return
+	}
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(snippet.Command, "\r\n", "\n"), "\n"), "\n")
+	if s.commandFilter != nil && !c.isOwner {
+		for _, line := range lines {
+			if command, ok := s.commandFilter.Check(line); !ok {
+				s.recordEvent(EventRefused, c.remoteIP, "snippet %s refused: %s", name, command)
+				s.sendStatus(c, translate(c.lang, "command.refused", command))
+				return
+			}
+		}
+	}
+	data := []byte(strings.Join(lines, "\r") + "\r")
+	s.recordEvent(EventStatus, c.remoteIP, "snippet %s run", name)
+	s.inputLog.record(c, data)
+	_ = s.session.WriteInput(data)
+}
+
+// handleSnippets lists the snippets for the owner and level 0 clients.
+// With the owner token, POST adds or replaces the snippet in the body and
+// DELETE removes the one named in {"name": "..."}.
+func (s *Server) handleSnippets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !s.ownerTokenMatches(r) && s.requestUserLevel(r) != UserLevelInteract {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(s.snippetList())
+		return
+	case http.MethodPost, http.MethodDelete:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST, DELETE")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.ownerTokenMatches(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body Snippet
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSnippetsBody)).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+
+	var err error
+	if r.Method == http.MethodPost {
+		if err := validateSnippet(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = s.snippets.set(body)
+	} else {
+		var removed bool
+		removed, err = s.snippets.remove(body.Name)
+		if !removed {
+			http.Error(w, "No such snippet", http.StatusNotFound)
+			return
+		}
+	}
+	if err != nil {
+		logger().Warn("failed to save snippets", "error", err)
+	}
+
+	payload := protocol.Encode(protocol.Snippets{Snippets: s.snippetList()})
+	s.notifyAdmins(nil, func(string) []byte { return payload })
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// snippetList returns the snippets, never nil so it encodes as [].
+func (s *Server) snippetList() []Snippet {
+	list := s.snippets.all()
+	if list == nil {
+		list = []Snippet{}
+	}
+	return list
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnippetsPersist(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "snippets.json")
+	if err := os.WriteFile(path, []byte(`[{"name":"tests","command":"go test ./..."}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	snippets, err := LoadSnippets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snippets.set(Snippet{Name: "logs", Command: "tail -f app.log"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := snippets.set(Snippet{Name: "tests", Command: "go test -race ./..."}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadSnippets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := reloaded.all()
+	if len(all) != 2 || all[0].Command != "go test -race ./..." || all[1].Name != "logs" {
+		t.Fatalf("snippets after reload = %+v", all)
+	}
+	if removed, err := reloaded.remove("logs"); !removed || err != nil {
+		t.Fatalf("remove = %v, %v", removed, err)
+	}
+
+	for _, bad := range []string{`[{"name":"","command":"ls"}]`, `[{"name":"a","command":" "}]`, `[{"name":"a","command":"ls"},{"name":"a","command":"pwd"}]`} {
+		if err := os.WriteFile(path, []byte(bad), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadSnippets(path); err == nil {
+			t.Errorf("LoadSnippets(%s) succeeded", bad)
+		}
+	}
+}
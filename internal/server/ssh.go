@@ -0,0 +1,269 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH viewers attach to the same session as browser clients. They get raw
+// terminal output, and their keystrokes are forwarded only at user level 0;
+// control messages meant for the web client are not sent to them.
+const sshHandshakeTimeout = 10 * time.Second
+
+// LoadSSHHostKey reads the PEM-encoded host key at path, creating a new
+// ed25519 key there if the file does not exist.
+func LoadSSHHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = createSSHHostKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM-encoded key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+func createSSHHostKey(path string) ([]byte, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *Server) sshConfig() *ssh.ServerConfig {
+	cfg := &ssh.ServerConfig{ServerVersion: "SSH-2.0-alices-mirror"}
+	if s.auth.Enabled {
+		cfg.PasswordCallback = func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if s.auth.Check(meta.User(), string(password)) {
+				return nil, nil
+			}
+			return nil, errors.New("invalid credentials")
+		}
+	} else {
+		cfg.NoClientAuth = true
+	}
+	cfg.AddHostKey(s.sshHostKey)
+	return cfg
+}
+
+func (s *Server) serveSSH(listener net.Listener, cfg *ssh.ServerConfig) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleSSHConn(conn, cfg)
+	}
+}
+
+func (s *Server) handleSSHConn(conn net.Conn, cfg *ssh.ServerConfig) {
+	remoteIP := hostOfAddr(conn.RemoteAddr().String())
+	if !s.allowedIP(remoteIP) {
+		_ = conn.Close()
+		return
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(sshHandshakeTimeout))
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	defer sshConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	// Without auth the SSH username is whatever the client chose, so only
+	// IP rules apply.
+	user := ""
+	if s.auth.Enabled {
+		user = sshConn.User()
+	}
+	if s.accessExpired(remoteIP, user) {
+		return
+	}
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSSHSession(channel, channelRequests, remoteIP, user)
+	}
+}
+
+// handleSSHSession waits for the shell request and then attaches the channel
+// to the session. Commands and subsystems are refused; there is only the one
+// shared shell.
+func (s *Server) handleSSHSession(channel ssh.Channel, requests <-chan *ssh.Request, remoteIP, user string) {
+	defer channel.Close()
+
+	level, matched := MatchUserLevel(s.userLevelRules(), remoteIP, user)
+	if !matched {
+		s.warnNoUserLevelMatch(remoteIP)
+	}
+	c := &client{
+		send:      make(chan wsMessage, 128),
+		kick:      make(chan struct{}),
+		remoteIP:  remoteIP,
+		user:      user,
+		lang:      negotiateLanguage(""),
+		transport: "ssh",
+
+		snapshotLimit: -1,
+	}
+	c.setLevel(level)
+
+	var cols, rows int
+	started := false
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			cols, rows = parsePtyRequest(req.Payload)
+			_ = req.Reply(true, nil)
+		case "window-change":
+			if len(req.Payload) >= 8 {
+				cols = int(binary.BigEndian.Uint32(req.Payload[0:4]))
+				rows = int(binary.BigEndian.Uint32(req.Payload[4:8]))
+			}
+			if !started {
+				continue
+			}
+			if s.resizeAllowed(c) {
+				_ = s.session.Resize(cols, rows)
+			} else {
+				s.denyResize(c)
+			}
+		case "shell":
+			if started || !s.AcceptingClients() {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			started = true
+			if s.resizeAllowed(c) && cols > 0 && rows > 0 {
+				_ = s.session.Resize(cols, rows)
+			}
+			go func() {
+				s.attachSSH(channel, c)
+				_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				_ = channel.Close()
+			}()
+		case "env":
+			_ = req.Reply(true, nil)
+		default:
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// attachSSH streams the session to channel until either side goes away.
+func (s *Server) attachSSH(channel ssh.Channel, c *client) {
+	c.joinedAt = time.Now()
+	s.addClient(c)
+	defer func() {
+		c.disconnect()
+		s.removeClient(c)
+	}()
+	go s.greetClient(c)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := channel.Read(buf)
+			if n > 0 {
+				s.handleClientMessage(c, websocket.BinaryMessage, append([]byte(nil), buf[:n]...))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-c.kick:
+			return
+		case <-s.session.Done():
+			return
+		case msg := <-c.send:
+			c.written(len(msg.data))
+			var err error
+			if msg.messageType == websocket.BinaryMessage {
+				_, err = channel.Write(msg.data)
+			}
+			msg.chunk.Release()
+			if err != nil {
+				return
+			}
+			c.drainBacklog()
+			s.resumeIfCaughtUp(c)
+		}
+	}
+}
+
+// parsePtyRequest extracts the terminal size from a pty-req payload.
+func parsePtyRequest(payload []byte) (int, int) {
+	var req struct {
+		Term     string
+		Cols     uint32
+		Rows     uint32
+		Width    uint32
+		Height   uint32
+		Modelist string
+	}
+	if err := ssh.Unmarshal(payload, &req); err != nil {
+		return 0, 0
+	}
+	return int(req.Cols), int(req.Rows)
+}
+
+func hostOfAddr(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSpace(addr)
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"time"
+
+	"alices-mirror/internal/telemetry"
+)
+
+// serverMetrics are the counters exported through Config.Telemetry. Their
+// methods do nothing when telemetry is off.
+type serverMetrics struct {
+	connections *telemetry.Counter
+	outputBytes *telemetry.Counter
+	refused     *telemetry.Counter
+}
+
+func (s *Server) registerMetrics() {
+	s.metrics.connections = s.telemetry.Counter("alices_mirror.client.connections", "Client sessions started, over any transport.", "{connection}")
+	s.metrics.outputBytes = s.telemetry.Counter("alices_mirror.output.bytes", "Terminal output broadcast to clients.", "By")
+	s.metrics.refused = s.telemetry.Counter("alices_mirror.client.refused", "Requests refused for exceeding the per-address connection limit.", "{request}")
+	s.telemetry.Gauge("alices_mirror.clients", "Connected clients.", "{client}", func() int64 {
+		return int64(len(s.snapshotClients()))
+	})
+}
+
+func (s *Server) startClientSpan(c *client) {
+	s.metrics.connections.Add(1)
+	c.span = s.telemetry.StartSpan("client session", telemetry.KindServer)
+	c.span.SetAttr("client.address", c.remoteIP)
+	c.span.SetAttr("alices_mirror.transport", c.transport)
+	c.span.SetAttr("alices_mirror.user_level", int(c.level()))
+	c.span.SetAttr("alices_mirror.owner", c.isOwner)
+}
+
+func (s *Server) endClientSpan(c *client) {
+	if !c.joinedAt.IsZero() {
+		c.span.SetAttr("alices_mirror.duration_ms", time.Since(c.joinedAt).Milliseconds())
+	}
+	c.span.End()
+}
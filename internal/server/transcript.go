@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"alices-mirror/internal/transcript"
+)
+
+// handleTranscript renders the session's scrollback buffer as plain text
+// (the default) or as HTML with ?format=html. ?download=1 asks the browser
+// to save the file instead of displaying it.
+func (s *Server) handleTranscript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.historyAllowed(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	data := s.session.Snapshot()
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+
+	var body, filename string
+	switch format {
+	case "", "text", "txt":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		body = transcript.Text(data)
+		filename = "transcript.txt"
+	case "html":
+		title := s.Alias()
+		if title == "" {
+			title = "alices mirror"
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		body = transcript.HTML(data, title+" transcript")
+		filename = "transcript.html"
+	default:
+		http.Error(w, "Unsupported format (expected text or html)", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if r.URL.Query().Get("download") == "1" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	_, _ = w.Write([]byte(body))
+}
+
+// historyAllowed reports whether r may read the scrollback through the
+// transcript or search. With noSnapshot only the owner may.
+func (s *Server) historyAllowed(r *http.Request) bool {
+	return !s.noSnapshot || s.ownerTokenMatches(r)
+}
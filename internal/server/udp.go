@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"alices-mirror/internal/datagram"
+)
+
+// The UDP transport is for terminal clients on lossy links. A client POSTs
+// to /api/udp with the usual credentials and gets a session ID and key; it
+// then talks to the UDP port directly, and the session survives changes of
+// the client's address. Messages use the datagram framing, with the same
+// text and binary kinds as the WebSocket.
+const udpAttachTimeout = 10 * time.Second
+
+type udpSessionResponse struct {
+	Port int    `json:"port"`
+	ID   string `json:"id"`
+	Key  string `json:"key"`
+}
+
+func (s *Server) listenAllUDP(addrs []string) ([]net.PacketConn, error) {
+	conns := make([]net.PacketConn, 0, len(addrs))
+	for _, addr := range addrs {
+		pc, err := s.listenPacket(addr)
+		if err != nil {
+			for _, conn := range conns {
+				_ = conn.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, pc)
+	}
+	return conns, nil
+}
+
+func (s *Server) handleUDPSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.AcceptingClients() {
+		http.Error(w, translate(requestLanguage(r), "sharing.paused"), http.StatusServiceUnavailable)
+		return
+	}
+	snapshotLimit, err := parseSnapshotLimit(r.URL.Query().Get("snapshot"))
+	if err != nil {
+		http.Error(w, "Invalid snapshot parameter", http.StatusBadRequest)
+		return
+	}
+
+	conn, id, key, err := s.udp.NewSession()
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	c := &client{
+		send:      make(chan wsMessage, 128),
+		kick:      make(chan struct{}),
+		remoteIP:  extractRemoteIP(r),
+		user:      s.requestUser(r),
+		lang:      requestLanguage(r),
+		transport: "udp",
+		joinedAt:  time.Now(),
+		levelCap:  handoverLevel(r),
+
+		snapshotLimit: snapshotLimit,
+	}
+	c.setLevel(s.requestUserLevel(r))
+	go s.attachUDP(conn, c)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(udpSessionResponse{
+		Port: s.udpPort,
+		ID:   hex.EncodeToString(id[:]),
+		Key:  base64.StdEncoding.EncodeToString(key),
+	})
+}
+
+// attachUDP waits for the client's first packet and then streams the
+// session to it until either side goes away.
+func (s *Server) attachUDP(conn *datagram.Conn, c *client) {
+	defer conn.Close()
+	select {
+	case <-conn.Established():
+	case <-time.After(udpAttachTimeout):
+		return
+	}
+
+	s.addClient(c)
+	defer func() {
+		c.disconnect()
+		s.removeClient(c)
+	}()
+	go s.greetClient(c)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		reader := datagram.NewMessageReader(conn)
+		for {
+			kind, payload, err := reader.ReadMessage()
+			if err != nil {
+				return
+			}
+			s.handleClientMessage(c, kind, payload)
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-c.kick:
+			return
+		case <-s.session.Done():
+			return
+		case msg := <-c.send:
+			c.written(len(msg.data))
+			err := datagram.WriteMessage(conn, msg.messageType, msg.data)
+			msg.chunk.Release()
+			if err != nil {
+				return
+			}
+			c.drainBacklog()
+			s.resumeIfCaughtUp(c)
+		}
+	}
+}
+
+func udpPortOf(pc net.PacketConn) int {
+	_, port, _ := net.SplitHostPort(pc.LocalAddr().String())
+	n, _ := strconv.Atoi(port)
+	return n
+}
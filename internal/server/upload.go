@@ -31,37 +31,29 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	remoteIP := extractRemoteIP(r)
-	uploadAllowed := true
-	if strings.TrimSpace(remoteIP) != "" {
-		level, matched := MatchUserLevel(s.userLevels, remoteIP)
-		if matched {
-			uploadAllowed = level == UserLevelInteract
-		} else {
-			s.warnNoUserLevelMatch(remoteIP)
-		}
-	}
-	if !uploadAllowed {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	lang := requestLanguage(r)
+	if s.requestUserLevel(r) != UserLevelInteract {
+		http.Error(w, translate(lang, "upload.forbidden"), http.StatusForbidden)
 		return
 	}
 
 	targetDir, err := s.session.CurrentDirectory()
 	if err != nil {
-		http.Error(w, "Shell directory not available", http.StatusServiceUnavailable)
+		http.Error(w, translate(lang, "upload.noDirectory"), http.StatusServiceUnavailable)
 		return
 	}
 	if info, statErr := os.Stat(targetDir); statErr != nil || !info.IsDir() {
-		http.Error(w, "Shell directory not available", http.StatusServiceUnavailable)
+		http.Error(w, translate(lang, "upload.noDirectory"), http.StatusServiceUnavailable)
 		return
 	}
 
 	reader, err := r.MultipartReader()
 	if err != nil {
-		http.Error(w, "Invalid multipart upload", http.StatusBadRequest)
+		http.Error(w, translate(lang, "upload.invalid"), http.StatusBadRequest)
 		return
 	}
 
-	fmt.Fprintf(os.Stderr, "Upload: receiving files from %s into %s\n", safeLogValue(remoteIP), targetDir)
+	logger().Info("upload started", "remote", safeLogValue(remoteIP), "dir", targetDir)
 
 	var saved []uploadSavedFile
 	var totalBytes int64
@@ -71,7 +63,7 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 		if err != nil {
-			http.Error(w, "Upload failed", http.StatusBadRequest)
+			http.Error(w, translate(lang, "upload.failed"), http.StatusBadRequest)
 			return
 		}
 		if part == nil {
@@ -92,7 +84,7 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		finalName, file, err := createUniqueFile(targetDir, safeName)
 		if err != nil {
 			_ = part.Close()
-			http.Error(w, "Failed to create upload file", http.StatusInternalServerError)
+			http.Error(w, translate(lang, "upload.createFailed"), http.StatusInternalServerError)
 			return
 		}
 
@@ -101,7 +93,7 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		_ = part.Close()
 		if copyErr != nil || closeErr != nil {
 			_ = os.Remove(filepath.Join(targetDir, finalName))
-			http.Error(w, "Upload failed", http.StatusInternalServerError)
+			http.Error(w, translate(lang, "upload.failed"), http.StatusInternalServerError)
 			return
 		}
 
@@ -112,15 +104,16 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		})
 		totalBytes += n
 
-		fmt.Fprintf(os.Stderr, "Upload: saved %s (%d bytes)\n", finalName, n)
+		logger().Info("upload saved", "file", finalName, "bytes", n)
 	}
 
 	if len(saved) == 0 {
-		http.Error(w, "No files received", http.StatusBadRequest)
+		http.Error(w, translate(lang, "upload.noFiles"), http.StatusBadRequest)
 		return
 	}
 
-	fmt.Fprintf(os.Stderr, "Upload: complete (%d file(s), %d bytes)\n", len(saved), totalBytes)
+	logger().Info("upload complete", "files", len(saved), "bytes", totalBytes)
+	s.recordEvent(EventUpload, remoteIP, "%d file(s), %d bytes uploaded to %s", len(saved), totalBytes, targetDir)
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_ = json.NewEncoder(w).Encode(uploadResponse{
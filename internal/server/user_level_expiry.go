@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// expireUserLevels applies each time-boxed user-level rule to the connected
+// clients as soon as it expires.
+func (s *Server) expireUserLevels(ctx context.Context) {
+	for {
+		var next time.Time
+		now := time.Now()
+		for _, rule := range s.userLevelRules() {
+			if rule.expires.After(now) && (next.IsZero() || rule.expires.Before(next)) {
+				next = rule.expires
+			}
+		}
+		wait := time.Duration(math.MaxInt64)
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.session.Done():
+			timer.Stop()
+			return
+		case <-s.rulesChangedCh:
+			timer.Stop()
+		case <-timer.C:
+			s.applyUserLevels("access.expired")
+		}
+	}
+}
+
+// rulesChanged applies changed access rules to the connected clients.
+func (s *Server) rulesChanged() {
+	s.applyUserLevels("access.changed")
+	select {
+	case s.rulesChangedCh <- struct{}{}:
+	default:
+	}
+}
+
+// applyUserLevels moves every connected client other than the owner to the
+// level its rule grants now, and disconnects those no longer admitted. The
+// clients that were moved are shown the message statusKey.
+func (s *Server) applyUserLevels(statusKey string) {
+	now := time.Now()
+	rules := s.userLevelRules()
+	for _, c := range s.snapshotClients() {
+		if c.isOwner {
+			continue
+		}
+		if !s.allowedIP(c.remoteIP) {
+			s.recordEvent(EventAccess, c.remoteIP, "address no longer allowed, %s client disconnected", c.transport)
+			c.disconnect()
+			continue
+		}
+		if c.transport == "board" {
+			// The board stays watch-only whatever the rules say.
+			continue
+		}
+		level := UserLevelInteract
+		if rule, ok := matchUserLevelRule(rules, c.remoteIP, c.user); ok {
+			var allowed bool
+			level, allowed = rule.levelAt(now)
+			if !allowed {
+				s.recordEvent(EventAccess, c.remoteIP, "access under rule %s expired, %s client disconnected", rule, c.transport)
+				c.disconnect()
+				continue
+			}
+		}
+		level = stricterLevel(level, c.levelCap)
+		previous := c.level()
+		if level == previous {
+			continue
+		}
+		c.setLevel(level)
+		if previous == UserLevelApproval {
+			s.dropApprovals(c)
+		}
+		s.recordEvent(EventAccess, c.remoteIP, "%s client moved from user level %d to %d", c.transport, previous, level)
+		c.trySend(wsMessage{messageType: websocket.TextMessage, data: s.helloPayload(c, 0)})
+		s.sendStatus(c, translate(c.lang, statusKey))
+	}
+}
+
+// accessExpired reports whether the rule for remoteIP and user has expired
+// and no longer admits them.
+func (s *Server) accessExpired(remoteIP, user string) bool {
+	rule, ok := matchUserLevelRule(s.userLevelRules(), remoteIP, user)
+	if !ok {
+		return false
+	}
+	_, allowed := rule.levelAt(time.Now())
+	return !allowed
+}
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type UserLevel int
@@ -12,13 +13,45 @@ type UserLevel int
 const (
 	UserLevelInteract  UserLevel = 0
 	UserLevelWatchOnly UserLevel = 1
+	// UserLevelApproval clients may type, but their input only reaches the
+	// shell once the owner or a level 0 client approves it.
+	UserLevelApproval UserLevel = 2
 )
 
+// stricterLevel returns whichever of a and b allows less: watch-only, then
+// approval, then interact.
+func stricterLevel(a, b UserLevel) UserLevel {
+	rank := func(level UserLevel) int {
+		switch level {
+		case UserLevelInteract:
+			return 0
+		case UserLevelApproval:
+			return 1
+		}
+		return 2
+	}
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
+
+// userRulePrefix marks a rule that matches the Basic Auth username rather
+// than the client IP, as in user:alice-0.
+const userRulePrefix = "user:"
+
 type UserLevelRule struct {
 	Pattern string
 	Level   UserLevel
 
+	// Duration, when non-zero, is how long the rule grants Level after the
+	// server starts. Afterwards it grants watch-only access, or none at all
+	// when Disconnect is set, and connected clients are moved along.
+	Duration   time.Duration
+	Disconnect bool
+
 	matcher *regexp.Regexp
+	expires time.Time
 }
 
 func ParseUserLevelRules(raw string) ([]UserLevelRule, error) {
@@ -37,32 +70,42 @@ func ParseUserLevelRules(raw string) ([]UserLevelRule, error) {
 
 		sep := strings.LastIndex(item, "-")
 		if sep <= 0 || sep >= len(item)-1 {
-			return nil, fmt.Errorf("invalid rule %q (expected <pattern>-<level>)", item)
+			return nil, fmt.Errorf("invalid rule %q (expected <pattern>-<level>[@<duration>])", item)
 		}
 
 		pattern := strings.TrimSpace(item[:sep])
-		levelText := strings.TrimSpace(item[sep+1:])
+		levelText, window, timed := strings.Cut(strings.TrimSpace(item[sep+1:]), "@")
 		if pattern == "" || levelText == "" {
-			return nil, fmt.Errorf("invalid rule %q (expected <pattern>-<level>)", item)
+			return nil, fmt.Errorf("invalid rule %q (expected <pattern>-<level>[@<duration>])", item)
 		}
 
-		levelValue, err := strconv.Atoi(levelText)
-		if err != nil {
-			return nil, fmt.Errorf("invalid level %q in rule %q (expected 0 or 1)", levelText, item)
+		var duration time.Duration
+		disconnect := false
+		if timed {
+			window, disconnect = strings.CutSuffix(window, "!")
+			parsed, err := time.ParseDuration(window)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid duration %q in rule %q (expected a duration such as 2h or 30m)", window, item)
+			}
+			duration = parsed
 		}
-		if levelValue != 0 && levelValue != 1 {
-			return nil, fmt.Errorf("invalid level %q in rule %q (expected 0 or 1)", levelText, item)
+
+		levelValue, err := strconv.Atoi(levelText)
+		if err != nil || levelValue < 0 || levelValue > 2 {
+			return nil, fmt.Errorf("invalid level %q in rule %q (expected 0, 1 or 2)", levelText, item)
 		}
 
-		matcher, err := compileUserLevelPattern(pattern)
+		matcher, err := compileUserLevelPattern(strings.TrimPrefix(pattern, userRulePrefix))
 		if err != nil {
 			return nil, fmt.Errorf("invalid pattern %q in rule %q: %v", pattern, item, err)
 		}
 
 		rules = append(rules, UserLevelRule{
-			Pattern: pattern,
-			Level:   UserLevel(levelValue),
-			matcher: matcher,
+			Pattern:    pattern,
+			Level:      UserLevel(levelValue),
+			Duration:   duration,
+			Disconnect: disconnect,
+			matcher:    matcher,
 		})
 	}
 
@@ -73,13 +116,65 @@ func ParseUserLevelRules(raw string) ([]UserLevelRule, error) {
 	return rules, nil
 }
 
-func MatchUserLevel(rules []UserLevelRule, ip string) (UserLevel, bool) {
+// MatchUserLevel returns the level of the first rule matching user, the
+// Basic Auth username (empty without auth), or else of the first rule
+// matching ip. User rules take precedence since clients behind one NAT or
+// proxy share an IP.
+func MatchUserLevel(rules []UserLevelRule, ip, user string) (UserLevel, bool) {
+	rule, ok := matchUserLevelRule(rules, ip, user)
+	if !ok {
+		return UserLevelInteract, false
+	}
+	level, _ := rule.levelAt(time.Now())
+	return level, true
+}
+
+func matchUserLevelRule(rules []UserLevelRule, ip, user string) (UserLevelRule, bool) {
+	if user != "" {
+		for _, rule := range rules {
+			if rule.forUser() && rule.matcher != nil && rule.matcher.MatchString(user) {
+				return rule, true
+			}
+		}
+	}
 	for _, rule := range rules {
-		if rule.matcher != nil && rule.matcher.MatchString(ip) {
-			return rule.Level, true
+		if !rule.forUser() && rule.matcher != nil && rule.matcher.MatchString(ip) {
+			return rule, true
 		}
 	}
-	return UserLevelInteract, false
+	return UserLevelRule{}, false
+}
+
+func (r UserLevelRule) forUser() bool {
+	return strings.HasPrefix(r.Pattern, userRulePrefix)
+}
+
+// String formats the rule the way ParseUserLevelRules reads it.
+func (r UserLevelRule) String() string {
+	text := fmt.Sprintf("%s-%d", r.Pattern, r.Level)
+	if r.Duration > 0 {
+		window := r.Duration.String()
+		if strings.HasSuffix(window, "m0s") {
+			window = strings.TrimSuffix(window, "0s")
+		}
+		if strings.HasSuffix(window, "h0m") {
+			window = strings.TrimSuffix(window, "0m")
+		}
+		text += "@" + window
+		if r.Disconnect {
+			text += "!"
+		}
+	}
+	return text
+}
+
+// levelAt returns the level the rule grants at now, and false once a rule
+// with Disconnect set has expired and grants no access.
+func (r UserLevelRule) levelAt(now time.Time) (UserLevel, bool) {
+	if r.expires.IsZero() || now.Before(r.expires) {
+		return r.Level, true
+	}
+	return UserLevelWatchOnly, !r.Disconnect
 }
 
 func compileUserLevelPattern(pattern string) (*regexp.Regexp, error) {
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseUserLevelRulesDuration(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseUserLevelRules("192.168.1.*-0@2h,10.*-2@30m!,*-1")
+	if err != nil {
+		t.Fatalf("ParseUserLevelRules: %v", err)
+	}
+	want := []UserLevelRule{
+		{Pattern: "192.168.1.*", Level: UserLevelInteract, Duration: 2 * time.Hour},
+		{Pattern: "10.*", Level: UserLevelApproval, Duration: 30 * time.Minute, Disconnect: true},
+		{Pattern: "*", Level: UserLevelWatchOnly},
+	}
+	for i, rule := range rules {
+		if rule.Pattern != want[i].Pattern || rule.Level != want[i].Level || rule.Duration != want[i].Duration || rule.Disconnect != want[i].Disconnect {
+			t.Errorf("rule %d = %+v, want %+v", i, rule, want[i])
+		}
+	}
+
+	for _, raw := range []string{"*-0@", "*-0@soon", "*-0@-1h", "*-0@0s"} {
+		if _, err := ParseUserLevelRules(raw); err == nil {
+			t.Errorf("ParseUserLevelRules(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestUserLevelRuleLevelAt(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	cases := []struct {
+		rule        UserLevelRule
+		wantLevel   UserLevel
+		wantAllowed bool
+	}{
+		{rule: UserLevelRule{Level: UserLevelInteract}, wantLevel: UserLevelInteract, wantAllowed: true},
+		{rule: UserLevelRule{Level: UserLevelInteract, expires: now.Add(time.Minute)}, wantLevel: UserLevelInteract, wantAllowed: true},
+		{rule: UserLevelRule{Level: UserLevelInteract, expires: now}, wantLevel: UserLevelWatchOnly, wantAllowed: true},
+		{rule: UserLevelRule{Level: UserLevelApproval, expires: now, Disconnect: true}, wantLevel: UserLevelWatchOnly, wantAllowed: false},
+	}
+	for i, tc := range cases {
+		level, allowed := tc.rule.levelAt(now)
+		if level != tc.wantLevel || allowed != tc.wantAllowed {
+			t.Errorf("case %d: levelAt = %d, %v, want %d, %v", i, level, allowed, tc.wantLevel, tc.wantAllowed)
+		}
+	}
+}
+
+func TestMatchUserLevelPrefersUserRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseUserLevelRules("10.0.0.1-1,user:alice-0,user:*-2")
+	if err != nil {
+		t.Fatalf("ParseUserLevelRules: %v", err)
+	}
+	cases := []struct {
+		ip, user string
+		want     UserLevel
+	}{
+		{ip: "10.0.0.1", user: "alice", want: UserLevelInteract},
+		{ip: "10.0.0.1", user: "bob", want: UserLevelApproval},
+		{ip: "10.0.0.1", user: "", want: UserLevelWatchOnly},
+	}
+	for _, tc := range cases {
+		if got, _ := MatchUserLevel(rules, tc.ip, tc.user); got != tc.want {
+			t.Errorf("MatchUserLevel(%q, %q) = %d, want %d", tc.ip, tc.user, got, tc.want)
+		}
+	}
+	if _, matched := MatchUserLevel(rules, "10.0.0.2", ""); matched {
+		t.Errorf("user rules matched a request without a user")
+	}
+}
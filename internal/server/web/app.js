@@ -4,6 +4,8 @@
   const keybar = document.getElementById('keybar');
   const mdToggle = document.querySelector('[data-key="md-toggle"]');
   const mdSubmenu = document.getElementById('md-submenu');
+  const snippetsToggle = document.querySelector('[data-key="snippets-toggle"]');
+  const snippetsSubmenu = document.getElementById('snippets-submenu');
   const modal = document.getElementById('confirm-modal');
   const confirmTitle = document.getElementById('confirm-title');
   const confirmMessage = document.getElementById('confirm-message');
@@ -22,10 +24,9 @@
   const isDesktopLike = Boolean(pointerFine && hoverHover && !isMobileUA);
   const keybarEnabled = !isDesktopLike;
   const hostLabel = window.location.host || 'localhost';
-  const aliasMeta = document.querySelector('meta[name="alices-mirror-alias"]');
-  const aliasLabel = aliasMeta ? (aliasMeta.getAttribute('content') || '').trim() : '';
-  const titleHostLabel = aliasLabel || hostLabel;
-  const titlePrefix = 'alices-mirror|';
+  let titleHostLabel = hostLabel;
+  const defaultTitlePrefix = 'alices-mirror';
+  let titlePrefix = defaultTitlePrefix;
   if (keybar && !keybarEnabled) {
     root.classList.add('keybar-hidden');
   }
@@ -63,14 +64,35 @@
   let terminalFocused = false;
   let pendingKeybarCopy = '';
   let mdOpen = false;
+  let snippetsOpen = false;
   let suppressKeybarClickUntil = 0;
   let lastTitleCwd = '';
   let lastTitleProc = '';
+  // A bell rang while the tab was in the background; the title shows
+  // bellMark until the tab is visible again.
+  let bellPending = false;
+  const bellMark = '\u{1F514} ';
   let clientReadOnly = false;
   let readOnlyNoticeSent = false;
+  // A compressed snapshot being received; output that follows it waits in
+  // held until it is decoded.
+  let snapshotDecode = null;
+  let pendingApprovals = [];
+  let shownApproval = null;
   let uploadQueue = [];
   let uploadInProgress = false;
   let uploadToastTimer = 0;
+  let uploadsEnabled = true;
+  let canResize = true;
+  let canReset = true;
+  let motdShown = false;
+  let flowControl = false;
+  let bytesProcessed = 0;
+  let bytesAcked = 0;
+  let writesInFlight = 0;
+  const ackEveryBytes = 32 * 1024;
+  const wsProtocol = 'alices-mirror.v1';
+  let wsPath = '/ws';
 
   function trimTrailingPunctuation(value) {
     let end = value.length;
@@ -253,14 +275,71 @@
     }
     lastTitleCwd = safeCwd;
     lastTitleProc = safeProc;
-    document.title = `${titleHostLabel} - ${safeCwd} - ${safeProc}`;
+    document.title = `${bellPending ? bellMark : ''}${titleHostLabel} - ${safeCwd} - ${safeProc}`;
+  }
+
+  // followRedirect opens the mirror the session moved to, with its handover
+  // token so it does not ask for a password.
+  function followRedirect(payload) {
+    let target;
+    try {
+      target = new URL(payload.url);
+    } catch (_) {
+      return;
+    }
+    if (target.protocol !== 'http:' && target.protocol !== 'https:') {
+      return;
+    }
+    if (payload.token) {
+      target.searchParams.set('handover', payload.token);
+    }
+    if (socket) {
+      socket.onclose = null;
+    }
+    updateStatus(`Session moved, opening ${target.host}...`);
+    window.location.assign(target.toString());
+  }
+
+  // ringBell flags a bell in the tab title, and with a notification when
+  // the user allowed them, while the tab is in the background.
+  function ringBell() {
+    if (!document.hidden) {
+      return;
+    }
+    if (!bellPending) {
+      bellPending = true;
+      document.title = bellMark + document.title;
+    }
+    if (typeof Notification === 'function' && Notification.permission === 'granted') {
+      new Notification(titleHostLabel || 'alices-mirror', {
+        body: 'The shell rang the bell.',
+        tag: 'alices-mirror-bell'
+      });
+    }
+  }
+
+  function clearBell() {
+    if (bellPending) {
+      bellPending = false;
+      if (document.title.startsWith(bellMark)) {
+        document.title = document.title.slice(bellMark.length);
+      }
+    }
   }
 
   function handleTitleChange(title) {
-    if (typeof title !== 'string' || !title.startsWith(titlePrefix)) {
+    if (typeof title !== 'string') {
       return;
     }
-    const payload = title.slice(titlePrefix.length);
+    const first = title.indexOf('|');
+    if (first <= 0) {
+      return;
+    }
+    const prefix = title.slice(0, first);
+    if (prefix !== titlePrefix && !prefix.startsWith(defaultTitlePrefix)) {
+      return;
+    }
+    const payload = title.slice(first + 1);
     const divider = payload.indexOf('|');
     if (divider <= 0) {
       return;
@@ -370,6 +449,10 @@
       warnReadOnly();
       return;
     }
+    if (!uploadsEnabled) {
+      updateStatus('Uploads are disabled on this server.');
+      return;
+    }
     const files = Array.from(fileList).filter((file) => file && typeof file.name === 'string');
     if (!files.length) {
       return;
@@ -532,34 +615,266 @@
     }
   }
 
+  function applyConfig(config) {
+    if (!config || typeof config !== 'object') {
+      return;
+    }
+    if (typeof config.alias === 'string' && config.alias.trim()) {
+      titleHostLabel = config.alias.trim();
+    }
+    if (typeof config.accent === 'string' && /^#[0-9a-f]{3}([0-9a-f]{3})?$/i.test(config.accent)) {
+      document.documentElement.style.setProperty('--accent', config.accent);
+    }
+    if (typeof config.titlePrefix === 'string' && config.titlePrefix) {
+      titlePrefix = config.titlePrefix;
+    }
+    if (typeof config.wsPath === 'string' && config.wsPath.startsWith('/')) {
+      wsPath = config.wsPath;
+    }
+    if (typeof config.readOnly === 'boolean') {
+      setClientReadOnly(config.readOnly);
+    }
+    const features = config.features || {};
+    uploadsEnabled = features.uploads !== false;
+    if (features.snippets) {
+      loadSnippets();
+    }
+  }
+
+  function loadConfig() {
+    if (typeof fetch !== 'function') {
+      return Promise.resolve();
+    }
+    return fetch('/api/config.json', { cache: 'no-store', credentials: 'same-origin' })
+      .then((response) => (response.ok ? response.json() : null))
+      .then(applyConfig)
+      .catch(() => {
+      });
+  }
+
+  // createEventStreamSocket exposes the /events fallback transport through the
+  // subset of the WebSocket interface this file uses.
+  function createEventStreamSocket() {
+    const sock = {
+      readyState: WebSocket.CONNECTING,
+      onopen: null,
+      onclose: null,
+      onerror: null,
+      onmessage: null
+    };
+    const source = new EventSource('/events', { withCredentials: true });
+    let sessionId = '';
+    let sendChain = Promise.resolve();
+
+    const closeWith = (handler) => {
+      if (sock.readyState === WebSocket.CLOSED) {
+        return;
+      }
+      sock.readyState = WebSocket.CLOSED;
+      source.close();
+      if (handler) {
+        handler();
+      }
+    };
+
+    source.addEventListener('session', (event) => {
+      try {
+        sessionId = JSON.parse(event.data).id || '';
+      } catch (_) {
+        sessionId = '';
+      }
+      sock.readyState = WebSocket.OPEN;
+      if (sock.onopen) {
+        sock.onopen();
+      }
+    });
+    source.addEventListener('output', (event) => {
+      const binary = atob(event.data);
+      const bytes = new Uint8Array(binary.length);
+      for (let i = 0; i < binary.length; i += 1) {
+        bytes[i] = binary.charCodeAt(i);
+      }
+      if (sock.onmessage) {
+        sock.onmessage({ data: bytes.buffer });
+      }
+    });
+    source.onmessage = (event) => {
+      if (sock.onmessage) {
+        sock.onmessage({ data: event.data });
+      }
+    };
+    source.onerror = () => {
+      const opened = sock.readyState === WebSocket.OPEN;
+      closeWith(() => {
+        if (!opened && sock.onerror) {
+          sock.onerror();
+        }
+        if (sock.onclose) {
+          sock.onclose();
+        }
+      });
+    };
+
+    sock.send = (data) => {
+      if (sock.readyState !== WebSocket.OPEN) {
+        return;
+      }
+      const isText = typeof data === 'string';
+      const url = `/events/input?id=${encodeURIComponent(sessionId)}`;
+      sendChain = sendChain
+        .then(() => fetch(url, {
+          method: 'POST',
+          credentials: 'same-origin',
+          headers: { 'Content-Type': isText ? 'application/json' : 'application/octet-stream' },
+          body: data
+        }))
+        .catch(() => {
+        });
+    };
+    sock.close = () => closeWith(sock.onclose);
+    return sock;
+  }
+
   function connect() {
     const proto = window.location.protocol === 'https:' ? 'wss' : 'ws';
-    const wsUrl = `${proto}://${window.location.host}/ws`;
-    socket = new WebSocket(wsUrl);
-    socket.binaryType = 'arraybuffer';
-
-    socket.onopen = () => {
+    let wsUrl = `${proto}://${window.location.host}${wsPath}`;
+    if (typeof DecompressionStream === 'function') {
+      wsUrl += `${wsPath.includes('?') ? '&' : '?'}snapshotEncoding=gzip`;
+    }
+    let opened = false;
+    const ws = new WebSocket(wsUrl, [wsProtocol]);
+    ws.binaryType = 'arraybuffer';
+    attachSocket(ws);
+    ws.onopen = () => {
+      opened = true;
       updateStatus('Connected');
       sendResize();
     };
-    socket.onclose = () => updateStatus('Disconnected');
+    ws.onerror = () => {
+      if (!opened && typeof EventSource === 'function') {
+        ws.onclose = null;
+        connectEventStream();
+        return;
+      }
+      updateStatus('Connection error');
+    };
+  }
+
+  function connectEventStream() {
+    updateStatus('WebSocket unavailable, using fallback transport...');
+    const sock = createEventStreamSocket();
+    attachSocket(sock);
+    sock.onopen = () => {
+      updateStatus('Connected (fallback)');
+      sendResize();
+    };
+  }
+
+  function attachSocket(nextSocket) {
+    socket = nextSocket;
+    bytesProcessed = 0;
+    snapshotDecode = null;
+    bytesAcked = 0;
+    writesInFlight = 0;
+
+    socket.onclose = (event) => {
+      // 1012 (service restart): the server is being upgraded and the new
+      // process takes over the session, replaying its scrollback.
+      if (event && event.code === 1012) {
+        updateStatus('Server restarting, reconnecting...');
+        setTimeout(() => {
+          term.reset();
+          connect();
+        }, 500);
+        return;
+      }
+      updateStatus('Disconnected');
+    };
     socket.onerror = () => updateStatus('Connection error');
     socket.onmessage = (event) => {
       if (typeof event.data === 'string') {
         try {
           const payload = JSON.parse(event.data);
-          if (payload.type === 'client-info') {
+          if (payload.type === 'hello') {
             const level = Number(payload.userLevel);
             setClientReadOnly(Boolean(payload.readOnly) || level === 1);
+            canResize = payload.canResize !== false;
+            canReset = payload.canReset !== false;
+            flowControl = Boolean(payload.flowControl);
             if (clientReadOnly) {
               updateStatus('Connected');
             }
+            if (payload.needsApproval) {
+              updateStatus('Connected. Your input is sent to the host for approval.');
+            }
+            if (canResize) {
+              sendResize();
+            }
+            return;
+          }
+          if (payload.type === 'snapshot') {
+            snapshotDecode = {
+              encoding: payload.encoding,
+              bytes: Number(payload.bytes) || 0,
+              remaining: Number(payload.compressedBytes) || 0,
+              parts: [],
+              held: []
+            };
+            return;
+          }
+          if (payload.type === 'latency') {
+            const rtt = Number(payload.rttMs);
+            if (Number.isFinite(rtt)) {
+              statusEl.title = `Round-trip time: ${Math.round(rtt)} ms`;
+            }
             return;
           }
           if (payload.type === 'status' && payload.message) {
             updateStatus(payload.message);
             return;
           }
+          if (payload.type === 'alias') {
+            const alias = typeof payload.alias === 'string' ? payload.alias.trim() : '';
+            titleHostLabel = alias || hostLabel;
+            updateTitle();
+            return;
+          }
+          if (payload.type === 'approval-request') {
+            pendingApprovals.push(payload);
+            showNextApproval();
+            return;
+          }
+          if (payload.type === 'snippets') {
+            renderSnippets(payload.snippets);
+            return;
+          }
+          if (payload.type === 'paste-confirm') {
+            confirmPaste(payload);
+            return;
+          }
+          if (payload.type === 'approval-resolved') {
+            resolveApprovalLocally(payload.id);
+            return;
+          }
+          if (payload.type === 'bell') {
+            ringBell();
+            return;
+          }
+          if (payload.type === 'redirect') {
+            followRedirect(payload);
+            return;
+          }
+          if (payload.type === 'motd') {
+            if (!motdShown && payload.message) {
+              motdShown = true;
+              showModalNotice(titleHostLabel || 'Message of the day', payload.message);
+            }
+            return;
+          }
+          if (payload.type === 'reset-progress') {
+            updateStatus(payload.message || 'Resetting the shell...');
+            return;
+          }
           if (payload.type === 'reset-failed') {
             const title = payload.title || 'Reset failed';
             const message = payload.message || 'The shell could not be fully reset.';
@@ -570,10 +885,62 @@
         }
         return;
       }
-      term.write(new Uint8Array(event.data));
+      const chunk = new Uint8Array(event.data);
+      if (snapshotDecode) {
+        if (snapshotDecode.remaining > 0) {
+          snapshotDecode.parts.push(chunk);
+          snapshotDecode.remaining -= chunk.length;
+          if (snapshotDecode.remaining <= 0) {
+            decodeSnapshot(snapshotDecode);
+          }
+        } else {
+          snapshotDecode.held.push(chunk);
+        }
+        return;
+      }
+      writeOutput(chunk);
     };
   }
 
+  function writeOutput(chunk) {
+    writesInFlight += 1;
+    term.write(chunk, () => {
+      writesInFlight -= 1;
+      bytesProcessed += chunk.length;
+      maybeSendAck();
+    });
+  }
+
+  // decodeSnapshot writes a compressed snapshot once all its frames are in,
+  // followed by the output that arrived while it was decoded.
+  function decodeSnapshot(state) {
+    const stream = new Blob(state.parts).stream().pipeThrough(new DecompressionStream(state.encoding));
+    new Response(stream).arrayBuffer()
+      .then((data) => writeOutput(new Uint8Array(data)))
+      .catch(() => {
+        bytesProcessed += state.bytes;
+        updateStatus('Could not decode the scrollback');
+      })
+      .finally(() => {
+        if (snapshotDecode === state) {
+          snapshotDecode = null;
+        }
+        state.held.forEach(writeOutput);
+      });
+  }
+
+  function maybeSendAck() {
+    if (!flowControl || !socket || socket.readyState !== WebSocket.OPEN) {
+      return;
+    }
+    const unacked = bytesProcessed - bytesAcked;
+    if (unacked <= 0 || (unacked < ackEveryBytes && writesInFlight > 0)) {
+      return;
+    }
+    bytesAcked = bytesProcessed;
+    socket.send(JSON.stringify({ type: 'ack', bytes: bytesProcessed }));
+  }
+
   function sendBinary(data) {
     if (!socket || socket.readyState !== WebSocket.OPEN) {
       return;
@@ -593,7 +960,7 @@
     if (!socket || socket.readyState !== WebSocket.OPEN) {
       return;
     }
-    if (clientReadOnly) {
+    if (clientReadOnly || !canResize) {
       return;
     }
     const payload = {
@@ -604,16 +971,16 @@
     socket.send(JSON.stringify(payload));
   }
 
-  function sendReset() {
+  function sendReset(type = 'reset') {
     if (!socket || socket.readyState !== WebSocket.OPEN) {
       updateStatus('Not connected.');
       return;
     }
-    if (clientReadOnly) {
-      warnReadOnly();
+    if (!canReset) {
+      updateStatus('You may not reset this shell.');
       return;
     }
-    socket.send(JSON.stringify({ type: 'reset' }));
+    socket.send(JSON.stringify({ type }));
   }
 
   let resizeTimer;
@@ -661,6 +1028,9 @@
   }
 
   function setMdMenu(open) {
+    if (open) {
+      setSnippetsMenu(false);
+    }
     mdOpen = open;
     if (mdToggle) {
       mdToggle.setAttribute('aria-expanded', String(open));
@@ -678,6 +1048,63 @@
     setMdMenu(!mdOpen);
   }
 
+  function setSnippetsMenu(open) {
+    if (open && mdOpen) {
+      setMdMenu(false);
+    }
+    snippetsOpen = open;
+    if (snippetsToggle) {
+      snippetsToggle.setAttribute('aria-expanded', String(open));
+    }
+    if (snippetsSubmenu) {
+      snippetsSubmenu.setAttribute('aria-hidden', String(!open));
+    }
+    if (keybar) {
+      keybar.classList.toggle('keybar--snippets-open', open);
+    }
+    updateKeybarHeight();
+  }
+
+  // renderSnippets fills the Run menu with the snippets the server offers
+  // and hides it when there are none.
+  function renderSnippets(snippets) {
+    if (!snippetsToggle || !snippetsSubmenu) {
+      return;
+    }
+    const list = Array.isArray(snippets) ? snippets : [];
+    snippetsSubmenu.textContent = '';
+    list.forEach((snippet) => {
+      const button = document.createElement('button');
+      button.dataset.key = 'snippet';
+      button.dataset.name = snippet.name;
+      button.textContent = snippet.name;
+      button.title = snippet.description || snippet.command || '';
+      snippetsSubmenu.appendChild(button);
+    });
+    snippetsToggle.style.display = list.length > 0 ? '' : 'none';
+    if (list.length === 0) {
+      setSnippetsMenu(false);
+    }
+  }
+
+  function loadSnippets() {
+    if (typeof fetch !== 'function') {
+      return;
+    }
+    fetch('/api/snippets', { cache: 'no-store', credentials: 'same-origin' })
+      .then((response) => (response.ok ? response.json() : []))
+      .then(renderSnippets)
+      .catch(() => {
+      });
+  }
+
+  function runSnippet(name) {
+    if (!name || !socket || socket.readyState !== WebSocket.OPEN) {
+      return;
+    }
+    socket.send(JSON.stringify({ type: 'run-snippet', name }));
+  }
+
   function insertSnippet(text) {
     sendBinary(normalizeInput(text));
     term.focus();
@@ -761,6 +1188,62 @@
     });
   }
 
+  function showNextApproval() {
+    if (shownApproval || pendingConfirm || pendingApprovals.length === 0) {
+      return;
+    }
+    const request = pendingApprovals.shift();
+    shownApproval = request;
+    const answer = (approve) => {
+      shownApproval = null;
+      if (socket && socket.readyState === WebSocket.OPEN) {
+        socket.send(JSON.stringify({ type: 'approval', id: request.id, approve }));
+      }
+    };
+    openConfirmDialog({
+      title: request.title || 'Approve input?',
+      message: request.message || request.input || '',
+      confirmLabel: request.approve || 'Approve',
+      cancelLabel: request.deny || 'Deny',
+      onConfirm: () => answer(true),
+      onCancel: () => answer(false)
+    });
+  }
+
+  // confirmPaste asks before a large paste the server held back reaches the
+  // shared shell.
+  function confirmPaste(request) {
+    const answer = (approve) => {
+      if (socket && socket.readyState === WebSocket.OPEN) {
+        socket.send(JSON.stringify({ type: 'paste-confirm', id: request.id, approve }));
+      }
+    };
+    if (pendingConfirm) {
+      answer(false);
+      updateStatus('Paste cancelled while another dialog is open.');
+      return;
+    }
+    openConfirmDialog({
+      title: request.title || 'Paste into the shared shell?',
+      message: request.message || '',
+      confirmLabel: request.confirm || 'Paste',
+      cancelLabel: request.cancel || 'Cancel',
+      onConfirm: () => answer(true),
+      onCancel: () => answer(false)
+    });
+  }
+
+  // resolveApprovalLocally forgets a request another client decided on, or
+  // whose sender left.
+  function resolveApprovalLocally(id) {
+    pendingApprovals = pendingApprovals.filter((request) => request.id !== id);
+    if (shownApproval && shownApproval.id === id) {
+      shownApproval = null;
+      clearConfirm();
+      showNextApproval();
+    }
+  }
+
   function showModalNotice(title, message) {
     openConfirmDialog({
       title,
@@ -776,6 +1259,9 @@
     pendingConfirm = null;
     pendingCancel = null;
     modal.classList.add('hidden');
+    if (pendingApprovals.length > 0) {
+      setTimeout(showNextApproval, 0);
+    }
   }
 
   confirmBtn.addEventListener('click', () => {
@@ -993,7 +1479,7 @@
     }
   });
 
-  function handleKeybarAction(key, selectionSnapshot) {
+  function handleKeybarAction(key, selectionSnapshot, name) {
     if (!key) {
       return;
     }
@@ -1052,6 +1538,9 @@
         term.scrollToBottom();
         term.focus();
         break;
+      case 'reset-soft':
+        sendReset('reset-soft');
+        break;
       case 'reset':
         openConfirmDialog({
           title: 'Reset shell',
@@ -1068,6 +1557,13 @@
       case 'md-toggle':
         toggleMdMenu();
         break;
+      case 'snippets-toggle':
+        setSnippetsMenu(!snippetsOpen);
+        break;
+      case 'snippet':
+        setSnippetsMenu(false);
+        runSnippet(name);
+        break;
       case 'md-h1':
         insertSnippet('# ');
         break;
@@ -1097,7 +1593,7 @@
       event.preventDefault();
       event.stopPropagation();
       suppressKeybarClickUntil = Date.now() + 700;
-      handleKeybarAction(key, key === 'copy' ? term.getSelection() : '');
+      handleKeybarAction(key, key === 'copy' ? term.getSelection() : '', button.dataset.name);
       pendingKeybarCopy = '';
       return;
     }
@@ -1116,7 +1612,7 @@
     if (!button) {
       return;
     }
-    handleKeybarAction(button.dataset.key);
+    handleKeybarAction(button.dataset.key, undefined, button.dataset.name);
   });
 
   if (mdSubmenu) {
@@ -1133,6 +1629,7 @@
 
   document.addEventListener('visibilitychange', () => {
     if (!document.hidden) {
+      clearBell();
       scheduleResize(180);
     }
   });
@@ -1140,5 +1637,5 @@
   window.addEventListener('pageshow', () => scheduleResize(180));
 
   registerFileDrop();
-  connect();
+  loadConfig().then(connect);
 })();
@@ -0,0 +1,47 @@
+package telemetry
+
+import "sync/atomic"
+
+type metric struct {
+	name        string
+	description string
+	unit        string
+	monotonic   bool
+	value       func() int64
+}
+
+// Counter is a monotonic sum. A nil *Counter is valid and counts nothing.
+type Counter struct {
+	n atomic.Int64
+}
+
+// Add increases the counter by n.
+func (c *Counter) Add(n int64) {
+	if c != nil {
+		c.n.Add(n)
+	}
+}
+
+// Counter registers a monotonic counter.
+func (e *Exporter) Counter(name, description, unit string) *Counter {
+	if e == nil {
+		return nil
+	}
+	c := &Counter{}
+	e.register(metric{name: name, description: description, unit: unit, monotonic: true, value: c.n.Load})
+	return c
+}
+
+// Gauge registers a gauge whose value is read from fn at each export.
+func (e *Exporter) Gauge(name, description, unit string, fn func() int64) {
+	if e == nil {
+		return
+	}
+	e.register(metric{name: name, description: description, unit: unit, value: fn})
+}
+
+func (e *Exporter) register(m metric) {
+	e.mu.Lock()
+	e.metrics = append(e.metrics, m)
+	e.mu.Unlock()
+}
@@ -0,0 +1,147 @@
+package telemetry
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"alices-mirror/internal/logging"
+)
+
+func logger() *slog.Logger {
+	return logging.For("telemetry")
+}
+
+// The payloads below follow the OTLP/JSON encoding: IDs are hex, 64-bit
+// integers are strings and enums are numbers.
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func attributes[V any](m map[string]V) []otlpAttr {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]otlpAttr, 0, len(keys))
+	for _, key := range keys {
+		var v otlpValue
+		switch value := any(m[key]).(type) {
+		case string:
+			v.StringValue = &value
+		case bool:
+			v.BoolValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		default:
+			continue
+		}
+		out = append(out, otlpAttr{Key: key, Value: v})
+	}
+	return out
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+func (e *Exporter) tracesPayload(spans []*Span) []byte {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        attributes(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.failed != "" {
+			span.Status = otlpStatus{Code: 2, Message: s.failed}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+	payload, _ := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource":   otlpResource{Attributes: attributes(e.cfg.Resource)},
+			"scopeSpans": []any{map[string]any{"scope": otlpScope{Name: scopeName}, "spans": out}},
+		}},
+	})
+	return payload
+}
+
+type otlpDataPoint struct {
+	StartTimeUnixNano string `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string `json:"timeUnixNano"`
+	AsInt             string `json:"asInt"`
+}
+
+func (e *Exporter) metricsPayload(metrics []metric, now time.Time) []byte {
+	out := make([]map[string]any, 0, len(metrics))
+	for _, m := range metrics {
+		point := otlpDataPoint{TimeUnixNano: unixNano(now), AsInt: strconv.FormatInt(m.value(), 10)}
+		entry := map[string]any{"name": m.name, "description": m.description, "unit": m.unit}
+		if m.monotonic {
+			point.StartTimeUnixNano = unixNano(e.started)
+			// Aggregation temporality 2 is cumulative.
+			entry["sum"] = map[string]any{"dataPoints": []otlpDataPoint{point}, "aggregationTemporality": 2, "isMonotonic": true}
+		} else {
+			entry["gauge"] = map[string]any{"dataPoints": []otlpDataPoint{point}}
+		}
+		out = append(out, entry)
+	}
+	payload, _ := json.Marshal(map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource":     otlpResource{Attributes: attributes(e.cfg.Resource)},
+			"scopeMetrics": []any{map[string]any{"scope": otlpScope{Name: scopeName}, "metrics": out}},
+		}},
+	})
+	return payload
+}
@@ -0,0 +1,268 @@
+// Package telemetry exports traces and metrics to an OpenTelemetry
+// collector over OTLP/HTTP with JSON encoding. It is configured with the
+// standard OTEL_* environment variables and is off unless an OTLP endpoint
+// is set. Only what the mirror needs is implemented: spans with attributes,
+// monotonic counters and gauges.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	scopeName       = "alices-mirror"
+	defaultService  = "alices-mirror"
+	maxQueuedSpans  = 2048
+	maxSpansPerPost = 512
+)
+
+// Config is the exporter configuration read from the environment.
+type Config struct {
+	TracesURL      string
+	MetricsURL     string
+	TracesHeaders  http.Header
+	MetricsHeaders http.Header
+	Timeout        time.Duration
+	SpanDelay      time.Duration
+	MetricInterval time.Duration
+	Resource       map[string]string
+}
+
+// FromEnv reads the OTEL_* variables. It returns ok false when telemetry is
+// disabled, which is the case unless an OTLP endpoint is set.
+func FromEnv() (cfg Config, ok bool, err error) {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return Config{}, false, nil
+	}
+	switch protocol := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")); protocol {
+	case "", "http/json":
+	default:
+		return Config{}, false, fmt.Errorf("OTEL_EXPORTER_OTLP_PROTOCOL %q is not supported (only http/json)", protocol)
+	}
+
+	base := strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+	cfg.TracesURL = signalURL(base, "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_TRACES_EXPORTER", "/v1/traces")
+	cfg.MetricsURL = signalURL(base, "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "OTEL_METRICS_EXPORTER", "/v1/metrics")
+	if cfg.TracesURL == "" && cfg.MetricsURL == "" {
+		return Config{}, false, nil
+	}
+	for _, raw := range []string{cfg.TracesURL, cfg.MetricsURL} {
+		if raw == "" {
+			continue
+		}
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, false, fmt.Errorf("invalid OTLP endpoint %q", raw)
+		}
+	}
+
+	common := parseList(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	cfg.TracesHeaders = headers(common, parseList(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS")))
+	cfg.MetricsHeaders = headers(common, parseList(os.Getenv("OTEL_EXPORTER_OTLP_METRICS_HEADERS")))
+	cfg.Timeout = envMillis("OTEL_EXPORTER_OTLP_TIMEOUT", 10*time.Second)
+	cfg.SpanDelay = envMillis("OTEL_BSP_SCHEDULE_DELAY", 5*time.Second)
+	cfg.MetricInterval = envMillis("OTEL_METRIC_EXPORT_INTERVAL", 60*time.Second)
+
+	cfg.Resource = parseList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if name := strings.TrimSpace(os.Getenv("OTEL_SERVICE_NAME")); name != "" {
+		cfg.Resource["service.name"] = name
+	} else if cfg.Resource["service.name"] == "" {
+		cfg.Resource["service.name"] = defaultService
+	}
+	return cfg, true, nil
+}
+
+// signalURL is the endpoint for one signal: its own variable as is, or the
+// base endpoint with path appended. An exporter of "none" disables it.
+func signalURL(base, endpointEnv, exporterEnv, path string) string {
+	if strings.TrimSpace(os.Getenv(exporterEnv)) == "none" {
+		return ""
+	}
+	if own := strings.TrimSpace(os.Getenv(endpointEnv)); own != "" {
+		return own
+	}
+	if base == "" {
+		return ""
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// parseList parses the key=value,key=value form of the OTEL variables.
+// Values are URL-decoded.
+func parseList(raw string) map[string]string {
+	out := map[string]string{}
+	for _, item := range strings.Split(raw, ",") {
+		key, value, ok := strings.Cut(item, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = decoded
+		}
+		out[key] = strings.TrimSpace(value)
+	}
+	return out
+}
+
+func headers(lists ...map[string]string) http.Header {
+	h := http.Header{}
+	for _, list := range lists {
+		for key, value := range list {
+			h.Set(key, value)
+		}
+	}
+	return h
+}
+
+func envMillis(name string, fallback time.Duration) time.Duration {
+	ms, err := strconv.Atoi(strings.TrimSpace(os.Getenv(name)))
+	if err != nil || ms <= 0 {
+		return fallback
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Exporter collects spans and metrics and sends them to the collector. A
+// nil *Exporter is valid and records nothing.
+type Exporter struct {
+	cfg    Config
+	client *http.Client
+
+	mu      sync.Mutex
+	spans   []*Span
+	dropped int
+	metrics []metric
+	started time.Time
+
+	requests *Counter
+	wake     chan struct{}
+}
+
+// New creates an exporter. proxy, if set, selects the proxy for requests to
+// the collector.
+func New(cfg Config, proxy func(*http.Request) (*url.URL, error)) *Exporter {
+	e := &Exporter{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout, Transport: &http.Transport{Proxy: proxy}},
+		started: time.Now(),
+		wake:    make(chan struct{}, 1),
+	}
+	e.requests = e.Counter("alices_mirror.http.requests", "HTTP requests served.", "{request}")
+	return e
+}
+
+// Run exports on the configured schedule until ctx is done, then flushes
+// what is left.
+func (e *Exporter) Run(ctx context.Context) {
+	if e == nil {
+		return
+	}
+	spanTicker := time.NewTicker(e.cfg.SpanDelay)
+	defer spanTicker.Stop()
+	metricTicker := time.NewTicker(e.cfg.MetricInterval)
+	defer metricTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
+			e.exportSpans(flushCtx)
+			e.exportMetrics(flushCtx)
+			cancel()
+			return
+		case <-spanTicker.C:
+			e.exportSpans(ctx)
+		case <-e.wake:
+			e.exportSpans(ctx)
+		case <-metricTicker.C:
+			e.exportMetrics(ctx)
+		}
+	}
+}
+
+func (e *Exporter) enqueue(span *Span) {
+	e.mu.Lock()
+	if len(e.spans) >= maxQueuedSpans {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.spans = append(e.spans, span)
+	full := len(e.spans) >= maxSpansPerPost
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *Exporter) exportSpans(ctx context.Context) {
+	if e.cfg.TracesURL == "" {
+		return
+	}
+	for {
+		e.mu.Lock()
+		n := min(len(e.spans), maxSpansPerPost)
+		batch := e.spans[:n:n]
+		e.spans = e.spans[n:]
+		dropped := e.dropped
+		e.dropped = 0
+		e.mu.Unlock()
+		if dropped > 0 {
+			logger().Warn("telemetry span queue full", "dropped", dropped)
+		}
+		if n == 0 {
+			return
+		}
+		if err := e.post(ctx, e.cfg.TracesURL, e.cfg.TracesHeaders, e.tracesPayload(batch)); err != nil {
+			logger().Warn("trace export failed", "error", err)
+			return
+		}
+	}
+}
+
+func (e *Exporter) exportMetrics(ctx context.Context) {
+	if e.cfg.MetricsURL == "" {
+		return
+	}
+	e.mu.Lock()
+	metrics := append([]metric(nil), e.metrics...)
+	e.mu.Unlock()
+	if len(metrics) == 0 {
+		return
+	}
+	if err := e.post(ctx, e.cfg.MetricsURL, e.cfg.MetricsHeaders, e.metricsPayload(metrics, time.Now())); err != nil {
+		logger().Warn("metric export failed", "error", err)
+	}
+}
+
+func (e *Exporter) post(ctx context.Context, target string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20abc,x-team=ops")
+	t.Setenv("OTEL_METRICS_EXPORTER", "none")
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "deployment.environment=lab")
+	cfg, ok, err := FromEnv()
+	if err != nil || !ok {
+		t.Fatalf("FromEnv() = %v, %v", ok, err)
+	}
+	if cfg.TracesURL != "http://collector:4318/v1/traces" || cfg.MetricsURL != "" {
+		t.Fatalf("urls = %q, %q", cfg.TracesURL, cfg.MetricsURL)
+	}
+	if got := cfg.TracesHeaders.Get("Authorization"); got != "Bearer abc" {
+		t.Fatalf("Authorization = %q", got)
+	}
+	if cfg.Resource["service.name"] != "alices-mirror" || cfg.Resource["deployment.environment"] != "lab" {
+		t.Fatalf("resource = %v", cfg.Resource)
+	}
+
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	if _, ok, _ := FromEnv(); ok {
+		t.Fatal("FromEnv() enabled with OTEL_SDK_DISABLED")
+	}
+}
+
+func TestExportOnShutdown(t *testing.T) {
+	var mu sync.Mutex
+	bodies := map[string]string{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies[r.URL.Path] = string(data)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	e := New(Config{
+		TracesURL:      collector.URL + "/v1/traces",
+		MetricsURL:     collector.URL + "/v1/metrics",
+		Timeout:        time.Second,
+		SpanDelay:      time.Hour,
+		MetricInterval: time.Hour,
+		Resource:       map[string]string{"service.name": "test"},
+	}, nil)
+	sent := e.Counter("sent", "", "By")
+	sent.Add(42)
+
+	handler := e.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/clients", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e.Run(ctx)
+
+	var traces struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal([]byte(bodies["/v1/traces"]), &traces); err != nil {
+		t.Fatalf("traces %q: %v", bodies["/v1/traces"], err)
+	}
+	span := traces.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if span.Name != "GET /api/clients" || span.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || span.ParentSpanID != "00f067aa0ba902b7" {
+		t.Fatalf("span = %+v", span)
+	}
+	if !strings.Contains(bodies["/v1/traces"], `"intValue":"418"`) {
+		t.Fatalf("status code missing from %s", bodies["/v1/traces"])
+	}
+	for _, want := range []string{`"name":"sent"`, `"asInt":"42"`, `"name":"alices_mirror.http.requests"`, `"isMonotonic":true`} {
+		if !strings.Contains(bodies["/v1/metrics"], want) {
+			t.Fatalf("metrics missing %s: %s", want, bodies["/v1/metrics"])
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package telemetry
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span kinds, numbered as in OTLP.
+const (
+	KindInternal = 1
+	KindServer   = 2
+)
+
+// Span is one timed operation. A nil *Span is valid and records nothing.
+type Span struct {
+	exporter *Exporter
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  map[string]any
+	failed string
+	ended  bool
+}
+
+// StartSpan starts a root span.
+func (e *Exporter) StartSpan(name string, kind int) *Span {
+	if e == nil || e.cfg.TracesURL == "" {
+		return nil
+	}
+	span := &Span{exporter: e, name: name, kind: kind, start: time.Now(), attrs: map[string]any{}}
+	_, _ = rand.Read(span.traceID[:])
+	_, _ = rand.Read(span.spanID[:])
+	return span
+}
+
+// SetAttr records a string, bool, int or int64 attribute.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failed = message
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	s.exporter.enqueue(s)
+}
+
+// continueTrace makes s a child of the W3C traceparent header value, if it
+// is valid.
+func (s *Span) continueTrace(traceparent string) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return
+	}
+	traceID, err1 := hex.DecodeString(parts[1])
+	parentID, err2 := hex.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || len(traceID) != 16 || len(parentID) != 8 {
+		return
+	}
+	copy(s.traceID[:], traceID)
+	copy(s.parentID[:], parentID)
+}
+
+// Handler wraps next with a server span per request, continuing the
+// caller's trace when the request carries a traceparent header.
+func (e *Exporter) Handler(next http.Handler) http.Handler {
+	if e == nil || e.cfg.TracesURL == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := e.StartSpan(r.Method+" "+r.URL.Path, KindServer)
+		span.continueTrace(r.Header.Get("traceparent"))
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("url.path", r.URL.Path)
+		span.SetAttr("client.address", clientHost(r.RemoteAddr))
+		if agent := r.UserAgent(); agent != "" {
+			span.SetAttr("user_agent.original", agent)
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.hijacked {
+			rec.status = http.StatusSwitchingProtocols
+		}
+		span.SetAttr("http.response.status_code", rec.status)
+		if rec.status >= 500 {
+			span.SetError(fmt.Sprintf("HTTP %d", rec.status))
+		}
+		span.End()
+		e.requests.Add(1)
+	})
+}
+
+func clientHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// statusRecorder captures the response status while still letting
+// WebSocket upgrades and event streams reach the connection underneath.
+type statusRecorder struct {
+	http.ResponseWriter
+	status   int
+	wrote    bool
+	hijacked bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wrote {
+		r.status, r.wrote = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	r.wrote = true
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	r.hijacked = true
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
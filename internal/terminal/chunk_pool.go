@@ -0,0 +1,63 @@
+package terminal
+
+import "sync"
+
+// chunkBuffer is a pooled read buffer shared by every holder of the output
+// chunks read into it. It goes back to its pool when the last reference is
+// released.
+type chunkBuffer struct {
+	data []byte
+	pool *sync.Pool
+
+	mu   sync.Mutex
+	refs int
+}
+
+func newChunkPool(size int) *sync.Pool {
+	pool := &sync.Pool{}
+	pool.New = func() any {
+		return &chunkBuffer{data: make([]byte, size), pool: pool}
+	}
+	return pool
+}
+
+func getChunkBuffer(pool *sync.Pool) *chunkBuffer {
+	buf := pool.Get().(*chunkBuffer)
+	buf.refs = 1
+	return buf
+}
+
+func (b *chunkBuffer) retain() {
+	b.mu.Lock()
+	b.refs++
+	b.mu.Unlock()
+}
+
+func (b *chunkBuffer) release() {
+	b.mu.Lock()
+	b.refs--
+	done := b.refs == 0
+	b.mu.Unlock()
+	if done {
+		b.pool.Put(b)
+	}
+}
+
+// Retain adds a reference to the buffer behind c.Data. Every holder that keeps
+// c beyond the call it received it in must retain it and Release it once it
+// is done with the data.
+func (c OutputChunk) Retain() {
+	if c.buf != nil {
+		c.buf.retain()
+	}
+}
+
+// Release drops a reference taken with Retain, or the one handed over with
+// the chunk on Session.Output. Chunks that are never released are simply
+// garbage collected, so dropping a reference on an error path is safe;
+// releasing one twice is not.
+func (c OutputChunk) Release() {
+	if c.buf != nil {
+		c.buf.release()
+	}
+}
@@ -0,0 +1,38 @@
+package terminal
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessionContextCancel(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err := NewSessionContext(ctx, Config{WorkDir: t.TempDir(), Shell: "/bin/sh"})
+	if err != nil {
+		t.Fatalf("NewSessionContext: %v", err)
+	}
+	select {
+	case <-s.Status():
+	case <-time.After(5 * time.Second):
+		t.Fatal("shell did not start")
+	}
+	// A job left behind keeps the terminal open after the shell is gone.
+	if err := s.WriteInput([]byte("sleep 30 &\n")); err != nil {
+		t.Fatalf("WriteInput: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	cancel()
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session still running after the context was cancelled")
+	}
+	for range s.Output() {
+	}
+	s.Close()
+}
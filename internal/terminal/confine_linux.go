@@ -0,0 +1,202 @@
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// confineHelperEnv carries the confinement directory to the mirror binary
+// re-run as a Landlock helper; confineFilesEnv lists extra files the
+// shell may read, separated by NUL.
+const (
+	confineHelperEnv = "ALICES_MIRROR_CONFINE"
+	confineFilesEnv  = "ALICES_MIRROR_CONFINE_FILES"
+)
+
+// confineSystemDirs are readable (and executable) by a confined shell so
+// the usual tools keep working. Home directories are not among them.
+var confineSystemDirs = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/etc", "/opt"}
+
+// CheckConfine reports how a shell would be confined to dir: with
+// bubblewrap when bwrap is installed, else with Landlock when the kernel
+// supports it, else with chroot when running as root.
+func CheckConfine(dir, shell string) (string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", errors.New("not a directory")
+	}
+	if _, err := exec.LookPath("bwrap"); err == nil {
+		return ConfineBubblewrap, nil
+	}
+	if landlockABI() > 0 {
+		return ConfineLandlock, nil
+	}
+	path, err := exec.LookPath(confineShellName(shell))
+	if err != nil {
+		return "", err
+	}
+	if err := canChroot(dir, path); err != nil {
+		return "", fmt.Errorf("bubblewrap is not installed, Landlock is not available and %v", err)
+	}
+	return ConfineChroot, nil
+}
+
+func confineShellName(shell string) string {
+	if shell = strings.TrimSpace(shell); shell == "" {
+		return "bash"
+	}
+	return shell
+}
+
+// confineCommand rewrites cmd so the shell only sees dir and the system
+// directories. files are extra files outside dir the shell needs to read.
+func confineCommand(cmd *exec.Cmd, dir string, files []string) error {
+	if bwrap, err := exec.LookPath("bwrap"); err == nil {
+		args := []string{bwrap, "--die-with-parent"}
+		for _, sys := range confineSystemDirs {
+			args = append(args, "--ro-bind-try", sys, sys)
+		}
+		args = append(args, "--proc", "/proc", "--dev", "/dev", "--tmpfs", "/tmp")
+		for _, file := range files {
+			args = append(args, "--ro-bind", file, file)
+		}
+		args = append(args, "--bind", dir, dir, "--chdir", cmd.Dir, "--")
+		cmd.Args = append(args, cmd.Args...)
+		cmd.Path = bwrap
+		return nil
+	}
+
+	if landlockABI() > 0 {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		cmd.Args = append([]string{exe, cmd.Path}, cmd.Args...)
+		cmd.Path = exe
+		cmd.Env = append(cmd.Env, confineHelperEnv+"="+dir, confineFilesEnv+"="+strings.Join(files, "\x00"))
+		return nil
+	}
+
+	return chrootCommand(cmd, dir)
+}
+
+// RunConfineHelper restricts this process with Landlock and replaces it
+// with the shell when it was started by confineCommand. It returns false
+// otherwise and must be called before anything else in main.
+func RunConfineHelper() bool {
+	dir, ok := os.LookupEnv(confineHelperEnv)
+	if !ok {
+		return false
+	}
+	var files []string
+	if raw := os.Getenv(confineFilesEnv); raw != "" {
+		files = strings.Split(raw, "\x00")
+	}
+	env := dropEnvVar(dropEnvVar(os.Environ(), confineHelperEnv), confineFilesEnv)
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "alices-mirror: confine helper started without a command")
+		os.Exit(1)
+	}
+	if err := landlockRestrict(dir, files); err != nil {
+		fmt.Fprintf(os.Stderr, "alices-mirror: failed to confine shell: %v\n", err)
+		os.Exit(1)
+	}
+	err := syscall.Exec(os.Args[1], os.Args[2:], env)
+	fmt.Fprintf(os.Stderr, "alices-mirror: failed to start shell: %v\n", err)
+	os.Exit(1)
+	return true
+}
+
+// landlockABI returns the Landlock ABI version of the running kernel, or 0
+// when Landlock is unavailable.
+func landlockABI() int {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0
+	}
+	return int(abi)
+}
+
+// landlockRestrict limits this process and its children to full access
+// under dir, read and execute access to confineSystemDirs and /proc, read
+// and write access to devices, and read access to files.
+func landlockRestrict(dir string, files []string) error {
+	abi := landlockABI()
+	if abi == 0 {
+		return errors.New("landlock is not available")
+	}
+	handled := uint64(unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG | unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO | unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM)
+	if abi >= 2 {
+		handled |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		handled |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	if abi >= 5 {
+		handled |= unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+	}
+	read := uint64(unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR)
+	device := handled & (read | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV)
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to create ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer unix.Close(ruleset)
+
+	if err := landlockAllow(ruleset, dir, handled); err != nil {
+		return err
+	}
+	for _, sys := range append(confineSystemDirs, "/proc") {
+		if err := landlockAllow(ruleset, sys, read); err != nil && !errors.Is(err, unix.ENOENT) {
+			return err
+		}
+	}
+	if err := landlockAllow(ruleset, "/dev", device); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := landlockAllow(ruleset, file, unix.LANDLOCK_ACCESS_FS_READ_FILE); err != nil {
+			return err
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("failed to enforce ruleset: %w", errno)
+	}
+	return nil
+}
+
+func landlockAllow(ruleset int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer unix.Close(fd)
+	rule := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("%s: %w", path, errno)
+	}
+	return nil
+}
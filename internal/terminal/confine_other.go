@@ -0,0 +1,43 @@
+//go:build !linux && !windows
+
+package terminal
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CheckConfine reports how a shell would be confined to dir. Only chroot
+// is available here, which needs root.
+func CheckConfine(dir, shell string) (string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", errors.New("not a directory")
+	}
+	name := strings.TrimSpace(shell)
+	if name == "" {
+		name = "bash"
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", err
+	}
+	if err := canChroot(dir, path); err != nil {
+		return "", err
+	}
+	return ConfineChroot, nil
+}
+
+func confineCommand(cmd *exec.Cmd, dir string, files []string) error {
+	return chrootCommand(cmd, dir)
+}
+
+// RunConfineHelper is only needed for Landlock, which is Linux only.
+func RunConfineHelper() bool {
+	return false
+}
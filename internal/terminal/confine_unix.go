@@ -0,0 +1,55 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Ways a confined shell can be started, best first.
+const (
+	ConfineBubblewrap = "bubblewrap"
+	ConfineLandlock   = "landlock"
+	ConfineChroot     = "chroot"
+)
+
+// confineEnv applies the confined view to the shell's environment: its home
+// is the confinement directory.
+func confineEnv(env []string, dir string) []string {
+	env = dropEnvVar(env, "HOME")
+	return append(env, "HOME="+dir)
+}
+
+// canChroot reports whether the shell can be started with dir as its root:
+// the mirror must be root and the shell must exist at the same path inside
+// dir.
+func canChroot(dir, shellPath string) error {
+	if os.Geteuid() != 0 {
+		return errors.New("chroot needs root")
+	}
+	if _, err := os.Stat(filepath.Join(dir, shellPath)); err != nil {
+		return fmt.Errorf("chroot needs %s inside the directory", shellPath)
+	}
+	return nil
+}
+
+// chrootCommand runs cmd with dir as its root directory. The bash rc file
+// lives outside dir, so bash starts without the title integration.
+func chrootCommand(cmd *exec.Cmd, dir string) error {
+	if err := canChroot(dir, cmd.Path); err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(dir, cmd.Dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = "."
+	}
+	cmd.SysProcAttr.Chroot = dir
+	cmd.Dir = filepath.Join("/", rel)
+	cmd.Args = cmd.Args[:1]
+	return nil
+}
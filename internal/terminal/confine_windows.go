@@ -0,0 +1,15 @@
+//go:build windows
+
+package terminal
+
+import "errors"
+
+// CheckConfine always fails: confined shells are not supported on Windows.
+func CheckConfine(dir, shell string) (string, error) {
+	return "", errors.New("not supported on Windows")
+}
+
+// RunConfineHelper is only needed for Landlock, which is Linux only.
+func RunConfineHelper() bool {
+	return false
+}
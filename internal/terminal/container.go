@@ -0,0 +1,187 @@
+package terminal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"alices-mirror/internal/container"
+)
+
+// The container target runs the shell inside a running Docker or Podman
+// container through the engine's exec API. The exec first prints its PID so
+// the shell can be signalled later: closing the attached stream does not
+// end an exec, so Kill and Reset signal the shell inside the container.
+const (
+	containerShellScript = `echo $$; if command -v bash >/dev/null 2>&1; then exec bash -l; fi; exec sh -l`
+	containerKillScript  = `kill -HUP "$1" 2>/dev/null; sleep 0.5; kill -KILL "$1" 2>/dev/null; true`
+	containerStartWait   = 10 * time.Second
+	containerPollEvery   = 500 * time.Millisecond
+)
+
+// CheckContainer reports whether a shell can be started in name.
+func CheckContainer(name string) error {
+	client, err := container.NewClient()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), containerStartWait)
+	defer cancel()
+	_, err = client.Run(ctx, name, []string{"true"})
+	return err
+}
+
+// containerShell is an exec session. It serves as both the ptyDevice and
+// the shellCommand of a session.
+type containerShell struct {
+	client *container.Client
+	name   string
+	execID string
+	conn   net.Conn
+	reader *bufio.Reader
+	pid    int
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func startContainerShell(name string, cols, rows int) (*containerShell, error) {
+	client, err := container.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), containerStartWait)
+	defer cancel()
+	id, err := client.CreateExec(ctx, name, container.ExecConfig{
+		Cmd:   []string{"sh", "-c", containerShellScript},
+		Env:   []string{"TERM=xterm-256color"},
+		Tty:   true,
+		Stdin: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.StartExec(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &containerShell{
+		client: client,
+		name:   name,
+		execID: id,
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		closed: make(chan struct{}),
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(containerStartWait))
+	line, err := c.reader.ReadString('\n')
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("shell did not start in container %s: %v", name, err)
+	}
+	c.pid, err = strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("unexpected output from container %s: %q", name, line)
+	}
+	if cols > 0 && rows > 0 {
+		_ = c.Resize(cols, rows)
+	}
+	return c, nil
+}
+
+func (c *containerShell) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (c *containerShell) Write(p []byte) (int, error) {
+	return c.conn.Write(p)
+}
+
+func (c *containerShell) Resize(cols, rows int) error {
+	if cols <= 0 || rows <= 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), containerStartWait)
+	defer cancel()
+	return c.client.ResizeExec(ctx, c.execID, cols, rows)
+}
+
+func (c *containerShell) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.conn.Close()
+}
+
+// PID is zero: the shell's PID is only meaningful inside the container.
+func (c *containerShell) PID() int {
+	return 0
+}
+
+func (c *containerShell) Kill() error {
+	ctx, cancel := context.WithTimeout(context.Background(), containerStartWait)
+	defer cancel()
+	_, err := c.client.Run(ctx, c.name, []string{"sh", "-c", containerKillScript, "sh", strconv.Itoa(c.pid)})
+	return err
+}
+
+// Wait polls the engine until the exec has ended. Once the stream is closed
+// it gives up after a few seconds, since a stopped container may no longer
+// report on its execs.
+func (c *containerShell) Wait() error {
+	var closedAt time.Time
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), containerStartWait)
+		state, err := c.client.InspectExec(ctx, c.execID)
+		cancel()
+		if err != nil {
+			return err
+		}
+		if !state.Running {
+			if state.ExitCode != 0 {
+				return fmt.Errorf("exit status %d", state.ExitCode)
+			}
+			return nil
+		}
+		select {
+		case <-c.closed:
+			if closedAt.IsZero() {
+				closedAt = time.Now()
+			} else if time.Since(closedAt) > containerStartWait {
+				return errors.New("shell in container did not exit")
+			}
+		default:
+		}
+		time.Sleep(containerPollEvery)
+	}
+}
+
+// Reset ends the shell and everything it started; the session then starts
+// a new one.
+func (c *containerShell) Reset(ResetOptions) ([]ProcessInfo, error) {
+	if err := c.Kill(); err != nil {
+		return []ProcessInfo{{PID: c.pid, Name: "shell in " + c.name}}, err
+	}
+	return nil, nil
+}
+
+// CurrentDirectory returns the shell's working directory in the container.
+func (c *containerShell) CurrentDirectory() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), containerStartWait)
+	defer cancel()
+	out, err := c.client.Run(ctx, c.name, []string{"readlink", fmt.Sprintf("/proc/%d/cwd", c.pid)})
+	if err != nil {
+		return "", err
+	}
+	if dir := strings.TrimSpace(out); dir != "" {
+		return dir, nil
+	}
+	return "", errors.New("current directory not available")
+}
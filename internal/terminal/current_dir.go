@@ -2,25 +2,42 @@ package terminal
 
 import (
 	"errors"
-	"fmt"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
 )
 
+// dirReporter is implemented by commands that know their working directory
+// better than /proc does, such as the tmux bridge.
+type dirReporter interface {
+	CurrentDirectory() (string, error)
+}
+
 func (s *Session) CurrentDirectory() (string, error) {
+	s.mu.Lock()
+	reporter, ok := s.cmd.(dirReporter)
+	s.mu.Unlock()
+	if ok {
+		return reporter.CurrentDirectory()
+	}
+
 	pid := s.shellPID()
-	if pid > 0 && runtime.GOOS != "windows" {
+	if pid > 0 {
 		if dir, err := readProcCwd(pid); err == nil && strings.TrimSpace(dir) != "" {
 			return filepath.Clean(dir), nil
 		}
 	}
 
 	s.mu.Lock()
-	titleCwd := s.lastTitleCwd
+	reportedCwd, titleCwd := s.reportedCwd, s.lastTitleCwd
 	s.mu.Unlock()
 
+	// OSC 7 is the standard way for a shell to report its directory, so it
+	// is preferred to the mirror's own title convention.
+	if reportedCwd != "" {
+		return reportedCwd, nil
+	}
+
 	if strings.TrimSpace(titleCwd) == "" {
 		return "", errors.New("current directory not available")
 	}
@@ -45,14 +62,6 @@ func (s *Session) shellPID() int {
 	return cmd.PID()
 }
 
-func readProcCwd(pid int) (string, error) {
-	target, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
-	if err != nil {
-		return "", err
-	}
-	return target, nil
-}
-
 func expandLeadingTilde(value string) (string, error) {
 	trimmed := strings.TrimSpace(value)
 	if trimmed == "" {
@@ -0,0 +1,67 @@
+package terminal
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// proc_info arguments and the layout of struct proc_vnodepathinfo from
+// <sys/proc_info.h>: the current directory's vnode_info_path comes first,
+// its path following a 152-byte vnode_info.
+const (
+	procInfoCallPIDInfo    = 2
+	procPIDVnodePathInfo   = 9
+	vnodeInfoSize          = 152
+	vnodePathInfoSize      = 2 * (vnodeInfoSize + unix.PathMax)
+	vnodePathInfoCwdOffset = vnodeInfoSize
+)
+
+// readProcCwd asks the kernel for pid's current directory, as
+// proc_pidinfo(PROC_PIDVNODEPATHINFO) does, and falls back to lsof.
+func readProcCwd(pid int) (string, error) {
+	if dir, err := procPIDCwd(pid); err == nil {
+		return dir, nil
+	}
+	return lsofCwd(pid)
+}
+
+func procPIDCwd(pid int) (string, error) {
+	var buf [vnodePathInfoSize]byte
+	n, _, errno := syscall.Syscall6(unix.SYS_PROC_INFO, procInfoCallPIDInfo, uintptr(pid), procPIDVnodePathInfo, 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if errno != 0 {
+		return "", errno
+	}
+	if int(n) < vnodePathInfoCwdOffset+1 {
+		return "", errors.New("short proc_info reply")
+	}
+	path := buf[vnodePathInfoCwdOffset : vnodePathInfoCwdOffset+unix.PathMax]
+	if i := bytes.IndexByte(path, 0); i >= 0 {
+		path = path[:i]
+	}
+	if len(path) == 0 {
+		return "", errors.New("current directory not available")
+	}
+	return string(path), nil
+}
+
+// lsofCwd reads the cwd entry from lsof's field output, where the name
+// line starts with n.
+func lsofCwd(pid int) (string, error) {
+	out, err := exec.Command("lsof", "-a", "-p", strconv.Itoa(pid), "-d", "cwd", "-Fn").Output()
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if dir, ok := strings.CutPrefix(line, "n"); ok && dir != "" {
+			return dir, nil
+		}
+	}
+	return "", errors.New("current directory not available")
+}
@@ -0,0 +1,16 @@
+//go:build !darwin && !windows
+
+package terminal
+
+import (
+	"fmt"
+	"os"
+)
+
+func readProcCwd(pid int) (string, error) {
+	target, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid))
+	if err != nil {
+		return "", err
+	}
+	return target, nil
+}
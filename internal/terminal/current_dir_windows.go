@@ -0,0 +1,67 @@
+//go:build windows
+
+package terminal
+
+import (
+	"errors"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// maxRemoteCwdBytes bounds the directory read from another process: a long
+// path of 32767 UTF-16 units.
+const maxRemoteCwdBytes = 65534
+
+// remoteUnicodeString is windows.NTUnicodeString with the buffer as an
+// address in the other process rather than a Go pointer.
+type remoteUnicodeString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        uintptr
+}
+
+// readProcCwd reads pid's current directory from the process parameters in
+// its PEB. cmd keeps it up to date on every cd, and the PowerShell init
+// script mirrors Set-Location into it, so it still works when a profile
+// replaces the prompt that reports the directory in the title.
+func readProcCwd(pid int) (string, error) {
+	process, err := windows.OpenProcess(windows.PROCESS_QUERY_INFORMATION|windows.PROCESS_VM_READ, false, uint32(pid))
+	if err != nil {
+		return "", err
+	}
+	defer windows.CloseHandle(process)
+
+	var info windows.PROCESS_BASIC_INFORMATION
+	if err := windows.NtQueryInformationProcess(process, windows.ProcessBasicInformation, unsafe.Pointer(&info), uint32(unsafe.Sizeof(info)), nil); err != nil {
+		return "", err
+	}
+	peb := uintptr(unsafe.Pointer(info.PebBaseAddress))
+	if peb == 0 {
+		return "", errors.New("process has no PEB")
+	}
+
+	var params uintptr
+	if err := readRemote(process, peb+unsafe.Offsetof(windows.PEB{}.ProcessParameters), unsafe.Pointer(&params), unsafe.Sizeof(params)); err != nil {
+		return "", err
+	}
+	var dosPath remoteUnicodeString
+	offset := unsafe.Offsetof(windows.RTL_USER_PROCESS_PARAMETERS{}.CurrentDirectory) + unsafe.Offsetof(windows.CURDIR{}.DosPath)
+	if err := readRemote(process, params+offset, unsafe.Pointer(&dosPath), unsafe.Sizeof(dosPath)); err != nil {
+		return "", err
+	}
+	if dosPath.Length == 0 || dosPath.Length > maxRemoteCwdBytes || dosPath.Buffer == 0 {
+		return "", errors.New("current directory not available")
+	}
+
+	buf := make([]uint16, dosPath.Length/2)
+	if err := readRemote(process, dosPath.Buffer, unsafe.Pointer(&buf[0]), uintptr(dosPath.Length)); err != nil {
+		return "", err
+	}
+	return filepath.Clean(windows.UTF16ToString(buf)), nil
+}
+
+func readRemote(process windows.Handle, addr uintptr, dst unsafe.Pointer, size uintptr) error {
+	return windows.ReadProcessMemory(process, addr, (*byte)(dst), size, nil)
+}
@@ -1,6 +1,75 @@
 package terminal
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// titlePrefixEnv passes the title prefix to the shell integrations.
+	titlePrefixEnv     = "ALICES_MIRROR_TITLE_PREFIX"
+	defaultTitlePrefix = "alices-mirror"
+	maxTitlePrefix     = 64
+)
+
+// secretEnv are the variables the mirror is handed its tokens in. They are
+// never passed on to the shell, where any viewer allowed to type could read
+// them.
+var secretEnv = []string{"ALICES_MIRROR_OWNER_TOKEN", "ALICES_MIRROR_DEBUG_TOKEN"}
+
+// CheckTitlePrefix reports whether prefix can start the shell titles. It is
+// limited to letters, digits, spaces and -_.:()@#+,/[] so that every shell
+// integration, cmd's prompt included, passes it through unchanged.
+func CheckTitlePrefix(prefix string) error {
+	if utf8.RuneCountInString(prefix) > maxTitlePrefix {
+		return fmt.Errorf("title prefix is longer than %d characters", maxTitlePrefix)
+	}
+	if strings.ContainsFunc(prefix, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(" -_.:()@#+,/[]", r)
+	}) {
+		return errors.New("title prefix may only contain letters, digits, spaces and -_.:()@#+,/[]")
+	}
+	return nil
+}
+
+// resolveTitlePrefix returns prefix, or the one inherited through
+// titlePrefixEnv, or the default.
+func resolveTitlePrefix(prefix string) string {
+	if prefix = strings.TrimSpace(prefix); prefix != "" {
+		return prefix
+	}
+	if prefix = strings.TrimSpace(os.Getenv(titlePrefixEnv)); prefix != "" {
+		return prefix
+	}
+	return defaultTitlePrefix
+}
+
+// TitlePrefix returns the prefix of the titles the shell integrations emit.
+func (s *Session) TitlePrefix() string {
+	return s.titlePrefix
+}
+
+// shellEnv is the environment shells start with: the mirror's own, without
+// its tokens and with the session's title prefix.
+func (s *Session) shellEnv() []string {
+	env := dropEnvVar(withoutSecrets(os.Environ()), titlePrefixEnv)
+	if s.titlePrefix == "" {
+		return env
+	}
+	return append(env, titlePrefixEnv+"="+s.titlePrefix)
+}
+
+// withoutSecrets returns env without the variables in secretEnv.
+func withoutSecrets(env []string) []string {
+	for _, key := range secretEnv {
+		env = dropEnvVar(env, key)
+	}
+	return env
+}
 
 func dropEnvVar(env []string, key string) []string {
 	if key == "" {
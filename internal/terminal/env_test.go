@@ -0,0 +1,33 @@
+package terminal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShellEnvDropsTokens(t *testing.T) {
+	t.Setenv("ALICES_MIRROR_OWNER_TOKEN", "owner-secret")
+	t.Setenv("ALICES_MIRROR_DEBUG_TOKEN", "debug-secret")
+	t.Setenv(titlePrefixEnv, "stale")
+
+	s := &Session{titlePrefix: "alices-mirror(test)"}
+	var prefixes []string
+	for _, item := range s.shellEnv() {
+		key, value, _ := strings.Cut(item, "=")
+		switch key {
+		case "ALICES_MIRROR_OWNER_TOKEN", "ALICES_MIRROR_DEBUG_TOKEN":
+			t.Errorf("shell environment has %s", key)
+		case titlePrefixEnv:
+			prefixes = append(prefixes, value)
+		}
+	}
+	if len(prefixes) != 1 || prefixes[0] != "alices-mirror(test)" {
+		t.Errorf("title prefix = %q, want only %q", prefixes, "alices-mirror(test)")
+	}
+
+	for _, item := range withoutSecrets([]string{"ALICES_MIRROR_DEBUG_TOKEN=x", "HOME=/root"}) {
+		if strings.HasPrefix(item, "ALICES_MIRROR_DEBUG_TOKEN=") {
+			t.Errorf("tmux environment has %s", item)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package terminal
+
+// Filter transforms a stream of terminal data. It is given the stream in
+// order, in chunks of any size, and returns what to pass on in place of
+// each chunk, which may be shorter, longer or empty. A filter that matches
+// across chunks keeps its own state. It must not change the returned data
+// afterwards. A session calls each of its filters from one goroutine at a
+// time.
+type Filter interface {
+	Filter(data []byte) []byte
+}
+
+// FilterFunc adapts a function to Filter.
+type FilterFunc func(data []byte) []byte
+
+func (f FilterFunc) Filter(data []byte) []byte {
+	return f(data)
+}
+
+// runFilters passes data through filters in order.
+func runFilters(filters []Filter, data []byte) []byte {
+	for _, f := range filters {
+		if len(data) == 0 {
+			return nil
+		}
+		data = f.Filter(data)
+	}
+	return data
+}
+
+// intoChunkBuffer moves filtered output back into buf, the buffer it was
+// read into, or drops buf when the output no longer fits in it.
+func intoChunkBuffer(data []byte, buf *chunkBuffer) ([]byte, *chunkBuffer) {
+	if len(data) <= len(buf.data) {
+		return buf.data[:copy(buf.data, data)], buf
+	}
+	buf.release()
+	return data, nil
+}
+
+// outputWatcher is the session's own output filter. It passes output on
+// unchanged and reacts to what the shell reports in it: titles, the
+// working directory, OSC 52 clipboard copies, the bell and bracketed paste
+// mode.
+type outputWatcher struct {
+	s         *Session
+	parser    *oscTitleParser
+	pasteMode pasteModeTracker
+}
+
+func newOutputWatcher(s *Session) *outputWatcher {
+	return &outputWatcher{s: s, parser: newOSCTitleParser()}
+}
+
+func (w *outputWatcher) Filter(data []byte) []byte {
+	for _, event := range w.parser.Feed(data) {
+		switch event.Code {
+		case codeBell:
+			w.s.ringBell()
+		case 7:
+			w.s.captureWorkingDirectory(event.Data)
+		case 52:
+			w.s.captureClipboard(event.Data)
+		default:
+			w.s.captureTitle(event.Data)
+		}
+	}
+	if on, changed := w.pasteMode.Feed(data); changed {
+		w.s.bracketedPaste.Store(on)
+	}
+	return data
+}
@@ -0,0 +1,48 @@
+package terminal
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSessionFilters(t *testing.T) {
+	t.Parallel()
+
+	redact := FilterFunc(func(data []byte) []byte {
+		return bytes.ReplaceAll(data, []byte("hunter2"), []byte("[redacted]"))
+	})
+	dropBell := FilterFunc(func(data []byte) []byte {
+		return bytes.ReplaceAll(data, []byte("\a"), nil)
+	})
+	upper := FilterFunc(bytes.ToUpper)
+
+	pty := NewScriptedPTY(nil)
+	s := NewScriptedSession(Config{
+		OutputFilters: []Filter{redact, dropBell},
+		InputFilters:  []Filter{upper},
+	}, pty)
+	defer s.Close()
+
+	pty.Emit([]byte("\a"))
+	pty.Emit([]byte("password: hunter2\r\n"))
+	select {
+	case chunk := <-s.Output():
+		if got := string(chunk.Data); got != "password: [redacted]\r\n" || chunk.Offset != 0 {
+			t.Errorf("output chunk = %q at %d", got, chunk.Offset)
+		}
+		chunk.Release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("no output")
+	}
+	if got := string(s.Snapshot()); got != "password: [redacted]\r\n" {
+		t.Errorf("snapshot = %q", got)
+	}
+
+	if err := s.WriteInput([]byte("ls\r")); err != nil {
+		t.Fatalf("WriteInput: %v", err)
+	}
+	if got := string(pty.Input()); got != "LS\r" {
+		t.Errorf("input = %q, want LS\\r", got)
+	}
+}
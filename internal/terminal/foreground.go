@@ -0,0 +1,117 @@
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	foregroundPollInterval = time.Second
+	// titleInjectQuiet is how long the shell must have been silent before
+	// the session writes a title into its output, so the sequence does not
+	// land inside one the shell is still writing.
+	titleInjectQuiet = 150 * time.Millisecond
+)
+
+// foregroundReporter is implemented by commands whose shell does not put
+// the running program in its title, such as cmd.exe. Foreground returns the
+// program's name, or "" when there is nothing to report.
+type foregroundReporter interface {
+	Foreground() string
+}
+
+// foregroundDirReporter is implemented by foregroundReporters that also
+// know the running program's working directory. They stand in for prompt
+// hooks altogether, so they are ignored once the shell's hooks report a
+// title.
+type foregroundDirReporter interface {
+	ForegroundDir() string
+}
+
+// watchForeground polls reporter until done and, when the running program
+// or its directory changes, writes the title a prompt hook would have
+// written for it.
+func (s *Session) watchForeground(reporter foregroundReporter, done <-chan struct{}) {
+	dirs, _ := reporter.(foregroundDirReporter)
+	ticker := time.NewTicker(foregroundPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		name := reporter.Foreground()
+		if name == "" {
+			continue
+		}
+		s.mu.Lock()
+		currentCwd, current, hooked := s.lastTitleCwd, s.lastTitleProc, s.titleHooked
+		s.mu.Unlock()
+		if dirs != nil && hooked {
+			continue
+		}
+		cwd := currentCwd
+		if dirs != nil {
+			if dir := dirs.ForegroundDir(); dir != "" {
+				cwd = abbreviateHome(dir)
+			}
+		}
+		if name == current && cwd == currentCwd {
+			continue
+		}
+		if s.injectOutput([]byte(formatMirrorTitle(s.titlePrefix, cwd, name))) {
+			s.mu.Lock()
+			s.lastTitleProc = name
+			s.lastTitleCwd = cwd
+			s.mu.Unlock()
+		}
+	}
+}
+
+// abbreviateHome writes dir relative to the home directory as ~, the way
+// the prompt hooks do; expandLeadingTilde undoes it.
+func abbreviateHome(dir string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return dir
+	}
+	if dir == home {
+		return "~"
+	}
+	if rest, ok := strings.CutPrefix(dir, strings.TrimSuffix(home, "/")+"/"); ok {
+		return "~/" + rest
+	}
+	return dir
+}
+
+// injectOutput adds data to the output stream as if the shell had written
+// it, unless the shell wrote something within titleInjectQuiet.
+func (s *Session) injectOutput(data []byte) bool {
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+	if time.Since(s.lastOutput) < titleInjectQuiet {
+		return false
+	}
+	buf := getChunkBuffer(s.chunkPool)
+	if len(data) > len(buf.data) {
+		buf.release()
+		return false
+	}
+	chunk := buf.data[:copy(buf.data, data)]
+	offset := s.buffer.Append(chunk)
+	s.writeOutputLog(chunk)
+	s.emitOutput(OutputChunk{Data: chunk, Offset: offset, buf: buf})
+	return true
+}
+
+// formatMirrorTitle builds the OSC 0 title the shell integrations emit,
+// which parseAlicesMirrorTitle and the web client read back.
+func formatMirrorTitle(prefix, cwd, proc string) string {
+	clean := func(value string) string {
+		return strings.NewReplacer("|", "", "\x07", "", "\x1b", "").Replace(value)
+	}
+	return fmt.Sprintf("\x1b]0;%s|%s|%s\x07", clean(prefix), clean(cwd), clean(proc))
+}
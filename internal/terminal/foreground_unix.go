@@ -0,0 +1,77 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ptyShellCommand is a shell on a PTY. For shells without the mirror's
+// prompt hooks, such as zsh, fish or ksh or a bash whose rc file execs
+// another shell, the running program and its directory are found from the
+// PTY's foreground process group instead.
+type ptyShellCommand struct {
+	*execShellCommand
+	pty *os.File
+}
+
+// Foreground returns the name of the foreground process group's leader,
+// which is the shell itself while it is at its prompt.
+func (c *ptyShellCommand) Foreground() string {
+	pgrp := c.foregroundGroup()
+	if pgrp <= 0 {
+		return ""
+	}
+	return processComm(pgrp)
+}
+
+// ForegroundDir returns the foreground process group leader's working
+// directory.
+func (c *ptyShellCommand) ForegroundDir() string {
+	pgrp := c.foregroundGroup()
+	if pgrp <= 0 {
+		return ""
+	}
+	dir, err := readProcCwd(pgrp)
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// foregroundGroup is tcgetpgrp on the PTY. It goes through SyscallConn
+// because Fd would switch the PTY to blocking mode under the read loop.
+func (c *ptyShellCommand) foregroundGroup() int {
+	conn, err := c.pty.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	pgrp := 0
+	_ = conn.Control(func(fd uintptr) {
+		pgrp, err = unix.IoctlGetInt(int(fd), unix.TIOCGPGRP)
+	})
+	if err != nil {
+		return 0
+	}
+	return pgrp
+}
+
+// processComm returns the command name of pid from /proc, or from ps where
+// there is no /proc.
+func processComm(pid int) string {
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid)); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(strings.TrimSpace(string(out)))
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package terminal
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// cmdShellCommand is a cmd.exe shell. cmd's prompt hook can only title the
+// prompt, so the running program is found from the shell's child processes.
+type cmdShellCommand struct {
+	*windowsShellCommand
+}
+
+// Foreground returns the newest child of cmd.exe other than its console
+// host, without the .exe extension.
+func (c *cmdShellCommand) Foreground() string {
+	pid := uint32(c.PID())
+	if pid == 0 {
+		return ""
+	}
+	processes, err := snapshotProcesses()
+	if err != nil {
+		return ""
+	}
+	name := ""
+	for _, proc := range processes {
+		if proc.parent != pid || strings.EqualFold(proc.exe, "conhost.exe") {
+			continue
+		}
+		name = strings.TrimSuffix(proc.exe, filepath.Ext(proc.exe))
+	}
+	return name
+}
@@ -0,0 +1,17 @@
+package terminal
+
+import "os"
+
+// Handoff is a running shell passed from one session to another, usually
+// in a new process of the mirror, so that restarting the mirror does not
+// end the shell.
+type Handoff struct {
+	// PTY is the terminal the shell runs in and PID the shell itself.
+	PTY *os.File
+	PID int
+	// Scrollback is the output the session kept, and Cols and Rows the
+	// terminal's last size.
+	Scrollback []byte
+	Cols       int
+	Rows       int
+}
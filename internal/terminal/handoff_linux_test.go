@@ -0,0 +1,67 @@
+package terminal
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSessionHandoff(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{WorkDir: t.TempDir(), Shell: "/bin/sh"}
+	first, err := NewSession(cfg)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	select {
+	case <-first.Status():
+	case <-time.After(5 * time.Second):
+		t.Fatal("shell did not start")
+	}
+	if err := first.WriteInput([]byte("X=handed; echo before\n")); err != nil {
+		t.Fatalf("WriteInput: %v", err)
+	}
+	readUntil(t, first, "before")
+
+	h, err := first.Handoff()
+	if err != nil {
+		t.Fatalf("Handoff: %v", err)
+	}
+	select {
+	case <-first.Done():
+	default:
+		t.Error("session not done after Handoff")
+	}
+
+	cfg.Adopt = h
+	second, err := NewSession(cfg)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer second.Close()
+	if !bytes.Contains(second.Snapshot(), []byte("before")) {
+		t.Errorf("scrollback not handed over: %q", second.Snapshot())
+	}
+	// The shell still has its variables, so it is the same one.
+	time.Sleep(100 * time.Millisecond)
+	if err := second.WriteInput([]byte("echo $X-after\n")); err != nil {
+		t.Fatalf("WriteInput: %v", err)
+	}
+	readUntil(t, second, "handed-after")
+}
+
+func readUntil(t *testing.T, s *Session, want string) {
+	t.Helper()
+	var output []byte
+	timeout := time.After(5 * time.Second)
+	for !bytes.Contains(output, []byte(want)) {
+		select {
+		case chunk := <-s.Output():
+			output = append(output, chunk.Data...)
+			chunk.Release()
+		case <-timeout:
+			t.Fatalf("waiting for %q, got %q", want, output)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Handoff ends the session without ending its shell and returns what a new
+// session needs to take the shell over with Config.Adopt. When it returns,
+// the session no longer reads from the PTY and is done. Only a shell the
+// session started itself can be handed off, and only where reads from its
+// PTY can be interrupted.
+func (s *Session) Handoff() (*Handoff, error) {
+	s.mu.Lock()
+	cmd, err := s.handoffCommand()
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	pty, err := dupFile(cmd.pty)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.closed = true
+	s.handedOff = true
+	close(s.stopCh)
+	h := &Handoff{PTY: pty, PID: cmd.PID(), Cols: s.lastCols, Rows: s.lastRows}
+	s.mu.Unlock()
+
+	// Reading stops at the deadline; the shell is left alone.
+	s.SetOutputPaused(false)
+	_ = cmd.pty.SetReadDeadline(time.Now())
+	<-s.doneCh
+	h.Scrollback = s.Snapshot()
+	return h, nil
+}
+
+// CanHandoff reports why Handoff would fail now, if it would.
+func (s *Session) CanHandoff() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.handoffCommand()
+	return err
+}
+
+// handoffCommand returns the shell to hand off. s.mu must be held.
+func (s *Session) handoffCommand() (*ptyShellCommand, error) {
+	cmd, ok := s.cmd.(*ptyShellCommand)
+	switch {
+	case s.closed:
+		return nil, errors.New("session is closed")
+	case !ok:
+		return nil, errors.New("only a local shell can be handed off")
+	case s.cgroup != "":
+		return nil, errors.New("a shell with resource limits cannot be handed off")
+	}
+	if err := cmd.pty.SetReadDeadline(time.Time{}); err != nil {
+		return nil, fmt.Errorf("the shell cannot be handed off on this system: %w", err)
+	}
+	return cmd, nil
+}
+
+// adoptShell takes over the shell of h.
+func adoptShell(h *Handoff) (shellCommand, ptyDevice, error) {
+	proc, err := os.FindProcess(h.PID)
+	if err != nil {
+		return nil, nil, err
+	}
+	file := pollable(h.PTY)
+	cmd := &execShellCommand{cmd: &exec.Cmd{Process: proc}, adopted: true}
+	return &ptyShellCommand{execShellCommand: cmd, pty: file}, &unixPTYDevice{file: file}, nil
+}
+
+// dupFile returns a copy of f that is closed on exec, as files opened by
+// Go are.
+func dupFile(f *os.File) (*os.File, error) {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	fd := -1
+	var dupErr error
+	if err := conn.Control(func(raw uintptr) {
+		fd, dupErr = unix.FcntlInt(raw, unix.F_DUPFD_CLOEXEC, 0)
+	}); err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, dupErr
+	}
+	return os.NewFile(uintptr(fd), f.Name()), nil
+}
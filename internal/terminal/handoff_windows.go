@@ -0,0 +1,21 @@
+package terminal
+
+import "errors"
+
+// errNoHandoff is returned on Windows, where a pseudo console cannot be
+// passed to another process.
+var errNoHandoff = errors.New("handing off the shell is not supported on Windows")
+
+// Handoff is not supported on Windows.
+func (s *Session) Handoff() (*Handoff, error) {
+	return nil, errNoHandoff
+}
+
+// CanHandoff always fails on Windows.
+func (s *Session) CanHandoff() error {
+	return errNoHandoff
+}
+
+func adoptShell(*Handoff) (shellCommand, ptyDevice, error) {
+	return nil, nil, errNoHandoff
+}
@@ -0,0 +1,15 @@
+package terminal
+
+// Limits caps the resources used by the shell and everything started from
+// it. Zero fields are unlimited.
+type Limits struct {
+	// CPU is the number of CPUs the shell may keep busy, such as 0.5.
+	CPU float64
+	// Memory is in bytes.
+	Memory int64
+	PIDs   int
+}
+
+func (l Limits) IsZero() bool {
+	return l.CPU == 0 && l.Memory == 0 && l.PIDs == 0
+}
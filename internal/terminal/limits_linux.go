@@ -0,0 +1,169 @@
+package terminal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+	// cpuPeriod is the cpu.max period, in microseconds.
+	cpuPeriod = 100000
+)
+
+// CheckLimits reports whether the shell's resources can be limited: the
+// mirror must be root and cgroup v2 must be mounted with the needed
+// controllers.
+func CheckLimits(l Limits) error {
+	data, err := os.ReadFile(filepath.Join(cgroupRoot, "cgroup.controllers"))
+	if err != nil {
+		return errors.New("cgroup v2 is not mounted at " + cgroupRoot)
+	}
+	available := strings.Fields(string(data))
+	for _, controller := range limitControllers(l) {
+		if !slices.Contains(available, controller) {
+			return fmt.Errorf("the %s cgroup controller is not available", controller)
+		}
+	}
+	if os.Geteuid() != 0 {
+		return errors.New("the mirror must be started as root")
+	}
+	return nil
+}
+
+func limitControllers(l Limits) []string {
+	var controllers []string
+	if l.CPU > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if l.Memory > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if l.PIDs > 0 {
+		controllers = append(controllers, "pids")
+	}
+	return controllers
+}
+
+// setupLimits creates the cgroup shells are started in. The mirror moves
+// into a "mirror" child of its own cgroup so that a "shell" sibling can
+// carry the limits; with RunAs, that account may move processes into the
+// shell cgroup but not change its limits or leave it.
+func (s *Session) setupLimits() error {
+	if err := CheckLimits(s.limits); err != nil {
+		return err
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		return err
+	}
+	base := filepath.Join(cgroupRoot, own)
+
+	mirror := filepath.Join(base, "alices-mirror")
+	if err := os.MkdirAll(mirror, 0o755); err != nil {
+		return fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	if err := writeCgroup(mirror, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+		return err
+	}
+	var enable []string
+	for _, controller := range limitControllers(s.limits) {
+		enable = append(enable, "+"+controller)
+	}
+	if err := writeCgroup(base, "cgroup.subtree_control", strings.Join(enable, " ")); err != nil {
+		return fmt.Errorf("%w (the mirror must be the only process in its cgroup; start it with systemd-run --scope -p Delegate=yes or in its own service)", err)
+	}
+
+	shell := filepath.Join(base, fmt.Sprintf("alices-mirror-shell-%d", os.Getpid()))
+	if err := os.Mkdir(shell, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	if s.limits.CPU > 0 {
+		quota := max(int(s.limits.CPU*cpuPeriod), 1000)
+		if err := writeCgroup(shell, "cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriod)); err != nil {
+			return err
+		}
+	}
+	if s.limits.Memory > 0 {
+		if err := writeCgroup(shell, "memory.max", strconv.FormatInt(s.limits.Memory, 10)); err != nil {
+			return err
+		}
+		// Without this a memory hog pushes the host into swap instead.
+		_ = writeCgroup(shell, "memory.swap.max", "0")
+	}
+	if s.limits.PIDs > 0 {
+		if err := writeCgroup(shell, "pids.max", strconv.Itoa(s.limits.PIDs)); err != nil {
+			return err
+		}
+	}
+	if a := s.runAs; a != nil {
+		for _, path := range []string{filepath.Join(base, "cgroup.procs"), filepath.Join(shell, "cgroup.procs")} {
+			if err := os.Chown(path, int(a.UID), int(a.GID)); err != nil {
+				return fmt.Errorf("failed to delegate cgroup to %s: %w", a.Username, err)
+			}
+		}
+	}
+	s.cgroup = shell
+	return nil
+}
+
+// limitCommand starts cmd in the shell cgroup. The returned function
+// releases the cgroup handle once cmd has started.
+func (s *Session) limitCommand(cmd *exec.Cmd) (func(), error) {
+	if s.cgroup == "" {
+		return func() {}, nil
+	}
+	dir, err := os.Open(s.cgroup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return func() { _ = dir.Close() }, nil
+}
+
+// releaseLimits ends whatever is left in the shell cgroup and removes it.
+func (s *Session) releaseLimits() {
+	if s.cgroup == "" {
+		return
+	}
+	_ = writeCgroup(s.cgroup, "cgroup.kill", "1")
+	for range 20 {
+		if err := os.Remove(s.cgroup); err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	logger().Warn("failed to remove shell cgroup", "path", s.cgroup)
+}
+
+// ownCgroup returns this process's cgroup v2 path.
+func ownCgroup() (string, error) {
+	file, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", errors.New("not in a cgroup v2 hierarchy")
+}
+
+func writeCgroup(dir, name, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0); err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux && !windows
+
+package terminal
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// CheckLimits always fails: resource limits need cgroup v2 or a Windows
+// job object.
+func CheckLimits(Limits) error {
+	return errors.New("not supported on this platform")
+}
+
+func (s *Session) setupLimits() error {
+	return CheckLimits(s.limits)
+}
+
+func (s *Session) limitCommand(*exec.Cmd) (func(), error) {
+	return func() {}, nil
+}
+
+func (s *Session) releaseLimits() {}
@@ -0,0 +1,66 @@
+//go:build windows
+
+package terminal
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	jobCPURateControlEnable  = 0x1
+	jobCPURateControlHardCap = 0x4
+)
+
+// jobCPURateControlInformation is JOBOBJECT_CPU_RATE_CONTROL_INFORMATION
+// with the CpuRate member of its union.
+type jobCPURateControlInformation struct {
+	ControlFlags uint32
+	CPURate      uint32
+}
+
+// CheckLimits reports whether the shell's resources can be limited. Every
+// shell runs in a job object, so they always can.
+func CheckLimits(Limits) error {
+	return nil
+}
+
+// The limits are applied to each shell's job in startAttachedProcess.
+func (s *Session) setupLimits() error {
+	return nil
+}
+
+func (s *Session) releaseLimits() {}
+
+// applyJobLimits sets l on job. CPU is converted to a hard cap on the share
+// of all CPUs, in hundredths of a percent.
+func applyJobLimits(job windows.Handle, l Limits) error {
+	if l.Memory > 0 || l.PIDs > 0 {
+		var info windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+		if l.Memory > 0 {
+			info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_JOB_MEMORY
+			info.JobMemoryLimit = uintptr(l.Memory)
+		}
+		if l.PIDs > 0 {
+			info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_ACTIVE_PROCESS
+			info.BasicLimitInformation.ActiveProcessLimit = uint32(l.PIDs)
+		}
+		if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+			return fmt.Errorf("failed to set job limits: %w", err)
+		}
+	}
+	if l.CPU > 0 {
+		rate := uint32(min(max(l.CPU/float64(runtime.NumCPU())*10000, 1), 10000))
+		info := jobCPURateControlInformation{
+			ControlFlags: jobCPURateControlEnable | jobCPURateControlHardCap,
+			CPURate:      rate,
+		}
+		if _, err := windows.SetInformationJobObject(job, windows.JobObjectCpuRateControlInformation, uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+			return fmt.Errorf("failed to set job CPU rate: %w", err)
+		}
+	}
+	return nil
+}
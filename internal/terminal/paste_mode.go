@@ -0,0 +1,47 @@
+package terminal
+
+import "bytes"
+
+var (
+	bracketedPasteOn  = []byte("\x1b[?2004h")
+	bracketedPasteOff = []byte("\x1b[?2004l")
+)
+
+// pasteModeTracker follows the shell switching bracketed paste mode (DECSET
+// 2004) on and off, including switches split across reads.
+type pasteModeTracker struct {
+	tail []byte
+}
+
+// Feed scans data and reports the last mode it switched to, if any.
+func (t *pasteModeTracker) Feed(data []byte) (on bool, changed bool) {
+	keep := len(bracketedPasteOn) - 1
+	// A switch that starts in the previous read can only end within the
+	// first keep bytes of this one.
+	edge := append(t.tail, data[:min(len(data), keep)]...)
+	on, changed = lastPasteSwitch(edge)
+	if inData, found := lastPasteSwitch(data); found {
+		on, changed = inData, true
+	}
+	if len(data) >= keep {
+		t.tail = append(t.tail[:0], data[len(data)-keep:]...)
+	} else {
+		t.tail = append(t.tail[:0], edge[len(edge)-min(len(edge), keep):]...)
+	}
+	return on, changed
+}
+
+func lastPasteSwitch(data []byte) (on bool, found bool) {
+	onAt := bytes.LastIndex(data, bracketedPasteOn)
+	offAt := bytes.LastIndex(data, bracketedPasteOff)
+	if onAt < 0 && offAt < 0 {
+		return false, false
+	}
+	return onAt > offAt, true
+}
+
+// BracketedPaste reports whether the program in the shell asked for pasted
+// text to be wrapped in ESC [200~ and ESC [201~.
+func (s *Session) BracketedPaste() bool {
+	return s.bracketedPaste.Load()
+}
@@ -0,0 +1,25 @@
+package terminal
+
+import "testing"
+
+func TestPasteModeTracker(t *testing.T) {
+	t.Parallel()
+
+	var tracker pasteModeTracker
+	steps := []struct {
+		data        string
+		on, changed bool
+	}{
+		{data: "prompt$ ", on: false, changed: false},
+		{data: "\x1b[?20", on: false, changed: false},
+		{data: "04h$ ", on: true, changed: true},
+		{data: "ls\r\n\x1b[?2004l", on: false, changed: true},
+		{data: "\x1b[?2004l\x1b[?2004h", on: true, changed: true},
+	}
+	for _, step := range steps {
+		on, changed := tracker.Feed([]byte(step.data))
+		if on != step.on || changed != step.changed {
+			t.Errorf("Feed(%q) = %v, %v; want %v, %v", step.data, on, changed, step.on, step.changed)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package terminal
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// processEntry is a process in a Toolhelp snapshot.
+type processEntry struct {
+	pid    uint32
+	parent uint32
+	exe    string
+}
+
+// snapshotProcesses lists the processes running on the machine.
+func snapshotProcesses() ([]processEntry, error) {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	var entries []processEntry
+	var entry windows.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Process32First(snapshot, &entry); err == nil; err = windows.Process32Next(snapshot, &entry) {
+		entries = append(entries, processEntry{
+			pid:    entry.ProcessID,
+			parent: entry.ParentProcessID,
+			exe:    windows.UTF16ToString(entry.ExeFile[:]),
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,24 @@
+package terminal
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// pollable returns the PTY master f as a file read through the runtime
+// poller, so that closing it ends a pending Read even while programs the
+// shell left behind hold the terminal open. pty.Start hands it back in
+// blocking mode.
+func pollable(f *os.File) *os.File {
+	fd, err := unix.FcntlInt(f.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return f
+	}
+	if err := unix.SetNonblock(fd, true); err != nil {
+		_ = unix.Close(fd)
+		return f
+	}
+	_ = f.Close()
+	return os.NewFile(uintptr(fd), f.Name())
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package terminal
+
+import "os"
+
+// pollable keeps the PTY master in blocking mode: kqueue does not watch
+// terminal devices reliably on the BSDs and macOS.
+func pollable(f *os.File) *os.File {
+	return f
+}
@@ -0,0 +1,56 @@
+package terminal
+
+import (
+	"io"
+	"sync"
+)
+
+// NewReaderSession returns a session whose output is read from r instead of a
+// shell. Input and resizes are discarded. Once r is exhausted the session
+// stays open, keeping its buffer, until Close. It is used to drive the server
+// with synthetic output in benchmarks.
+func NewReaderSession(cfg Config, r io.Reader) *Session {
+	s := newSession(cfg)
+	device := &readerDevice{r: r, closed: make(chan struct{})}
+	s.setPTY(nil, device)
+	go func() {
+		s.readLoop(device)
+		s.closeChannels()
+	}()
+	return s
+}
+
+type readerDevice struct {
+	r         io.Reader
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (d *readerDevice) Read(p []byte) (int, error) {
+	select {
+	case <-d.closed:
+		return 0, io.EOF
+	default:
+	}
+	n, err := d.r.Read(p)
+	if err == io.EOF {
+		if n > 0 {
+			return n, nil
+		}
+		<-d.closed
+	}
+	return n, err
+}
+
+func (d *readerDevice) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (d *readerDevice) Resize(cols, rows int) error {
+	return nil
+}
+
+func (d *readerDevice) Close() error {
+	d.closeOnce.Do(func() { close(d.closed) })
+	return nil
+}
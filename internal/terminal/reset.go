@@ -1,17 +1,98 @@
 package terminal
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 type ProcessInfo struct {
 	PID  int    `json:"pid"`
 	Name string `json:"name"`
 }
 
+// DefaultResetWait is how long a reset waits for processes to exit after
+// each step before it escalates.
+const DefaultResetWait = 700 * time.Millisecond
+
+// ResetOptions control how Reset ends the shell's processes.
+type ResetOptions struct {
+	// Wait is how long each step, such as SIGTERM and then SIGKILL, is
+	// given before the next. Defaults to DefaultResetWait.
+	Wait time.Duration
+	// Sudo lets a reset on Unix finish with "sudo -n kill -9" when the
+	// processes survive SIGKILL, as they do after changing user.
+	Sudo bool
+
+	// progress is told about each step of one reset.
+	progress func(ResetProgress)
+}
+
+// ResetStep is a step of a reset, in the order they are taken.
+type ResetStep string
+
+const (
+	// ResetTerminating: the processes were asked to exit (SIGTERM, or the
+	// terminal closed on Windows).
+	ResetTerminating ResetStep = "terminate"
+	// ResetKilling: some outlived the wait and are being killed.
+	ResetKilling ResetStep = "kill"
+	// ResetSudoKilling: some outlived SIGKILL and are killed through sudo.
+	ResetSudoKilling ResetStep = "sudo-kill"
+)
+
+// ResetProgress reports a step of a reset as it is taken. Wait is how long
+// the step is given; Remaining lists the processes still running when the
+// step started, where that is known.
+type ResetProgress struct {
+	Step      ResetStep
+	Wait      time.Duration
+	Remaining []ProcessInfo
+}
+
+func (o ResetOptions) report(step ResetStep, remaining []ProcessInfo) {
+	if o.progress != nil {
+		o.progress(ResetProgress{Step: step, Wait: o.wait(), Remaining: remaining})
+	}
+}
+
+func (o ResetOptions) wait() time.Duration {
+	if o.Wait <= 0 {
+		return DefaultResetWait
+	}
+	return o.Wait
+}
+
+// resetter is implemented by commands that track their own processes, such
+// as a shell in a container or a Windows shell in a job object, and so
+// reset themselves.
+type resetter interface {
+	Reset(opts ResetOptions) ([]ProcessInfo, error)
+}
+
+// Reset ends the shell and everything started from it, escalating from a
+// polite request to killing; the session then starts a new shell. It
+// returns the processes that could not be ended.
 func (s *Session) Reset() ([]ProcessInfo, error) {
+	return s.ResetWithProgress(nil)
+}
+
+// ResetWithProgress is Reset, telling progress about each step as it is
+// taken so a reset that takes a while can be followed.
+func (s *Session) ResetWithProgress(progress func(ResetProgress)) ([]ProcessInfo, error) {
 	s.mu.Lock()
 	cmd := s.cmd
 	ptyHandle := s.pty
 	s.mu.Unlock()
+	opts := s.resetOptions
+	opts.progress = progress
+
+	if r, ok := cmd.(resetter); ok {
+		remaining, err := r.Reset(opts)
+		if ptyHandle != nil {
+			_ = ptyHandle.Close()
+		}
+		return remaining, err
+	}
 
 	if cmd == nil || cmd.PID() <= 0 {
 		return nil, errors.New("shell not ready")
@@ -21,5 +102,64 @@ func (s *Session) Reset() ([]ProcessInfo, error) {
 		_ = ptyHandle.Close()
 	}
 
-	return terminateProcessTree(cmd.PID())
+	return terminateProcessTree(cmd.PID(), opts)
+}
+
+const (
+	// softResetQuiet is how long the shell must be silent after the
+	// interrupt before the terminal is reset, and softResetDrain bounds the
+	// wait for that.
+	softResetQuiet = 150 * time.Millisecond
+	softResetDrain = time.Second
+)
+
+// interrupter is implemented by commands that can interrupt the program in
+// the foreground directly, without going through the terminal's line
+// discipline.
+type interrupter interface {
+	Interrupt() error
+}
+
+// SoftReset recovers the terminal without ending the shell: the foreground
+// program is interrupted, its remaining output is let through, and the
+// terminal is reset (RIS) with the buffered output dropped, so clients that
+// join later start from a clean screen. Finally the program is asked to
+// redraw with ^L.
+func (s *Session) SoftReset() error {
+	s.mu.Lock()
+	cmd := s.cmd
+	ptyHandle := s.pty
+	s.mu.Unlock()
+	if cmd == nil || ptyHandle == nil {
+		return errors.New("shell not ready")
+	}
+
+	if i, ok := cmd.(interrupter); !ok || i.Interrupt() != nil {
+		if err := s.WriteInput([]byte{0x03}); err != nil {
+			return err
+		}
+	}
+
+	interrupted := time.Now()
+	deadline := interrupted.Add(softResetDrain)
+	for time.Now().Before(deadline) {
+		s.emitMu.Lock()
+		quiet := time.Since(s.lastOutput) >= softResetQuiet && time.Since(interrupted) >= softResetQuiet
+		s.emitMu.Unlock()
+		if quiet {
+			break
+		}
+		time.Sleep(softResetQuiet / 3)
+	}
+
+	s.emitMu.Lock()
+	buf := getChunkBuffer(s.chunkPool)
+	chunk := buf.data[:copy(buf.data, "\x1bc")]
+	s.buffer.Clear()
+	offset := s.buffer.Append(chunk)
+	s.writeOutputLog(chunk)
+	s.emitOutput(OutputChunk{Data: chunk, Offset: offset, buf: buf})
+	s.emitMu.Unlock()
+
+	return s.WriteInput([]byte{0x0c})
 }
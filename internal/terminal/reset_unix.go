@@ -12,13 +12,7 @@ import (
 	"time"
 )
 
-const (
-	resetGracefulWait = 700 * time.Millisecond
-	resetForceWait    = 700 * time.Millisecond
-	resetSudoWait     = 700 * time.Millisecond
-)
-
-func terminateProcessTree(pid int) ([]ProcessInfo, error) {
+func terminateProcessTree(pid int, opts ResetOptions) ([]ProcessInfo, error) {
 	if pid <= 0 {
 		return nil, errors.New("shell not ready")
 	}
@@ -27,20 +21,29 @@ func terminateProcessTree(pid int) ([]ProcessInfo, error) {
 	if err != nil || pgid <= 0 {
 		pgid = pid
 	}
+	if pgid == syscall.Getpgrp() {
+		// Signalling the group would take the mirror down with the shell.
+		return []ProcessInfo{{PID: pid, Name: "shell"}}, errors.New("shell shares the mirror's process group; not signalling it")
+	}
 
 	_ = syscall.Kill(-pgid, syscall.SIGTERM)
-	if waitForProcessGroupExit(pgid, resetGracefulWait) {
+	opts.report(ResetTerminating, nil)
+	if waitForProcessGroupExit(pgid, opts.wait()) {
 		return nil, nil
 	}
 
+	opts.report(ResetKilling, listProcessGroup(pgid))
 	_ = syscall.Kill(-pgid, syscall.SIGKILL)
-	if waitForProcessGroupExit(pgid, resetForceWait) {
+	if waitForProcessGroupExit(pgid, opts.wait()) {
 		return nil, nil
 	}
 
-	_ = runSudoKill(pgid)
-	if waitForProcessGroupExit(pgid, resetSudoWait) {
-		return nil, nil
+	if opts.Sudo {
+		opts.report(ResetSudoKilling, listProcessGroup(pgid))
+		_ = runSudoKill(pgid)
+		if waitForProcessGroupExit(pgid, opts.wait()) {
+			return nil, nil
+		}
 	}
 
 	if !isProcessGroupAlive(pgid) {
@@ -55,6 +58,19 @@ func terminateProcessTree(pid int) ([]ProcessInfo, error) {
 	return remaining, errors.New("some processes could not be terminated")
 }
 
+// Interrupt sends SIGINT to the PTY's foreground process group, which is
+// what ^C does unless the program turned signals off.
+func (c *ptyShellCommand) Interrupt() error {
+	pgrp := c.foregroundGroup()
+	if pgrp <= 0 {
+		return errors.New("no foreground process group")
+	}
+	if pgrp == syscall.Getpgrp() {
+		return errors.New("foreground group is the mirror's own")
+	}
+	return syscall.Kill(-pgrp, syscall.SIGINT)
+}
+
 func runSudoKill(pgid int) error {
 	if pgid <= 0 {
 		return errors.New("invalid process group")
@@ -3,39 +3,96 @@
 package terminal
 
 import (
-	"encoding/csv"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"os/exec"
+	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
 )
 
 const (
-	resetGracefulWait = 700 * time.Millisecond
-	resetForceWait    = 700 * time.Millisecond
+	// maxJobProcesses bounds the process list read from a job.
+	maxJobProcesses = 1024
+
+	// stillActive is the exit code GetExitCodeProcess reports for a
+	// running process.
+	stillActive = 259
 )
 
-type windowsProcessInfo struct {
-	ProcessId int    `json:"ProcessId"`
-	Name      string `json:"Name"`
+// Reset ends every process in the shell's job. Without a job it falls back
+// to terminateProcessTree.
+func (c *windowsShellCommand) Reset(opts ResetOptions) ([]ProcessInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.job == 0 {
+		return terminateProcessTree(c.pid, opts)
+	}
+
+	opts.report(ResetKilling, jobProcesses(c.job))
+	if err := windows.TerminateJobObject(c.job, 1); err != nil {
+		return jobProcesses(c.job), fmt.Errorf("failed to terminate job: %w", err)
+	}
+	deadline := time.Now().Add(opts.wait())
+	for {
+		remaining := jobProcesses(c.job)
+		if len(remaining) == 0 {
+			return nil, nil
+		}
+		if time.Now().After(deadline) {
+			return remaining, errors.New("some processes could not be terminated")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// jobProcesses lists the processes still running in job.
+func jobProcesses(job windows.Handle) []ProcessInfo {
+	var list struct {
+		Assigned uint32
+		InList   uint32
+		IDs      [maxJobProcesses]uintptr
+	}
+	err := windows.QueryInformationJobObject(job, windows.JobObjectBasicProcessIdList, uintptr(unsafe.Pointer(&list)), uint32(unsafe.Sizeof(list)), nil)
+	if err != nil && !errors.Is(err, windows.ERROR_MORE_DATA) {
+		return nil
+	}
+	infos := make([]ProcessInfo, 0, list.InList)
+	for _, id := range list.IDs[:min(list.InList, maxJobProcesses)] {
+		pid := int(id)
+		if !isProcessAlive(pid) {
+			continue
+		}
+		infos = append(infos, ProcessInfo{PID: pid, Name: processName(pid)})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].PID < infos[j].PID
+	})
+	return infos
 }
 
-func terminateProcessTree(pid int) ([]ProcessInfo, error) {
+// terminateProcessTree ends pid and its descendants one by one. It is only
+// used for shells that are not in a job. Windows has no sudo, so opts.Sudo
+// is ignored.
+func terminateProcessTree(pid int, opts ResetOptions) ([]ProcessInfo, error) {
 	if pid <= 0 {
 		return nil, errors.New("shell not ready")
 	}
 
-	_ = exec.Command("taskkill", "/T", "/PID", strconv.Itoa(pid)).Run()
-	if waitForProcessTreeExit(pid, resetGracefulWait) {
+	opts.report(ResetTerminating, nil)
+	if waitForProcessTreeExit(pid, opts.wait()) {
 		return nil, nil
 	}
 
-	_ = exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
-	if waitForProcessTreeExit(pid, resetForceWait) {
+	procs := listProcessTree(pid)
+	opts.report(ResetKilling, procs)
+	for _, proc := range procs {
+		terminateProcess(proc.PID)
+	}
+	if waitForProcessTreeExit(pid, opts.wait()) {
 		return nil, nil
 	}
 
@@ -47,6 +104,15 @@ func terminateProcessTree(pid int) ([]ProcessInfo, error) {
 	return remaining, errors.New("some processes could not be terminated")
 }
 
+func terminateProcess(pid int) {
+	handle, err := windows.OpenProcess(windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		return
+	}
+	defer windows.CloseHandle(handle)
+	_ = windows.TerminateProcess(handle, 1)
+}
+
 func waitForProcessTreeExit(pid int, timeout time.Duration) bool {
 	if pid <= 0 {
 		return true
@@ -61,44 +127,37 @@ func waitForProcessTreeExit(pid int, timeout time.Duration) bool {
 	return len(listProcessTree(pid)) == 0
 }
 
+// listProcessTree lists pid and its descendants from a Toolhelp snapshot.
 func listProcessTree(pid int) []ProcessInfo {
 	if pid <= 0 {
 		return nil
 	}
-	script := fmt.Sprintf("$ErrorActionPreference='SilentlyContinue';$rootPid=%d;$procs=Get-CimInstance Win32_Process | Select-Object ProcessId,ParentProcessId,Name;function Get-Descendants([int]$parent){$children=$procs | Where-Object { $_.ParentProcessId -eq $parent };foreach($child in $children){$child;Get-Descendants $child.ProcessId}};$root=$procs | Where-Object { $_.ProcessId -eq $rootPid };$list=@();if ($root){$list += $root};$list += Get-Descendants $rootPid;$list | Select-Object ProcessId,Name | ConvertTo-Json -Compress", pid)
-	out, err := exec.Command("powershell.exe", "-NoProfile", "-Command", script).Output()
+	processes, err := snapshotProcesses()
 	if err != nil {
 		return listSingleProcess(pid)
 	}
-	raw := strings.TrimSpace(string(out))
-	if raw == "" || raw == "null" {
-		return nil
-	}
-	if strings.HasPrefix(raw, "[") {
-		var items []windowsProcessInfo
-		if err := json.Unmarshal([]byte(raw), &items); err != nil {
-			return listSingleProcess(pid)
+	children := make(map[uint32][]processEntry)
+	var infos []ProcessInfo
+	for _, proc := range processes {
+		if proc.pid == uint32(pid) {
+			infos = append(infos, ProcessInfo{PID: pid, Name: processEntryName(proc)})
+		} else if proc.pid != proc.parent {
+			children[proc.parent] = append(children[proc.parent], proc)
 		}
-		return toProcessInfo(items)
 	}
-	var item windowsProcessInfo
-	if err := json.Unmarshal([]byte(raw), &item); err != nil {
-		return listSingleProcess(pid)
-	}
-	return toProcessInfo([]windowsProcessInfo{item})
-}
-
-func toProcessInfo(items []windowsProcessInfo) []ProcessInfo {
-	infos := make([]ProcessInfo, 0, len(items))
-	for _, item := range items {
-		if item.ProcessId <= 0 {
-			continue
+	queue := []uint32{uint32(pid)}
+	seen := map[uint32]bool{uint32(pid): true}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range children[parent] {
+			if seen[child.pid] {
+				continue
+			}
+			seen[child.pid] = true
+			infos = append(infos, ProcessInfo{PID: int(child.pid), Name: processEntryName(child)})
+			queue = append(queue, child.pid)
 		}
-		name := strings.TrimSpace(item.Name)
-		if name == "" {
-			name = "unknown"
-		}
-		infos = append(infos, ProcessInfo{PID: item.ProcessId, Name: name})
 	}
 	sort.Slice(infos, func(i, j int) bool {
 		return infos[i].PID < infos[j].PID
@@ -106,29 +165,47 @@ func toProcessInfo(items []windowsProcessInfo) []ProcessInfo {
 	return infos
 }
 
+func processEntryName(proc processEntry) string {
+	if name := strings.TrimSpace(proc.exe); name != "" {
+		return name
+	}
+	return "unknown"
+}
+
 func listSingleProcess(pid int) []ProcessInfo {
 	if !isProcessAlive(pid) {
 		return nil
 	}
-	return []ProcessInfo{{PID: pid, Name: "unknown"}}
+	return []ProcessInfo{{PID: pid, Name: processName(pid)}}
 }
 
 func isProcessAlive(pid int) bool {
 	if pid <= 0 {
 		return false
 	}
-	out, err := exec.Command("tasklist", "/FI", fmt.Sprintf("PID eq %d", pid), "/FO", "CSV", "/NH").Output()
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
 	if err != nil {
+		// A process we may not open still exists.
+		return errors.Is(err, windows.ERROR_ACCESS_DENIED)
+	}
+	defer windows.CloseHandle(handle)
+	var code uint32
+	if err := windows.GetExitCodeProcess(handle, &code); err != nil {
 		return true
 	}
-	line := strings.TrimSpace(string(out))
-	if line == "" || strings.HasPrefix(line, "INFO:") {
-		return false
+	return code == stillActive
+}
+
+func processName(pid int) string {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return "unknown"
 	}
-	reader := csv.NewReader(strings.NewReader(line))
-	record, err := reader.Read()
-	if err != nil || len(record) < 2 {
-		return false
+	defer windows.CloseHandle(handle)
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(handle, 0, &buf[0], &size); err != nil {
+		return "unknown"
 	}
-	return strings.TrimSpace(record[1]) == strconv.Itoa(pid)
+	return filepath.Base(windows.UTF16ToString(buf[:size]))
 }
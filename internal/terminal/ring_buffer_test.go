@@ -0,0 +1,83 @@
+package terminal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRingBufferKeepsLastBytes(t *testing.T) {
+	r := newRingBuffer(8)
+	var want string
+	for i, chunk := range []string{"abc", "defg", "hi", "jklmnopqrs", "t", "uvw"} {
+		offset := r.Append([]byte(chunk))
+		if offset != int64(len(want)) {
+			t.Fatalf("chunk %d: offset = %d, want %d", i, offset, len(want))
+		}
+		want += chunk
+		expected := want[max(len(want)-8, 0):]
+
+		data, total := r.Snapshot()
+		if string(data) != expected || total != int64(len(want)) {
+			t.Fatalf("chunk %d: Snapshot() = %q, %d; want %q, %d", i, data, total, expected, len(want))
+		}
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil || buf.String() != expected {
+			t.Fatalf("chunk %d: WriteTo() = %q, %v; want %q", i, buf.String(), err, expected)
+		}
+	}
+}
+
+func TestRingBufferLargeAppend(t *testing.T) {
+	r := newRingBuffer(4)
+	r.Append([]byte("ab"))
+	r.Append([]byte(strings.Repeat("x", 10) + "wxyz"))
+	if got := string(r.Bytes()); got != "wxyz" {
+		t.Fatalf("Bytes() = %q, want %q", got, "wxyz")
+	}
+}
+
+func TestRingBufferClear(t *testing.T) {
+	r := newRingBuffer(4)
+	r.Append([]byte("abcdef"))
+	r.Clear()
+	if offset := r.Append([]byte("xy")); offset != 6 {
+		t.Fatalf("Append after Clear: offset = %d, want 6", offset)
+	}
+	if data, total := r.Snapshot(); string(data) != "xy" || total != 8 {
+		t.Fatalf("Snapshot() = %q, %d; want %q, 8", data, total, "xy")
+	}
+}
+
+func BenchmarkRingBufferAppend(b *testing.B) {
+	r := newRingBuffer(256 * 1024)
+	chunk := bytes.Repeat([]byte("x"), DefaultReadBufferSize)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(chunk)))
+	for i := 0; i < b.N; i++ {
+		r.Append(chunk)
+	}
+}
+
+func TestRingBufferTail(t *testing.T) {
+	r := newRingBuffer(8)
+	r.Append([]byte("abcdef"))
+	r.Append([]byte("ghij"))
+
+	cases := []struct {
+		limit int
+		want  string
+	}{
+		{limit: -1, want: "cdefghij"},
+		{limit: 0, want: ""},
+		{limit: 3, want: "hij"},
+		{limit: 6, want: "efghij"},
+		{limit: 100, want: "cdefghij"},
+	}
+	for _, tc := range cases {
+		data, total := r.Tail(tc.limit)
+		if string(data) != tc.want || total != 10 {
+			t.Errorf("Tail(%d) = %q, %d; want %q, 10", tc.limit, data, total, tc.want)
+		}
+	}
+}
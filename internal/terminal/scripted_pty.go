@@ -0,0 +1,175 @@
+package terminal
+
+import (
+	"io"
+	"sync"
+)
+
+// ScriptedPTY stands in for a shell and its PTY in tests. What Emit writes
+// is read by the session as shell output; input, resizes and resets the
+// session sends are recorded, and the reply function can answer input the
+// way a shell would, such as by echoing it.
+type ScriptedPTY struct {
+	reply func(input []byte) []byte
+
+	mu      sync.Mutex
+	pending []byte
+	input   []byte
+	cols    int
+	rows    int
+	resets  int
+	failure error
+	ready   chan struct{}
+	closed  chan struct{}
+}
+
+// NewScriptedPTY returns a PTY that answers each input with what reply
+// returns for it. reply may be nil.
+func NewScriptedPTY(reply func(input []byte) []byte) *ScriptedPTY {
+	return &ScriptedPTY{
+		reply:  reply,
+		ready:  make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+}
+
+// NewScriptedSession returns a session attached to pty instead of a shell.
+// A reset ends the scripted shell like a real one, and pty then carries on
+// as the next shell, so Resets counts them. The session ends on Close.
+func NewScriptedSession(cfg Config, pty *ScriptedPTY) *Session {
+	s := newSession(cfg)
+	// Set before returning, so a Close right away finds the PTY to close.
+	s.setPTY(pty, pty)
+	go func() {
+		for {
+			s.readLoop(pty)
+			s.clearPTY()
+			if s.isClosed() {
+				break
+			}
+			pty.restart()
+			s.setPTY(pty, pty)
+		}
+		s.closeChannels()
+	}()
+	return s
+}
+
+// Emit makes data appear as output of the shell.
+func (p *ScriptedPTY) Emit(data []byte) {
+	p.mu.Lock()
+	p.pending = append(p.pending, data...)
+	p.mu.Unlock()
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Input returns everything written to the shell so far.
+func (p *ScriptedPTY) Input() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]byte(nil), p.input...)
+}
+
+// Size returns the last size the terminal was resized to.
+func (p *ScriptedPTY) Size() (cols, rows int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cols, p.rows
+}
+
+// Resets returns how many times the shell was reset.
+func (p *ScriptedPTY) Resets() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resets
+}
+
+func (p *ScriptedPTY) Read(b []byte) (int, error) {
+	for {
+		p.mu.Lock()
+		closed := p.closed
+		if len(p.pending) > 0 {
+			n := copy(b, p.pending)
+			p.pending = p.pending[n:]
+			p.mu.Unlock()
+			return n, nil
+		}
+		p.mu.Unlock()
+		select {
+		case <-p.ready:
+		case <-closed:
+			return 0, io.EOF
+		}
+	}
+}
+
+func (p *ScriptedPTY) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	p.input = append(p.input, b...)
+	p.mu.Unlock()
+	if p.reply != nil {
+		if out := p.reply(b); len(out) > 0 {
+			p.Emit(out)
+		}
+	}
+	return len(b), nil
+}
+
+func (p *ScriptedPTY) Resize(cols, rows int) error {
+	p.mu.Lock()
+	p.cols, p.rows = cols, rows
+	p.mu.Unlock()
+	return nil
+}
+
+// Close ends the current shell's output.
+func (p *ScriptedPTY) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.closed:
+	default:
+		close(p.closed)
+	}
+	return nil
+}
+
+// restart readies the PTY for the next shell. Output emitted in between
+// is kept for it.
+func (p *ScriptedPTY) restart() {
+	p.mu.Lock()
+	p.closed = make(chan struct{})
+	p.mu.Unlock()
+}
+
+// PID is zero, as there is no process.
+func (p *ScriptedPTY) PID() int { return 0 }
+
+func (p *ScriptedPTY) Kill() error { return p.Close() }
+
+func (p *ScriptedPTY) Wait() error {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	<-closed
+	return nil
+}
+
+// Reset counts the reset; the session closes the PTY afterwards.
+func (p *ScriptedPTY) Reset(ResetOptions) ([]ProcessInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resets++
+	return nil, p.failure
+}
+
+// FailResets makes the resets after it return err, or succeed again when
+// err is nil.
+func (p *ScriptedPTY) FailResets(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failure = err
+}
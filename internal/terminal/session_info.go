@@ -0,0 +1,59 @@
+package terminal
+
+import "time"
+
+// SessionInfo describes a session at one moment.
+type SessionInfo struct {
+	// PID is the shell's process ID, or 0 while no shell runs.
+	PID int
+	// Cwd is the shell's working directory, or "" when it is not known.
+	Cwd string
+	// Process is the program the shell last named in its title.
+	Process string
+	// StartedAt is when the session was created and ShellStartedAt when
+	// the running shell was started.
+	StartedAt      time.Time
+	ShellStartedAt time.Time
+	// Respawns counts the shells started after the first one.
+	Respawns   int
+	Cols, Rows int
+	// Alive reports whether a shell is running with its PTY open.
+	Alive bool
+	// LastOutputAt is when the shell last printed anything and LastInputAt
+	// when input was last written to it; zero if never. A shell that is
+	// neither printing nor being typed to is idle; one that stopped
+	// printing right after input may be hung.
+	LastOutputAt time.Time
+	LastInputAt  time.Time
+}
+
+// Info gathers what the session knows about itself and its shell.
+func (s *Session) Info() SessionInfo {
+	s.mu.Lock()
+	info := SessionInfo{
+		Process:   s.lastTitleProc,
+		StartedAt: s.startedAt,
+		Cols:      s.lastCols,
+		Rows:      s.lastRows,
+		Alive:     s.cmd != nil && s.pty != nil && !s.closed,
+
+		LastInputAt: s.lastInput,
+	}
+	if s.cmd != nil {
+		info.PID = s.cmd.PID()
+		info.ShellStartedAt = s.shellStartedAt
+	}
+	if s.shellStarts > 1 {
+		info.Respawns = s.shellStarts - 1
+	}
+	s.mu.Unlock()
+
+	s.emitMu.Lock()
+	info.LastOutputAt = s.lastOutput
+	s.emitMu.Unlock()
+
+	if dir, err := s.CurrentDirectory(); err == nil {
+		info.Cwd = dir
+	}
+	return info
+}
@@ -7,8 +7,10 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
 
 	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
 )
 
 type unixPTYDevice struct {
@@ -31,11 +33,30 @@ func (d *unixPTYDevice) Resize(cols, rows int) error {
 	if cols <= 0 || rows <= 0 {
 		return nil
 	}
-	return pty.Setsize(d.file, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+	return setWinsize(d.file, cols, rows)
+}
+
+// setWinsize sets the terminal size through the file's raw connection,
+// since pty.Setsize would put the file back in blocking mode.
+func setWinsize(f *os.File, cols, rows int) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	err = conn.Control(func(fd uintptr) {
+		ioctlErr = unix.IoctlSetWinsize(int(fd), unix.TIOCSWINSZ, &unix.Winsize{Col: uint16(cols), Row: uint16(rows)})
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
 }
 
 type execShellCommand struct {
 	cmd *exec.Cmd
+	// adopted is set for a shell taken over from another process.
+	adopted bool
 }
 
 func (c *execShellCommand) PID() int {
@@ -52,34 +73,86 @@ func (c *execShellCommand) Kill() error {
 	return c.cmd.Process.Kill()
 }
 
+// Hangup sends the shell SIGHUP, as the kernel does when its terminal
+// closes; the shell passes it on to its jobs.
+func (c *execShellCommand) Hangup() error {
+	if c == nil || c.cmd == nil || c.cmd.Process == nil {
+		return nil
+	}
+	return c.cmd.Process.Signal(syscall.SIGHUP)
+}
+
 func (c *execShellCommand) Wait() error {
 	if c == nil || c.cmd == nil {
 		return nil
 	}
+	if c.adopted {
+		// The shell is not a child of this process. The session only
+		// waits once the terminal is closed, which it is when the shell
+		// has exited.
+		return nil
+	}
 	return c.cmd.Wait()
 }
 
+// CheckPseudoConsole reports whether shells can be started in a pseudo
+// terminal. Unix systems always can.
+func CheckPseudoConsole() error {
+	return nil
+}
+
 func (s *Session) startShell() (shellCommand, ptyDevice, error) {
 	shell := strings.TrimSpace(s.shell)
 	useBash := shell == "" || shell == "bash" || strings.HasSuffix(shell, "/bash")
 
 	var cmd *exec.Cmd
+	var rcFiles []string
 	if useBash {
 		rcPath, err := s.ensureBashRC()
 		if err != nil {
 			return nil, nil, err
 		}
 		cmd = exec.Command("bash", "--rcfile", rcPath)
+		rcFiles = append(rcFiles, rcPath)
 	} else {
 		cmd = exec.Command(shell)
 	}
-	cmd.Dir = s.workDir
-	env := dropEnvVar(os.Environ(), "ALICES_MIRROR_OWNER_TOKEN")
+	cmd.Dir = s.WorkDir()
+	// Each shell leads a new session and process group with the PTY as its
+	// controlling terminal, so a reset signals only that group and a
+	// respawned shell starts clean.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	env := s.shellEnv()
+	if a := s.runAs; a != nil {
+		// Once the mirror has dropped to the account itself, shells it
+		// restarts already run as it.
+		if os.Geteuid() == 0 {
+			cmd.SysProcAttr.Credential = &syscall.Credential{Uid: a.UID, Gid: a.GID, Groups: a.Groups}
+		}
+		for _, name := range []string{"HOME", "USER", "LOGNAME", "MAIL", "XDG_RUNTIME_DIR", "XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME", "SUDO_USER", "SUDO_UID", "SUDO_GID", "SUDO_COMMAND"} {
+			env = dropEnvVar(env, name)
+		}
+		env = append(env, "HOME="+a.Home, "USER="+a.Username, "LOGNAME="+a.Username)
+	}
+	if s.confine != "" {
+		env = confineEnv(env, s.confine)
+	}
 	cmd.Env = append(env, "TERM=xterm-256color")
+	if s.confine != "" {
+		if err := confineCommand(cmd, s.confine, rcFiles); err != nil {
+			return nil, nil, fmt.Errorf("failed to confine shell to %s: %w", s.confine, err)
+		}
+	}
+	release, err := s.limitCommand(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
 	ptyFile, err := pty.Start(cmd)
+	release()
 	if err != nil {
 		return nil, nil, err
 	}
+	ptyFile = pollable(ptyFile)
 
 	s.mu.Lock()
 	cols := s.lastCols
@@ -87,10 +160,10 @@ func (s *Session) startShell() (shellCommand, ptyDevice, error) {
 	s.mu.Unlock()
 
 	if cols > 0 && rows > 0 {
-		_ = pty.Setsize(ptyFile, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
+		_ = setWinsize(ptyFile, cols, rows)
 	}
 
-	return &execShellCommand{cmd: cmd}, &unixPTYDevice{file: ptyFile}, nil
+	return &ptyShellCommand{execShellCommand: &execShellCommand{cmd: cmd}, pty: ptyFile}, &unixPTYDevice{file: ptyFile}, nil
 }
 
 func (s *Session) ensureBashRC() (string, error) {
@@ -119,6 +192,12 @@ func (s *Session) ensureBashRC() (string, error) {
 		_ = os.Remove(path)
 		return "", fmt.Errorf("failed to close bash rc file: %w", err)
 	}
+	if a := s.runAs; a != nil {
+		if err := os.Chown(path, int(a.UID), int(a.GID)); err != nil {
+			_ = os.Remove(path)
+			return "", fmt.Errorf("failed to hand bash rc file to %s: %w", a.Username, err)
+		}
+	}
 
 	s.mu.Lock()
 	s.bashRCPath = path
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -15,6 +16,20 @@ import (
 	"golang.org/x/sys/windows"
 )
 
+// conPTYMinBuild is the first Windows 10 build (version 1809) with ConPTY.
+const conPTYMinBuild = 17763
+
+// CheckPseudoConsole reports whether this Windows has ConPTY, which the
+// mirror needs to host a shell.
+func CheckPseudoConsole() error {
+	version := windows.RtlGetVersion()
+	if windows.NewLazySystemDLL("kernel32.dll").NewProc("CreatePseudoConsole").Find() == nil && version.BuildNumber >= conPTYMinBuild {
+		return nil
+	}
+	return fmt.Errorf("%w: Windows %d.%d build %d has no ConPTY, which needs Windows 10 version 1809 (build %d) or Windows Server 2019 or later; update Windows to run the mirror here",
+		ErrNoPseudoConsole, version.MajorVersion, version.MinorVersion, version.BuildNumber, conPTYMinBuild)
+}
+
 type conPTYDevice struct {
 	mu      sync.Mutex
 	console windows.Handle
@@ -49,7 +64,11 @@ func newConPTYDevice(cols, rows int) (*conPTYDevice, error) {
 	coord := windows.Coord{X: cols16, Y: rows16}
 	if err := windows.CreatePseudoConsole(coord, windows.Handle(consoleIn.Fd()), windows.Handle(consoleOut.Fd()), 0, &console); err != nil {
 		if errors.Is(err, windows.ERROR_CALL_NOT_IMPLEMENTED) || errors.Is(err, windows.ERROR_PROC_NOT_FOUND) {
-			err = fmt.Errorf("ConPTY is not supported on this Windows version: %w", err)
+			if checkErr := CheckPseudoConsole(); checkErr != nil {
+				err = checkErr
+			} else {
+				err = fmt.Errorf("%w: %v", ErrNoPseudoConsole, err)
+			}
 		}
 		_ = consoleIn.Close()
 		_ = inPipeOurs.Close()
@@ -147,6 +166,9 @@ type windowsShellCommand struct {
 	mu     sync.Mutex
 	pid    int
 	handle windows.Handle
+	// job holds the shell and everything it starts, so a reset can find
+	// and end the whole tree. It is zero if the job could not be set up.
+	job windows.Handle
 }
 
 func (c *windowsShellCommand) PID() int {
@@ -184,12 +206,16 @@ func (c *windowsShellCommand) Wait() error {
 		_ = windows.CloseHandle(c.handle)
 		c.handle = 0
 	}
+	if c.job != 0 {
+		_ = windows.CloseHandle(c.job)
+		c.job = 0
+	}
 	c.mu.Unlock()
 	return nil
 }
 
 func (s *Session) startShell() (shellCommand, ptyDevice, error) {
-	shell := strings.ToLower(strings.TrimSpace(s.shell))
+	shell := strings.TrimSpace(s.shell)
 	if shell == "" {
 		shell = "powershell"
 	}
@@ -209,33 +235,78 @@ func (s *Session) startShell() (shellCommand, ptyDevice, error) {
 		_ = ptyHandle.Close()
 		return nil, nil, err
 	}
+	dir, args, err := shellStartDir(shell, args, s.WorkDir())
+	if err != nil {
+		_ = ptyHandle.Close()
+		return nil, nil, err
+	}
 
-	process, err := startAttachedProcess(exe, args, s.workDir, dropEnvVar(os.Environ(), "ALICES_MIRROR_OWNER_TOKEN"), ptyHandle.console)
+	process, err := startAttachedProcess(exe, args, dir, s.shellEnv(), ptyHandle.console, s.limits)
 	if err != nil {
 		_ = ptyHandle.Close()
 		return nil, nil, err
 	}
 
-	return &windowsShellCommand{pid: process.pid, handle: process.handle}, ptyHandle, nil
+	cmd := &windowsShellCommand{pid: process.pid, handle: process.handle, job: process.job}
+	if strings.EqualFold(shell, "cmd") {
+		return &cmdShellCommand{cmd}, ptyHandle, nil
+	}
+	return cmd, ptyHandle, nil
 }
 
 type startedWindowsProcess struct {
 	pid    int
 	handle windows.Handle
+	job    windows.Handle
 }
 
 func windowsShellCommandLine(shell string) (string, []string, error) {
-	switch shell {
+	switch strings.ToLower(shell) {
 	case "powershell":
 		return "powershell.exe", []string{"-NoLogo", "-NoExit", "-Command", buildPowerShellInitScript()}, nil
 	case "cmd":
 		return "cmd.exe", []string{"/Q", "/V:ON", "/K", buildCmdInitCommand()}, nil
 	default:
-		return "", nil, fmt.Errorf("unsupported shell %q", shell)
+		return splitWindowsShell(shell)
+	}
+}
+
+// CheckWindowsShell reports whether shell is usable as --shell: powershell,
+// cmd, or an absolute path to an executable with optional arguments.
+func CheckWindowsShell(shell string) error {
+	_, _, err := windowsShellCommandLine(strings.TrimSpace(shell))
+	return err
+}
+
+// splitWindowsShell parses a custom shell such as
+// `C:\Tools\nu.exe --login`. A path containing spaces must be quoted as
+// on a Windows command line, unless the whole value names the executable.
+func splitWindowsShell(shell string) (string, []string, error) {
+	exe, args := shell, []string(nil)
+	if info, err := os.Stat(shell); err != nil || info.IsDir() {
+		parts, err := windows.DecomposeCommandLine(shell)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid shell %q: %v", shell, err)
+		}
+		if len(parts) == 0 {
+			return "", nil, errors.New("empty shell")
+		}
+		exe, args = parts[0], parts[1:]
+	}
+	if !filepath.IsAbs(exe) {
+		return "", nil, fmt.Errorf("unsupported shell %q (expected powershell, cmd or an absolute path to an executable)", exe)
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return "", nil, err
 	}
+	if info.IsDir() {
+		return "", nil, fmt.Errorf("%s is a directory", exe)
+	}
+	return exe, args, nil
 }
 
-func startAttachedProcess(exe string, args []string, workDir string, env []string, console windows.Handle) (*startedWindowsProcess, error) {
+func startAttachedProcess(exe string, args []string, workDir string, env []string, console windows.Handle, limits Limits) (*startedWindowsProcess, error) {
 	exePath, err := exec.LookPath(exe)
 	if err != nil {
 		return nil, err
@@ -283,15 +354,49 @@ func startAttachedProcess(exe string, args []string, workDir string, env []strin
 	siEx.ProcThreadAttributeList = attrs.List()
 	siEx.Cb = uint32(unsafe.Sizeof(*siEx))
 
+	// The process starts suspended so it is in the job before it can start
+	// children of its own.
 	pi := new(windows.ProcessInformation)
-	flags := uint32(windows.CREATE_UNICODE_ENVIRONMENT) | windows.EXTENDED_STARTUPINFO_PRESENT
+	flags := uint32(windows.CREATE_UNICODE_ENVIRONMENT) | windows.EXTENDED_STARTUPINFO_PRESENT | windows.CREATE_SUSPENDED
 	if err := windows.CreateProcess(argv0, cmdLine, nil, nil, false, flags, envPtr, dirPtr, &siEx.StartupInfo, pi); err != nil {
 		return nil, fmt.Errorf("failed to create process: %w", err)
 	}
 
+	job, err := windows.CreateJobObject(nil, nil)
+	if err == nil {
+		if err = windows.AssignProcessToJobObject(job, pi.Process); err != nil {
+			_ = windows.CloseHandle(job)
+			job = 0
+		}
+	}
+	if err == nil && !limits.IsZero() {
+		err = applyJobLimits(job, limits)
+	}
+	if err != nil && !limits.IsZero() {
+		_ = windows.TerminateProcess(pi.Process, 1)
+		_ = windows.CloseHandle(pi.Thread)
+		_ = windows.CloseHandle(pi.Process)
+		if job != 0 {
+			_ = windows.CloseHandle(job)
+		}
+		return nil, fmt.Errorf("failed to limit the shell: %w", err)
+	}
+	if err != nil {
+		logger().Warn("failed to put the shell in a job object; reset falls back to walking the process tree", "err", err)
+	}
+
+	if _, err := windows.ResumeThread(pi.Thread); err != nil {
+		_ = windows.TerminateProcess(pi.Process, 1)
+		_ = windows.CloseHandle(pi.Thread)
+		_ = windows.CloseHandle(pi.Process)
+		if job != 0 {
+			_ = windows.CloseHandle(job)
+		}
+		return nil, fmt.Errorf("failed to start process: %w", err)
+	}
 	_ = windows.CloseHandle(pi.Thread)
 
-	return &startedWindowsProcess{pid: int(pi.ProcessId), handle: pi.Process}, nil
+	return &startedWindowsProcess{pid: int(pi.ProcessId), handle: pi.Process, job: job}, nil
 }
 
 func createEnvBlock(env []string) ([]uint16, error) {
@@ -361,6 +466,11 @@ func buildPowerShellInitScript() string {
 		"  $cwd = __AlicesMirrorFormatCwd",
 		"  __AlicesMirrorEmitTitle $cwd $proc",
 		"}",
+		"try {",
+		"  $ExecutionContext.InvokeCommand.LocationChangedAction = {",
+		"    if ($PWD.Provider.Name -eq 'FileSystem') { [Environment]::CurrentDirectory = $PWD.ProviderPath }",
+		"  }",
+		"} catch {}",
 		"$script:__AlicesMirrorOriginalPrompt = $function:prompt",
 		"function global:prompt {",
 		"  __AlicesMirrorSetTitle 'powershell'",
@@ -1,18 +1,100 @@
 package terminal
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"alices-mirror/internal/logging"
+)
+
+const (
+	DefaultReadBufferSize   = 4096
+	DefaultOutputQueueDepth = 128
 )
 
+// ErrNoPseudoConsole is returned when the system cannot host a shell in a
+// pseudo console at all, so retrying is pointless.
+var ErrNoPseudoConsole = errors.New("pseudo console not supported")
+
 type Config struct {
 	WorkDir         string
 	BufferSize      int
 	Shell           string
 	ExitOnShellExit bool
+
+	// ReadBufferSize is the size of each PTY read. Defaults to 4096.
+	ReadBufferSize int
+	// OutputQueueDepth is how many output chunks may wait for the server.
+	// While it is full, reads from the PTY wait for room. Defaults to 128.
+	OutputQueueDepth int
+
+	// OnClipboard, when set, receives text a program in the shell copied
+	// with OSC 52.
+	OnClipboard func(text string)
+
+	// InputFilters and OutputFilters, when set, process what is written to
+	// the shell and what it prints, in order. Output is filtered before it
+	// is kept for the scrollback, logged or sent, so every client sees the
+	// same stream.
+	InputFilters  []Filter
+	OutputFilters []Filter
+
+	// Tmux, when set, names an existing tmux session to mirror instead of
+	// starting a shell. Shell is ignored.
+	Tmux string
+
+	// Container, when set, names a running Docker or Podman container to
+	// start the shell in. Shell and WorkDir are ignored for it.
+	Container string
+
+	// OutputLog, when set, receives all shell output as it is read. After
+	// a write fails nothing more is written to it.
+	OutputLog io.Writer
+
+	// RunAs, when set, is the account the shell runs as. Unix only; the
+	// mirror must be running as root.
+	RunAs *Account
+
+	// Confine, when set, is a directory the shell is confined to: it sees
+	// only that directory and the system directories. Unix only; see
+	// CheckConfine.
+	Confine string
+
+	// Limits caps the resources of the shell; see CheckLimits. Shells in a
+	// container or tmux session are not limited.
+	Limits Limits
+
+	// Reset controls how Reset ends the shell's processes.
+	Reset ResetOptions
+
+	// TitlePrefix starts the titles the shell integrations emit, so
+	// several mirrors can be told apart. It must not contain "|". Empty
+	// means ALICES_MIRROR_TITLE_PREFIX, or "alices-mirror".
+	TitlePrefix string
+
+	// Adopt, when set, is a shell handed off by another session to take
+	// over instead of starting one. Later shells are started as usual.
+	Adopt *Handoff
+}
+
+// Account is a Unix user to run the shell as.
+type Account struct {
+	Username string
+	Home     string
+	UID      uint32
+	GID      uint32
+	Groups   []uint32
 }
 
 type Session struct {
@@ -21,19 +103,80 @@ type Session struct {
 	cmd             shellCommand
 	workDir         string
 	shell           string
+	tmuxTarget      string
+	container       string
 	bashRCPath      string
 	exitOnShellExit bool
+	onClipboard     func(text string)
+	inputFilters    []Filter
+	outputFilters   []Filter
+	outputLog       io.Writer
+	outputLogFailed atomic.Bool
+	bracketedPaste  atomic.Bool
+	runAs           *Account
+	confine         string
+	limits          Limits
+	resetOptions    ResetOptions
+	titlePrefix     string
+	cgroup          string
 	buffer          *ringBuffer
-	outputCh        chan []byte
+	readBufferSize  int
+	chunkPool       *sync.Pool
+	outputCh        chan OutputChunk
 	statusCh        chan string
+	bellCh          chan struct{}
 	doneCh          chan struct{}
 	lastCols        int
 	lastRows        int
 	lastTitleCwd    string
 	lastTitleProc   string
-	writeMu         sync.Mutex
-	closeOnce       sync.Once
-	closed          bool
+	// reportedCwd is the directory the shell last reported with OSC 7.
+	reportedCwd string
+	// titleHooked is set once the running shell's prompt hooks report a
+	// title.
+	titleHooked    bool
+	restartPending bool
+	// startedAt is when the session was created; shellStartedAt is when
+	// the running shell started and shellStarts how many have.
+	startedAt      time.Time
+	shellStartedAt time.Time
+	shellStarts    int
+	// lastInput is when input was last written to the shell.
+	lastInput time.Time
+	writeMu   sync.Mutex
+	// emitMu orders output read from the PTY with output the session adds
+	// itself; lastOutput is when the PTY last produced any.
+	emitMu     sync.Mutex
+	lastOutput time.Time
+	closeOnce  sync.Once
+	closed     bool
+	// adopt is the shell to take over first; handedOff is set once the
+	// shell was handed off instead.
+	adopt     *Handoff
+	handedOff bool
+	// stopCh is closed along with closed being set by Close or Shutdown,
+	// to cut short the waits between shells. stopContext stops watching
+	// the context the session was created with.
+	stopCh      chan struct{}
+	stopContext func() bool
+
+	pauseMu  sync.Mutex
+	resumeCh chan struct{}
+}
+
+// maxOutputPause bounds how long a paused session stops reading from the
+// PTY, so a reset or a stuck client cannot wedge the shell indefinitely.
+const maxOutputPause = time.Second
+
+// OutputChunk is a piece of shell output. Offset is the position of Data[0]
+// in the session's output stream, which lets consumers line chunks up with a
+// snapshot. Data lives in a pooled buffer: the receiver of a chunk from
+// Output owns one reference to it and must not use Data after releasing it.
+type OutputChunk struct {
+	Data   []byte
+	Offset int64
+
+	buf *chunkBuffer
 }
 
 type ptyDevice interface {
@@ -48,34 +191,86 @@ type shellCommand interface {
 }
 
 func NewSession(cfg Config) (*Session, error) {
+	return NewSessionContext(context.Background(), cfg)
+}
+
+// NewSessionContext is NewSession for a session that is closed, as with
+// Close, once ctx is done.
+func NewSessionContext(ctx context.Context, cfg Config) (*Session, error) {
 	if cfg.WorkDir == "" {
 		return nil, errors.New("work directory is required")
 	}
+
+	s := newSession(cfg)
+	if !s.limits.IsZero() {
+		if err := s.setupLimits(); err != nil {
+			return nil, err
+		}
+	}
+	s.stopContext = context.AfterFunc(ctx, s.Close)
+	go s.runLoop()
+	return s, nil
+}
+
+func newSession(cfg Config) *Session {
 	bufferSize := cfg.BufferSize
 	if bufferSize <= 0 {
 		bufferSize = 256 * 1024
 	}
+	readBufferSize := cfg.ReadBufferSize
+	if readBufferSize <= 0 {
+		readBufferSize = DefaultReadBufferSize
+	}
+	outputQueueDepth := cfg.OutputQueueDepth
+	if outputQueueDepth <= 0 {
+		outputQueueDepth = DefaultOutputQueueDepth
+	}
 
 	s := &Session{
 		workDir:         cfg.WorkDir,
 		shell:           cfg.Shell,
+		tmuxTarget:      cfg.Tmux,
+		container:       cfg.Container,
 		exitOnShellExit: cfg.ExitOnShellExit,
+		onClipboard:     cfg.OnClipboard,
+		inputFilters:    cfg.InputFilters,
+		outputFilters:   cfg.OutputFilters,
+		outputLog:       cfg.OutputLog,
+		runAs:           cfg.RunAs,
+		confine:         cfg.Confine,
+		limits:          cfg.Limits,
+		resetOptions:    cfg.Reset,
+		titlePrefix:     resolveTitlePrefix(cfg.TitlePrefix),
 		buffer:          newRingBuffer(bufferSize),
-		outputCh:        make(chan []byte, 128),
+		readBufferSize:  readBufferSize,
+		chunkPool:       newChunkPool(readBufferSize),
+		outputCh:        make(chan OutputChunk, outputQueueDepth),
 		statusCh:        make(chan string, 16),
+		bellCh:          make(chan struct{}, 1),
 		doneCh:          make(chan struct{}),
+		stopCh:          make(chan struct{}),
+		startedAt:       time.Now(),
+		adopt:           cfg.Adopt,
 	}
-
-	go s.runLoop()
-	return s, nil
+	if a := cfg.Adopt; a != nil {
+		s.buffer.Append(a.Scrollback)
+		s.lastCols, s.lastRows = a.Cols, a.Rows
+	}
+	return s
 }
 
 func CheckShell(workDir, shell string) error {
+	if err := CheckPseudoConsole(); err != nil {
+		return err
+	}
 	s := &Session{
 		workDir: workDir,
 		shell:   shell,
 	}
 	cmd, ptyHandle, err := s.startShell()
+	if s.bashRCPath != "" {
+		defer os.Remove(s.bashRCPath)
+	}
 	if err != nil {
 		return err
 	}
@@ -85,7 +280,7 @@ func CheckShell(workDir, shell string) error {
 	return nil
 }
 
-func (s *Session) Output() <-chan []byte {
+func (s *Session) Output() <-chan OutputChunk {
 	return s.outputCh
 }
 
@@ -93,6 +288,12 @@ func (s *Session) Status() <-chan string {
 	return s.statusCh
 }
 
+// Bells receives after the shell rings the bell. Bells rung while one is
+// still waiting to be received are merged into it.
+func (s *Session) Bells() <-chan struct{} {
+	return s.bellCh
+}
+
 func (s *Session) Done() <-chan struct{} {
 	return s.doneCh
 }
@@ -101,6 +302,24 @@ func (s *Session) Snapshot() []byte {
 	return s.buffer.Bytes()
 }
 
+// WriteSnapshotTo writes the retained output to w without an intermediate
+// copy.
+func (s *Session) WriteSnapshotTo(w io.Writer) (int64, error) {
+	return s.buffer.WriteTo(w)
+}
+
+// SnapshotWithOffset returns the retained output together with the stream
+// offset just past its last byte.
+func (s *Session) SnapshotWithOffset() ([]byte, int64) {
+	return s.buffer.Snapshot()
+}
+
+// SnapshotTail is like SnapshotWithOffset but returns at most the last limit
+// bytes of the retained output. A negative limit means everything.
+func (s *Session) SnapshotTail(limit int) ([]byte, int64) {
+	return s.buffer.Tail(limit)
+}
+
 func (s *Session) WriteInput(data []byte) error {
 	s.writeMu.Lock()
 	defer s.writeMu.Unlock()
@@ -113,7 +332,16 @@ func (s *Session) WriteInput(data []byte) error {
 		return errors.New("shell not ready")
 	}
 
+	data = runFilters(s.inputFilters, data)
+	if len(data) == 0 {
+		return nil
+	}
 	_, err := ptyHandle.Write(data)
+	if err == nil {
+		s.mu.Lock()
+		s.lastInput = time.Now()
+		s.mu.Unlock()
+	}
 	return err
 }
 
@@ -135,23 +363,133 @@ func (s *Session) Resize(cols, rows int) error {
 	return ptyHandle.Resize(cols, rows)
 }
 
-func (s *Session) Close() {
+// ChangeWorkDir validates dir and restarts the shell inside it. The restart
+// happens even when the session is configured to exit with its shell.
+func (s *Session) ChangeWorkDir(dir string) error {
+	cleaned := strings.TrimSpace(dir)
+	if cleaned == "" {
+		return errors.New("work directory is required")
+	}
+	abs, err := filepath.Abs(cleaned)
+	if err != nil {
+		return fmt.Errorf("invalid work directory %q: %v", cleaned, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return fmt.Errorf("invalid work directory %q: %v", cleaned, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("work directory is not a directory: %s", abs)
+	}
+
 	s.mu.Lock()
 	if s.closed {
 		s.mu.Unlock()
-		return
+		return errors.New("session is closed")
+	}
+	s.workDir = abs
+	s.lastTitleCwd = ""
+	s.reportedCwd = ""
+	running := s.cmd != nil
+	if running {
+		s.restartPending = true
 	}
-	s.closed = true
-	cmd := s.cmd
-	ptyHandle := s.pty
 	s.mu.Unlock()
 
+	if !running {
+		return nil
+	}
+	remaining, err := s.Reset()
+	if err != nil && len(remaining) == 0 {
+		// The shell was not stopped, so its exit later must not be taken
+		// for this restart.
+		s.mu.Lock()
+		s.restartPending = false
+		s.mu.Unlock()
+		return err
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("%d process(es) could not be terminated", len(remaining))
+	}
+	return nil
+}
+
+// WorkDir returns the directory new shells are started in.
+func (s *Session) WorkDir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.workDir
+}
+
+// Close ends the session: the PTY is closed and the shell killed. It
+// returns once the session is done, when the shell has exited, nothing
+// reads from the PTY any more and the channels are closed.
+func (s *Session) Close() {
+	cmd, ptyHandle, ok := s.stop()
+	if ok {
+		s.SetOutputPaused(false)
+		if ptyHandle != nil {
+			_ = ptyHandle.Close()
+		}
+		if cmd != nil {
+			_ = cmd.Kill()
+		}
+	}
+	<-s.doneCh
+}
+
+// stop marks the session closed and returns its shell, or reports that it
+// was already closed.
+func (s *Session) stop() (shellCommand, ptyDevice, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, nil, false
+	}
+	s.closed = true
+	close(s.stopCh)
+	return s.cmd, s.pty, true
+}
+
+// hangupSender is implemented by commands that can be told their terminal
+// went away.
+type hangupSender interface {
+	Hangup() error
+}
+
+// Shutdown ends the session gracefully: the PTY is closed and the shell
+// hung up on, and it is killed only if it has not exited within grace. It returns once
+// the session is done or, failing that, after a second grace period.
+func (s *Session) Shutdown(grace time.Duration) {
+	cmd, ptyHandle, ok := s.stop()
+	if !ok {
+		return
+	}
+	s.SetOutputPaused(false)
+
 	if ptyHandle != nil {
 		_ = ptyHandle.Close()
 	}
+	// Closing the PTY only hangs up once its pending read returns, so the
+	// shell is told directly as well.
+	if h, ok := cmd.(hangupSender); ok {
+		_ = h.Hangup()
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-s.doneCh:
+		return
+	case <-timer.C:
+	}
 	if cmd != nil {
 		_ = cmd.Kill()
 	}
+	timer.Reset(grace)
+	select {
+	case <-s.doneCh:
+	case <-timer.C:
+	}
 }
 
 func (s *Session) runLoop() {
@@ -160,30 +498,55 @@ func (s *Session) runLoop() {
 			s.closeChannels()
 			return
 		}
-		cmd, ptyHandle, err := s.startShell()
+		cmd, ptyHandle, err := s.startProcess()
 		if err != nil {
+			logger().Warn("shell start failed", "error", err)
 			s.emitStatus(fmt.Sprintf("Shell start failed: %v", err))
-			time.Sleep(2 * time.Second)
+			if errors.Is(err, ErrNoPseudoConsole) {
+				s.mu.Lock()
+				s.closed = true
+				s.mu.Unlock()
+				s.closeChannels()
+				return
+			}
+			s.pause(2 * time.Second)
 			continue
 		}
 
 		s.setPTY(cmd, ptyHandle)
+		logger().Info("shell started", "pid", cmd.PID())
 		s.emitStatus("Shell started.")
 
 		done := make(chan error, 1)
 		go func() {
 			done <- cmd.Wait()
 		}()
+		stopWatch := make(chan struct{})
+		if reporter, ok := cmd.(foregroundReporter); ok {
+			go s.watchForeground(reporter, stopWatch)
+		}
 
 		s.readLoop(ptyHandle)
+		close(stopWatch)
+		if s.isHandedOff() {
+			// The shell lives on in the session that took it over.
+			s.clearPTY()
+			s.closeChannels()
+			return
+		}
 		_ = ptyHandle.Close()
-		<-done
+		waitErr := <-done
+		logger().Info("shell exited", "pid", cmd.PID(), "error", waitErr)
 
 		s.clearPTY()
 		if s.isClosed() {
 			s.closeChannels()
 			return
 		}
+		if s.takeRestartPending() {
+			s.emitStatus(fmt.Sprintf("Restarting shell in %s.", s.WorkDir()))
+			continue
+		}
 		if s.exitOnShellExit {
 			s.emitStatus("Shell exited.")
 			s.mu.Lock()
@@ -192,23 +555,71 @@ func (s *Session) runLoop() {
 			s.closeChannels()
 			return
 		}
+		if s.tmuxTarget != "" {
+			s.emitStatus("Detached from tmux. Reattaching.")
+			s.pause(tmuxReattachDelay)
+			continue
+		}
 		s.emitStatus("Shell exited. Respawning now.")
 	}
 }
 
+// startProcess starts the shell on the host or in the configured
+// container, or attaches to the configured tmux session.
+func (s *Session) startProcess() (shellCommand, ptyDevice, error) {
+	s.mu.Lock()
+	adopt := s.adopt
+	s.adopt = nil
+	s.mu.Unlock()
+	if adopt != nil {
+		return adoptShell(adopt)
+	}
+	if s.tmuxTarget == "" && s.container == "" {
+		return s.startShell()
+	}
+	s.mu.Lock()
+	cols, rows := s.lastCols, s.lastRows
+	s.mu.Unlock()
+	if s.container != "" {
+		shell, err := startContainerShell(s.container, cols, rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		return shell, shell, nil
+	}
+	client, err := startTmuxClient(s.tmuxTarget, cols, rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, client, nil
+}
+
 func (s *Session) readLoop(reader io.Reader) {
-	parser := newOSCTitleParser()
-	buf := make([]byte, 4096)
+	// The configured filters run first, so the session reacts to the
+	// output clients see.
+	filters := append(slices.Clip(s.outputFilters), newOutputWatcher(s))
 	for {
-		n, err := reader.Read(buf)
+		s.waitOutputResumed()
+		buf := getChunkBuffer(s.chunkPool)
+		n, err := reader.Read(buf.data)
 		if n > 0 {
-			chunk := make([]byte, n)
-			copy(chunk, buf[:n])
-			for _, title := range parser.Feed(chunk) {
-				s.captureTitle(title)
+			chunk := runFilters(filters, buf.data[:n])
+			if len(s.outputFilters) > 0 {
+				chunk, buf = intoChunkBuffer(chunk, buf)
+			}
+			s.emitMu.Lock()
+			s.lastOutput = time.Now()
+			if len(chunk) > 0 {
+				offset := s.buffer.Append(chunk)
+				s.writeOutputLog(chunk)
+				s.emitOutput(OutputChunk{Data: chunk, Offset: offset, buf: buf})
+			}
+			s.emitMu.Unlock()
+			if len(chunk) == 0 {
+				buf.release()
 			}
-			s.buffer.Append(chunk)
-			s.emitOutput(chunk)
+		} else {
+			buf.release()
 		}
 		if err != nil {
 			return
@@ -216,8 +627,78 @@ func (s *Session) readLoop(reader io.Reader) {
 	}
 }
 
+func (s *Session) writeOutputLog(data []byte) {
+	if s.outputLog == nil || s.outputLogFailed.Load() {
+		return
+	}
+	if _, err := s.outputLog.Write(data); err != nil && !s.outputLogFailed.Swap(true) {
+		logger().Error("output log write failed; output logging stopped", "error", err)
+	}
+}
+
+// SetOutputPaused stops or resumes reading from the PTY. It is used for flow
+// control when every client is behind; the shell blocks on its own writes
+// while paused.
+func (s *Session) SetOutputPaused(paused bool) {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	if paused {
+		if s.resumeCh == nil {
+			s.resumeCh = make(chan struct{})
+		}
+		return
+	}
+	if s.resumeCh != nil {
+		close(s.resumeCh)
+		s.resumeCh = nil
+	}
+}
+
+func (s *Session) waitOutputResumed() {
+	s.pauseMu.Lock()
+	resume := s.resumeCh
+	s.pauseMu.Unlock()
+	if resume == nil {
+		return
+	}
+	timer := time.NewTimer(maxOutputPause)
+	defer timer.Stop()
+	select {
+	case <-resume:
+	case <-timer.C:
+	}
+}
+
+// captureClipboard handles an OSC 52 payload ("<selection>;<base64>").
+// Clipboard queries ("?") are ignored so the shell cannot read the clipboard.
+func (s *Session) captureClipboard(data string) {
+	if s.onClipboard == nil {
+		return
+	}
+	_, encoded, ok := strings.Cut(data, ";")
+	if !ok || encoded == "?" {
+		return
+	}
+	text, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return
+	}
+	go s.onClipboard(string(text))
+}
+
+// captureWorkingDirectory handles an OSC 7 payload.
+func (s *Session) captureWorkingDirectory(data string) {
+	dir, ok := parseWorkingDirectory(data)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	s.reportedCwd = dir
+	s.mu.Unlock()
+}
+
 func (s *Session) captureTitle(title string) {
-	cwd, proc, ok := parseAlicesMirrorTitle(title)
+	cwd, proc, ok := parseAlicesMirrorTitle(title, s.titlePrefix)
 	if !ok {
 		return
 	}
@@ -225,6 +706,7 @@ func (s *Session) captureTitle(title string) {
 		return
 	}
 	s.mu.Lock()
+	s.titleHooked = true
 	if cwd != "" {
 		s.lastTitleCwd = cwd
 	}
@@ -234,14 +716,30 @@ func (s *Session) captureTitle(title string) {
 	s.mu.Unlock()
 }
 
-func (s *Session) emitOutput(data []byte) {
+func (s *Session) emitOutput(chunk OutputChunk) {
 	if s.isClosed() {
+		chunk.Release()
 		return
 	}
 	select {
-	case s.outputCh <- data:
+	case s.outputCh <- chunk:
+		return
 	default:
 	}
+
+	// The server is behind: hold the PTY rather than drop output, but only
+	// for as long as a pause may last.
+	timer := time.NewTimer(maxOutputPause)
+	defer timer.Stop()
+	select {
+	case s.outputCh <- chunk:
+	case <-timer.C:
+		chunk.Release()
+	}
+}
+
+func logger() *slog.Logger {
+	return logging.For("terminal")
 }
 
 func (s *Session) emitStatus(message string) {
@@ -254,11 +752,25 @@ func (s *Session) emitStatus(message string) {
 	}
 }
 
+func (s *Session) ringBell() {
+	if s.isClosed() {
+		return
+	}
+	select {
+	case s.bellCh <- struct{}{}:
+	default:
+	}
+}
+
 func (s *Session) setPTY(cmd shellCommand, ptyHandle ptyDevice) {
 	s.mu.Lock()
 	s.cmd = cmd
 	s.pty = ptyHandle
+	s.titleHooked = false
+	s.shellStartedAt = time.Now()
+	s.shellStarts++
 	s.mu.Unlock()
+	s.bracketedPaste.Store(false)
 }
 
 func (s *Session) clearPTY() {
@@ -268,6 +780,14 @@ func (s *Session) clearPTY() {
 	s.mu.Unlock()
 }
 
+func (s *Session) takeRestartPending() bool {
+	s.mu.Lock()
+	pending := s.restartPending
+	s.restartPending = false
+	s.mu.Unlock()
+	return pending
+}
+
 func (s *Session) isClosed() bool {
 	s.mu.Lock()
 	closed := s.closed
@@ -275,47 +795,148 @@ func (s *Session) isClosed() bool {
 	return closed
 }
 
+// pause waits between shells for d, or until the session is closed.
+func (s *Session) pause(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-s.stopCh:
+	}
+}
+
+func (s *Session) isHandedOff() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handedOff
+}
+
 func (s *Session) closeChannels() {
 	s.closeOnce.Do(func() {
+		if s.stopContext != nil {
+			s.stopContext()
+		}
+		s.mu.Lock()
+		rcPath := s.bashRCPath
+		s.mu.Unlock()
+		if rcPath != "" {
+			_ = os.Remove(rcPath)
+		}
+		s.releaseLimits()
 		close(s.outputCh)
 		close(s.statusCh)
+		close(s.bellCh)
 		close(s.doneCh)
 	})
 }
 
-// ringBuffer keeps the last N bytes of output for new clients.
+// ringBuffer keeps the last N bytes of output for new clients. The backing
+// array grows up to max and is then reused as a circular buffer, so appends
+// never shift existing data.
 type ringBuffer struct {
-	mu   sync.Mutex
-	data []byte
-	max  int
+	mu    sync.Mutex
+	buf   []byte
+	start int
+	max   int
+	total int64
 }
 
 func newRingBuffer(max int) *ringBuffer {
 	return &ringBuffer{max: max}
 }
 
-func (r *ringBuffer) Append(p []byte) {
+// Append stores p and returns the stream offset of its first byte.
+func (r *ringBuffer) Append(p []byte) int64 {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if len(p) >= r.max {
-		r.data = append(r.data[:0], p[len(p)-r.max:]...)
-		return
+	offset := r.total
+	r.total += int64(len(p))
+
+	if len(p) > r.max {
+		p = p[len(p)-r.max:]
+	}
+	if len(r.buf) < r.max {
+		n := min(r.max-len(r.buf), len(p))
+		r.buf = append(r.buf, p[:n]...)
+		p = p[n:]
+	}
+	for len(p) > 0 {
+		n := copy(r.buf[r.start:], p)
+		r.start = (r.start + n) % r.max
+		p = p[n:]
 	}
+	return offset
+}
 
-	needed := len(r.data) + len(p) - r.max
-	if needed > 0 {
-		r.data = r.data[needed:]
+// segmentsLocked returns the buffered bytes, oldest first, as up to two
+// slices of the backing array.
+func (r *ringBuffer) segmentsLocked() ([]byte, []byte) {
+	if len(r.buf) < r.max {
+		return r.buf, nil
 	}
+	return r.buf[r.start:], r.buf[:r.start]
+}
 
-	r.data = append(r.data, p...)
+// Clear drops the buffered bytes. Offsets carry on from where they were.
+func (r *ringBuffer) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = r.buf[:0]
+	r.start = 0
 }
 
 func (r *ringBuffer) Bytes() []byte {
+	data, _ := r.Snapshot()
+	return data
+}
+
+// Snapshot returns a copy of the buffered bytes and the stream offset just
+// past the last one.
+func (r *ringBuffer) Snapshot() ([]byte, int64) {
+	return r.Tail(-1)
+}
+
+// Tail is like Snapshot but copies at most the last limit bytes. A negative
+// limit means everything.
+func (r *ringBuffer) Tail(limit int) ([]byte, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	head, tail := r.segmentsLocked()
+	if limit >= 0 {
+		if skip := len(head) + len(tail) - limit; skip > 0 {
+			if skip >= len(head) {
+				tail = tail[skip-len(head):]
+				head = nil
+			} else {
+				head = head[skip:]
+			}
+		}
+	}
+	copyBuf := make([]byte, 0, len(head)+len(tail))
+	copyBuf = append(copyBuf, head...)
+	copyBuf = append(copyBuf, tail...)
+	return copyBuf, r.total
+}
+
+// WriteTo writes the buffered bytes to w straight from the backing array.
+// The buffer is locked for the duration, so w should be fast.
+func (r *ringBuffer) WriteTo(w io.Writer) (int64, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	copyBuf := make([]byte, len(r.data))
-	copy(copyBuf, r.data)
-	return copyBuf
+	head, tail := r.segmentsLocked()
+	var written int64
+	for _, segment := range [][]byte{head, tail} {
+		if len(segment) == 0 {
+			continue
+		}
+		n, err := w.Write(segment)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
 }
@@ -1,6 +1,12 @@
 package terminal
 
-import "strings"
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
 
 type oscTitleState int
 
@@ -13,6 +19,20 @@ const (
 	oscStateTitleEsc
 )
 
+// maxClipboardOSCSize bounds the base64 payload captured from OSC 52.
+const maxClipboardOSCSize = 1 << 20
+
+// codeBell is the Code of an oscEvent for a bell (BEL) outside an OSC
+// sequence, where BEL ends the sequence instead of ringing.
+const codeBell = -1
+
+// oscEvent is a captured OSC sequence: Code is the numeric parameter and Data
+// everything after the first ';'.
+type oscEvent struct {
+	Code int
+	Data string
+}
+
 type oscTitleParser struct {
 	state   oscTitleState
 	param   int
@@ -21,6 +41,17 @@ type oscTitleParser struct {
 	maxSize int
 }
 
+func capturedOSC(param int) bool {
+	return param == 0 || param == 2 || param == 7 || param == 52
+}
+
+func (p *oscTitleParser) limit() int {
+	if p.param == 52 {
+		return maxClipboardOSCSize
+	}
+	return p.maxSize
+}
+
 func newOSCTitleParser() *oscTitleParser {
 	return &oscTitleParser{
 		state:   oscStateText,
@@ -28,17 +59,19 @@ func newOSCTitleParser() *oscTitleParser {
 	}
 }
 
-func (p *oscTitleParser) Feed(data []byte) []string {
+func (p *oscTitleParser) Feed(data []byte) []oscEvent {
 	if len(data) == 0 {
 		return nil
 	}
 
-	var titles []string
+	var events []oscEvent
 	for _, b := range data {
 		switch p.state {
 		case oscStateText:
 			if b == 0x1b {
 				p.state = oscStateEsc
+			} else if b == 0x07 {
+				events = append(events, oscEvent{Code: codeBell})
 			}
 		case oscStateEsc:
 			if b == ']' {
@@ -51,6 +84,8 @@ func (p *oscTitleParser) Feed(data []byte) []string {
 			p.state = oscStateText
 			if b == 0x1b {
 				p.state = oscStateEsc
+			} else if b == 0x07 {
+				events = append(events, oscEvent{Code: codeBell})
 			}
 		case oscStateOSC:
 			if b >= '0' && b <= '9' {
@@ -59,7 +94,7 @@ func (p *oscTitleParser) Feed(data []byte) []string {
 				break
 			}
 			if b == ';' {
-				p.capture = p.param == 0 || p.param == 2
+				p.capture = capturedOSC(p.param)
 				p.buf = p.buf[:0]
 				p.state = oscStateTitle
 				break
@@ -71,7 +106,7 @@ func (p *oscTitleParser) Feed(data []byte) []string {
 				break
 			}
 			if b == ';' {
-				p.capture = p.param == 0 || p.param == 2
+				p.capture = capturedOSC(p.param)
 				p.buf = p.buf[:0]
 				p.state = oscStateTitle
 				break
@@ -80,7 +115,7 @@ func (p *oscTitleParser) Feed(data []byte) []string {
 		case oscStateTitle:
 			if b == 0x07 {
 				if p.capture && len(p.buf) > 0 {
-					titles = append(titles, string(p.buf))
+					events = append(events, oscEvent{Code: p.param, Data: string(p.buf)})
 				}
 				p.buf = p.buf[:0]
 				p.state = oscStateText
@@ -90,21 +125,21 @@ func (p *oscTitleParser) Feed(data []byte) []string {
 				p.state = oscStateTitleEsc
 				break
 			}
-			if p.capture && len(p.buf) < p.maxSize {
+			if p.capture && len(p.buf) < p.limit() {
 				p.buf = append(p.buf, b)
 			}
 		case oscStateTitleEsc:
 			if b == '\\' {
 				if p.capture && len(p.buf) > 0 {
-					titles = append(titles, string(p.buf))
+					events = append(events, oscEvent{Code: p.param, Data: string(p.buf)})
 				}
 				p.buf = p.buf[:0]
 				p.state = oscStateText
 				break
 			}
-			if p.capture && len(p.buf) < p.maxSize {
+			if p.capture && len(p.buf) < p.limit() {
 				p.buf = append(p.buf, 0x1b)
-				if len(p.buf) < p.maxSize {
+				if len(p.buf) < p.limit() {
 					p.buf = append(p.buf, b)
 				}
 			}
@@ -113,16 +148,18 @@ func (p *oscTitleParser) Feed(data []byte) []string {
 			p.state = oscStateText
 		}
 	}
-	return titles
+	return events
 }
 
-func parseAlicesMirrorTitle(title string) (cwd string, proc string, ok bool) {
+// parseAlicesMirrorTitle reads a title emitted by the shell integrations,
+// prefix|cwd|proc. Titles starting with another mirror's default prefix are
+// read too.
+func parseAlicesMirrorTitle(title, prefix string) (cwd string, proc string, ok bool) {
 	first := strings.Index(title, "|")
 	if first <= 0 {
 		return "", "", false
 	}
-	prefix := title[:first]
-	if !strings.HasPrefix(prefix, "alices-mirror") {
+	if got := title[:first]; got != prefix && !strings.HasPrefix(got, defaultTitlePrefix) {
 		return "", "", false
 	}
 	rest := title[first+1:]
@@ -137,3 +174,35 @@ func parseAlicesMirrorTitle(title string) (cwd string, proc string, ok bool) {
 	}
 	return cwd, proc, true
 }
+
+// parseWorkingDirectory reads an OSC 7 payload, file://host/path with the
+// path percent-encoded, as many shell configurations emit on every prompt.
+// Reports from another host, such as an ssh session inside the shell, are
+// ignored.
+func parseWorkingDirectory(data string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(data))
+	if err != nil || u.Scheme != "file" || u.Path == "" || !isLocalHost(u.Hostname()) {
+		return "", false
+	}
+	dir := u.Path
+	if runtime.GOOS == "windows" {
+		// file://host/C:/Users/alice
+		if len(dir) >= 3 && dir[0] == '/' && dir[2] == ':' {
+			dir = dir[1:]
+		}
+		dir = filepath.FromSlash(dir)
+	}
+	return filepath.Clean(dir), true
+}
+
+func isLocalHost(host string) bool {
+	if host == "" || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	name, err := os.Hostname()
+	if err != nil {
+		return false
+	}
+	short, _, _ := strings.Cut(name, ".")
+	return strings.EqualFold(host, name) || strings.EqualFold(host, short)
+}
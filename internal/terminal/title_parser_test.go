@@ -0,0 +1,81 @@
+package terminal
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestParseWorkingDirectory(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("paths below are POSIX paths")
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skip(err)
+	}
+	cases := []struct {
+		data string
+		want string
+		ok   bool
+	}{
+		{data: "file://" + host + "/home/alice/my%20dir", want: "/home/alice/my dir", ok: true},
+		{data: "file:///tmp/", want: "/tmp", ok: true},
+		{data: "file://localhost/var/log", want: "/var/log", ok: true},
+		{data: "file://elsewhere.invalid/home/alice", ok: false},
+		{data: "https://example.com/x", ok: false},
+		{data: "not a url", ok: false},
+	}
+	for _, tc := range cases {
+		got, ok := parseWorkingDirectory(tc.data)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("parseWorkingDirectory(%q) = %q, %v; want %q, %v", tc.data, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	parser := newOSCTitleParser()
+	events := parser.Feed([]byte("a\x1b]7;file:///tmp\x1b\\b"))
+	if len(events) != 1 || events[0].Code != 7 || events[0].Data != "file:///tmp" {
+		t.Errorf("Feed captured %+v", events)
+	}
+}
+
+func TestParseAlicesMirrorTitle(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		title, prefix string
+		cwd, proc     string
+		ok            bool
+	}{
+		{title: "alices-mirror|~/src|vim", prefix: "alices-mirror", cwd: "~/src", proc: "vim", ok: true},
+		{title: "work|~|bash", prefix: "work", cwd: "~", proc: "bash", ok: true},
+		{title: "alices-mirror(shared:3002)|/tmp|top", prefix: "work", cwd: "/tmp", proc: "top", ok: true},
+		{title: "home|~|bash", prefix: "work", ok: false},
+		{title: "vim README.md", prefix: "alices-mirror", ok: false},
+	}
+	for _, tc := range cases {
+		cwd, proc, ok := parseAlicesMirrorTitle(tc.title, tc.prefix)
+		if ok != tc.ok || cwd != tc.cwd || proc != tc.proc {
+			t.Errorf("parseAlicesMirrorTitle(%q, %q) = %q, %q, %v", tc.title, tc.prefix, cwd, proc, ok)
+		}
+	}
+}
+
+func TestOSCTitleParserBell(t *testing.T) {
+	t.Parallel()
+
+	parser := newOSCTitleParser()
+	// A BEL ending an OSC sequence does not ring, even split across reads.
+	events := parser.Feed([]byte("done\a\x1b]0;title"))
+	events = append(events, parser.Feed([]byte("\a\x1b\a"))...)
+	var codes []int
+	for _, event := range events {
+		codes = append(codes, event.Code)
+	}
+	if len(codes) != 3 || codes[0] != codeBell || codes[1] != 0 || codes[2] != codeBell {
+		t.Errorf("Feed events = %+v", events)
+	}
+}
@@ -0,0 +1,337 @@
+package terminal
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The tmux bridge mirrors an existing tmux session instead of a new shell.
+// It runs "tmux -C attach-session", tmux's control mode, and forwards the
+// output of the session's active pane. When another pane or window becomes
+// active the mirror is redrawn from capture-pane. Input goes to the active
+// pane with send-keys and resizes set the control client's size, so tmux
+// sizes the window as it would for any other attached client.
+const (
+	tmuxInputChunk   = 256
+	tmuxQueryTimeout = 2 * time.Second
+	// tmuxReattachDelay paces reattaching after the client was detached or
+	// the session went away.
+	tmuxReattachDelay = time.Second
+)
+
+// CheckTmux reports whether target names a tmux session that can be
+// attached to.
+func CheckTmux(target string) error {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return errors.New("tmux was not found in PATH")
+	}
+	out, err := exec.Command("tmux", "has-session", "-t", target).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+type tmuxReply func(lines []string, ok bool)
+
+// tmuxClient is a control-mode client. It serves as both the ptyDevice and
+// the shellCommand of a session.
+type tmuxClient struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	out    *io.PipeReader
+	outW   *io.PipeWriter
+	// readDone is closed once tmux's output has been read to the end.
+	readDone chan struct{}
+
+	mu      sync.Mutex
+	pending []tmuxReply
+	pane    string
+	closed  bool
+}
+
+func startTmuxClient(target string, cols, rows int) (*tmuxClient, error) {
+	if err := CheckTmux(target); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("tmux", "-C", "attach-session", "-t", target)
+	// TMUX, if set, is kept: it names the server the session lives on.
+	cmd.Env = withoutSecrets(os.Environ())
+	detachTmuxClient(cmd)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	out, outW := io.Pipe()
+	c := &tmuxClient{cmd: cmd, stdin: stdin, stdout: stdout, out: out, outW: outW, readDone: make(chan struct{})}
+	go c.readLoop()
+	if cols > 0 && rows > 0 {
+		_ = c.Resize(cols, rows)
+	}
+	c.followActivePane()
+	return c, nil
+}
+
+func (c *tmuxClient) Read(p []byte) (int, error) {
+	return c.out.Read(p)
+}
+
+// Write types p into the active pane.
+func (c *tmuxClient) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	pane := c.pane
+	c.mu.Unlock()
+	if pane == "" {
+		return 0, errors.New("tmux pane not ready")
+	}
+	for start := 0; start < len(p); start += tmuxInputChunk {
+		chunk := p[start:min(start+tmuxInputChunk, len(p))]
+		var b strings.Builder
+		b.WriteString("send-keys -t " + pane + " -H")
+		for _, ch := range chunk {
+			b.WriteString(" ")
+			b.WriteString(hex.EncodeToString([]byte{ch}))
+		}
+		if err := c.command(b.String(), nil); err != nil {
+			return start, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *tmuxClient) Resize(cols, rows int) error {
+	if cols <= 0 || rows <= 0 {
+		return nil
+	}
+	return c.command(fmt.Sprintf("refresh-client -C %d,%d", cols, rows), nil)
+}
+
+// Close detaches from tmux; the tmux session keeps running.
+func (c *tmuxClient) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+	_ = c.stdin.Close()
+	return c.out.Close()
+}
+
+func (c *tmuxClient) PID() int {
+	if c.cmd.Process == nil {
+		return 0
+	}
+	return c.cmd.Process.Pid
+}
+
+func (c *tmuxClient) Kill() error {
+	if c.cmd.Process == nil {
+		return nil
+	}
+	return c.cmd.Process.Kill()
+}
+
+func (c *tmuxClient) Wait() error {
+	<-c.readDone
+	return c.cmd.Wait()
+}
+
+// CurrentDirectory returns the working directory of the active pane.
+func (c *tmuxClient) CurrentDirectory() (string, error) {
+	lines, err := c.query("display-message -p '#{pane_current_path}'")
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) == "" {
+		return "", errors.New("current directory not available")
+	}
+	return lines[0], nil
+}
+
+// command sends one command line; reply, if set, gets its output.
+// Replies arrive in the order commands are sent.
+func (c *tmuxClient) command(line string, reply tmuxReply) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errors.New("tmux client closed")
+	}
+	if _, err := io.WriteString(c.stdin, line+"\n"); err != nil {
+		return err
+	}
+	c.pending = append(c.pending, reply)
+	return nil
+}
+
+func (c *tmuxClient) query(line string) ([]string, error) {
+	type result struct {
+		lines []string
+		ok    bool
+	}
+	done := make(chan result, 1)
+	if err := c.command(line, func(lines []string, ok bool) { done <- result{lines, ok} }); err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-done:
+		if !r.ok {
+			return nil, fmt.Errorf("tmux: %s", strings.Join(r.lines, " "))
+		}
+		return r.lines, nil
+	case <-time.After(tmuxQueryTimeout):
+		return nil, errors.New("tmux did not answer")
+	}
+}
+
+// followActivePane looks up the active pane and, if it changed, redraws the
+// mirror from its contents and starts forwarding its output.
+func (c *tmuxClient) followActivePane() {
+	_ = c.command("display-message -p '#{pane_id}'", func(lines []string, ok bool) {
+		if !ok || len(lines) == 0 {
+			return
+		}
+		pane := strings.TrimSpace(lines[0])
+		c.mu.Lock()
+		same := pane == c.pane
+		c.mu.Unlock()
+		if same || !strings.HasPrefix(pane, "%") {
+			return
+		}
+		var screen []string
+		_ = c.command("capture-pane -p -e -t "+pane, func(lines []string, ok bool) {
+			if ok {
+				screen = lines
+			}
+		})
+		_ = c.command("display-message -p -t "+pane+" '#{cursor_x} #{cursor_y}'", func(lines []string, ok bool) {
+			x, y := 0, 0
+			if ok && len(lines) > 0 {
+				fmt.Sscanf(lines[0], "%d %d", &x, &y)
+			}
+			c.mu.Lock()
+			c.pane = pane
+			c.mu.Unlock()
+			_, _ = c.outW.Write(tmuxRedraw(screen, x, y))
+		})
+	})
+}
+
+// readLoop parses control-mode output until tmux exits.
+func (c *tmuxClient) readLoop() {
+	defer close(c.readDone)
+	defer c.outW.Close()
+	reader := bufio.NewReaderSize(c.stdout, 64<<10)
+
+	var block []string
+	inBlock, ours := false, false
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if inBlock {
+			if strings.HasPrefix(line, "%end ") || strings.HasPrefix(line, "%error ") {
+				inBlock = false
+				if ours {
+					c.deliver(block, strings.HasPrefix(line, "%end "))
+				}
+				continue
+			}
+			block = append(block, line)
+			continue
+		}
+
+		kind, rest, _ := strings.Cut(line, " ")
+		switch kind {
+		case "%begin":
+			// The last field is 1 for commands sent by this client and 0
+			// for the attach itself.
+			fields := strings.Fields(rest)
+			inBlock = true
+			ours = len(fields) == 3 && fields[2] == "1"
+			block = nil
+		case "%output":
+			pane, data, _ := strings.Cut(rest, " ")
+			c.mu.Lock()
+			active := pane == c.pane
+			c.mu.Unlock()
+			if active {
+				if _, err := c.outW.Write(unescapeTmuxOutput(data)); err != nil {
+					return
+				}
+			}
+		case "%window-pane-changed", "%session-window-changed", "%session-changed", "%window-close", "%unlinked-window-close":
+			c.followActivePane()
+		case "%exit":
+			_, _ = io.Copy(io.Discard, reader)
+			return
+		}
+	}
+}
+
+func (c *tmuxClient) deliver(lines []string, ok bool) {
+	c.mu.Lock()
+	if len(c.pending) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	reply := c.pending[0]
+	c.pending = c.pending[1:]
+	c.mu.Unlock()
+	if reply != nil {
+		reply(lines, ok)
+	}
+}
+
+// tmuxRedraw clears the screen, draws the captured lines and puts the
+// cursor back where tmux has it.
+func tmuxRedraw(lines []string, x, y int) []byte {
+	var b strings.Builder
+	b.WriteString("\x1b[0m\x1b[H\x1b[2J")
+	b.WriteString(strings.Join(lines, "\x1b[0m\r\n"))
+	b.WriteString("\x1b[0m")
+	fmt.Fprintf(&b, "\x1b[%d;%dH", y+1, x+1)
+	return []byte(b.String())
+}
+
+// unescapeTmuxOutput decodes the octal escapes (\ooo) tmux uses for control
+// characters and backslashes in %output lines.
+func unescapeTmuxOutput(data string) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == '\\' && i+4 <= len(data) {
+			if v, err := strconv.ParseUint(data[i+1:i+4], 8, 8); err == nil {
+				out = append(out, byte(v))
+				i += 3
+				continue
+			}
+		}
+		out = append(out, data[i])
+	}
+	return out
+}
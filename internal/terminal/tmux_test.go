@@ -0,0 +1,22 @@
+package terminal
+
+import "testing"
+
+func TestUnescapeTmuxOutput(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		`plain`:         "plain",
+		`hi\015\012`:    "hi\r\n",
+		`\033[?2004h`:   "\x1b[?2004h",
+		`back\134slash`: `back\slash`,
+		`trailing\01`:   `trailing\01`,
+		`not\9octal`:    `not\9octal`,
+		"caf\303\251":   "caf\303\251",
+	}
+	for in, want := range cases {
+		if got := string(unescapeTmuxOutput(in)); got != want {
+			t.Errorf("unescapeTmuxOutput(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package terminal
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachTmuxClient puts the tmux client in its own session so a reset,
+// which signals the shell's process group, only detaches it.
+func detachTmuxClient(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
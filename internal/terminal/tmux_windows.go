@@ -0,0 +1,7 @@
+//go:build windows
+
+package terminal
+
+import "os/exec"
+
+func detachTmuxClient(cmd *exec.Cmd) {}
@@ -0,0 +1,30 @@
+package terminal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestChangeWorkDirFailedReset(t *testing.T) {
+	t.Parallel()
+
+	pty := NewScriptedPTY(nil)
+	s := NewScriptedSession(Config{}, pty)
+	defer s.Close()
+
+	failure := errors.New("reset refused")
+	pty.FailResets(failure)
+	dir := t.TempDir()
+	if err := s.ChangeWorkDir(dir); !errors.Is(err, failure) {
+		t.Fatalf("ChangeWorkDir error = %v, want %v", err, failure)
+	}
+	if pty.Resets() != 1 {
+		t.Errorf("resets = %d, want 1", pty.Resets())
+	}
+	if s.takeRestartPending() {
+		t.Error("restart still pending after the reset failed")
+	}
+	if s.WorkDir() != dir {
+		t.Errorf("work dir = %q, want %q", s.WorkDir(), dir)
+	}
+}
@@ -0,0 +1,90 @@
+//go:build windows
+
+package terminal
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// maxProcessDir is the longest current directory CreateProcess accepts: it
+// must fit in MAX_PATH with a trailing backslash and NUL.
+const maxProcessDir = windows.MAX_PATH - 2
+
+// shellStartDir picks the directory to create the shell in and, when the
+// shell cannot be created there directly, rewrites args so the shell changes
+// to workDir itself. CreateProcess takes neither \\?\ paths nor ones longer
+// than MAX_PATH, and cmd refuses a UNC current directory, so:
+//   - \\?\ prefixes are removed;
+//   - long paths are replaced by their 8.3 short name when there is one;
+//   - otherwise PowerShell starts with Set-Location, and cmd starts with
+//     pushd, which maps a UNC share to a drive letter.
+//
+// An empty directory means the shell starts in the mirror's own.
+func shellStartDir(shell string, args []string, workDir string) (string, []string, error) {
+	dir := plainPath(workDir)
+	if dir == "" {
+		return "", args, nil
+	}
+	if len(dir) > maxProcessDir {
+		if short, err := shortPath(dir); err == nil && len(short) <= maxProcessDir {
+			dir = short
+		}
+	}
+	unc := strings.HasPrefix(dir, `\\`)
+	switch strings.ToLower(shell) {
+	case "cmd":
+		if !unc && len(dir) <= maxProcessDir {
+			return dir, args, nil
+		}
+		if len(dir) > maxProcessDir {
+			return "", nil, fmt.Errorf("cmd cannot start in %s: the path is longer than %d characters and has no short name", dir, maxProcessDir)
+		}
+		out := append([]string(nil), args...)
+		out[len(out)-1] = fmt.Sprintf(`pushd "%s" & %s`, dir, out[len(out)-1])
+		return "", out, nil
+	case "powershell":
+		if len(dir) <= maxProcessDir {
+			return dir, args, nil
+		}
+		out := append([]string(nil), args...)
+		out[len(out)-1] = fmt.Sprintf("Set-Location -LiteralPath '%s'\n%s", strings.ReplaceAll(dir, "'", "''"), out[len(out)-1])
+		return "", out, nil
+	default:
+		if len(dir) > maxProcessDir {
+			return "", nil, fmt.Errorf("cannot start %s in %s: the path is longer than %d characters and has no short name", shell, dir, maxProcessDir)
+		}
+		return dir, args, nil
+	}
+}
+
+// plainPath removes the \\?\ prefix, turning \\?\UNC\server\share back into
+// \\server\share.
+func plainPath(path string) string {
+	path = strings.TrimSpace(path)
+	if rest, ok := strings.CutPrefix(path, `\\?\UNC\`); ok {
+		return `\\` + rest
+	}
+	return strings.TrimPrefix(path, `\\?\`)
+}
+
+// shortPath returns the 8.3 form of path, which exists only on volumes that
+// keep short names.
+func shortPath(path string) (string, error) {
+	long := `\\?\` + path
+	if strings.HasPrefix(path, `\\`) {
+		long = `\\?\UNC\` + path[2:]
+	}
+	in, err := windows.UTF16PtrFromString(long)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	n, err := windows.GetShortPathName(in, &buf[0], uint32(len(buf)))
+	if err != nil {
+		return "", err
+	}
+	return plainPath(windows.UTF16ToString(buf[:n])), nil
+}
@@ -0,0 +1,80 @@
+package transcript
+
+import "io"
+
+type stripState int
+
+const (
+	stripText stripState = iota
+	stripEscape
+	stripCSI
+	stripString
+	stripStringEscape
+)
+
+// Stripper is a streaming filter that removes escape sequences and control
+// characters other than newline and tab. Unlike Text it keeps no screen, so
+// overwritten text (a progress bar redrawn with \r) appears as written.
+// Sequences may be split across writes.
+type Stripper struct {
+	w     io.Writer
+	state stripState
+	out   []byte
+}
+
+// NewStripper returns a Stripper writing plain text to w.
+func NewStripper(w io.Writer) *Stripper {
+	return &Stripper{w: w}
+}
+
+// Write filters p. It reports len(p) on success even when nothing is
+// written through.
+func (s *Stripper) Write(p []byte) (int, error) {
+	s.out = s.out[:0]
+	for _, b := range p {
+		switch s.state {
+		case stripText:
+			switch {
+			case b == 0x1b:
+				s.state = stripEscape
+			case b == '\n' || b == '\t' || (b >= 0x20 && b != 0x7f):
+				s.out = append(s.out, b)
+			}
+		case stripEscape:
+			switch {
+			case b == '[':
+				s.state = stripCSI
+			case b == ']' || b == 'P' || b == '_' || b == '^' || b == 'X':
+				s.state = stripString
+			case b >= 0x20 && b <= 0x2f:
+				// Intermediate byte; the final byte follows.
+			default:
+				s.state = stripText
+			}
+		case stripCSI:
+			if b >= 0x40 && b <= 0x7e {
+				s.state = stripText
+			}
+		case stripString:
+			switch b {
+			case 0x07:
+				s.state = stripText
+			case 0x1b:
+				s.state = stripStringEscape
+			}
+		case stripStringEscape:
+			if b == '\\' {
+				s.state = stripText
+			} else {
+				s.state = stripString
+			}
+		}
+	}
+	if len(s.out) == 0 {
+		return len(p), nil
+	}
+	if _, err := s.w.Write(s.out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,372 @@
+// Package transcript renders raw terminal output into plain text or HTML.
+//
+// It is not a terminal emulator: it understands line feeds, carriage returns,
+// backspaces, tabs, erase-in-line and SGR colors, and drops every other
+// escape sequence. That is enough for readable shell transcripts.
+package transcript
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	tabWidth = 8
+	// maxColumns is as far right as cursor movement reaches. Text printed
+	// past it still lengthens the line.
+	maxColumns = 512
+	// padPerByte bounds the blank cells cursor movement may add, for all
+	// lines together, per byte of input: a few bytes of escape sequences
+	// must not turn into megabytes of padding.
+	padPerByte = 4
+)
+
+type style struct {
+	fg        string
+	bg        string
+	bold      bool
+	italic    bool
+	underline bool
+	inverse   bool
+}
+
+type cell struct {
+	r     rune
+	style style
+}
+
+type screen struct {
+	lines  [][]cell
+	cursor int
+	style  style
+	// padBudget is how many more blank cells put may add to reach the
+	// cursor.
+	padBudget int
+}
+
+// Text renders data as plain text with all escape sequences removed.
+func Text(data []byte) string {
+	return strings.TrimRight(strings.Join(Lines(data), "\n"), "\n") + "\n"
+}
+
+// Lines renders data as plain text lines with all escape sequences removed.
+func Lines(data []byte) []string {
+	sc := parse(data)
+	lines := make([]string, len(sc.lines))
+	for i, line := range sc.lines {
+		var b strings.Builder
+		for _, c := range line {
+			b.WriteRune(c.r)
+		}
+		lines[i] = b.String()
+	}
+	return lines
+}
+
+// HTML renders data as a standalone HTML document with SGR colors converted
+// to inline styles.
+func HTML(data []byte, title string) string {
+	sc := parse(data)
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\">")
+	fmt.Fprintf(&b, "<title>%s</title>", html.EscapeString(title))
+	b.WriteString("<style>body{margin:0;background:#0b0b0b;color:#d0d0d0}pre{margin:0;padding:12px;font-family:ui-monospace,Menlo,Consolas,monospace;font-size:13px;line-height:1.3;white-space:pre-wrap}</style>")
+	b.WriteString("</head><body><pre>")
+	for i, line := range sc.lines {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		writeHTMLLine(&b, line)
+	}
+	b.WriteString("</pre></body></html>\n")
+	return b.String()
+}
+
+func writeHTMLLine(b *strings.Builder, line []cell) {
+	start := 0
+	for start < len(line) {
+		end := start + 1
+		for end < len(line) && line[end].style == line[start].style {
+			end++
+		}
+		var text strings.Builder
+		for _, c := range line[start:end] {
+			text.WriteRune(c.r)
+		}
+		escaped := html.EscapeString(text.String())
+		if css := line[start].style.css(); css != "" {
+			fmt.Fprintf(b, "<span style=\"%s\">%s</span>", css, escaped)
+		} else {
+			b.WriteString(escaped)
+		}
+		start = end
+	}
+}
+
+func (s style) css() string {
+	fg, bg := s.fg, s.bg
+	if s.inverse {
+		fg, bg = bg, fg
+		if fg == "" {
+			fg = "#0b0b0b"
+		}
+		if bg == "" {
+			bg = "#d0d0d0"
+		}
+	}
+	var parts []string
+	if fg != "" {
+		parts = append(parts, "color:"+fg)
+	}
+	if bg != "" {
+		parts = append(parts, "background:"+bg)
+	}
+	if s.bold {
+		parts = append(parts, "font-weight:bold")
+	}
+	if s.italic {
+		parts = append(parts, "font-style:italic")
+	}
+	if s.underline {
+		parts = append(parts, "text-decoration:underline")
+	}
+	return strings.Join(parts, ";")
+}
+
+func parse(data []byte) *screen {
+	sc := &screen{lines: [][]cell{nil}, padBudget: padPerByte * len(data)}
+	for i := 0; i < len(data); {
+		b := data[i]
+		switch {
+		case b == 0x1b:
+			i = sc.escape(data, i)
+			continue
+		case b == '\n':
+			sc.lines = append(sc.lines, nil)
+			sc.cursor = 0
+		case b == '\r':
+			sc.cursor = 0
+		case b == '\b':
+			if sc.cursor > 0 {
+				sc.cursor--
+			}
+		case b == '\t':
+			next := (sc.cursor/tabWidth + 1) * tabWidth
+			for sc.cursor < next {
+				sc.put(' ')
+			}
+		case b < 0x20 || b == 0x7f:
+		default:
+			r, size := utf8.DecodeRune(data[i:])
+			if r == utf8.RuneError && size <= 1 {
+				i++
+				continue
+			}
+			sc.put(r)
+			i += size
+			continue
+		}
+		i++
+	}
+	return sc
+}
+
+func (sc *screen) put(r rune) {
+	line := sc.lines[len(sc.lines)-1]
+	if sc.cursor > len(line) {
+		pad := min(sc.cursor, maxColumns) - len(line)
+		pad = max(min(pad, sc.padBudget), 0)
+		sc.padBudget -= pad
+		for range pad {
+			line = append(line, cell{r: ' '})
+		}
+		sc.cursor = len(line)
+	}
+	c := cell{r: r, style: sc.style}
+	if sc.cursor < len(line) {
+		line[sc.cursor] = c
+	} else {
+		line = append(line, c)
+	}
+	sc.cursor++
+	sc.lines[len(sc.lines)-1] = line
+}
+
+// escape consumes the escape sequence starting at data[i] and returns the
+// index just past it.
+func (sc *screen) escape(data []byte, i int) int {
+	if i+1 >= len(data) {
+		return len(data)
+	}
+	switch data[i+1] {
+	case '[':
+		j := i + 2
+		for j < len(data) && (data[j] < 0x40 || data[j] > 0x7e) {
+			j++
+		}
+		if j >= len(data) {
+			return len(data)
+		}
+		sc.csi(string(data[i+2:j]), data[j])
+		return j + 1
+	case ']', 'P', '_', '^':
+		// OSC/DCS/APC/PM strings end with BEL or ST (ESC \).
+		for j := i + 2; j < len(data); j++ {
+			if data[j] == 0x07 {
+				return j + 1
+			}
+			if data[j] == 0x1b && j+1 < len(data) && data[j+1] == '\\' {
+				return j + 2
+			}
+		}
+		return len(data)
+	case '(', ')', '*', '+', '#', '%':
+		return min(i+3, len(data))
+	default:
+		return i + 2
+	}
+}
+
+func (sc *screen) csi(params string, final byte) {
+	switch final {
+	case 'm':
+		sc.sgr(params)
+	case 'K':
+		mode := strings.TrimSpace(params)
+		line := sc.lines[len(sc.lines)-1]
+		switch mode {
+		case "", "0":
+			if sc.cursor < len(line) {
+				sc.lines[len(sc.lines)-1] = line[:sc.cursor]
+			}
+		case "2":
+			sc.lines[len(sc.lines)-1] = nil
+		}
+	case 'G':
+		n := atoi(params, 1)
+		sc.cursor = min(max(n-1, 0), maxColumns)
+	case 'C':
+		// Past maxColumns only when text already took the cursor there.
+		sc.cursor = max(sc.cursor, min(sc.cursor+max(atoi(params, 1), 1), maxColumns))
+	case 'D':
+		sc.cursor = max(sc.cursor-max(atoi(params, 1), 1), 0)
+	}
+}
+
+func (sc *screen) sgr(params string) {
+	if params == "" {
+		sc.style = style{}
+		return
+	}
+	fields := strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ':' })
+	for k := 0; k < len(fields); k++ {
+		code := atoi(fields[k], 0)
+		switch {
+		case code == 0:
+			sc.style = style{}
+		case code == 1:
+			sc.style.bold = true
+		case code == 3:
+			sc.style.italic = true
+		case code == 4:
+			sc.style.underline = true
+		case code == 7:
+			sc.style.inverse = true
+		case code == 22:
+			sc.style.bold = false
+		case code == 23:
+			sc.style.italic = false
+		case code == 24:
+			sc.style.underline = false
+		case code == 27:
+			sc.style.inverse = false
+		case code >= 30 && code <= 37:
+			sc.style.fg = palette[code-30]
+		case code == 39:
+			sc.style.fg = ""
+		case code >= 40 && code <= 47:
+			sc.style.bg = palette[code-40]
+		case code == 49:
+			sc.style.bg = ""
+		case code >= 90 && code <= 97:
+			sc.style.fg = palette[code-90+8]
+		case code >= 100 && code <= 107:
+			sc.style.bg = palette[code-100+8]
+		case code == 38 || code == 48:
+			color, used := extendedColor(fields[k+1:])
+			k += used
+			if code == 38 {
+				sc.style.fg = color
+			} else {
+				sc.style.bg = color
+			}
+		}
+	}
+}
+
+// extendedColor parses the arguments of SGR 38/48 and reports how many
+// fields it consumed.
+func extendedColor(fields []string) (string, int) {
+	if len(fields) == 0 {
+		return "", 0
+	}
+	switch atoi(fields[0], -1) {
+	case 5:
+		if len(fields) < 2 {
+			return "", len(fields)
+		}
+		return color256(atoi(fields[1], 0)), 2
+	case 2:
+		if len(fields) < 4 {
+			return "", len(fields)
+		}
+		r, g, b := clampByte(atoi(fields[1], 0)), clampByte(atoi(fields[2], 0)), clampByte(atoi(fields[3], 0))
+		return fmt.Sprintf("#%02x%02x%02x", r, g, b), 4
+	}
+	return "", 1
+}
+
+var palette = [16]string{
+	"#000000", "#cd3131", "#0dbc79", "#e5e510", "#2472c8", "#bc3fbc", "#11a8cd", "#e5e5e5",
+	"#666666", "#f14c4c", "#23d18b", "#f5f543", "#3b8eea", "#d670d6", "#29b8db", "#ffffff",
+}
+
+func color256(n int) string {
+	switch {
+	case n < 0 || n > 255:
+		return ""
+	case n < 16:
+		return palette[n]
+	case n < 232:
+		n -= 16
+		levels := [6]int{0, 95, 135, 175, 215, 255}
+		return fmt.Sprintf("#%02x%02x%02x", levels[n/36], levels[(n/6)%6], levels[n%6])
+	default:
+		v := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+}
+
+func atoi(s string, fallback int) int {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return fallback
+	}
+	n := 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return fallback
+		}
+		n = n*10 + int(r-'0')
+		if n > 1<<16 {
+			return fallback
+		}
+	}
+	return n
+}
+
+func clampByte(n int) int {
+	return min(max(n, 0), 255)
+}
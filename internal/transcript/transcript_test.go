@@ -0,0 +1,59 @@
+package transcript
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	input := "\x1b]0;title\x07$ ls\r\n\x1b[1;32mok\x1b[0m file\r\nprogress 10%\rprogress 100%\r\nab\bc\x1b[K\r\n"
+	got := Text([]byte(input))
+	want := "$ ls\nok file\nprogress 100%\nac\n"
+	if got != want {
+		t.Fatalf("Text() = %q, want %q", got, want)
+	}
+}
+
+func TestHTMLColors(t *testing.T) {
+	got := HTML([]byte("\x1b[31m<red>\x1b[0m \x1b[38;5;196mx\x1b[48;2;1;2;3my\x1b[0m"), "t")
+	for _, want := range []string{
+		`<span style="color:#cd3131">&lt;red&gt;</span>`,
+		`<span style="color:#ff0000">x</span>`,
+		`<span style="color:#ff0000;background:#010203">y</span>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("HTML() missing %q in %q", want, got)
+		}
+	}
+}
+
+func TestStripperAcrossWrites(t *testing.T) {
+	var b strings.Builder
+	s := NewStripper(&b)
+	for _, part := range []string{"$ ls\r\n\x1b[1;3", "2mok\x1b[0m\x1b]0;ti", "tle\x1b\\ file\x07\r\n", "ab\bc\x1b(B\n"} {
+		if n, err := s.Write([]byte(part)); err != nil || n != len(part) {
+			t.Fatalf("Write(%q) = %d, %v", part, n, err)
+		}
+	}
+	if got, want := b.String(), "$ ls\nok file\nabc\n"; got != want {
+		t.Fatalf("stripped = %q, want %q", got, want)
+	}
+}
+
+func TestCursorMovementIsBounded(t *testing.T) {
+	input := strings.Repeat("\x1b[65000C.\x1b[65000G!\n", 1000)
+	lines := Lines([]byte(input))
+	total := 0
+	for _, line := range lines {
+		if len(line) > maxColumns+1 {
+			t.Fatalf("line of %d cells", len(line))
+		}
+		total += len(line)
+	}
+	if total > padPerByte*len(input)+len(input) {
+		t.Fatalf("%d cells from %d bytes of input", total, len(input))
+	}
+	if got := Text([]byte("a\x1b[3Cb\x1b[2Gc")); got != "ac  b\n" {
+		t.Fatalf("Text() = %q", got)
+	}
+}
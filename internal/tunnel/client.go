@@ -0,0 +1,224 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// tunnelIdleTimeout drops a tunnel that has heard nothing, not even the
+	// relay's pings, for this long.
+	tunnelIdleTimeout = 90 * time.Second
+	minRedialDelay    = time.Second
+	maxRedialDelay    = 30 * time.Second
+)
+
+// Client keeps a mirror registered with a relay. Connections the relay
+// forwards are accepted from Listener, so the HTTP server sees them with the
+// public client's address.
+type Client struct {
+	// Proxy selects the proxy for the connection to the relay. Nil means
+	// the environment, as for websocket.DefaultDialer.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	relayURL string
+	listener *listener
+
+	mu   sync.Mutex
+	name string
+}
+
+// NewClient prepares a tunnel to relayURL (ws://, wss://, http:// or
+// https://; a token query parameter is passed through to the relay). name is
+// the subdomain to ask for; the relay may assign another one.
+func NewClient(relayURL, name string) (*Client, error) {
+	u, err := url.Parse(strings.TrimSpace(relayURL))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid relay URL %q", relayURL)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return nil, fmt.Errorf("invalid relay URL %q (expected ws, wss, http or https)", relayURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + registerPath
+
+	return &Client{
+		relayURL: u.String(),
+		listener: newListener(),
+		name:     name,
+	}, nil
+}
+
+// Listener returns the listener forwarded connections arrive on.
+func (c *Client) Listener() net.Listener {
+	return c.listener
+}
+
+// Run keeps the tunnel up until ctx is done, redialing with backoff, and
+// calls onURL with the public URL after every registration.
+func (c *Client) Run(ctx context.Context, onURL func(publicURL string)) error {
+	delay := minRedialDelay
+	for {
+		registeredAt := time.Now()
+		err := c.runOnce(ctx, onURL)
+		if ctx.Err() != nil {
+			_ = c.listener.Close()
+			return ctx.Err()
+		}
+		var fatal *registrationError
+		if errors.As(err, &fatal) && fatal.permanent {
+			_ = c.listener.Close()
+			return err
+		}
+		if time.Since(registeredAt) > maxRedialDelay {
+			delay = minRedialDelay
+		}
+		select {
+		case <-ctx.Done():
+			_ = c.listener.Close()
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRedialDelay)
+	}
+}
+
+type registrationError struct {
+	status    int
+	permanent bool
+}
+
+func (e *registrationError) Error() string {
+	return fmt.Sprintf("relay refused the tunnel: %s", http.StatusText(e.status))
+}
+
+func (c *Client) runOnce(ctx context.Context, onURL func(string)) error {
+	u, _ := url.Parse(c.relayURL)
+	q := u.Query()
+	c.mu.Lock()
+	if c.name != "" {
+		q.Set("name", c.name)
+	}
+	c.mu.Unlock()
+	u.RawQuery = q.Encode()
+
+	dialer := *websocket.DefaultDialer
+	dialer.Subprotocols = []string{Subprotocol}
+	if c.Proxy != nil {
+		dialer.Proxy = c.Proxy
+	}
+	conn, resp, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		if resp != nil {
+			return &registrationError{
+				status:    resp.StatusCode,
+				permanent: resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden,
+			}
+		}
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	_ = conn.SetReadDeadline(time.Now().Add(tunnelIdleTimeout))
+	var registered registeredMessage
+	if err := conn.ReadJSON(&registered); err != nil || registered.Type != "registered" {
+		_ = conn.Close()
+		return errors.New("relay did not confirm the tunnel")
+	}
+	c.mu.Lock()
+	c.name = registered.Name
+	c.mu.Unlock()
+	if onURL != nil {
+		onURL(registered.URL)
+	}
+
+	conn.SetPingHandler(func(data string) error {
+		_ = conn.SetReadDeadline(time.Now().Add(tunnelIdleTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeWait))
+	})
+
+	m := newMux(conn)
+	return m.run(func(id uint32, remote string) {
+		_ = conn.SetReadDeadline(time.Now().Add(tunnelIdleTimeout))
+		local, forwarded := net.Pipe()
+		if m.attach(id, forwarded) {
+			c.listener.deliver(&tunnelConn{Conn: local, remote: parseAddr(remote)})
+		}
+	})
+}
+
+// listener hands forwarded connections to an http.Server.
+type listener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newListener() *listener {
+	return &listener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *listener) deliver(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *listener) Addr() net.Addr {
+	return tunnelAddr("relay")
+}
+
+// tunnelConn is the server's end of a forwarded connection. It reports the
+// public client's address so allow-ip and user-level rules apply to it.
+type tunnelConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *tunnelConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type tunnelAddr string
+
+func (a tunnelAddr) Network() string { return "tunnel" }
+func (a tunnelAddr) String() string  { return string(a) }
+
+func parseAddr(raw string) net.Addr {
+	if addr, err := net.ResolveTCPAddr("tcp", raw); err == nil {
+		return addr
+	}
+	return tunnelAddr(raw)
+}
@@ -0,0 +1,21 @@
+package tunnel
+
+import (
+	"context"
+	"regexp"
+)
+
+// cloudflared opens a Cloudflare quick tunnel, which needs no account and
+// gets a random trycloudflare.com host name.
+type cloudflared struct {
+	env []string
+}
+
+var cloudflaredURL = regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)
+
+func (p cloudflared) Start(ctx context.Context, localAddr string) (string, error) {
+	args := []string{"tunnel", "--no-autoupdate", "--url", "http://" + localAddr}
+	return startAgent(ctx, "cloudflared", args, p.env, func(line string) string {
+		return cloudflaredURL.FindString(line)
+	})
+}
@@ -0,0 +1,226 @@
+// Package tunnel implements a small reverse tunnel so a mirror behind NAT can
+// be reached through a relay it dials out to.
+//
+// The mirror keeps one WebSocket open to the relay. Every public TCP
+// connection the relay accepts for that mirror becomes a stream multiplexed
+// over it as binary frames: one type byte, a big-endian uint32 stream id and
+// the payload.
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocol is the WebSocket subprotocol spoken on the tunnel connection.
+const Subprotocol = "alices-mirror-tunnel.v1"
+
+const (
+	// frameOpen starts a stream; its payload is the public client address.
+	frameOpen byte = 1
+	// frameData carries stream bytes in either direction.
+	frameData byte = 2
+	// frameClose ends a stream from either side.
+	frameClose byte = 3
+)
+
+const (
+	frameHeaderSize = 5
+	maxFramePayload = 32 << 10
+	// streamBacklog is how many frames may wait for a slow stream before it
+	// is closed, so one stuck connection cannot stall the others.
+	streamBacklog = 256
+)
+
+// registeredMessage is the first message the relay sends on a new tunnel.
+type registeredMessage struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type mux struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	streams map[uint32]*stream
+	closed  bool
+}
+
+type stream struct {
+	id   uint32
+	conn net.Conn
+	in   chan []byte
+}
+
+func newMux(conn *websocket.Conn) *mux {
+	return &mux{conn: conn, streams: make(map[uint32]*stream)}
+}
+
+func (m *mux) writeFrame(kind byte, id uint32, payload []byte) error {
+	frame := make([]byte, frameHeaderSize+len(payload))
+	frame[0] = kind
+	binary.BigEndian.PutUint32(frame[1:frameHeaderSize], id)
+	copy(frame[frameHeaderSize:], payload)
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	return m.conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+func parseFrame(data []byte) (byte, uint32, []byte, error) {
+	if len(data) < frameHeaderSize {
+		return 0, 0, nil, errors.New("short tunnel frame")
+	}
+	return data[0], binary.BigEndian.Uint32(data[1:frameHeaderSize]), data[frameHeaderSize:], nil
+}
+
+// attach starts pumping bytes between conn and stream id. Data from the
+// other side is written to conn in order; when the stream ends, whatever was
+// already received is flushed before conn is closed.
+func (m *mux) attach(id uint32, conn net.Conn) bool {
+	st := &stream{id: id, conn: conn, in: make(chan []byte, streamBacklog)}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		_ = conn.Close()
+		return false
+	}
+	m.streams[id] = st
+	m.mu.Unlock()
+
+	go func() {
+		defer conn.Close()
+		for data := range st.in {
+			if _, err := conn.Write(data); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		buf := make([]byte, maxFramePayload)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 && m.writeFrame(frameData, id, buf[:n]) != nil {
+				m.endStream(st, false)
+				return
+			}
+			if err != nil {
+				m.endStream(st, true)
+				return
+			}
+		}
+	}()
+	return true
+}
+
+// endStream removes st and stops its writer, telling the other side unless
+// it ended the stream itself. It reports whether st was still open.
+func (m *mux) endStream(st *stream, notify bool) bool {
+	m.mu.Lock()
+	open := m.streams[st.id] == st
+	if open {
+		delete(m.streams, st.id)
+		close(st.in)
+	}
+	m.mu.Unlock()
+	if open && notify {
+		_ = m.writeFrame(frameClose, st.id, nil)
+	}
+	return open
+}
+
+// deliver hands payload to stream id, dropping the stream if it is too far
+// behind.
+func (m *mux) deliver(id uint32, payload []byte) {
+	m.mu.Lock()
+	st := m.streams[id]
+	if st == nil {
+		m.mu.Unlock()
+		return
+	}
+	select {
+	case st.in <- payload:
+		m.mu.Unlock()
+		return
+	default:
+	}
+	m.mu.Unlock()
+	if m.endStream(st, true) {
+		_ = st.conn.Close()
+	}
+}
+
+func (m *mux) remoteClose(id uint32) {
+	m.mu.Lock()
+	st := m.streams[id]
+	m.mu.Unlock()
+	if st != nil {
+		m.endStream(st, false)
+	}
+}
+
+// run reads frames until the tunnel connection fails, passing stream opens
+// to onOpen, and then closes every stream.
+func (m *mux) run(onOpen func(id uint32, remote string)) error {
+	defer m.shutdown()
+	for {
+		messageType, data, err := m.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+		kind, id, payload, err := parseFrame(data)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case frameOpen:
+			if onOpen != nil {
+				onOpen(id, string(payload))
+			}
+		case frameData:
+			m.deliver(id, payload)
+		case frameClose:
+			m.remoteClose(id)
+		}
+	}
+}
+
+func (m *mux) shutdown() {
+	m.mu.Lock()
+	m.closed = true
+	streams := make([]*stream, 0, len(m.streams))
+	for _, st := range m.streams {
+		streams = append(streams, st)
+	}
+	m.mu.Unlock()
+	for _, st := range streams {
+		m.endStream(st, false)
+	}
+	_ = m.conn.Close()
+}
+
+// pipe copies between two connections until either side is done.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+	_ = a.Close()
+	_ = b.Close()
+}
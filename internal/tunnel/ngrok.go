@@ -0,0 +1,34 @@
+package tunnel
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// ngrok runs the ngrok agent, which must already be signed in with
+// `ngrok config add-authtoken`.
+type ngrok struct {
+	env []string
+}
+
+func (p ngrok) Start(ctx context.Context, localAddr string) (string, error) {
+	args := []string{"http", localAddr, "--log=stdout", "--log-format=json"}
+	return startAgent(ctx, "ngrok", args, p.env, parseNgrokLog)
+}
+
+// parseNgrokLog returns the public URL from ngrok's "started tunnel" log
+// line, or "" for any other line.
+func parseNgrokLog(line string) string {
+	var entry struct {
+		Msg string `json:"msg"`
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return ""
+	}
+	if entry.Msg != "started tunnel" || !strings.HasPrefix(entry.URL, "http") {
+		return ""
+	}
+	return entry.URL
+}
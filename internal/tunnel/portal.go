@@ -0,0 +1,84 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// MirrorInfo describes a registered mirror on the relay portal.
+type MirrorInfo struct {
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	RemoteIP string    `json:"remoteIp"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+// Mirrors lists the registered mirrors by name.
+func (r *Relay) Mirrors() []MirrorInfo {
+	r.mu.Lock()
+	mirrors := make([]MirrorInfo, 0, len(r.tunnels))
+	for _, t := range r.tunnels {
+		mirrors = append(mirrors, MirrorInfo{
+			Name:     t.name,
+			URL:      t.url,
+			RemoteIP: t.remoteIP,
+			JoinedAt: t.joinedAt,
+		})
+	}
+	r.mu.Unlock()
+	sort.Slice(mirrors, func(i, j int) bool {
+		return mirrors[i].Name < mirrors[j].Name
+	})
+	return mirrors
+}
+
+var portalTemplate = template.Must(template.New("portal").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>alices mirror hub</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem auto; max-width: 48rem; padding: 0 1rem; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.4rem 0.6rem; border-bottom: 1px solid #ddd; }
+.empty { color: #777; }
+</style>
+</head>
+<body>
+<h1>alices mirror hub</h1>
+{{if .}}
+<table>
+<tr><th>Mirror</th><th>From</th><th>Connected</th></tr>
+{{range .}}<tr><td><a href="{{.URL}}">{{.Name}}</a></td><td>{{.RemoteIP}}</td><td>{{.JoinedAt.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>
+{{else}}
+<p class="empty">No mirrors are registered. Start one with --share-public pointing at this hub.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// servePortal lists the registered mirrors as a page at / and as JSON at
+// /api/mirrors.
+func (r *Relay) servePortal(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	switch req.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = portalTemplate.Execute(w, r.Mirrors())
+	case "/api/mirrors":
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		_ = json.NewEncoder(w).Encode(map[string][]MirrorInfo{"mirrors": r.Mirrors()})
+	default:
+		http.NotFound(w, req)
+	}
+}
@@ -0,0 +1,124 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Provider exposes a local HTTP address through a third-party tunnel.
+type Provider interface {
+	// Start opens a tunnel to localAddr (host:port) and returns its public
+	// URL. The tunnel stays up until ctx is done.
+	Start(ctx context.Context, localAddr string) (string, error)
+}
+
+// ProviderOptions configures a built-in provider.
+type ProviderOptions struct {
+	// Env is added to the environment of the provider's agent process.
+	Env []string
+}
+
+var providers = map[string]func(ProviderOptions) Provider{
+	"cloudflared": func(opts ProviderOptions) Provider { return cloudflared{env: opts.Env} },
+	"ngrok":       func(opts ProviderOptions) Provider { return ngrok{env: opts.Env} },
+}
+
+// NewProvider returns the provider registered as name.
+func NewProvider(name string, opts ProviderOptions) (Provider, error) {
+	newProvider, ok := providers[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("unknown tunnel provider %q (expected %s)", name, strings.Join(ProviderNames(), " or "))
+	}
+	return newProvider(opts), nil
+}
+
+// ProviderNames lists the built-in providers.
+func ProviderNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// agentStartTimeout bounds how long an agent may take to report its URL.
+const agentStartTimeout = 30 * time.Second
+
+// startAgent runs an agent binary with env added to its environment and
+// scans its output with findURL until it reports the public URL. The agent
+// keeps running until ctx is done.
+func startAgent(ctx context.Context, binary string, args, env []string, findURL func(line string) string) (string, error) {
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return "", fmt.Errorf("%s was not found in PATH", binary)
+	}
+
+	agentCtx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(agentCtx, path, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	output, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return "", fmt.Errorf("failed to start %s: %v", binary, err)
+	}
+	go func() {
+		_ = writer.CloseWithError(cmd.Wait())
+		cancel()
+	}()
+
+	found := make(chan string, 1)
+	failed := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(output)
+		reported := false
+		last := ""
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			last = line
+			if !reported {
+				if u := findURL(line); u != "" {
+					reported = true
+					found <- u
+				}
+			}
+		}
+		if !reported {
+			if last != "" {
+				failed <- fmt.Errorf("%s exited before reporting a URL: %s", binary, last)
+			} else {
+				failed <- fmt.Errorf("%s exited before reporting a URL", binary)
+			}
+		}
+	}()
+
+	timer := time.NewTimer(agentStartTimeout)
+	defer timer.Stop()
+	select {
+	case u := <-found:
+		return u, nil
+	case err := <-failed:
+		cancel()
+		return "", err
+	case <-timer.C:
+		cancel()
+		return "", fmt.Errorf("%s did not report a URL within %s", binary, agentStartTimeout)
+	case <-ctx.Done():
+		return "", errors.Join(ctx.Err(), fmt.Errorf("%s was stopped", binary))
+	}
+}
@@ -0,0 +1,21 @@
+package tunnel
+
+import "testing"
+
+func TestParseNgrokLog(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		line string
+		want string
+	}{
+		{line: `{"lvl":"info","msg":"started tunnel","obj":"tunnels","name":"command_line","addr":"http://127.0.0.1:3002","url":"https://abcd.ngrok-free.app"}`, want: "https://abcd.ngrok-free.app"},
+		{line: `{"lvl":"info","msg":"client session established","obj":"tunnels.session"}`},
+		{line: `t=2024-01-01 lvl=info msg="started tunnel" url=https://abcd.ngrok-free.app`},
+	}
+	for _, tc := range cases {
+		if got := parseNgrokLog(tc.line); got != tc.want {
+			t.Errorf("parseNgrokLog(%q) = %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package tunnel
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	registerPath = "/_tunnel"
+	writeWait    = 10 * time.Second
+	pingInterval = 30 * time.Second
+	maxNameLen   = 32
+)
+
+// RelayConfig configures a Relay.
+type RelayConfig struct {
+	// Token, when set, must be presented by registering mirrors.
+	Token string
+	// User and Password, when both set, protect the portal and every
+	// forwarded request with Basic Auth. Mirrors behind such a relay should
+	// use the same credentials, since the header is passed through to them.
+	User     string
+	Password string
+	// Portal serves a page listing the registered mirrors on the relay's
+	// own host name.
+	Portal bool
+}
+
+// Relay is the public side of the tunnel. Mirrors register on /_tunnel and
+// get a subdomain of the host they registered through; requests for that
+// subdomain are forwarded to them. TLS, if wanted, is terminated in front of
+// the relay.
+type Relay struct {
+	cfg      RelayConfig
+	upgrader websocket.Upgrader
+
+	mu sync.Mutex
+	// tunnels is keyed by public host name, without the port.
+	tunnels map[string]*relayTunnel
+}
+
+type relayTunnel struct {
+	mux *mux
+
+	name     string
+	url      string
+	remoteIP string
+	joinedAt time.Time
+
+	mu     sync.Mutex
+	nextID uint32
+}
+
+// NewRelay returns a relay. Without a token any mirror may register.
+func NewRelay(cfg RelayConfig) *Relay {
+	return &Relay{
+		cfg: cfg,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{Subprotocol},
+			CheckOrigin:  func(*http.Request) bool { return true },
+		},
+		tunnels: make(map[string]*relayTunnel),
+	}
+}
+
+func (r *Relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == registerPath {
+		r.handleRegister(w, req)
+		return
+	}
+
+	if !r.authorized(req) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="alices mirror"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	t := r.tunnels[strings.ToLower(hostOnly(req.Host))]
+	r.mu.Unlock()
+	if t == nil {
+		if r.cfg.Portal {
+			r.servePortal(w, req)
+			return
+		}
+		http.Error(w, "no mirror is registered for this address", http.StatusBadGateway)
+		return
+	}
+	r.forward(w, req, t)
+}
+
+func (r *Relay) authorized(req *http.Request) bool {
+	if r.cfg.User == "" || r.cfg.Password == "" {
+		return true
+	}
+	user, pass, ok := req.BasicAuth()
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(r.cfg.User)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(r.cfg.Password)) == 1
+	return ok && userOK && passOK
+}
+
+func (r *Relay) handleRegister(w http.ResponseWriter, req *http.Request) {
+	if r.cfg.Token != "" {
+		given := req.URL.Query().Get("token")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(r.cfg.Token)) != 1 {
+			http.Error(w, "invalid relay token", http.StatusUnauthorized)
+			return
+		}
+	}
+	conn, err := r.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+
+	scheme := "http"
+	if req.TLS != nil || strings.EqualFold(req.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+
+	// Hold the write lock until the registration is sent so that no stream
+	// can be opened ahead of it.
+	t := &relayTunnel{
+		mux:      newMux(conn),
+		remoteIP: hostOnly(clientAddr(req)),
+		joinedAt: time.Now(),
+	}
+	t.mux.writeMu.Lock()
+	base := strings.ToLower(hostOnly(req.Host))
+	name := r.claim(sanitizeName(req.URL.Query().Get("name")), base, t, func(name string) string {
+		return scheme + "://" + name + "." + req.Host
+	})
+	defer r.release(name+"."+base, t)
+
+	registered := registeredMessage{
+		Type: "registered",
+		Name: name,
+		URL:  t.url,
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+	err = conn.WriteJSON(registered)
+	_ = conn.SetWriteDeadline(time.Time{})
+	t.mux.writeMu.Unlock()
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+					_ = conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	// Mirrors never open streams, so open frames from them are ignored.
+	_ = t.mux.run(nil)
+}
+
+// claim registers t as name.base, or under a random name if name is empty
+// or already taken, and returns the name used. urlFor builds the public URL
+// for the chosen name.
+func (r *Relay) claim(name, base string, t *relayTunnel, urlFor func(name string) string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name == "" || r.tunnels[name+"."+base] != nil {
+		name = randomName()
+	}
+	t.name = name
+	t.url = urlFor(name)
+	r.tunnels[name+"."+base] = t
+	return name
+}
+
+func (r *Relay) release(host string, t *relayTunnel) {
+	r.mu.Lock()
+	if r.tunnels[host] == t {
+		delete(r.tunnels, host)
+	}
+	r.mu.Unlock()
+}
+
+// forward takes over the public connection and replays req into a new
+// stream, so WebSocket upgrades and keep-alive requests pass through as-is.
+func (r *Relay) forward(w http.ResponseWriter, req *http.Request, t *relayTunnel) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be forwarded", http.StatusInternalServerError)
+		return
+	}
+	public, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	_ = public.SetDeadline(time.Time{})
+
+	t.mu.Lock()
+	t.nextID++
+	id := t.nextID
+	t.mu.Unlock()
+
+	local, remote := net.Pipe()
+	if !t.mux.attach(id, remote) {
+		_ = public.Close()
+		_ = local.Close()
+		return
+	}
+	if err := t.mux.writeFrame(frameOpen, id, []byte(clientAddr(req))); err != nil {
+		_ = public.Close()
+		_ = local.Close()
+		return
+	}
+
+	if err := writeRequestHead(local, req); err != nil || flushBuffered(buffered.Reader, local) != nil {
+		_ = public.Close()
+		_ = local.Close()
+		return
+	}
+	pipe(public, local)
+}
+
+// writeRequestHead re-serializes the request line and headers. The body is
+// still unread in the hijacked connection and is copied through raw.
+func writeRequestHead(w io.Writer, req *http.Request) error {
+	header := req.Header.Clone()
+	if len(req.TransferEncoding) > 0 {
+		header.Set("Transfer-Encoding", strings.Join(req.TransferEncoding, ", "))
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.RequestURI, req.Host)
+	if err := header.Write(bw); err != nil {
+		return err
+	}
+	bw.WriteString("\r\n")
+	return bw.Flush()
+}
+
+func flushBuffered(reader *bufio.Reader, conn net.Conn) error {
+	if n := reader.Buffered(); n > 0 {
+		data, _ := reader.Peek(n)
+		if _, err := conn.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientAddr is the address the mirror should see the request as coming
+// from. X-Forwarded-For is only trusted from a proxy on the same host.
+func clientAddr(req *http.Request) string {
+	host, port, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := net.ParseIP(strings.TrimSpace(first)); ip != nil {
+				return net.JoinHostPort(ip.String(), port)
+			}
+		}
+	}
+	return req.RemoteAddr
+}
+
+func sanitizeName(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(raw) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-' || r == '_' || r == '.' || r == ' ':
+			if b.Len() > 0 {
+				b.WriteByte('-')
+			}
+		}
+		if b.Len() >= maxNameLen {
+			break
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+func randomName() string {
+	buf := make([]byte, 4)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func hostOnly(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
@@ -0,0 +1,73 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelayForwardsRequests(t *testing.T) {
+	t.Parallel()
+
+	relay := httptest.NewServer(NewRelay(RelayConfig{Token: "secret"}))
+	defer relay.Close()
+
+	client, err := NewClient(relay.URL+"?token=secret", "My Mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = io.WriteString(w, r.Method+" "+r.URL.Path+" "+string(body)+" from "+r.RemoteAddr)
+	})}
+	go func() { _ = mirror.Serve(client.Listener()) }()
+	defer mirror.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	urls := make(chan string, 1)
+	go func() { _ = client.Run(ctx, func(u string) { urls <- u }) }()
+
+	var public string
+	select {
+	case public = <-urls:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tunnel was not registered")
+	}
+	relayURL, _ := url.Parse(relay.URL)
+	if want := "http://my-mirror." + relayURL.Host; public != want {
+		t.Fatalf("public URL = %q, want %q", public, want)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, relay.URL+"/upload", strings.NewReader("hello"))
+	req.Host = strings.TrimPrefix(public, "http://")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if got := string(body); !strings.HasPrefix(got, "POST /upload hello from 127.0.0.1:") {
+		t.Fatalf("forwarded response = %q", got)
+	}
+}
+
+func TestRelayRejectsBadToken(t *testing.T) {
+	t.Parallel()
+
+	relay := httptest.NewServer(NewRelay(RelayConfig{Token: "secret"}))
+	defer relay.Close()
+
+	client, err := NewClient(relay.URL+"?token=wrong", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Run(context.Background(), nil); err == nil {
+		t.Fatal("Run succeeded with a bad token")
+	}
+}
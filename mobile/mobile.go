@@ -2,15 +2,19 @@ package mobile
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"alices-mirror/internal/app"
 	"alices-mirror/internal/discovery"
@@ -21,12 +25,16 @@ import (
 const ownerTokenEnv = "ALICES_MIRROR_OWNER_TOKEN"
 const defaultBindList = "127.0.0.1,192.168.1.*"
 const defaultAllowIPList = "127.0.0.1,192.168.1.*"
+const lowPowerIntervalFactor = 5
 
-// Listener receives status and log updates from the server.
+// Listener receives status and log updates from the server. OnBell is
+// called when the shell rings the bell, at most once a second, so the app
+// can notify the user that a command finished or wants input.
 type Listener interface {
 	OnLog(line string)
 	OnStatus(message string)
 	OnError(message string)
+	OnBell()
 }
 
 // Server exposes Alice's Mirror for mobile bindings.
@@ -38,6 +46,25 @@ type Server struct {
 	server    *server.Server
 	discovery *discovery.Service
 	cancel    context.CancelFunc
+	connInfo  *connectionInfo
+
+	discoveryInterval time.Duration
+	lowPower          bool
+	clientCount       int
+	embedCredentials  bool
+
+	readBufferSize   int
+	outputQueueDepth int
+}
+
+type connectionInfo struct {
+	Type      string   `json:"type"`
+	Version   string   `json:"version"`
+	Alias     string   `json:"alias,omitempty"`
+	URL       string   `json:"url"`
+	Endpoints []string `json:"endpoints"`
+	Port      int      `json:"port"`
+	AuthMode  string   `json:"auth_mode"`
 }
 
 // NewServer creates a new server wrapper.
@@ -103,6 +130,8 @@ func (s *Server) StartWithUserLevelAndAllowIPs(
 		s.mu.Unlock()
 		return errors.New("server is already running")
 	}
+	readBufferSize := s.readBufferSize
+	outputQueueDepth := s.outputQueueDepth
 	s.mu.Unlock()
 
 	resolvedWorkDir := strings.TrimSpace(workDir)
@@ -144,6 +173,9 @@ func (s *Server) StartWithUserLevelAndAllowIPs(
 		WorkDir:   resolvedWorkDir,
 		Shell:     shell,
 		Visible:   visible,
+
+		ReadBufferSize:   readBufferSize,
+		OutputQueueDepth: outputQueueDepth,
 	}
 
 	if err := app.Validate(cfg); err != nil {
@@ -166,10 +198,12 @@ func (s *Server) StartWithUserLevelAndAllowIPs(
 	}
 
 	session, err := terminal.NewSession(terminal.Config{
-		WorkDir:         cfg.WorkDir,
-		BufferSize:      256 * 1024,
-		Shell:           cfg.Shell,
-		ExitOnShellExit: ownerToken != "",
+		WorkDir:          cfg.WorkDir,
+		BufferSize:       256 * 1024,
+		Shell:            cfg.Shell,
+		ExitOnShellExit:  ownerToken != "",
+		ReadBufferSize:   cfg.ReadBufferSize,
+		OutputQueueDepth: cfg.OutputQueueDepth,
 	})
 	if err != nil {
 		return err
@@ -189,6 +223,27 @@ func (s *Server) StartWithUserLevelAndAllowIPs(
 		Alias:      trimmedAlias,
 		OwnerToken: ownerToken,
 		UserLevels: userLevels,
+		Version:    readVersion(),
+		OnClientsChanged: func(count int) {
+			s.mu.Lock()
+			s.clientCount = count
+			s.mu.Unlock()
+			s.applyDiscoveryPolicy()
+		},
+		OnBell: s.emitBell,
+		OnAliasChanged: func(alias string) {
+			s.mu.Lock()
+			svc := s.discovery
+			if s.connInfo != nil {
+				updated := *s.connInfo
+				updated.Alias = alias
+				s.connInfo = &updated
+			}
+			s.mu.Unlock()
+			if svc != nil {
+				_ = svc.SetAlias(alias)
+			}
+		},
 	})
 	if err != nil {
 		session.Close()
@@ -202,6 +257,7 @@ func (s *Server) StartWithUserLevelAndAllowIPs(
 	s.session = session
 	s.server = srv
 	s.cancel = cancel
+	s.connInfo = buildConnectionInfo(trimmedAlias, resolvedBinds, cfg.Port, auth, s.embedCredentials)
 	s.mu.Unlock()
 
 	go s.forwardStatus(session)
@@ -227,6 +283,7 @@ func (s *Server) StartWithUserLevelAndAllowIPs(
 		s.mu.Lock()
 		s.discovery = svc
 		s.mu.Unlock()
+		s.applyDiscoveryPolicy()
 	}
 
 	for _, line := range app.StartupLines(app.StartupInfo{
@@ -263,6 +320,138 @@ func (s *Server) Stop() error {
 	return nil
 }
 
+// ConnectionInfoJSON returns the connection details of the running server as
+// JSON, meant to be rendered as a QR code. The url field is the preferred
+// endpoint; it carries the Basic Auth credentials only after
+// SetEmbedCredentials(true).
+func (s *Server) ConnectionInfoJSON() (string, error) {
+	s.mu.Lock()
+	info := s.connInfo
+	s.mu.Unlock()
+	if info == nil {
+		return "", errors.New("server is not running")
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// RecentEventsJSON returns the server's recent events with an ID above
+// since (connections, resets, uploads, status changes and errors) as a JSON
+// array, oldest first.
+func (s *Server) RecentEventsJSON(since int64) (string, error) {
+	s.mu.Lock()
+	srv := s.server
+	s.mu.Unlock()
+	if srv == nil {
+		return "", errors.New("server is not running")
+	}
+	data, err := json.Marshal(srv.RecentEvents(since))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SetAcceptingClients pauses or resumes accepting new viewers. Clients that
+// are already connected stay connected.
+func (s *Server) SetAcceptingClients(accepting bool) error {
+	s.mu.Lock()
+	srv := s.server
+	s.mu.Unlock()
+	if srv == nil {
+		return errors.New("server is not running")
+	}
+	srv.SetAcceptingClients(accepting)
+	return nil
+}
+
+// SetAlias changes the advertised alias and retitles connected clients.
+func (s *Server) SetAlias(alias string) error {
+	s.mu.Lock()
+	srv := s.server
+	s.mu.Unlock()
+	if srv == nil {
+		return errors.New("server is not running")
+	}
+	return srv.SetAlias(alias)
+}
+
+// ChangeWorkDir restarts the shared shell in path without stopping the server.
+func (s *Server) ChangeWorkDir(path string) error {
+	s.mu.Lock()
+	session := s.session
+	s.mu.Unlock()
+	if session == nil {
+		return errors.New("server is not running")
+	}
+	return session.ChangeWorkDir(path)
+}
+
+// SetDiscoveryInterval sets the UDP discovery broadcast interval in seconds.
+// Values <= 0 restore the default. It applies immediately when running.
+func (s *Server) SetDiscoveryInterval(seconds int) {
+	s.mu.Lock()
+	if seconds <= 0 {
+		s.discoveryInterval = 0
+	} else {
+		s.discoveryInterval = time.Duration(seconds) * time.Second
+	}
+	s.mu.Unlock()
+	s.applyDiscoveryPolicy()
+}
+
+// SetPTYBuffers sets the PTY read size in bytes and the output queue depth in
+// chunks. Values <= 0 restore the defaults. It applies on the next Start.
+func (s *Server) SetPTYBuffers(readBufferSize, outputQueueDepth int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readBufferSize = max(readBufferSize, 0)
+	s.outputQueueDepth = max(outputQueueDepth, 0)
+}
+
+// SetEmbedCredentials sets whether the connection URL carries the Basic Auth
+// user and password, so that scanning the QR code is enough to sign in.
+// Anyone who sees the code then has the password. It is off by default and
+// applies on the next Start.
+func (s *Server) SetEmbedCredentials(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embedCredentials = enabled
+}
+
+// SetLowPowerDiscovery enables a battery-friendly discovery mode that
+// broadcasts less often and pauses entirely while no clients are connected.
+func (s *Server) SetLowPowerDiscovery(enabled bool) {
+	s.mu.Lock()
+	s.lowPower = enabled
+	s.mu.Unlock()
+	s.applyDiscoveryPolicy()
+}
+
+func (s *Server) applyDiscoveryPolicy() {
+	s.mu.Lock()
+	svc := s.discovery
+	interval := s.discoveryInterval
+	lowPower := s.lowPower
+	clientCount := s.clientCount
+	s.mu.Unlock()
+
+	if svc == nil {
+		return
+	}
+	if interval <= 0 {
+		interval = discovery.DefaultInterval
+	}
+	if lowPower {
+		interval *= lowPowerIntervalFactor
+	}
+	svc.SetInterval(interval)
+	svc.SetPaused(lowPower && clientCount == 0)
+}
+
 func (s *Server) forwardStatus(session *terminal.Session) {
 	for message := range session.Status() {
 		s.emitStatus(message)
@@ -290,6 +479,13 @@ func (s *Server) emitError(message string) {
 	s.listener.OnError(message)
 }
 
+func (s *Server) emitBell() {
+	if s.listener == nil {
+		return
+	}
+	s.listener.OnBell()
+}
+
 func (s *Server) cleanup() {
 	s.mu.Lock()
 	cancel := s.cancel
@@ -299,6 +495,8 @@ func (s *Server) cleanup() {
 	s.session = nil
 	s.server = nil
 	s.discovery = nil
+	s.connInfo = nil
+	s.clientCount = 0
 	s.running = false
 	s.mu.Unlock()
 
@@ -313,6 +511,44 @@ func (s *Server) cleanup() {
 	}
 }
 
+func buildConnectionInfo(alias string, binds []string, port int, auth server.AuthConfig, embedCredentials bool) *connectionInfo {
+	hosts := filterLANHosts(buildDisplayHosts(binds))
+	if len(hosts) == 0 {
+		hosts = buildDisplayHosts(binds)
+	}
+	if len(hosts) == 0 {
+		hosts = []string{"localhost"}
+	}
+
+	endpoints := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		endpoints = append(endpoints, fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(port))))
+	}
+
+	authMode := "none"
+	best := endpoints[0]
+	if auth.Enabled {
+		authMode = "basic"
+	}
+	if auth.Enabled && embedCredentials {
+		u, err := url.Parse(best)
+		if err == nil {
+			u.User = url.UserPassword(auth.User, auth.Password)
+			best = u.String()
+		}
+	}
+
+	return &connectionInfo{
+		Type:      "alices-mirror",
+		Version:   readVersion(),
+		Alias:     alias,
+		URL:       best,
+		Endpoints: endpoints,
+		Port:      port,
+		AuthMode:  authMode,
+	}
+}
+
 func buildDisplayHosts(origins []string) []string {
 	var hosts []string
 	for _, origin := range origins {